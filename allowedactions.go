@@ -0,0 +1,122 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"slices"
+
+	"github.com/nuclio/errors"
+)
+
+type PermissionAllowedActionsRequest struct {
+	Input PermissionAllowedActionsRequestInput `json:"input,omitempty"`
+}
+
+type PermissionAllowedActionsRequestInput struct {
+	Resource   string         `json:"resource,omitempty"`
+	Ids        []string       `json:"ids,omitempty"`
+	Subject    *Subject       `json:"subject,omitempty"`
+	Ancestors  []string       `json:"ancestors,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Prefix     string         `json:"prefix,omitempty"`
+
+	// Extra fields are merged into the input
+	Extra map[string]any `json:"-"`
+}
+
+func (i PermissionAllowedActionsRequestInput) MarshalJSON() ([]byte, error) {
+	type permissionAllowedActionsRequestInput PermissionAllowedActionsRequestInput
+	return marshalInputWithExtra(permissionAllowedActionsRequestInput(i), i.Extra)
+}
+
+// PermissionAllowedActionsResponse lists the allowed actions of the resource
+type PermissionAllowedActionsResponse struct {
+	Result     []Action    `json:"result,omitempty"`
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// AllowedActions returns the actions allowed against the resource (sorted), e.g.: for a UI to tell the capabilities
+// of an object in a single round trip. The actions are evaluated in a single request to the allowed actions path
+// (see WithAllowedActionsPath), whose policy returns the allowed actions of input.resource.
+// If the override header value is accepted, the actions defined by the client (e.g.: ActionRead) are returned
+func (c *HTTPClient) AllowedActions(ctx context.Context,
+	resource string,
+	permissionOptions *PermissionOptions) ([]Action, error) {
+	if c.permissionAllowedActionsPath == "" {
+		return nil, errors.New("Allowed actions path is not configured")
+	}
+
+	if err := validateResources([]string{resource}); err != nil {
+		return nil, err
+	}
+	resource, err := c.scopeResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	ctx, permissionOptions, err = c.resolvePermissionOptions(ctx, permissionOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the override header value matches any accepted override header value, allow without checking
+	if overrideIssuer, overridden := c.overridden(permissionOptions); overridden {
+		allowedActions := standardActions()
+		decisions := make([]*Decision, len(allowedActions))
+		for actionIdx, action := range allowedActions {
+			decisions[actionIdx] = &Decision{
+				Resource:   resource,
+				Action:     action,
+				Allowed:    true,
+				Overridden: true,
+			}
+		}
+		c.auditOverride(ctx, decisions, permissionOptions, overrideIssuer)
+		return allowedActions, nil
+	}
+
+	requestInput := PermissionAllowedActionsRequestInput{
+		Resource:   resource,
+		Ids:        permissionOptions.memberIds(),
+		Subject:    permissionOptions.Subject,
+		Attributes: permissionOptions.ResourceAttributes[resource],
+		Extra:      queryExtraInput(ctx, permissionOptions),
+	}
+	if permissionOptions.HierarchyMode == HierarchyModeInput {
+		requestInput.Ancestors = resourceAncestors(resource)
+	}
+	if IsWildcardResource(resource) {
+		requestInput.Prefix = resourcePrefix(resource)
+	}
+
+	permissionAllowedActionsResponse := PermissionAllowedActionsResponse{}
+	if err := c.sendQuery(ctx,
+		c.permissionAllowedActionsPath,
+		&PermissionAllowedActionsRequest{Input: requestInput},
+		&permissionAllowedActionsResponse); err != nil {
+		return nil, errors.Wrapf(err, "Failed to query allowed actions of resource %s", resource)
+	}
+
+	allowedActions := slices.Clone(permissionAllowedActionsResponse.Result)
+	slices.Sort(allowedActions)
+	return slices.Compact(allowedActions), nil
+}
+
+// standardActions returns the actions defined by the client (sorted)
+func standardActions() []Action {
+	return []Action{ActionCreate, ActionDelete, ActionList, ActionRead, ActionUpdate}
+}
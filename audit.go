@@ -0,0 +1,237 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// AuditEventSchemaVersion is the version of the audit event schema. The minor version is bumped by additive
+// (backwards compatible) changes, and the major version by breaking ones
+const AuditEventSchemaVersion = "1.0"
+
+type AuditEventType string
+
+const (
+
+	// AuditEventTypeDecision is the event of a policy decision
+	AuditEventTypeDecision AuditEventType = "decision"
+
+	// AuditEventTypeOverride is the event of a request allowed by the override, without querying OPA
+	AuditEventTypeOverride AuditEventType = "override"
+)
+
+type AuditDecisionSource string
+
+const (
+	AuditDecisionSourceOPA        AuditDecisionSource = "opa"
+	AuditDecisionSourceCache      AuditDecisionSource = "cache"
+	AuditDecisionSourceStaleCache AuditDecisionSource = "stale_cache"
+	AuditDecisionSourceFallback   AuditDecisionSource = "fallback"
+	AuditDecisionSourceOverride   AuditDecisionSource = "override"
+)
+
+// AuditEvent is the stable, versioned form of a decision record (see AuditEventSchemaVersion), for audit pipelines
+// to validate against its JSON schema (see AuditEventJSONSchema). Unlike DecisionRecord, which follows the client
+// types, its fields only change along with the schema version
+type AuditEvent struct {
+	SchemaVersion string         `json:"schemaVersion" description:"Version of the audit event schema"`
+	EventID       string         `json:"eventId" description:"Unique identifier of the event, for deduplication"`
+	Type          AuditEventType `json:"type" enum:"decision,override" description:"Type of the event"`
+	Timestamp     time.Time      `json:"timestamp" description:"Time the decision was made at"`
+	Resource      string         `json:"resource" description:"Resource the action was authorized against"`
+	Action        string         `json:"action" description:"Action authorized against the resource"`
+	Subject       AuditSubject   `json:"subject" description:"Subject the action was authorized for"`
+	Decision      AuditDecision  `json:"decision" description:"Outcome of the authorization"`
+	Policy        *AuditPolicy   `json:"policy,omitempty" description:"Policy the decision was made by"`
+	Override      *AuditOverride `json:"override,omitempty" description:"Override the request was allowed by"`
+}
+
+type AuditSubject struct {
+	MemberIds []string `json:"memberIds,omitempty" description:"Member ids the subject was queried with"`
+	UserID    string   `json:"userId,omitempty" description:"User id of the subject"`
+	GroupIDs  []string `json:"groupIds,omitempty" description:"Group ids of the subject"`
+	Roles     []string `json:"roles,omitempty" description:"Roles of the subject"`
+	Tenant    string   `json:"tenant,omitempty" description:"Tenant of the subject"`
+}
+
+type AuditDecision struct {
+	Allowed     bool                `json:"allowed" description:"Whether the action was allowed"`
+	Source      AuditDecisionSource `json:"source" enum:"opa,cache,stale_cache,fallback,override" description:"Source the decision was served from"`
+	Enforced    bool                `json:"enforced" description:"Whether the decision was enforced (false in monitor enforcement mode)"`
+	Reason      string              `json:"reason,omitempty" description:"Reason of the decision, as given by the policy"`
+	Obligations []AuditObligation   `json:"obligations,omitempty" description:"Obligations attached to the decision"`
+	Error       string              `json:"error,omitempty" description:"Error querying the decision, if any"`
+}
+
+type AuditObligation struct {
+	Type       string         `json:"type" description:"Type of the obligation (e.g.: mask, row_limit)"`
+	Fields     []string       `json:"fields,omitempty" description:"Fields the obligation applies to"`
+	Limit      *int           `json:"limit,omitempty" description:"Limit the obligation sets"`
+	Parameters map[string]any `json:"parameters,omitempty" description:"Parameters of custom obligations"`
+}
+
+type AuditPolicy struct {
+	OPAVersion string            `json:"opaVersion,omitempty" description:"Version of the OPA server"`
+	Revision   string            `json:"revision,omitempty" description:"Revision of the legacy-style bundle"`
+	Bundles    map[string]string `json:"bundles,omitempty" description:"Revisions of the bundles, by bundle name"`
+}
+
+type AuditOverride struct {
+	Issuer string `json:"issuer,omitempty" description:"Issuer of the override token"`
+}
+
+// NewAuditEvent returns the audit event of the given decision record
+func NewAuditEvent(decisionRecord DecisionRecord) AuditEvent {
+	auditEvent := AuditEvent{
+		SchemaVersion: AuditEventSchemaVersion,
+		EventID:       newAuditEventID(),
+		Type:          AuditEventTypeDecision,
+		Timestamp:     decisionRecord.Timestamp,
+		Resource:      decisionRecord.Resource,
+		Action:        string(decisionRecord.Action),
+		Subject:       AuditSubject{MemberIds: decisionRecord.MemberIds},
+		Decision: AuditDecision{
+			Allowed:  decisionRecord.Allowed,
+			Source:   AuditDecisionSourceOPA,
+			Enforced: !decisionRecord.Monitored,
+			Reason:   decisionRecord.Reason,
+			Error:    decisionRecord.Error,
+		},
+	}
+
+	if subject := decisionRecord.Subject; subject != nil {
+		auditEvent.Subject.UserID = subject.UserID
+		auditEvent.Subject.GroupIDs = subject.GroupIDs
+		auditEvent.Subject.Roles = subject.Roles
+		auditEvent.Subject.Tenant = subject.Tenant
+	}
+
+	switch {
+	case decisionRecord.Overridden:
+		auditEvent.Type = AuditEventTypeOverride
+		auditEvent.Decision.Source = AuditDecisionSourceOverride
+		auditEvent.Override = &AuditOverride{Issuer: decisionRecord.OverrideIssuer}
+	case decisionRecord.Fallback:
+		auditEvent.Decision.Source = AuditDecisionSourceFallback
+	case decisionRecord.Stale:
+		auditEvent.Decision.Source = AuditDecisionSourceStaleCache
+	case decisionRecord.Cached:
+		auditEvent.Decision.Source = AuditDecisionSourceCache
+	}
+
+	for _, obligation := range decisionRecord.Obligations {
+		auditEvent.Decision.Obligations = append(auditEvent.Decision.Obligations, AuditObligation{
+			Type:       string(obligation.Type),
+			Fields:     obligation.Fields,
+			Limit:      obligation.Limit,
+			Parameters: obligation.Parameters,
+		})
+	}
+
+	if provenance := decisionRecord.Provenance; provenance != nil {
+		auditEvent.Policy = &AuditPolicy{
+			OPAVersion: provenance.Version,
+			Revision:   provenance.Revision,
+		}
+		for bundleName, bundle := range provenance.Bundles {
+			if auditEvent.Policy.Bundles == nil {
+				auditEvent.Policy.Bundles = map[string]string{}
+			}
+			auditEvent.Policy.Bundles[bundleName] = bundle.Revision
+		}
+	}
+
+	return auditEvent
+}
+
+// AuditEventJSONSchema returns the JSON schema (draft 2020-12) of the audit event, generated from its fields
+func AuditEventJSONSchema() ([]byte, error) {
+	schema := jsonSchemaOf(reflect.TypeOf(AuditEvent{}))
+	schema["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	schema["$id"] = "urn:nuclio:opa-client:audit-event:" + AuditEventSchemaVersion
+	schema["title"] = "AuditEvent"
+	schema["properties"].(map[string]any)["schemaVersion"].(map[string]any)["const"] = AuditEventSchemaVersion
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// jsonSchemaOf returns the JSON schema of values of the given type, as encoded by encoding/json. Struct fields
+// are described by their description and enum tags, and are required unless omitted when empty
+func jsonSchemaOf(valueType reflect.Type) map[string]any {
+	if valueType == reflect.TypeOf(time.Time{}) {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch valueType.Kind() {
+	case reflect.Pointer:
+		return jsonSchemaOf(valueType.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": jsonSchemaOf(valueType.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": jsonSchemaOf(valueType.Elem())}
+	case reflect.Struct:
+		properties := map[string]any{}
+		required := []string{}
+		for fieldIdx := 0; fieldIdx < valueType.NumField(); fieldIdx++ {
+			field := valueType.Field(fieldIdx)
+			name, tagOptions, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+
+			property := jsonSchemaOf(field.Type)
+			if description := field.Tag.Get("description"); description != "" {
+				property["description"] = description
+			}
+			if enum := field.Tag.Get("enum"); enum != "" {
+				property["enum"] = strings.Split(enum, ",")
+			}
+			properties[name] = property
+			if !strings.Contains(tagOptions, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]any{"type": "object", "properties": properties, "required": required}
+	default:
+
+		// any value
+		return map[string]any{}
+	}
+}
+
+func newAuditEventID() string {
+	eventID := make([]byte, 16)
+	_, _ = rand.Read(eventID)
+	return hex.EncodeToString(eventID)
+}
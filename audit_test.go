@@ -0,0 +1,158 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type AuditEventTestSuite struct {
+	suite.Suite
+}
+
+func (suite *AuditEventTestSuite) TestNewAuditEvent() {
+	rowLimit := 10
+	decisionRecord := DecisionRecord{
+		Timestamp: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Resource:  "/projects/p1",
+		Action:    ActionRead,
+		MemberIds: []string{"user1", "group1"},
+		Subject:   &Subject{UserID: "user1", GroupIDs: []string{"group1"}, Tenant: "t1"},
+		Allowed:   true,
+		Obligations: Obligations{
+			{Type: ObligationTypeRowLimit, Limit: &rowLimit},
+		},
+		Cached: true,
+		Provenance: &Provenance{
+			Version: "1.4.0",
+			Bundles: map[string]ProvenanceBundle{"authz": {Revision: "r1"}},
+		},
+		Monitored: true,
+	}
+
+	auditEvent := NewAuditEvent(decisionRecord)
+	suite.Require().Len(auditEvent.EventID, 32)
+	suite.Require().NotEqual(auditEvent.EventID, NewAuditEvent(decisionRecord).EventID)
+	auditEvent.EventID = ""
+	suite.Require().Equal(AuditEvent{
+		SchemaVersion: AuditEventSchemaVersion,
+		Type:          AuditEventTypeDecision,
+		Timestamp:     decisionRecord.Timestamp,
+		Resource:      "/projects/p1",
+		Action:        "read",
+		Subject: AuditSubject{
+			MemberIds: []string{"user1", "group1"},
+			UserID:    "user1",
+			GroupIDs:  []string{"group1"},
+			Tenant:    "t1",
+		},
+		Decision: AuditDecision{
+			Allowed:     true,
+			Source:      AuditDecisionSourceCache,
+			Enforced:    false,
+			Obligations: []AuditObligation{{Type: "row_limit", Limit: &rowLimit}},
+		},
+		Policy: &AuditPolicy{
+			OPAVersion: "1.4.0",
+			Bundles:    map[string]string{"authz": "r1"},
+		},
+	}, auditEvent)
+
+	// overrides take precedence over the other sources
+	decisionRecord.Overridden = true
+	decisionRecord.OverrideIssuer = "ci"
+	auditEvent = NewAuditEvent(decisionRecord)
+	suite.Require().Equal(AuditEventTypeOverride, auditEvent.Type)
+	suite.Require().Equal(AuditDecisionSourceOverride, auditEvent.Decision.Source)
+	suite.Require().Equal(&AuditOverride{Issuer: "ci"}, auditEvent.Override)
+}
+
+func (suite *AuditEventTestSuite) TestAuditEventJSONSchema() {
+	encodedSchema, err := AuditEventJSONSchema()
+	suite.Require().NoError(err)
+
+	schema := map[string]any{}
+	suite.Require().NoError(json.Unmarshal(encodedSchema, &schema))
+	suite.Require().Equal("https://json-schema.org/draft/2020-12/schema", schema["$schema"])
+	suite.Require().Equal([]any{
+		"schemaVersion", "eventId", "type", "timestamp", "resource", "action", "subject", "decision",
+	}, schema["required"])
+
+	properties := schema["properties"].(map[string]any)
+	suite.Require().Equal(AuditEventSchemaVersion, properties["schemaVersion"].(map[string]any)["const"])
+	suite.Require().Equal("date-time", properties["timestamp"].(map[string]any)["format"])
+	suite.Require().Equal([]any{"decision", "override"}, properties["type"].(map[string]any)["enum"])
+
+	decisionSchema := properties["decision"].(map[string]any)
+	suite.Require().Equal([]any{"allowed", "source", "enforced"}, decisionSchema["required"])
+	obligationsSchema := decisionSchema["properties"].(map[string]any)["obligations"].(map[string]any)
+	suite.Require().Equal("array", obligationsSchema["type"])
+	suite.Require().Equal("integer",
+		obligationsSchema["items"].(map[string]any)["properties"].(map[string]any)["limit"].(map[string]any)["type"])
+
+	// every field of a fully populated event is described by the schema
+	rowLimit := 10
+	auditEvent := NewAuditEvent(DecisionRecord{
+		Subject:     &Subject{UserID: "user1", GroupIDs: []string{"g1"}, Roles: []string{"r1"}, Tenant: "t1"},
+		MemberIds:   []string{"user1"},
+		Reason:      "reason",
+		Error:       "error",
+		Obligations: Obligations{{Type: ObligationTypeMask, Fields: []string{"f"}, Limit: &rowLimit}},
+		Provenance:  &Provenance{Version: "1.4.0", Revision: "r1"},
+		Overridden:  true,
+	})
+	auditEvent.Decision.Obligations[0].Parameters = map[string]any{"key": "value"}
+	auditEvent.Policy.Bundles = map[string]string{"authz": "r1"}
+	encodedEvent, err := json.Marshal(auditEvent)
+	suite.Require().NoError(err)
+	event := map[string]any{}
+	suite.Require().NoError(json.Unmarshal(encodedEvent, &event))
+	suite.requireDescribed(schema, event)
+}
+
+func (suite *AuditEventTestSuite) requireDescribed(schema map[string]any, value any) {
+	switch typedValue := value.(type) {
+	case map[string]any:
+		if properties, found := schema["properties"].(map[string]any); found {
+			for key, fieldValue := range typedValue {
+				suite.Require().Contains(properties, key)
+				suite.Require().NotEmpty(properties[key].(map[string]any)["description"], key)
+				suite.requireDescribed(properties[key].(map[string]any), fieldValue)
+			}
+			for _, requiredKey := range schema["required"].([]any) {
+				suite.Require().Contains(typedValue, requiredKey)
+			}
+		}
+	case []any:
+		for _, item := range typedValue {
+			suite.requireDescribed(schema["items"].(map[string]any), item)
+		}
+	default:
+		suite.Require().True(slices.Contains([]any{"string", "boolean", "integer", nil}, schema["type"]))
+	}
+}
+
+func TestAuditEventTestSuite(t *testing.T) {
+	suite.Run(t, new(AuditEventTestSuite))
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package authzproxy enforces permissions in front of an HTTP handler - typically an httputil.ReverseProxy - by
+// authorizing every request with the client before forwarding it, for thin authorization gateways.
+package authzproxy
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	opaclient "github.com/nuclio/opa-client"
+)
+
+// RequestMapper returns the resource and action the request is authorized against
+type RequestMapper func(request *http.Request) (string, opaclient.Action, error)
+
+// PermissionOptionsFunc returns the permission options the request is authorized with
+type PermissionOptionsFunc func(request *http.Request) (*opaclient.PermissionOptions, error)
+
+// ErrorHandler responds to requests which were not forwarded, by the given status code: 403 for denied requests
+// (the error being a *opaclient.ForbiddenError), 400 for requests which cannot be mapped, and 503 when the
+// permission could not be queried
+type ErrorHandler func(responseWriter http.ResponseWriter, request *http.Request, statusCode int, err error)
+
+type Config struct {
+
+	// Client to query permissions with
+	Client opaclient.Client
+
+	// Next handles the authorized requests (e.g.: an *httputil.ReverseProxy)
+	Next http.Handler
+
+	// RequestMapper maps requests to resources and actions (DefaultRequestMapper, unless set)
+	RequestMapper RequestMapper
+
+	// PermissionOptions returns the permission options of requests, whose member ids must come from a trusted
+	// source (e.g.: a verified token) rather than a header any caller may set
+	PermissionOptions PermissionOptionsFunc
+
+	// ErrorHandler responds to the requests which were not forwarded (DefaultErrorHandler, unless set)
+	ErrorHandler ErrorHandler
+}
+
+// Handler authorizes requests before passing them to the next handler
+type Handler struct {
+	logger logger.Logger
+	config Config
+}
+
+func NewHandler(parentLogger logger.Logger, config Config) (*Handler, error) {
+	if config.Client == nil {
+		return nil, errors.New("Client must be set")
+	}
+	if config.Next == nil {
+		return nil, errors.New("Next handler must be set")
+	}
+	if config.PermissionOptions == nil {
+		return nil, errors.New("Permission options must be set")
+	}
+	if config.RequestMapper == nil {
+		config.RequestMapper = DefaultRequestMapper
+	}
+	if config.ErrorHandler == nil {
+		config.ErrorHandler = DefaultErrorHandler
+	}
+	if parentLogger == nil {
+		parentLogger = opaclient.NopLogger{}
+	}
+
+	return &Handler{
+		logger: parentLogger.GetChild("opa-authz-proxy"),
+		config: config,
+	}, nil
+}
+
+// ServeHTTP forwards the request to the next handler if allowed, and responds by the error handler otherwise.
+// The decision is carried by the context of the forwarded request (see DecisionFromContext)
+func (h *Handler) ServeHTTP(responseWriter http.ResponseWriter, request *http.Request) {
+	ctx := request.Context()
+
+	resource, action, err := h.config.RequestMapper(request)
+	if err != nil {
+		h.logger.DebugWithCtx(ctx, "Failed to map request",
+			"method", request.Method,
+			"path", request.URL.Path,
+			"err", err.Error())
+		h.config.ErrorHandler(responseWriter, request, http.StatusBadRequest, err)
+		return
+	}
+
+	permissionOptions, err := h.config.PermissionOptions(request)
+	if err != nil {
+		h.logger.DebugWithCtx(ctx, "Failed to resolve permission options of request",
+			"method", request.Method,
+			"path", request.URL.Path,
+			"err", err.Error())
+		h.config.ErrorHandler(responseWriter, request, http.StatusBadRequest, err)
+		return
+	}
+
+	decision, err := opaclient.QueryDecision(ctx, h.config.Client, resource, action, permissionOptions)
+	if err != nil {
+		h.logger.WarnWithCtx(ctx, "Failed to query permission of request",
+			"resource", resource,
+			"action", action,
+			"err", err.Error())
+		h.config.ErrorHandler(responseWriter,
+			request,
+			http.StatusServiceUnavailable,
+			errors.Wrapf(err, "Failed to query permission to %s resource %s", action, resource))
+		return
+	}
+
+	if !decision.Allowed {
+		h.logger.DebugWithCtx(ctx, "Denied request",
+			"resource", resource,
+			"action", action,
+			"reason", decision.Reason)
+		h.config.ErrorHandler(responseWriter, request, http.StatusForbidden, &opaclient.ForbiddenError{
+			Resource:   resource,
+			Action:     action,
+			Reason:     decision.Reason,
+			Violations: decision.Violations,
+		})
+		return
+	}
+
+	h.config.Next.ServeHTTP(responseWriter, request.WithContext(context.WithValue(ctx, decisionContextKey{}, decision)))
+}
+
+// DefaultRequestMapper authorizes the request path against the action of the request method
+// (see opaclient.ActionFromHTTPMethod). Paths with dot segments or repeated slashes are rejected, since the
+// upstream may resolve them to another resource than the one authorized
+func DefaultRequestMapper(request *http.Request) (string, opaclient.Action, error) {
+	if request.URL.Path == "" {
+		return "", "", errors.New("Request has no path")
+	}
+	if !isCleanPath(request.URL.Path) {
+		return "", "", errors.Errorf("Request path %s is not clean", request.URL.Path)
+	}
+
+	action, found := opaclient.ActionFromHTTPMethod(request.Method)
+	if !found {
+		return "", "", errors.Errorf("Request method %s maps to no action", request.Method)
+	}
+	return request.URL.Path, action, nil
+}
+
+// DefaultErrorHandler responds by the status code, with the deny reason of denied requests as the body (and the
+// status text otherwise, so internal errors are not exposed to the caller)
+func DefaultErrorHandler(responseWriter http.ResponseWriter, request *http.Request, statusCode int, err error) {
+	message := http.StatusText(statusCode)
+	if forbiddenErr, ok := err.(*opaclient.ForbiddenError); ok && forbiddenErr.Reason != "" {
+		message = forbiddenErr.Reason
+	}
+	http.Error(responseWriter, message, statusCode)
+}
+
+type decisionContextKey struct{}
+
+// DecisionFromContext returns the decision the request was forwarded by, if any
+func DecisionFromContext(ctx context.Context) *opaclient.Decision {
+	decision, _ := ctx.Value(decisionContextKey{}).(*opaclient.Decision)
+	return decision
+}
+
+// isCleanPath returns true if the path is absolute and has neither dot segments nor repeated slashes
+// (a trailing slash is allowed)
+func isCleanPath(requestPath string) bool {
+	if !strings.HasPrefix(requestPath, "/") {
+		return false
+	}
+	cleanedPath := path.Clean(requestPath)
+	return requestPath == cleanedPath || (cleanedPath != "/" && requestPath == cleanedPath+"/")
+}
@@ -0,0 +1,199 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authzproxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/nuclio/errors"
+	opaclient "github.com/nuclio/opa-client"
+	nucliozap "github.com/nuclio/zap"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+const testMemberIdsHeader = "x-member-ids"
+
+type HandlerTestSuite struct {
+	suite.Suite
+	client           *opaclient.MockClient
+	upstream         *httptest.Server
+	upstreamRequests []string
+	gateway          *httptest.Server
+}
+
+func (suite *HandlerTestSuite) SetupTest() {
+	loggerInstance, err := nucliozap.NewNuclioZapTest("authz-proxy-test")
+	suite.Require().NoError(err)
+
+	suite.client = &opaclient.MockClient{}
+	suite.upstreamRequests = nil
+	suite.upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.upstreamRequests = append(suite.upstreamRequests, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	upstreamURL, err := url.Parse(suite.upstream.URL)
+	suite.Require().NoError(err)
+
+	handler, err := NewHandler(loggerInstance, Config{
+		Client:            suite.client,
+		Next:              httputil.NewSingleHostReverseProxy(upstreamURL),
+		PermissionOptions: permissionOptionsFromHeader,
+	})
+	suite.Require().NoError(err)
+	suite.gateway = httptest.NewServer(handler)
+}
+
+func (suite *HandlerTestSuite) TearDownTest() {
+	suite.gateway.Close()
+	suite.upstream.Close()
+}
+
+func (suite *HandlerTestSuite) TestForwardAllowed() {
+	suite.client.
+		On("QueryDecision",
+			mock.Anything,
+			"/projects/p1/functions/f1",
+			opaclient.ActionUpdate,
+			mock.MatchedBy(func(permissionOptions *opaclient.PermissionOptions) bool {
+				return strings.Join(permissionOptions.MemberIds, ",") == "user1,group1"
+			})).
+		Return(&opaclient.Decision{Allowed: true}, nil).
+		Once()
+
+	statusCode, _ := suite.sendRequest(http.MethodPut, "/projects/p1/functions/f1?force=true", "user1, group1")
+	suite.Require().Equal(http.StatusNoContent, statusCode)
+	suite.Require().Equal([]string{"PUT /projects/p1/functions/f1"}, suite.upstreamRequests)
+	suite.client.AssertExpectations(suite.T())
+}
+
+func (suite *HandlerTestSuite) TestRejectDenied() {
+	suite.client.
+		On("QueryDecision", mock.Anything, "/projects/p1", opaclient.ActionDelete, mock.Anything).
+		Return(&opaclient.Decision{Allowed: false, Reason: "project is locked"}, nil).
+		Once()
+
+	statusCode, body := suite.sendRequest(http.MethodDelete, "/projects/p1", "user1")
+	suite.Require().Equal(http.StatusForbidden, statusCode)
+	suite.Require().Equal("project is locked\n", body)
+	suite.Require().Empty(suite.upstreamRequests)
+}
+
+func (suite *HandlerTestSuite) TestRejectUnmapped() {
+	statusCode, body := suite.sendRequest(http.MethodOptions, "/projects/p1", "user1")
+	suite.Require().Equal(http.StatusBadRequest, statusCode)
+	suite.Require().Equal("Bad Request\n", body)
+	suite.Require().Empty(suite.upstreamRequests)
+	suite.client.AssertNotCalled(suite.T(), "QueryDecision")
+}
+
+func (suite *HandlerTestSuite) TestRejectUncleanPath() {
+	for _, testCase := range []struct {
+		name string
+		path string
+	}{
+		{name: "dotDot", path: "/projects/p1/../p2"},
+		{name: "dot", path: "/projects/./p1"},
+		{name: "repeatedSlashes", path: "/projects//p1"},
+		{name: "escapedDotDot", path: "/projects/p1/%2e%2e/p2"},
+	} {
+		suite.Run(testCase.name, func() {
+			statusCode, body := suite.sendRequest(http.MethodGet, testCase.path, "user1")
+			suite.Require().Equal(http.StatusBadRequest, statusCode)
+			suite.Require().Equal("Bad Request\n", body)
+			suite.Require().Empty(suite.upstreamRequests)
+		})
+	}
+	suite.client.AssertNotCalled(suite.T(), "QueryDecision")
+}
+
+func (suite *HandlerTestSuite) TestRequirePermissionOptions() {
+	_, err := NewHandler(nil, Config{
+		Client: suite.client,
+		Next:   http.NotFoundHandler(),
+	})
+	suite.Require().Error(err)
+}
+
+func (suite *HandlerTestSuite) TestRejectQueryFailure() {
+	suite.client.
+		On("QueryDecision", mock.Anything, "/projects/p1", opaclient.ActionRead, mock.Anything).
+		Return((*opaclient.Decision)(nil), errors.New("OPA is unavailable")).
+		Once()
+
+	statusCode, _ := suite.sendRequest(http.MethodGet, "/projects/p1", "user1")
+	suite.Require().Equal(http.StatusServiceUnavailable, statusCode)
+	suite.Require().Empty(suite.upstreamRequests)
+}
+
+func (suite *HandlerTestSuite) TestDecisionFromContext() {
+	suite.Require().Nil(DecisionFromContext(context.Background()))
+
+	decision := &opaclient.Decision{Allowed: true, Reason: "owner"}
+	suite.client.
+		On("QueryDecision", mock.Anything, "/projects/p1", opaclient.ActionRead, mock.Anything).
+		Return(decision, nil).
+		Once()
+
+	var forwardedDecision *opaclient.Decision
+	handler, err := NewHandler(nil, Config{
+		Client: suite.client,
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwardedDecision = DecisionFromContext(r.Context())
+		}),
+		PermissionOptions: permissionOptionsFromHeader,
+	})
+	suite.Require().NoError(err)
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/projects/p1", nil))
+	suite.Require().Equal(decision, forwardedDecision)
+}
+
+func (suite *HandlerTestSuite) sendRequest(method string, path string, memberIds string) (int, string) {
+	request, err := http.NewRequest(method, suite.gateway.URL+path, nil)
+	suite.Require().NoError(err)
+	request.Header.Set(testMemberIdsHeader, memberIds)
+
+	response, err := http.DefaultClient.Do(request)
+	suite.Require().NoError(err)
+	defer response.Body.Close() // nolint: errcheck
+
+	body, err := io.ReadAll(response.Body)
+	suite.Require().NoError(err)
+	return response.StatusCode, string(body)
+}
+
+// permissionOptionsFromHeader reads the member ids from the test header, standing for a trusted identity source
+func permissionOptionsFromHeader(request *http.Request) (*opaclient.PermissionOptions, error) {
+	return &opaclient.PermissionOptions{
+		MemberIds: opaclient.MemberIDsFromHeader(request.Header, testMemberIdsHeader),
+	}, nil
+}
+
+func TestHandlerTestSuite(t *testing.T) {
+	suite.Run(t, new(HandlerTestSuite))
+}
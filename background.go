@@ -0,0 +1,113 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+)
+
+// backgroundTasks tracks the tasks a client runs in the background (e.g.: cache refreshes, shadow queries),
+// so they can be drained once the client is closed
+type backgroundTasks struct {
+	lock      sync.Mutex
+	closed    bool
+	waitGroup sync.WaitGroup
+	ctx       context.Context
+	cancel    context.CancelFunc
+	stopChan  chan struct{}
+}
+
+func newBackgroundTasks() *backgroundTasks {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundTasks{
+		ctx:      ctx,
+		cancel:   cancel,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// run runs the task in a background goroutine, outliving the request it was triggered by (keeping its values).
+// Returns false if the tasks are closed, and the task was not run
+func (b *backgroundTasks) run(ctx context.Context, task func(ctx context.Context)) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return false
+	}
+
+	b.waitGroup.Add(1)
+	go func() {
+		defer b.waitGroup.Done()
+
+		// canceled once the tasks are closed and draining them timed out
+		taskCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		defer cancel()
+		stop := context.AfterFunc(b.ctx, cancel)
+		defer stop()
+
+		task(taskCtx)
+	}()
+	return true
+}
+
+// runPeriodically runs the task in the background right away, and then every interval (as told by the clock),
+// until the tasks are closed. Returns false if the tasks are closed, and the task was not run
+func (b *backgroundTasks) runPeriodically(clock Clock, interval time.Duration, task func(ctx context.Context)) bool {
+	return b.run(context.Background(), func(ctx context.Context) {
+		for {
+			task(ctx)
+
+			select {
+			case <-b.stopChan:
+				return
+			case <-clock.After(interval):
+			}
+		}
+	})
+}
+
+// close stops running new tasks, and waits for the running ones to complete.
+// Once the context is done, the running tasks are canceled
+func (b *backgroundTasks) close(ctx context.Context) error {
+	b.lock.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.stopChan)
+	}
+	b.lock.Unlock()
+
+	doneChan := make(chan struct{})
+	go func() {
+		b.waitGroup.Wait()
+		close(doneChan)
+	}()
+
+	select {
+	case <-doneChan:
+		b.cancel()
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		<-doneChan
+		return errors.Wrap(ctx.Err(), "Failed to complete background tasks")
+	}
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package benchmarks drives load of single and batch permission queries against OPA through a client, and reports
+// their latency percentiles, for capacity planning of OPA servers (e.g.: sidecars).
+//
+// Queries are sent at the configured rate regardless of how fast they complete (open loop), so a saturated server
+// shows as growing latencies rather than a lower rate. Queries due while the concurrency limit is reached are
+// skipped, and counted as such
+package benchmarks
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nuclio/errors"
+	opaclient "github.com/nuclio/opa-client"
+)
+
+const (
+	DefaultConcurrency = 64
+	DefaultBatchSize   = 10
+)
+
+type QueryKind string
+
+const (
+	QueryKindSingle QueryKind = "single"
+	QueryKindBatch  QueryKind = "batch"
+)
+
+// Config configures the generated load
+type Config struct {
+
+	// QPS is the rate of queries to send. Zero sends them as fast as the concurrency allows (closed loop)
+	QPS float64
+
+	// Duration of sending queries
+	Duration time.Duration
+
+	// Concurrency is the maximum number of in-flight queries
+	Concurrency int
+
+	// BatchPercentage is the percentage (0-100) of queries sent as batches (multi-resource queries)
+	BatchPercentage float64
+
+	// BatchSize is the number of resources of a batch query
+	BatchSize int
+
+	// Resources are cycled through by the queries
+	Resources         []string
+	Action            opaclient.Action
+	PermissionOptions *opaclient.PermissionOptions
+}
+
+// LatencyStats summarizes the latencies of the completed queries of a kind
+type LatencyStats struct {
+	Queries  int64         `json:"queries"`
+	Failures int64         `json:"failures"`
+	Min      time.Duration `json:"min"`
+	Mean     time.Duration `json:"mean"`
+	P50      time.Duration `json:"p50"`
+	P90      time.Duration `json:"p90"`
+	P99      time.Duration `json:"p99"`
+	Max      time.Duration `json:"max"`
+}
+
+// Report is the outcome of a run
+type Report struct {
+	Duration time.Duration `json:"duration"`
+
+	// QPS is the achieved rate of completed queries
+	QPS float64 `json:"qps"`
+
+	// Skipped counts the queries not sent, since the concurrency limit was reached
+	Skipped int64 `json:"skipped"`
+
+	Latencies map[QueryKind]*LatencyStats `json:"latencies"`
+}
+
+// Run sends queries by the configuration through the client, until the duration elapses or the context is done,
+// and waits for the in-flight queries to complete
+func Run(ctx context.Context, client opaclient.Client, config Config) (*Report, error) {
+	if len(config.Resources) == 0 {
+		return nil, errors.New("At least one resource must be given")
+	}
+	if config.Duration <= 0 {
+		return nil, errors.New("Duration must be positive")
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = DefaultConcurrency
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.Action == "" {
+		config.Action = opaclient.ActionRead
+	}
+	if config.PermissionOptions == nil {
+		config.PermissionOptions = &opaclient.PermissionOptions{}
+	}
+
+	runCtx, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+
+	runner := &runner{
+		client:    client,
+		config:    config,
+		latencies: map[QueryKind][]time.Duration{},
+		failures:  map[QueryKind]int64{},
+	}
+	startTime := time.Now()
+	if config.QPS > 0 {
+		runner.runOpenLoop(runCtx)
+	} else {
+		runner.runClosedLoop(runCtx)
+	}
+	runner.waitGroup.Wait()
+
+	return runner.report(time.Since(startTime)), nil
+}
+
+type runner struct {
+	client        opaclient.Client
+	config        Config
+	waitGroup     sync.WaitGroup
+	nextResource  atomic.Uint64
+	skipped       atomic.Int64
+	latenciesLock sync.Mutex
+	latencies     map[QueryKind][]time.Duration
+	failures      map[QueryKind]int64
+}
+
+// runOpenLoop starts a query every 1/QPS, unless the concurrency limit is reached
+func (r *runner) runOpenLoop(ctx context.Context) {
+	slots := make(chan struct{}, r.config.Concurrency)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / r.config.QPS))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			r.skipped.Add(1)
+			continue
+		}
+
+		r.waitGroup.Add(1)
+		go func() {
+			defer r.waitGroup.Done()
+			defer func() { <-slots }()
+
+			// in-flight queries complete past the duration, so their latencies are not cut short
+			r.query(context.WithoutCancel(ctx))
+		}()
+	}
+}
+
+// runClosedLoop runs as many workers as the concurrency, each sending a query once its previous one completed
+func (r *runner) runClosedLoop(ctx context.Context) {
+	for range r.config.Concurrency {
+		r.waitGroup.Add(1)
+		go func() {
+			defer r.waitGroup.Done()
+
+			for ctx.Err() == nil {
+				r.query(context.WithoutCancel(ctx))
+			}
+		}()
+	}
+}
+
+// query sends a single or a batch query (by the batch percentage), and records its latency
+func (r *runner) query(ctx context.Context) {
+	queryKind := QueryKindSingle
+	if rand.Float64()*100 < r.config.BatchPercentage {
+		queryKind = QueryKindBatch
+	}
+
+	var err error
+	queryStartTime := time.Now()
+	switch queryKind {
+	case QueryKindSingle:
+		_, err = r.client.QueryPermissions(ctx, r.resources(1)[0], r.config.Action, r.config.PermissionOptions)
+	case QueryKindBatch:
+		_, err = r.client.QueryPermissionsMultiResources(ctx,
+			r.resources(r.config.BatchSize),
+			r.config.Action,
+			r.config.PermissionOptions)
+	}
+	latency := time.Since(queryStartTime)
+
+	r.latenciesLock.Lock()
+	defer r.latenciesLock.Unlock()
+
+	if err != nil {
+		r.failures[queryKind]++
+		return
+	}
+	r.latencies[queryKind] = append(r.latencies[queryKind], latency)
+}
+
+// resources returns the next resources to query, cycling through the configured ones
+func (r *runner) resources(count int) []string {
+	resources := make([]string, count)
+	for resourceIdx := range resources {
+		nextResource := r.nextResource.Add(1) - 1
+		resources[resourceIdx] = r.config.Resources[nextResource%uint64(len(r.config.Resources))]
+	}
+	return resources
+}
+
+func (r *runner) report(duration time.Duration) *Report {
+	r.latenciesLock.Lock()
+	defer r.latenciesLock.Unlock()
+
+	report := &Report{
+		Duration:  duration,
+		Skipped:   r.skipped.Load(),
+		Latencies: map[QueryKind]*LatencyStats{},
+	}
+	var completedQueries int
+	for _, queryKind := range []QueryKind{QueryKindSingle, QueryKindBatch} {
+		latencies := r.latencies[queryKind]
+		if len(latencies) == 0 && r.failures[queryKind] == 0 {
+			continue
+		}
+		report.Latencies[queryKind] = newLatencyStats(latencies, r.failures[queryKind])
+		completedQueries += len(latencies)
+	}
+	report.QPS = float64(completedQueries) / duration.Seconds()
+	return report
+}
+
+func newLatencyStats(latencies []time.Duration, failures int64) *LatencyStats {
+	latencyStats := &LatencyStats{
+		Queries:  int64(len(latencies)) + failures,
+		Failures: failures,
+	}
+	if len(latencies) == 0 {
+		return latencyStats
+	}
+
+	slices.Sort(latencies)
+	var totalLatency time.Duration
+	for _, latency := range latencies {
+		totalLatency += latency
+	}
+	latencyStats.Min = latencies[0]
+	latencyStats.Mean = totalLatency / time.Duration(len(latencies))
+	latencyStats.P50 = percentile(latencies, 50)
+	latencyStats.P90 = percentile(latencies, 90)
+	latencyStats.P99 = percentile(latencies, 99)
+	latencyStats.Max = latencies[len(latencies)-1]
+	return latencyStats
+}
+
+// percentile returns the nearest-rank percentile of the sorted latencies
+func percentile(sortedLatencies []time.Duration, percentile float64) time.Duration {
+	rank := int(percentile/100*float64(len(sortedLatencies))+0.5) - 1
+	return sortedLatencies[min(max(rank, 0), len(sortedLatencies)-1)]
+}
+
+// String returns the report as a text table
+func (r *Report) String() string {
+	text := fmt.Sprintf("Duration: %s, achieved QPS: %.1f, skipped: %d\n\n",
+		r.Duration.Round(time.Millisecond),
+		r.QPS,
+		r.Skipped)
+	text += fmt.Sprintf("%-8s %9s %9s %10s %10s %10s %10s %10s %10s\n",
+		"kind", "queries", "failures", "min", "mean", "p50", "p90", "p99", "max")
+	for _, queryKind := range []QueryKind{QueryKindSingle, QueryKindBatch} {
+		latencyStats, found := r.Latencies[queryKind]
+		if !found {
+			continue
+		}
+		text += fmt.Sprintf("%-8s %9d %9d %10s %10s %10s %10s %10s %10s\n",
+			queryKind,
+			latencyStats.Queries,
+			latencyStats.Failures,
+			formatLatency(latencyStats.Min),
+			formatLatency(latencyStats.Mean),
+			formatLatency(latencyStats.P50),
+			formatLatency(latencyStats.P90),
+			formatLatency(latencyStats.P99),
+			formatLatency(latencyStats.Max))
+	}
+	return text
+}
+
+func formatLatency(latency time.Duration) string {
+	return latency.Round(time.Microsecond).String()
+}
@@ -0,0 +1,96 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package benchmarks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	opaclient "github.com/nuclio/opa-client"
+	"github.com/stretchr/testify/suite"
+)
+
+type BenchmarksTestSuite struct {
+	suite.Suite
+	ctx    context.Context
+	client opaclient.Client
+}
+
+func (suite *BenchmarksTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.client = opaclient.NewNopClient(nil, false)
+}
+
+func (suite *BenchmarksTestSuite) TestRunOpenLoop() {
+	report, err := Run(suite.ctx, suite.client, Config{
+		QPS:             500,
+		Duration:        200 * time.Millisecond,
+		BatchPercentage: 50,
+		Resources:       []string{"projects/p1", "projects/p2"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(report.Latencies, 2)
+
+	// paced by the rate
+	queries := report.Latencies[QueryKindSingle].Queries + report.Latencies[QueryKindBatch].Queries
+	suite.Require().InDelta(100, queries, 50)
+	for _, latencyStats := range report.Latencies {
+		suite.Require().Zero(latencyStats.Failures)
+		suite.Require().LessOrEqual(latencyStats.Min, latencyStats.P50)
+		suite.Require().LessOrEqual(latencyStats.P50, latencyStats.P99)
+		suite.Require().LessOrEqual(latencyStats.P99, latencyStats.Max)
+	}
+	suite.Require().Contains(report.String(), "batch")
+}
+
+func (suite *BenchmarksTestSuite) TestRunClosedLoop() {
+	report, err := Run(suite.ctx, suite.client, Config{
+		Duration:    50 * time.Millisecond,
+		Concurrency: 2,
+		Resources:   []string{"projects/p1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(report.Latencies, 1)
+	suite.Require().Positive(report.Latencies[QueryKindSingle].Queries)
+	suite.Require().Zero(report.Skipped)
+
+	_, err = Run(suite.ctx, suite.client, Config{Duration: time.Second})
+	suite.Require().Error(err)
+}
+
+func (suite *BenchmarksTestSuite) TestPercentile() {
+	var latencies []time.Duration
+	for latency := range 100 {
+		latencies = append(latencies, time.Duration(latency+1)*time.Millisecond)
+	}
+
+	latencyStats := newLatencyStats(latencies, 1)
+	suite.Require().Equal(int64(101), latencyStats.Queries)
+	suite.Require().Equal(time.Millisecond, latencyStats.Min)
+	suite.Require().Equal(50*time.Millisecond, latencyStats.P50)
+	suite.Require().Equal(90*time.Millisecond, latencyStats.P90)
+	suite.Require().Equal(99*time.Millisecond, latencyStats.P99)
+	suite.Require().Equal(100*time.Millisecond, latencyStats.Max)
+	suite.Require().Equal(50500*time.Microsecond, latencyStats.Mean)
+}
+
+func TestBenchmarksTestSuite(t *testing.T) {
+	suite.Run(t, new(BenchmarksTestSuite))
+}
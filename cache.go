@@ -0,0 +1,311 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DecisionCache stores permission decisions, keyed by resource, action and permission options
+type DecisionCache interface {
+
+	// Get returns the cached decision of the given key, if it exists and has not expired
+	Get(ctx context.Context, key string) (*CachedDecision, bool)
+
+	// Set stores the decision of the given key until it expires
+	Set(ctx context.Context, key string, decision *CachedDecision)
+}
+
+// MultiDecisionCache is a decision cache able to get multiple decisions at once (e.g.: pipelined),
+// used when querying multiple resources
+type MultiDecisionCache interface {
+	DecisionCache
+
+	// GetMulti returns the cached decisions of the given keys, omitting missing and expired ones
+	GetMulti(ctx context.Context, keys []string) map[string]*CachedDecision
+}
+
+// StaleDecisionCache is a decision cache able to retain expired decisions, to be served when OPA is unavailable
+type StaleDecisionCache interface {
+	DecisionCache
+
+	// RetainStale retains decisions for (at least) the given period past their expiry
+	RetainStale(maxStaleness time.Duration)
+
+	// GetStale returns the cached decision of the given key, if it has not expired more than maxStaleness ago
+	GetStale(ctx context.Context, key string, maxStaleness time.Duration) (*CachedDecision, bool)
+}
+
+// InstrumentedDecisionCache is a decision cache reporting its size and evictions
+type InstrumentedDecisionCache interface {
+	DecisionCache
+
+	// Len returns the number of cached decisions
+	Len() int
+
+	// Evictions returns the number of decisions evicted to make room for others
+	Evictions() int64
+}
+
+// FlushableDecisionCache is a decision cache able to drop all of its decisions, flushed once the policy revision
+// changes
+type FlushableDecisionCache interface {
+	DecisionCache
+
+	// Flush drops all cached decisions
+	Flush(ctx context.Context)
+}
+
+type CachedDecision struct {
+	Allowed     bool        `json:"allowed"`
+	Reason      string      `json:"reason,omitempty"`
+	Violations  []string    `json:"violations,omitempty"`
+	Obligations Obligations `json:"obligations,omitempty"`
+	Provenance  *Provenance `json:"provenance,omitempty"`
+	ExpiresAt   time.Time   `json:"expiresAt"`
+}
+
+func (d *CachedDecision) toDecision(resource string, action Action) *Decision {
+	return &Decision{
+		Resource:    resource,
+		Action:      action,
+		Allowed:     d.Allowed,
+		Reason:      d.Reason,
+		Violations:  d.Violations,
+		Obligations: d.Obligations,
+		Provenance:  d.Provenance,
+		Cached:      true,
+	}
+}
+
+type CacheStats struct {
+	Hits            int64 `json:"hits"`
+	Misses          int64 `json:"misses"`
+	Evictions       int64 `json:"evictions"`
+	Size            int   `json:"size"`
+	RefreshFailures int64 `json:"refreshFailures"`
+}
+
+// cacheCounters counts the decision cache usage of a client
+type cacheCounters struct {
+	hits              atomic.Int64
+	misses            atomic.Int64
+	refreshFailures   atomic.Int64
+	reportedEvictions atomic.Int64
+}
+
+// MemoryDecisionCache is an in-memory, size bounded, LRU decision cache
+type MemoryDecisionCache struct {
+	lock         sync.Mutex
+	maxSize      int
+	maxStaleness time.Duration
+	clock        Clock
+	entries      map[string]*list.Element
+	lru          *list.List
+	evictions    int64
+}
+
+type memoryDecisionCacheEntry struct {
+	key      string
+	decision *CachedDecision
+}
+
+func NewMemoryDecisionCache(maxSize int) *MemoryDecisionCache {
+	if maxSize <= 0 {
+		maxSize = DefaultCacheSize
+	}
+	return &MemoryDecisionCache{
+		maxSize: maxSize,
+		clock:   SystemClock{},
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+func (c *MemoryDecisionCache) Get(ctx context.Context, key string) (*CachedDecision, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+
+	entry := element.Value.(*memoryDecisionCacheEntry)
+	now := c.clock.Now()
+	if now.After(entry.decision.ExpiresAt) {
+
+		// retain stale decisions
+		if now.After(entry.decision.ExpiresAt.Add(c.maxStaleness)) {
+			c.lru.Remove(element)
+			delete(c.entries, key)
+		}
+		return nil, false
+	}
+
+	c.lru.MoveToFront(element)
+	return entry.decision, true
+}
+
+// RetainStale retains decisions for the given period past their expiry (until evicted)
+func (c *MemoryDecisionCache) RetainStale(maxStaleness time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.maxStaleness = maxStaleness
+}
+
+// SetClock tells the expiry of decisions by the given clock (e.g.: a fake clock in tests)
+func (c *MemoryDecisionCache) SetClock(clock Clock) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.clock = clock
+}
+
+func (c *MemoryDecisionCache) GetStale(ctx context.Context,
+	key string,
+	maxStaleness time.Duration) (*CachedDecision, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	element, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+
+	entry := element.Value.(*memoryDecisionCacheEntry)
+	if c.clock.Now().After(entry.decision.ExpiresAt.Add(maxStaleness)) {
+		return nil, false
+	}
+	return entry.decision, true
+}
+
+func (c *MemoryDecisionCache) Set(ctx context.Context, key string, decision *CachedDecision) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if element, found := c.entries[key]; found {
+		element.Value.(*memoryDecisionCacheEntry).decision = decision
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.lru.PushFront(&memoryDecisionCacheEntry{
+		key:      key,
+		decision: decision,
+	})
+
+	// evict the least recently used entry
+	if c.lru.Len() > c.maxSize {
+		oldestElement := c.lru.Back()
+		c.lru.Remove(oldestElement)
+		delete(c.entries, oldestElement.Value.(*memoryDecisionCacheEntry).key)
+		c.evictions++
+	}
+}
+
+// Flush drops all cached decisions (including stale ones)
+func (c *MemoryDecisionCache) Flush(ctx context.Context) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+}
+
+// Len returns the number of cached decisions
+func (c *MemoryDecisionCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lru.Len()
+}
+
+// Evictions returns the number of decisions evicted to make room for others
+func (c *MemoryDecisionCache) Evictions() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.evictions
+}
+
+// decisionCacheKey returns the cache key of a decision, which must capture everything affecting it
+// (including the queried policy, as clients derived from each other may query different ones)
+func decisionCacheKey(permissionQueryPath string,
+	resource string,
+	action Action,
+	permissionOptions *PermissionOptions) string {
+	cacheKey := fmt.Sprintf("%s|%s|%s|%s|%s",
+		permissionQueryPath,
+		action,
+		resource,
+		sortedJoin(permissionOptions.memberIds()),
+		permissionOptions.HierarchyMode)
+
+	if subject := permissionOptions.Subject; subject != nil {
+		cacheKey += fmt.Sprintf("|%s;%s;%s;%s",
+			subject.UserID,
+			sortedJoin(subject.GroupIDs),
+			sortedJoin(subject.Roles),
+			subject.Tenant)
+	}
+
+	// map keys are marshalled sorted, so equal extra inputs are encoded equally
+	if len(permissionOptions.ExtraInput) > 0 {
+		encodedExtraInput, err := json.Marshal(permissionOptions.ExtraInput)
+		if err != nil {
+			encodedExtraInput = []byte(fmt.Sprintf("%v", permissionOptions.ExtraInput))
+		}
+		cacheKey += "|" + string(encodedExtraInput)
+	}
+	if attributes := permissionOptions.ResourceAttributes[resource]; len(attributes) > 0 {
+		encodedAttributes, err := json.Marshal(attributes)
+		if err != nil {
+			encodedAttributes = []byte(fmt.Sprintf("%v", attributes))
+		}
+		cacheKey += "|" + string(encodedAttributes)
+	}
+	return cacheKey
+}
+
+// cacheKey returns the cache key of a decision of the client's policy. With provenance enabled, the key
+// includes the policy revision, so decisions are never served once OPA runs a different revision
+func (c *HTTPClient) cacheKey(resource string,
+	action Action,
+	permissionOptions *PermissionOptions,
+	revision string) string {
+	cacheKey := decisionCacheKey(c.permissionQueryPath, resource, action, permissionOptions)
+	if c.provenance && revision != "" {
+		cacheKey += "|" + revision
+	}
+	return cacheKey
+}
+
+func sortedJoin(values []string) string {
+	values = slices.Clone(values)
+	slices.Sort(values)
+	return strings.Join(values, ",")
+}
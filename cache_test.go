@@ -0,0 +1,75 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MemoryDecisionCacheTestSuite struct {
+	suite.Suite
+	ctx   context.Context
+	cache *MemoryDecisionCache
+}
+
+func (suite *MemoryDecisionCacheTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.cache = NewMemoryDecisionCache(2)
+}
+
+func (suite *MemoryDecisionCacheTestSuite) TestExpiry() {
+	suite.cache.Set(suite.ctx, "expired", &CachedDecision{Allowed: true, ExpiresAt: time.Now().Add(-time.Second)})
+	suite.cache.Set(suite.ctx, "valid", &CachedDecision{Allowed: true, ExpiresAt: time.Now().Add(time.Minute)})
+
+	_, found := suite.cache.Get(suite.ctx, "expired")
+	suite.Require().False(found)
+	suite.Require().Equal(1, suite.cache.Len())
+
+	decision, found := suite.cache.Get(suite.ctx, "valid")
+	suite.Require().True(found)
+	suite.Require().True(decision.Allowed)
+}
+
+func (suite *MemoryDecisionCacheTestSuite) TestLRUEviction() {
+	expiresAt := time.Now().Add(time.Minute)
+	suite.cache.Set(suite.ctx, "a", &CachedDecision{Allowed: true, ExpiresAt: expiresAt})
+	suite.cache.Set(suite.ctx, "b", &CachedDecision{Allowed: true, ExpiresAt: expiresAt})
+
+	// touch "a" so "b" becomes the least recently used
+	_, found := suite.cache.Get(suite.ctx, "a")
+	suite.Require().True(found)
+
+	suite.cache.Set(suite.ctx, "c", &CachedDecision{Allowed: true, ExpiresAt: expiresAt})
+	suite.Require().Equal(2, suite.cache.Len())
+
+	_, found = suite.cache.Get(suite.ctx, "b")
+	suite.Require().False(found)
+	_, found = suite.cache.Get(suite.ctx, "a")
+	suite.Require().True(found)
+	_, found = suite.cache.Get(suite.ctx, "c")
+	suite.Require().True(found)
+}
+
+func TestMemoryDecisionCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(MemoryDecisionCacheTestSuite))
+}
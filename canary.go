@@ -0,0 +1,123 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"math/rand/v2"
+)
+
+// canary evaluates a sample of the queries against a canary policy as well, to validate it on live traffic
+// before cutting over to it
+type canary struct {
+	client     *HTTPClient
+	percentage float64
+}
+
+// sampled returns whether the current query is evaluated against the canary policy
+func (c *canary) sampled() bool {
+	return rand.Float64()*100 < c.percentage
+}
+
+// canaryQueryPermissions queries the canary policy in the background (if sampled), and reports its agreement with
+// the given decision
+func (c *HTTPClient) canaryQueryPermissions(ctx context.Context,
+	decision *Decision,
+	permissionOptions *PermissionOptions) {
+	if c.canary == nil || !c.canary.sampled() {
+		return
+	}
+
+	// the caller may reuse its options once we return
+	canaryPermissionOptions := *permissionOptions
+
+	c.backgroundTasks.run(ctx, func(canaryCtx context.Context) {
+		canaryDecision, err := c.canary.client.queryPermissions(canaryCtx,
+			decision.Resource,
+			decision.Action,
+			&canaryPermissionOptions)
+		if err != nil {
+			c.reportCanaryFailure(canaryCtx, err)
+			return
+		}
+		c.reportCanaryComparisons(canaryCtx,
+			[]string{decision.Resource},
+			decision.Action,
+			[]bool{decision.Allowed},
+			[]bool{canaryDecision.Allowed})
+	})
+}
+
+// canaryQueryPermissionsMultiResources queries the canary policy in the background (if sampled), and reports its
+// agreement with the given results
+func (c *HTTPClient) canaryQueryPermissionsMultiResources(ctx context.Context,
+	resources []string,
+	action Action,
+	permissionOptions *PermissionOptions,
+	results []bool) {
+	if c.canary == nil || !c.canary.sampled() {
+		return
+	}
+
+	// the caller may reuse its options once we return
+	canaryPermissionOptions := *permissionOptions
+
+	c.backgroundTasks.run(ctx, func(canaryCtx context.Context) {
+		canaryResults, _, err := c.canary.client.queryPermissionsMultiResources(canaryCtx,
+			resources,
+			action,
+			&canaryPermissionOptions)
+		if err != nil {
+			c.reportCanaryFailure(canaryCtx, err)
+			return
+		}
+		c.reportCanaryComparisons(canaryCtx, resources, action, results, canaryResults)
+	})
+}
+
+func (c *HTTPClient) reportCanaryFailure(ctx context.Context, err error) {
+	c.metricsSink.IncrementCounter(MetricCanaryFailures, 1, nil)
+	c.logger.WarnWithCtx(ctx, "Failed to query canary policy",
+		"canaryQueryPath", c.canary.client.permissionQueryPath,
+		"err", err.Error())
+}
+
+func (c *HTTPClient) reportCanaryComparisons(ctx context.Context,
+	resources []string,
+	action Action,
+	results []bool,
+	canaryResults []bool) {
+	var agreements, disagreements int64
+	for resourceIdx, resource := range resources {
+		if results[resourceIdx] == canaryResults[resourceIdx] {
+			agreements++
+			continue
+		}
+		disagreements++
+		c.logger.WarnWithCtx(ctx, "Canary decision disagreed with primary decision",
+			"resource", resource,
+			"action", action,
+			"allowed", results[resourceIdx],
+			"canaryAllowed", canaryResults[resourceIdx])
+	}
+	if agreements > 0 {
+		c.metricsSink.IncrementCounter(MetricCanaryComparisons, agreements, map[string]string{"outcome": "agree"})
+	}
+	if disagreements > 0 {
+		c.metricsSink.IncrementCounter(MetricCanaryComparisons, disagreements, map[string]string{"outcome": "disagree"})
+	}
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+// CertificateReloader serves a file-based client certificate and CA, reloading them once the files change
+// (e.g.: rotated by cert-manager), without restarting.
+// The files are checked on every TLS handshake, and a failed reload keeps serving the previous ones
+type CertificateReloader struct {
+	logger   logger.Logger
+	certFile string
+	keyFile  string
+	caFile   string
+
+	lock        sync.RWMutex
+	modTimes    map[string]time.Time
+	certificate *tls.Certificate
+	rootCAs     *x509.CertPool
+}
+
+// NewCertificateReloader loads the given client certificate (and key) and CA files.
+// Either the certificate and key, or the CA, may be empty
+func NewCertificateReloader(parentLogger logger.Logger,
+	certFile string,
+	keyFile string,
+	caFile string) (*CertificateReloader, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("Client certificate and key files must be set together")
+	}
+
+	certificateReloader := &CertificateReloader{
+		logger:   childLogger(parentLogger, "certificates"),
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		modTimes: map[string]time.Time{},
+	}
+	if err := certificateReloader.reload(); err != nil {
+		return nil, errors.Wrap(err, "Failed to load certificates")
+	}
+	return certificateReloader, nil
+}
+
+// ConfigureTLS sets the given TLS configuration to use the reloaded certificate and CA
+func (r *CertificateReloader) ConfigureTLS(tlsConfig *tls.Config) {
+	if r.certFile != "" {
+		tlsConfig.GetClientCertificate = r.GetClientCertificate
+	}
+
+	// verify the server against the reloaded CA ourselves, since the RootCAs can't be changed once in use.
+	// Note that the server must be addressed by hostname, as IP addresses aren't reported for verification
+	if r.caFile != "" && !tlsConfig.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = r.VerifyConnection
+	}
+}
+
+// GetClientCertificate returns the current client certificate (see tls.Config.GetClientCertificate)
+func (r *CertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.reloadIfChanged()
+
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.certificate, nil
+}
+
+// VerifyConnection verifies the server certificate chain and name against the current CA
+// (see tls.Config.VerifyConnection)
+func (r *CertificateReloader) VerifyConnection(connectionState tls.ConnectionState) error {
+	r.reloadIfChanged()
+
+	if len(connectionState.PeerCertificates) == 0 {
+		return errors.New("Server presented no certificates")
+	}
+
+	// the server name is unknown when connecting by IP address, so it can't be verified
+	if connectionState.ServerName == "" {
+		return errors.New("Cannot verify the server name, the OPA server must be addressed by hostname")
+	}
+
+	r.lock.RLock()
+	rootCAs := r.rootCAs
+	r.lock.RUnlock()
+
+	verifyOptions := x509.VerifyOptions{
+		Roots:         rootCAs,
+		DNSName:       connectionState.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, intermediateCertificate := range connectionState.PeerCertificates[1:] {
+		verifyOptions.Intermediates.AddCert(intermediateCertificate)
+	}
+
+	if _, err := connectionState.PeerCertificates[0].Verify(verifyOptions); err != nil {
+		return errors.Wrap(err, "Failed to verify server certificate")
+	}
+	return nil
+}
+
+func (r *CertificateReloader) reloadIfChanged() {
+	changed := false
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+		fileInfo, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+
+		r.lock.RLock()
+		modTime := r.modTimes[file]
+		r.lock.RUnlock()
+		if !fileInfo.ModTime().Equal(modTime) {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	if err := r.reload(); err != nil {
+		r.logger.WarnWith("Failed to reload certificates, keeping the previous ones",
+			"certFile", r.certFile,
+			"caFile", r.caFile,
+			"err", err.Error())
+		return
+	}
+	r.logger.InfoWith("Reloaded certificates",
+		"certFile", r.certFile,
+		"caFile", r.caFile)
+}
+
+func (r *CertificateReloader) reload() error {
+	modTimes := map[string]time.Time{}
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file == "" {
+			continue
+		}
+		fileInfo, err := os.Stat(file)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to stat %s", file)
+		}
+		modTimes[file] = fileInfo.ModTime()
+	}
+
+	var certificate *tls.Certificate
+	if r.certFile != "" {
+		loadedCertificate, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return errors.Wrap(err, "Failed to load client certificate")
+		}
+		certificate = &loadedCertificate
+	}
+
+	var rootCAs *x509.CertPool
+	if r.caFile != "" {
+		caContents, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return errors.Wrap(err, "Failed to read CA file")
+		}
+		rootCAs = x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caContents) {
+			return errors.New("Failed to parse CA file")
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.modTimes = modTimes
+	r.certificate = certificate
+	r.rootCAs = rootCAs
+	return nil
+}
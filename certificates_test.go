@@ -0,0 +1,244 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nuclio/logger"
+	nucliozap "github.com/nuclio/zap"
+	"github.com/stretchr/testify/suite"
+)
+
+type CertificateReloaderTestSuite struct {
+	suite.Suite
+	logger   logger.Logger
+	tempDir  string
+	certFile string
+	keyFile  string
+	caFile   string
+
+	caCertificate *x509.Certificate
+	caKey         *ecdsa.PrivateKey
+}
+
+func (suite *CertificateReloaderTestSuite) SetupTest() {
+	var err error
+	suite.logger, err = nucliozap.NewNuclioZapTest("certificates-test")
+	suite.Require().NoError(err)
+
+	suite.tempDir = suite.T().TempDir()
+	suite.certFile = filepath.Join(suite.tempDir, "tls.crt")
+	suite.keyFile = filepath.Join(suite.tempDir, "tls.key")
+	suite.caFile = filepath.Join(suite.tempDir, "ca.crt")
+
+	// create a CA
+	suite.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &suite.caKey.PublicKey, suite.caKey)
+	suite.Require().NoError(err)
+	suite.caCertificate, err = x509.ParseCertificate(caDER)
+	suite.Require().NoError(err)
+	suite.writePEM(suite.caFile, "CERTIFICATE", caDER)
+}
+
+func (suite *CertificateReloaderTestSuite) TestReload() {
+	suite.writeClientCertificate("client-1", time.Now().Add(-time.Minute))
+	certificateReloader, err := NewCertificateReloader(suite.logger, suite.certFile, suite.keyFile, suite.caFile)
+	suite.Require().NoError(err)
+	suite.Require().Equal("client-1", suite.clientCertificateCommonName(certificateReloader))
+
+	// rotate the certificate
+	suite.writeClientCertificate("client-2", time.Now())
+	suite.Require().Equal("client-2", suite.clientCertificateCommonName(certificateReloader))
+
+	// a failed reload keeps the previous certificate
+	suite.Require().NoError(os.WriteFile(suite.certFile, []byte("not a certificate"), 0600))
+	suite.Require().NoError(os.Chtimes(suite.certFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	suite.Require().Equal("client-2", suite.clientCertificateCommonName(certificateReloader))
+}
+
+func (suite *CertificateReloaderTestSuite) TestMutualTLS() {
+	suite.writeClientCertificate("client-1", time.Now())
+
+	// serve with a CA-signed certificate, and require a CA-signed client certificate
+	serverCertificate := suite.createCertificate("localhost", x509.ExtKeyUsageServerAuth)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(suite.caCertificate)
+	var clientCommonName string
+	testHTTPServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientCommonName = r.TLS.PeerCertificates[0].Subject.CommonName
+		err := json.NewEncoder(w).Encode(PermissionQueryResponse{Result: true})
+		suite.Require().NoError(err)
+	}))
+	testHTTPServer.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCertificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}
+	testHTTPServer.StartTLS()
+	defer testHTTPServer.Close()
+
+	certificateReloader, err := NewCertificateReloader(suite.logger, suite.certFile, suite.keyFile, suite.caFile)
+	suite.Require().NoError(err)
+	httpClient := NewHTTPClient(suite.logger,
+		strings.Replace(testHTTPServer.URL, "127.0.0.1", "localhost", 1),
+		"/v1/data/authz/allow",
+		"/v1/data/authz/filter_allowed",
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithCertificateReloader(certificateReloader))
+
+	allowed, err := httpClient.QueryPermissions(context.Background(), "resource", ActionRead, &PermissionOptions{})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal("client-1", clientCommonName)
+
+	// new connections use the rotated certificate
+	suite.writeClientCertificate("client-2", time.Now().Add(time.Minute))
+	httpClient.httpClient.CloseIdleConnections()
+	_, err = httpClient.QueryPermissions(context.Background(), "resource", ActionRead, &PermissionOptions{})
+	suite.Require().NoError(err)
+	suite.Require().Equal("client-2", clientCommonName)
+}
+
+func (suite *CertificateReloaderTestSuite) TestFailClosed() {
+	var requestsCount atomic.Int64
+	testHTTPServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsCount.Add(1)
+		err := json.NewEncoder(w).Encode(PermissionQueryResponse{Result: true})
+		suite.Require().NoError(err)
+	}))
+	defer testHTTPServer.Close()
+
+	// the CA fails to load, so requests over TLS fail rather than verify the server by the system roots - and are
+	// neither retried, nor decided by the fallback policy
+	opaClient := CreateOpaClient(suite.logger, &Config{
+		ClientKind:          ClientKindHTTP,
+		Address:             testHTTPServer.URL,
+		PermissionQueryPath: "/v1/data/authz/allow",
+		TLSCAFile:           filepath.Join(suite.tempDir, "missing-ca.crt"),
+		FallbackPolicy:      &FallbackPolicy{Rules: []FallbackRule{{Allow: true}}},
+	})
+	defer opaClient.(Closer).Close(context.Background()) // nolint: errcheck
+
+	_, err := opaClient.QueryPermissions(context.Background(), "resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().ErrorIs(err, ErrTLSConfiguration)
+	suite.Require().ErrorIs(err, os.ErrNotExist)
+	suite.Require().Zero(requestsCount.Load())
+
+	// as do requests to an endpoint whose own CA fails to load, rather than connecting by the client-wide settings
+	endpointClient := CreateOpaClient(suite.logger, &Config{
+		ClientKind:          ClientKindHTTP,
+		Address:             testHTTPServer.URL,
+		PermissionQueryPath: "/v1/data/authz/allow",
+		EndpointTLS: map[string]*EndpointTLSConfig{
+			testHTTPServer.URL: {CAFile: filepath.Join(suite.tempDir, "missing-ca.crt"), SkipVerify: true},
+		},
+	})
+	defer endpointClient.(Closer).Close(context.Background()) // nolint: errcheck
+
+	_, err = endpointClient.QueryPermissions(context.Background(), "resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().ErrorIs(err, ErrTLSConfiguration)
+	suite.Require().Zero(requestsCount.Load())
+}
+
+func (suite *CertificateReloaderTestSuite) clientCertificateCommonName(certificateReloader *CertificateReloader) string {
+	certificate, err := certificateReloader.GetClientCertificate(nil)
+	suite.Require().NoError(err)
+	parsedCertificate, err := x509.ParseCertificate(certificate.Certificate[0])
+	suite.Require().NoError(err)
+	return parsedCertificate.Subject.CommonName
+}
+
+// writeClientCertificate writes a CA-signed client certificate, with the given modification time
+func (suite *CertificateReloaderTestSuite) writeClientCertificate(commonName string, modTime time.Time) {
+	certificate := suite.createCertificate(commonName, x509.ExtKeyUsageClientAuth)
+	keyDER, err := x509.MarshalECPrivateKey(certificate.PrivateKey.(*ecdsa.PrivateKey))
+	suite.Require().NoError(err)
+
+	suite.writePEM(suite.certFile, "CERTIFICATE", certificate.Certificate[0])
+	suite.writePEM(suite.keyFile, "EC PRIVATE KEY", keyDER)
+	for _, file := range []string{suite.certFile, suite.keyFile} {
+		suite.Require().NoError(os.Chtimes(file, modTime, modTime))
+	}
+}
+
+func (suite *CertificateReloaderTestSuite) createCertificate(commonName string,
+	extKeyUsage x509.ExtKeyUsage) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	suite.Require().NoError(err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{extKeyUsage},
+	}
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, suite.caCertificate, &key.PublicKey, suite.caKey)
+	suite.Require().NoError(err)
+	return tls.Certificate{
+		Certificate: [][]byte{certificateDER},
+		PrivateKey:  key,
+	}
+}
+
+func (suite *CertificateReloaderTestSuite) writePEM(path string, blockType string, contents []byte) {
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: contents}), 0600)
+	suite.Require().NoError(err)
+}
+
+func TestCertificateReloaderTestSuite(t *testing.T) {
+	suite.Run(t, new(CertificateReloaderTestSuite))
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import "time"
+
+// Clock tells the time and waits for durations to elapse, on behalf of the retries and the decision cache expiry,
+// so tests can control time rather than sleep
+type Clock interface {
+
+	// Now returns the current time
+	Now() time.Time
+
+	// After waits for the duration to elapse, then sends the current time on the returned channel
+	After(duration time.Duration) <-chan time.Time
+}
+
+// SystemClock is the wall clock
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) After(duration time.Duration) <-chan time.Time {
+	return time.After(duration)
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nuclio/errors"
+	opaclient "github.com/nuclio/opa-client"
+)
+
+const defaultBatchSize = 500
+
+// runBatch streams the resources of the batch file, queries them in chunks, and writes their decisions
+// as they are received
+func runBatch(queryOptions options,
+	client *opaclient.HTTPClient,
+	action opaclient.Action,
+	permissionOptions *opaclient.PermissionOptions,
+	writer io.Writer) (int, error) {
+	if queryOptions.batchSize <= 0 {
+		return exitCodeFailure, errors.New("Batch size must be positive")
+	}
+
+	batchReader := io.Reader(os.Stdin)
+	if queryOptions.batchFile != "-" {
+		batchFile, err := os.Open(queryOptions.batchFile)
+		if err != nil {
+			return exitCodeFailure, errors.Wrap(err, "Failed to open batch file")
+		}
+		defer batchFile.Close() // nolint: errcheck
+		batchReader = batchFile
+	}
+
+	resourceReader := csv.NewReader(bufio.NewReader(batchReader))
+	resourceReader.FieldsPerRecord = -1
+	resourceReader.Comment = '#'
+	resourceReader.ReuseRecord = true
+
+	decisionWriter, err := newBatchDecisionWriter(writer, queryOptions.output)
+	if err != nil {
+		return exitCodeFailure, err
+	}
+	defer decisionWriter.flush() // nolint: errcheck
+
+	exitCode := exitCodeAllowed
+	resources := make([]string, 0, queryOptions.batchSize)
+	queryResources := func() error {
+		if len(resources) == 0 {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), queryOptions.timeout)
+		defer cancel()
+
+		results, err := client.QueryPermissionsMultiResourcesMap(ctx, resources, action, permissionOptions)
+		if err != nil {
+			return errors.Wrap(err, "Failed to query permissions")
+		}
+		for _, resource := range resources {
+			if !results[resource] {
+				exitCode = exitCodeDenied
+			}
+			if err := decisionWriter.write(&opaclient.Decision{
+				Resource: resource,
+				Action:   action,
+				Allowed:  results[resource],
+			}); err != nil {
+				return errors.Wrap(err, "Failed to write decision")
+			}
+		}
+		resources = resources[:0]
+		return nil
+	}
+
+	for rowIndex := 0; ; rowIndex++ {
+		record, err := resourceReader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return exitCodeFailure, errors.Wrap(err, "Failed to read batch file")
+		}
+		if rowIndex == 0 && queryOptions.batchHeader {
+			continue
+		}
+		if queryOptions.batchColumn >= len(record) {
+			line, _ := resourceReader.FieldPos(0)
+			return exitCodeFailure, errors.Errorf("Line %d has no column %d", line, queryOptions.batchColumn)
+		}
+
+		resource := strings.TrimSpace(record[queryOptions.batchColumn])
+		if resource == "" {
+			continue
+		}
+		resources = append(resources, resource)
+		if len(resources) == queryOptions.batchSize {
+			if err := queryResources(); err != nil {
+				return exitCodeFailure, err
+			}
+		}
+	}
+	if err := queryResources(); err != nil {
+		return exitCodeFailure, err
+	}
+
+	if err := decisionWriter.flush(); err != nil {
+		return exitCodeFailure, errors.Wrap(err, "Failed to flush decisions")
+	}
+	return exitCode, nil
+}
+
+// batchDecisionWriter writes decisions as text lines, JSON lines or CSV rows
+type batchDecisionWriter struct {
+	output         string
+	bufferedWriter *bufio.Writer
+	csvWriter      *csv.Writer
+	jsonEncoder    *json.Encoder
+}
+
+func newBatchDecisionWriter(writer io.Writer, output string) (*batchDecisionWriter, error) {
+	decisionWriter := &batchDecisionWriter{
+		output:         output,
+		bufferedWriter: bufio.NewWriter(writer),
+	}
+
+	switch output {
+	case "text":
+	case "json":
+		decisionWriter.jsonEncoder = json.NewEncoder(decisionWriter.bufferedWriter)
+	case "csv":
+		decisionWriter.csvWriter = csv.NewWriter(decisionWriter.bufferedWriter)
+		if err := decisionWriter.csvWriter.Write([]string{"resource", "action", "allowed"}); err != nil {
+			return nil, errors.Wrap(err, "Failed to write CSV header")
+		}
+	default:
+		return nil, errors.Errorf("Unknown output format: %s", output)
+	}
+	return decisionWriter, nil
+}
+
+func (w *batchDecisionWriter) write(decision *opaclient.Decision) error {
+	switch w.output {
+	case "json":
+		return w.jsonEncoder.Encode(decision)
+	case "csv":
+		return w.csvWriter.Write([]string{
+			decision.Resource,
+			string(decision.Action),
+			strconv.FormatBool(decision.Allowed),
+		})
+	default:
+		_, err := fmt.Fprintln(w.bufferedWriter, formatDecision(decision))
+		return err
+	}
+}
+
+func (w *batchDecisionWriter) flush() error {
+	if w.csvWriter != nil {
+		w.csvWriter.Flush()
+		if err := w.csvWriter.Error(); err != nil {
+			return err
+		}
+	}
+	return w.bufferedWriter.Flush()
+}
@@ -0,0 +1,226 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	opaclient "github.com/nuclio/opa-client"
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	testAllowPath  = "/v1/data/authz/allow"
+	testFilterPath = "/v1/data/authz/filter_allowed"
+)
+
+type BatchTestSuite struct {
+	suite.Suite
+	testHTTPServer *httptest.Server
+	client         *opaclient.HTTPClient
+	lock           sync.Mutex
+	queriedChunks  [][]string
+}
+
+func (suite *BatchTestSuite) SetupTest() {
+	suite.queriedChunks = nil
+
+	// the policy allows every resource, unless denied by name
+	suite.testHTTPServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != testFilterPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var filterRequest opaclient.PermissionFilterRequest
+		suite.Require().NoError(json.NewDecoder(r.Body).Decode(&filterRequest))
+		suite.lock.Lock()
+		suite.queriedChunks = append(suite.queriedChunks, filterRequest.Input.Resources)
+		suite.lock.Unlock()
+
+		filterResponse := opaclient.PermissionFilterResponse{Result: []string{}}
+		for _, resource := range filterRequest.Input.Resources {
+			if !strings.Contains(resource, "deny") {
+				filterResponse.Result = append(filterResponse.Result, resource)
+			}
+		}
+		suite.Require().NoError(json.NewEncoder(w).Encode(filterResponse))
+	}))
+	suite.client = opaclient.NewHTTPClient(nil,
+		suite.testHTTPServer.URL,
+		testAllowPath,
+		testFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false)
+}
+
+func (suite *BatchTestSuite) TearDownTest() {
+	suite.testHTTPServer.Close()
+}
+
+func (suite *BatchTestSuite) TestRunBatch() {
+	batchFilePath := suite.writeBatchFile(`# resources to check
+name,resource
+p1,/projects/p1
+p2,/projects/deny-p2
+# commented out,/projects/p3
+p4, /projects/p4 
+p5,
+p6,/projects/p6
+`)
+
+	for _, testCase := range []struct {
+		name           string
+		output         string
+		expectedOutput string
+	}{
+		{
+			name:   "text",
+			output: "text",
+			expectedOutput: "ALLOW read /projects/p1\n" +
+				"DENY  read /projects/deny-p2\n" +
+				"ALLOW read /projects/p4\n" +
+				"ALLOW read /projects/p6\n",
+		},
+		{
+			name:   "json",
+			output: "json",
+			expectedOutput: `{"resource":"/projects/p1","action":"read","allowed":true}` + "\n" +
+				`{"resource":"/projects/deny-p2","action":"read","allowed":false}` + "\n" +
+				`{"resource":"/projects/p4","action":"read","allowed":true}` + "\n" +
+				`{"resource":"/projects/p6","action":"read","allowed":true}` + "\n",
+		},
+		{
+			name:   "csv",
+			output: "csv",
+			expectedOutput: "resource,action,allowed\n" +
+				"/projects/p1,read,true\n" +
+				"/projects/deny-p2,read,false\n" +
+				"/projects/p4,read,true\n" +
+				"/projects/p6,read,true\n",
+		},
+	} {
+		suite.Run(testCase.name, func() {
+			suite.queriedChunks = nil
+			output := &bytes.Buffer{}
+
+			// the header, comments and empty resources are skipped, and the resources are queried in chunks
+			exitCode, err := runBatch(options{
+				output:      testCase.output,
+				timeout:     5 * time.Second,
+				batchFile:   batchFilePath,
+				batchColumn: 1,
+				batchHeader: true,
+				batchSize:   2,
+			}, suite.client, opaclient.ActionRead, &opaclient.PermissionOptions{}, output)
+			suite.Require().NoError(err)
+			suite.Require().Equal(exitCodeDenied, exitCode)
+			suite.Require().Equal(testCase.expectedOutput, output.String())
+			suite.Require().Equal([][]string{
+				{"/projects/p1", "/projects/deny-p2"},
+				{"/projects/p4", "/projects/p6"},
+			}, suite.queriedChunks)
+		})
+	}
+}
+
+func (suite *BatchTestSuite) TestRunBatchAllowed() {
+	batchFilePath := suite.writeBatchFile("/projects/p1\n/projects/p2\n/projects/p3\n")
+
+	// without a header, the first row is a resource as well, and a partial chunk is queried last
+	output := &bytes.Buffer{}
+	exitCode, err := runBatch(options{
+		output:    "text",
+		timeout:   5 * time.Second,
+		batchFile: batchFilePath,
+		batchSize: 2,
+	}, suite.client, opaclient.ActionRead, &opaclient.PermissionOptions{}, output)
+	suite.Require().NoError(err)
+	suite.Require().Equal(exitCodeAllowed, exitCode)
+	suite.Require().Equal([][]string{
+		{"/projects/p1", "/projects/p2"},
+		{"/projects/p3"},
+	}, suite.queriedChunks)
+}
+
+func (suite *BatchTestSuite) TestRunBatchInvalid() {
+	batchFilePath := suite.writeBatchFile("p1,/projects/p1\np2\n")
+
+	for _, testCase := range []struct {
+		name         string
+		batchColumn  int
+		batchSize    int
+		errorMessage string
+	}{
+		{
+			name:         "zeroBatchSize",
+			batchColumn:  1,
+			batchSize:    0,
+			errorMessage: "Batch size must be positive",
+		},
+		{
+			name:         "negativeBatchSize",
+			batchColumn:  1,
+			batchSize:    -1,
+			errorMessage: "Batch size must be positive",
+		},
+		{
+			name:         "missingColumn",
+			batchColumn:  1,
+			batchSize:    10,
+			errorMessage: "Line 2 has no column 1",
+		},
+	} {
+		suite.Run(testCase.name, func() {
+			suite.queriedChunks = nil
+			exitCode, err := runBatch(options{
+				output:      "text",
+				timeout:     5 * time.Second,
+				batchFile:   batchFilePath,
+				batchColumn: testCase.batchColumn,
+				batchSize:   testCase.batchSize,
+			}, suite.client, opaclient.ActionRead, &opaclient.PermissionOptions{}, &bytes.Buffer{})
+			suite.Require().Error(err)
+			suite.Require().Contains(err.Error(), testCase.errorMessage)
+			suite.Require().Equal(exitCodeFailure, exitCode)
+			suite.Require().Empty(suite.queriedChunks)
+		})
+	}
+}
+
+func (suite *BatchTestSuite) writeBatchFile(content string) string {
+	batchFilePath := filepath.Join(suite.T().TempDir(), "resources.csv")
+	suite.Require().NoError(os.WriteFile(batchFilePath, []byte(content), 0600))
+	return batchFilePath
+}
+
+func TestBatchTestSuite(t *testing.T) {
+	suite.Run(t, new(BatchTestSuite))
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nuclio/errors"
+	opaclient "github.com/nuclio/opa-client"
+	"github.com/nuclio/opa-client/benchmarks"
+)
+
+// runBench runs the "bench" subcommand, sending load of single and batch queries and printing their latencies.
+// The exit code is 0 when the run completed (even if queries failed), and 2 on failure to run it
+func runBench(args []string, writer io.Writer) (int, error) {
+	flagSet := flag.NewFlagSet("bench", flag.ContinueOnError)
+	configPath := flagSet.String("config", "",
+		"Path of a JSON client configuration file (fields are overridden by OPA_* environment variables)")
+	qps := flagSet.Float64("qps", 100, "Queries to send per second (0 sends them as fast as the concurrency allows)")
+	duration := flagSet.Duration("duration", 30*time.Second, "Duration of sending queries")
+	concurrency := flagSet.Int("concurrency", benchmarks.DefaultConcurrency, "Maximum number of in-flight queries")
+	batchPercentage := flagSet.Float64("batch-percentage", 0,
+		"Percentage (0-100) of queries to send as batches (multi-resource queries)")
+	batchSize := flagSet.Int("batch-size", benchmarks.DefaultBatchSize, "Number of resources of a batch query")
+	action := flagSet.String("action", string(opaclient.ActionRead), "Action to query permissions for")
+	memberIds := flagSet.String("member-ids", "", "Comma separated member ids to query for")
+	resources := flagSet.String("resources", "", "Comma separated resources to cycle through")
+	output := flagSet.String("output", "text", "Output format (text or json)")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: opaq bench [flags] -resources resource[,resource...]\n")
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return exitCodeFailure, nil
+	}
+
+	client, err := createClient(*configPath, false)
+	if err != nil {
+		return exitCodeFailure, err
+	}
+	defer client.Close(context.Background()) // nolint: errcheck
+
+	report, err := benchmarks.Run(context.Background(), client, benchmarks.Config{
+		QPS:             *qps,
+		Duration:        *duration,
+		Concurrency:     *concurrency,
+		BatchPercentage: *batchPercentage,
+		BatchSize:       *batchSize,
+		Resources:       splitList(*resources),
+		Action:          opaclient.Action(*action),
+		PermissionOptions: &opaclient.PermissionOptions{
+			MemberIds: splitList(*memberIds),
+		},
+	})
+	if err != nil {
+		return exitCodeFailure, errors.Wrap(err, "Failed to run benchmark")
+	}
+
+	switch *output {
+	case "json":
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	case "text":
+		_, err = fmt.Fprint(writer, report.String())
+	default:
+		return exitCodeFailure, errors.Errorf("Unknown output format: %s", *output)
+	}
+	if err != nil {
+		return exitCodeFailure, errors.Wrap(err, "Failed to print report")
+	}
+	return exitCodeAllowed, nil
+}
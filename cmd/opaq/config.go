@@ -0,0 +1,69 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/nuclio/errors"
+	opaclient "github.com/nuclio/opa-client"
+	nucliozap "github.com/nuclio/zap"
+)
+
+// createClient creates an HTTP client by the configuration (read from the given YAML or JSON file, if set,
+// overridden by the environment), with the given interceptors
+func createClient(configPath string, verbose bool, interceptors ...opaclient.Interceptor) (*opaclient.HTTPClient, error) {
+	config, err := opaclient.LoadConfig(configPath, func(config *opaclient.Config) {
+		if config.ClientKind == "" {
+			config.ClientKind = opaclient.ClientKindHTTP
+		}
+		config.Verbose = config.Verbose || verbose
+		config.Interceptors = append(config.Interceptors, interceptors...)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to load configuration")
+	}
+	if config.ClientKind != opaclient.ClientKindHTTP {
+		return nil, errors.Errorf("Cannot query with a %s client", config.ClientKind)
+	}
+
+	loggerLevel := nucliozap.WarnLevel
+	if config.Verbose {
+		loggerLevel = nucliozap.DebugLevel
+	}
+	loggerInstance, err := nucliozap.NewNuclioZapCmd("opaq", loggerLevel, os.Stderr)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create logger")
+	}
+
+	client, ok := opaclient.CreateOpaClient(loggerInstance, config).(*opaclient.HTTPClient)
+	if !ok {
+		return nil, errors.New("Failed to create HTTP client")
+	}
+	return client, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
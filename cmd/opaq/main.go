@@ -0,0 +1,300 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command opaq queries OPA permissions from a shell, using the same configuration as the applications,
+// so operators can reproduce their authorization decisions.
+//
+// Usage:
+//
+//	opaq [flags] resource [resource...]
+//	opaq [flags] -batch-file resources.csv
+//	opaq test [flags] fixture.yaml [fixture.yaml...]
+//	opaq bench [flags] -resources resource[,resource...]
+//	opaq audit-schema
+//
+// The exit code is 0 when all resources are allowed, 1 when any is denied, and 2 on failure
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+	opaclient "github.com/nuclio/opa-client"
+)
+
+const (
+	exitCodeAllowed = 0
+	exitCodeDenied  = 1
+	exitCodeFailure = 2
+)
+
+type options struct {
+	configPath    string
+	action        string
+	memberIds     string
+	hierarchyMode string
+	extraInput    string
+	explain       string
+	output        string
+	timeout       time.Duration
+	verbose       bool
+	resources     []string
+
+	// batch mode
+	batchFile   string
+	batchColumn int
+	batchHeader bool
+	batchSize   int
+}
+
+// result is the outcome of a query, as printed
+type result struct {
+	Decisions    []*opaclient.Decision `json:"decisions"`
+	Explanations []json.RawMessage     `json:"explanations,omitempty"`
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		exitCode, err := runTests(os.Args[2:], os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", errors.GetErrorStackString(err, 10))
+		}
+		os.Exit(exitCode)
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		exitCode, err := runBench(os.Args[2:], os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", errors.GetErrorStackString(err, 10))
+		}
+		os.Exit(exitCode)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "audit-schema" {
+		auditEventSchema, err := opaclient.AuditEventJSONSchema()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", errors.GetErrorStackString(err, 10))
+			os.Exit(exitCodeFailure)
+		}
+		fmt.Println(string(auditEventSchema))
+		os.Exit(exitCodeAllowed)
+	}
+
+	queryOptions := options{}
+	flag.StringVar(&queryOptions.configPath, "config", "",
+		"Path of a JSON client configuration file (fields are overridden by OPA_* environment variables)")
+	flag.StringVar(&queryOptions.action, "action", string(opaclient.ActionRead), "Action to query permissions for")
+	flag.StringVar(&queryOptions.memberIds, "member-ids", "", "Comma separated member ids to query for")
+	flag.StringVar(&queryOptions.hierarchyMode, "hierarchy", "",
+		"Hierarchy mode (input or client), to evaluate the resource ancestors")
+	flag.StringVar(&queryOptions.extraInput, "input", "", "JSON object of extra input fields")
+	flag.StringVar(&queryOptions.explain, "explain", "",
+		"Have OPA explain the decisions (notes, fails, full or debug)")
+	flag.StringVar(&queryOptions.output, "output", "text", "Output format (text, json, or csv in batch mode)")
+	flag.DurationVar(&queryOptions.timeout, "timeout", 30*time.Second, "Timeout of each query")
+	flag.BoolVar(&queryOptions.verbose, "verbose", false, "Log the requests sent to OPA")
+	flag.StringVar(&queryOptions.batchFile, "batch-file", "",
+		"CSV file (or - for stdin) to stream the resources to query from, instead of the arguments")
+	flag.IntVar(&queryOptions.batchColumn, "batch-column", 0, "Column of the resources in the batch file")
+	flag.BoolVar(&queryOptions.batchHeader, "batch-header", false, "Skip the header row of the batch file")
+	flag.IntVar(&queryOptions.batchSize, "batch-size", defaultBatchSize, "Number of resources to query at once")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %[1]s [flags] resource [resource...]\n"+
+				"       %[1]s [flags] -batch-file file\n"+
+				"       %[1]s test [flags] fixture.yaml [fixture.yaml...]\n"+
+				"       %[1]s bench [flags] -resources resource[,resource...]\n"+
+				"       %[1]s audit-schema\n",
+			os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	queryOptions.resources = flag.Args()
+
+	exitCode, err := run(queryOptions, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", errors.GetErrorStackString(err, 10))
+	}
+	os.Exit(exitCode)
+}
+
+func run(queryOptions options, writer io.Writer) (int, error) {
+	if queryOptions.batchFile != "" {
+		if len(queryOptions.resources) > 0 {
+			return exitCodeFailure, errors.New("Resources cannot be given along with a batch file")
+		}
+		if queryOptions.explain != "" {
+			return exitCodeFailure, errors.New("Explaining is not supported in batch mode")
+		}
+	} else if len(queryOptions.resources) == 0 {
+		return exitCodeFailure, errors.New("At least one resource must be given")
+	}
+
+	permissionOptions := &opaclient.PermissionOptions{
+		MemberIds:     splitList(queryOptions.memberIds),
+		HierarchyMode: opaclient.HierarchyMode(queryOptions.hierarchyMode),
+	}
+	if queryOptions.extraInput != "" {
+		if err := json.Unmarshal([]byte(queryOptions.extraInput), &permissionOptions.ExtraInput); err != nil {
+			return exitCodeFailure, errors.Wrap(err, "Failed to parse extra input")
+		}
+	}
+
+	queryResult := &result{}
+	var interceptors []opaclient.Interceptor
+	if queryOptions.explain != "" {
+		interceptors = append(interceptors, explainInterceptor(queryOptions.explain, queryResult))
+	}
+
+	client, err := createClient(queryOptions.configPath, queryOptions.verbose, interceptors...)
+	if err != nil {
+		return exitCodeFailure, err
+	}
+	defer client.Close(context.Background()) // nolint: errcheck
+
+	action := opaclient.Action(queryOptions.action)
+	if queryOptions.batchFile != "" {
+		return runBatch(queryOptions, client, action, permissionOptions, writer)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), queryOptions.timeout)
+	defer cancel()
+
+	if len(queryOptions.resources) == 1 {
+		decision, err := client.QueryDecision(ctx, queryOptions.resources[0], action, permissionOptions)
+		if err != nil {
+			return exitCodeFailure, errors.Wrap(err, "Failed to query decision")
+		}
+		queryResult.Decisions = append(queryResult.Decisions, decision)
+	} else {
+		results, err := client.QueryPermissionsMultiResourcesMap(ctx,
+			queryOptions.resources,
+			action,
+			permissionOptions)
+		if err != nil {
+			return exitCodeFailure, errors.Wrap(err, "Failed to query permissions")
+		}
+		for _, resource := range queryOptions.resources {
+			queryResult.Decisions = append(queryResult.Decisions, &opaclient.Decision{
+				Resource: resource,
+				Action:   action,
+				Allowed:  results[resource],
+			})
+		}
+	}
+
+	if err := printResult(writer, queryOptions.output, queryResult); err != nil {
+		return exitCodeFailure, errors.Wrap(err, "Failed to print result")
+	}
+
+	for _, decision := range queryResult.Decisions {
+		if !decision.Allowed {
+			return exitCodeDenied, nil
+		}
+	}
+	return exitCodeAllowed, nil
+}
+
+// explainInterceptor has OPA explain every query, and collects the explanations into the result
+func explainInterceptor(explainMode string, queryResult *result) opaclient.Interceptor {
+	var lock sync.Mutex
+	return opaclient.Interceptor{
+		BeforeRequest: func(ctx context.Context, request *opaclient.InterceptedRequest) error {
+			request.QueryParameters.Set("explain", explainMode)
+
+			// pretty explanations are human-readable lines, rather than raw trace events
+			request.QueryParameters.Set("pretty", "true")
+			return nil
+		},
+		AfterResponse: func(ctx context.Context, response *opaclient.InterceptedResponse) error {
+			explainedResponse := struct {
+				Explanation json.RawMessage `json:"explanation"`
+			}{}
+			if err := json.Unmarshal(response.Body, &explainedResponse); err != nil {
+				return errors.Wrap(err, "Failed to unmarshal explanation")
+			}
+			if len(explainedResponse.Explanation) > 0 {
+				lock.Lock()
+				queryResult.Explanations = append(queryResult.Explanations, explainedResponse.Explanation)
+				lock.Unlock()
+			}
+			return nil
+		},
+	}
+}
+
+func printResult(writer io.Writer, output string, queryResult *result) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(queryResult)
+
+	case "text":
+		for _, decision := range queryResult.Decisions {
+			if _, err := fmt.Fprintln(writer, formatDecision(decision)); err != nil {
+				return err
+			}
+		}
+		for _, explanation := range queryResult.Explanations {
+			if _, err := fmt.Fprintf(writer, "\n%s\n", formatExplanation(explanation)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return errors.Errorf("Unknown output format: %s", output)
+	}
+}
+
+// formatDecision returns a decision as a text line (e.g.: "DENY  update projects/p1 (reason: locked)")
+func formatDecision(decision *opaclient.Decision) string {
+	verdict := "DENY "
+	if decision.Allowed {
+		verdict = "ALLOW"
+	}
+	line := fmt.Sprintf("%s %s %s", verdict, decision.Action, decision.Resource)
+	if decision.Reason != "" {
+		line += fmt.Sprintf(" (reason: %s)", decision.Reason)
+	}
+	if len(decision.Violations) > 0 {
+		line += fmt.Sprintf(" (violations: %s)", strings.Join(decision.Violations, ", "))
+	}
+	return line
+}
+
+// formatExplanation returns the lines of a pretty explanation as is, and any other explanation as indented JSON
+func formatExplanation(explanation json.RawMessage) string {
+	var lines []string
+	if err := json.Unmarshal(explanation, &lines); err == nil {
+		return strings.Join(lines, "\n")
+	}
+
+	var indentedExplanation bytes.Buffer
+	if err := json.Indent(&indentedExplanation, explanation, "", "  "); err != nil {
+		return string(explanation)
+	}
+	return indentedExplanation.String()
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/opa-client/policytest"
+)
+
+const (
+	exitCodeTestsPassed = 0
+	exitCodeTestsFailed = 1
+)
+
+// runTests runs the "test" subcommand, running the expectation suites of the given fixture files.
+// The exit code is 0 when all cases passed, 1 when any failed, and 2 on failure to run them
+func runTests(args []string, writer io.Writer) (int, error) {
+	flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+	configPath := flagSet.String("config", "",
+		"Path of a JSON client configuration file (fields are overridden by OPA_* environment variables)")
+	timeout := flagSet.Duration("timeout", 5*time.Minute, "Timeout of running all suites")
+	verbose := flagSet.Bool("verbose", false, "Log the requests sent to OPA")
+	flagSet.Usage = func() {
+		fmt.Fprintf(flagSet.Output(), "Usage: opaq test [flags] fixture.yaml [fixture.yaml...]\n")
+		flagSet.PrintDefaults()
+	}
+	if err := flagSet.Parse(args); err != nil {
+		return exitCodeFailure, nil
+	}
+	if flagSet.NArg() == 0 {
+		return exitCodeFailure, errors.New("At least one fixture file must be given")
+	}
+
+	var suites []*policytest.Suite
+	for _, fixturePath := range flagSet.Args() {
+		suite, err := policytest.LoadSuite(fixturePath)
+		if err != nil {
+			return exitCodeFailure, errors.Wrap(err, "Failed to load suite")
+		}
+		suites = append(suites, suite)
+	}
+
+	client, err := createClient(*configPath, *verbose)
+	if err != nil {
+		return exitCodeFailure, err
+	}
+	defer client.Close(context.Background()) // nolint: errcheck
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	passedCount, failedCount := 0, 0
+	for _, suite := range suites {
+		fmt.Fprintf(writer, "%s\n", suite.Name) // nolint: errcheck
+		for _, result := range policytest.Run(ctx, client, suite) {
+			if failure := result.Failure(); failure != "" {
+				failedCount++
+				fmt.Fprintf(writer, "  FAIL %s: %s\n", result.Case.Name, failure) // nolint: errcheck
+				continue
+			}
+			passedCount++
+			fmt.Fprintf(writer, "  PASS %s\n", result.Case.Name) // nolint: errcheck
+		}
+	}
+	fmt.Fprintf(writer, "\n%d passed, %d failed\n", passedCount, failedCount) // nolint: errcheck
+
+	if failedCount > 0 {
+		return exitCodeTestsFailed, nil
+	}
+	return exitCodeTestsPassed, nil
+}
@@ -0,0 +1,282 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nuclio/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+
+	// ConfigEnvPrefix prefixes the environment variables overriding the configuration fields
+	ConfigEnvPrefix = "OPA_"
+
+	// redactedValue replaces the secrets left out of logged configurations and request dumps
+	redactedValue = "<redacted>"
+)
+
+// ConfigOverride overrides configuration fields programmatically (e.g.: setting sinks, which cannot be configured
+// by a file or the environment)
+type ConfigOverride func(*Config)
+
+// LoadConfig loads the client configuration from its sources, each overriding the fields set by the previous ones:
+//  1. the given YAML or JSON file (by its extension, JSON unless .yaml or .yml), if the path is set
+//  2. the environment variables named by the JSON field names (e.g.: OPA_PERMISSION_QUERY_PATH for
+//     permissionQueryPath). List fields are comma separated, and structured fields are JSON encoded
+//  3. the given overrides, in order
+func LoadConfig(path string, overrides ...ConfigOverride) (*Config, error) {
+	config := &Config{}
+	if path != "" {
+		configContents, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(configContents, config); err != nil {
+			return nil, errors.Wrap(err, "Failed to unmarshal configuration file")
+		}
+	}
+
+	if err := overrideConfigFromEnv(config); err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration from the environment")
+	}
+
+	for _, override := range overrides {
+		override(config)
+	}
+	return config, nil
+}
+
+// Redacted returns a copy of the configuration with its secrets (override values and keys, signing key, bearer token
+// and OAuth2 client secret) redacted, as well as the passwords of its URLs. Secret references (e.g.: env://OPA_TOKEN)
+// are kept, as they aren't secret
+func (c Config) Redacted() Config {
+	secretResolvers := c.SecretResolvers
+	if secretResolvers == nil {
+		secretResolvers = DefaultSecretResolvers()
+	}
+	redactSecret := func(secret string) string {
+		if secret == "" || secretResolvers.IsReference(secret) {
+			return secret
+		}
+		return redactedValue
+	}
+	redactSecrets := func(secrets []string) []string {
+		if secrets == nil {
+			return nil
+		}
+		redactedSecrets := make([]string, 0, len(secrets))
+		for _, secret := range secrets {
+			redactedSecrets = append(redactedSecrets, redactSecret(secret))
+		}
+		return redactedSecrets
+	}
+
+	c.OverrideHeaderValue = redactSecret(c.OverrideHeaderValue)
+	c.OverrideHeaderValues = redactSecrets(c.OverrideHeaderValues)
+	c.OverrideTokenKeys = redactSecrets(c.OverrideTokenKeys)
+	c.RequestSigningKey = redactSecret(c.RequestSigningKey)
+	c.BearerToken = redactSecret(c.BearerToken)
+	c.OAuth2ClientSecret = redactSecret(c.OAuth2ClientSecret)
+	c.Address = redactURLPassword(c.Address)
+	c.ShadowAddress = redactURLPassword(c.ShadowAddress)
+	c.StatsdAddress = redactURLPassword(c.StatsdAddress)
+	c.OAuth2TokenURL = redactURLPassword(c.OAuth2TokenURL)
+	c.DecisionLogCollectorURL = redactURLPassword(c.DecisionLogCollectorURL)
+
+	// the slices and maps are copied, leaving the given configuration untouched
+	if c.SidecarAddresses != nil {
+		sidecarAddresses := make([]string, 0, len(c.SidecarAddresses))
+		for _, sidecarAddress := range c.SidecarAddresses {
+			sidecarAddresses = append(sidecarAddresses, redactURLPassword(sidecarAddress))
+		}
+		c.SidecarAddresses = sidecarAddresses
+	}
+	if c.Routes != nil {
+		routes := make([]Route, 0, len(c.Routes))
+		for _, route := range c.Routes {
+			route.Address = redactURLPassword(route.Address)
+			routes = append(routes, route)
+		}
+		c.Routes = routes
+	}
+	if c.EndpointTLS != nil {
+		endpointTLS := make(map[string]*EndpointTLSConfig, len(c.EndpointTLS))
+		for address, endpointTLSConfig := range c.EndpointTLS {
+			endpointTLS[redactURLPassword(address)] = endpointTLSConfig
+		}
+		c.EndpointTLS = endpointTLS
+	}
+	return c
+}
+
+// String returns the redacted configuration (see Redacted), as JSON, so logging the configuration doesn't leak secrets
+func (c Config) String() string {
+	encodedConfig, err := c.MarshalJSON()
+	if err != nil {
+		return "<invalid configuration: " + err.Error() + ">"
+	}
+	return string(encodedConfig)
+}
+
+// MarshalJSON marshals the redacted configuration (see Redacted)
+func (c Config) MarshalJSON() ([]byte, error) {
+
+	// the plain type doesn't marshal itself, avoiding the recursion
+	type plainConfig Config
+	return json.Marshal(plainConfig(c.Redacted()))
+}
+
+// redactURLPassword returns the URL with its password (if any) redacted (see url.URL.Redacted)
+func redactURLPassword(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || parsedURL.User == nil {
+		return rawURL
+	}
+	if _, hasPassword := parsedURL.User.Password(); !hasPassword {
+		return rawURL
+	}
+	return parsedURL.Redacted()
+}
+
+// readConfigFile reads the given YAML or JSON configuration file (by its extension), as JSON
+func readConfigFile(path string) ([]byte, error) {
+	configContents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read configuration file")
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+
+		// YAML files are converted to JSON, so their fields are named by the JSON field names
+		var configDocument any
+		if err := yaml.Unmarshal(configContents, &configDocument); err != nil {
+			return nil, errors.Wrap(err, "Failed to unmarshal configuration file")
+		}
+		if configContents, err = json.Marshal(configDocument); err != nil {
+			return nil, errors.Wrap(err, "Failed to convert configuration file to JSON")
+		}
+	}
+	return configContents, nil
+}
+
+// overrideConfigFromEnv sets the scalar and list configuration fields from their environment variables,
+// named by their JSON names (e.g.: OPA_PERMISSION_QUERY_PATH for permissionQueryPath)
+func overrideConfigFromEnv(config *Config) error {
+	configValue := reflect.ValueOf(config).Elem()
+	configType := configValue.Type()
+	for fieldIndex := range configType.NumField() {
+		jsonName, _, _ := strings.Cut(configType.Field(fieldIndex).Tag.Get("json"), ",")
+		if jsonName == "" || jsonName == "-" {
+			continue
+		}
+
+		envName := ConfigEnvPrefix + envVarName(jsonName)
+		envValue, found := os.LookupEnv(envName)
+		if !found {
+			continue
+		}
+
+		if err := setFieldValue(configValue.Field(fieldIndex), envValue); err != nil {
+			return errors.Wrapf(err, "Failed to parse %s", envName)
+		}
+	}
+	return nil
+}
+
+func setFieldValue(fieldValue reflect.Value, value string) error {
+	if fieldValue.Kind() == reflect.Pointer {
+		pointedValue := reflect.New(fieldValue.Type().Elem())
+		if err := setFieldValue(pointedValue.Elem(), value); err != nil {
+			return err
+		}
+		fieldValue.Set(pointedValue)
+		return nil
+	}
+
+	switch fieldValue.Kind() {
+	case reflect.String:
+		fieldValue.SetString(value)
+	case reflect.Bool:
+		parsedValue, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fieldValue.SetBool(parsedValue)
+	case reflect.Int:
+		parsedValue, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		fieldValue.SetInt(int64(parsedValue))
+	case reflect.Float64:
+		parsedValue, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		fieldValue.SetFloat(parsedValue)
+	case reflect.Slice:
+		if fieldValue.Type().Elem().Kind() != reflect.String {
+			return errors.New("Unsupported list type")
+		}
+		fieldValue.Set(reflect.ValueOf(splitList(value)))
+	default:
+
+		// structured fields (e.g.: fallbackPolicy) are JSON encoded
+		if err := json.Unmarshal([]byte(value), fieldValue.Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envVarName converts a JSON field name to an environment variable name (e.g.: tlsCAFile to TLS_CA_FILE)
+func envVarName(jsonName string) string {
+	runes := []rune(jsonName)
+	var envName strings.Builder
+	for runeIndex, currentRune := range runes {
+		if runeIndex > 0 && unicode.IsUpper(currentRune) {
+			previousRune := runes[runeIndex-1]
+			nextIsLower := runeIndex+1 < len(runes) && unicode.IsLower(runes[runeIndex+1])
+			if !unicode.IsUpper(previousRune) || nextIsLower {
+				envName.WriteRune('_')
+			}
+		}
+		envName.WriteRune(unicode.ToUpper(currentRune))
+	}
+	return envName.String()
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
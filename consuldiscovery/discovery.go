@@ -0,0 +1,256 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package consuldiscovery discovers the OPA servers registered as a Consul service, by watching its healthy
+// instances (using blocking queries), so the client balances queries between them as OPA instances come and go.
+package consuldiscovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	opaclient "github.com/nuclio/opa-client"
+)
+
+const (
+	DefaultAddress = "http://127.0.0.1:8500"
+
+	// DefaultRetryInterval is the period to wait before re-watching, once watching failed
+	DefaultRetryInterval = 5 * time.Second
+
+	// DefaultWaitTime is the max duration of a blocking query, after which it is re-issued
+	DefaultWaitTime = 5 * time.Minute
+)
+
+type Config struct {
+
+	// Consul agent address and ACL token (default to CONSUL_HTTP_ADDR and CONSUL_HTTP_TOKEN, and to the local agent)
+	Address string
+	Token   string
+
+	// name of the OPA service, and the tag (if any) and datacenter (defaults to the agent's) of its instances
+	ServiceName string
+	Tag         string
+	Datacenter  string
+
+	// scheme of the discovered addresses (defaults to http)
+	Scheme string
+
+	// HTTP client to query Consul by (blocking queries are long-lived, so it must not time out before the wait time)
+	HTTPClient *http.Client
+
+	// period to wait before re-watching once watching failed, and the max duration of a blocking query
+	RetryInterval time.Duration
+	WaitTime      time.Duration
+}
+
+// Discovery watches the healthy instances of the OPA service, and provides their addresses.
+// It implements opaclient.EndpointProvider
+type Discovery struct {
+	logger logger.Logger
+	config Config
+
+	lock      sync.RWMutex
+	endpoints []string
+}
+
+func NewDiscovery(parentLogger logger.Logger, config Config) (*Discovery, error) {
+	if config.ServiceName == "" {
+		return nil, errors.New("Service name must be set")
+	}
+	if config.Address == "" {
+		config.Address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if config.Address == "" {
+		config.Address = DefaultAddress
+	}
+	if !strings.Contains(config.Address, "://") {
+		config.Address = "http://" + config.Address
+	}
+	if config.Token == "" {
+		config.Token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	if config.Scheme == "" {
+		config.Scheme = "http"
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{}
+	}
+	if config.RetryInterval == 0 {
+		config.RetryInterval = DefaultRetryInterval
+	}
+	if config.WaitTime == 0 {
+		config.WaitTime = DefaultWaitTime
+	}
+	if parentLogger == nil {
+		parentLogger = opaclient.NopLogger{}
+	}
+
+	return &Discovery{
+		logger: parentLogger.GetChild("opa-consul-discovery"),
+		config: config,
+	}, nil
+}
+
+// Start lists the healthy instances of the service, and keeps watching them in the background until the context
+// is done
+func (d *Discovery) Start(ctx context.Context) error {
+	index, err := d.query(ctx, 0)
+	if err != nil {
+		return errors.Wrap(err, "Failed to query service instances")
+	}
+
+	go d.watch(ctx, index)
+	return nil
+}
+
+// Endpoints returns the addresses of the healthy instances of the service
+func (d *Discovery) Endpoints() []string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return d.endpoints
+}
+
+// watch keeps re-issuing blocking queries, which return once the instances change (or the wait time elapses)
+func (d *Discovery) watch(ctx context.Context, index uint64) {
+	for {
+		nextIndex, err := d.query(ctx, index)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			d.logger.WarnWithCtx(ctx, "Failed to watch service instances, retrying",
+				"service", d.config.ServiceName,
+				"err", err.Error())
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.config.RetryInterval):
+			}
+			continue
+		}
+
+		// the index may go backwards (e.g.: once the Consul servers restored a snapshot), requiring a reset
+		if nextIndex < index {
+			nextIndex = 0
+		}
+		index = nextIndex
+	}
+}
+
+// query queries the healthy instances of the service, blocking until their index is past the given one (unless 0),
+// and returns their index
+func (d *Discovery) query(ctx context.Context, index uint64) (uint64, error) {
+	query := url.Values{
+		"passing": []string{"true"},
+	}
+	if d.config.Tag != "" {
+		query.Set("tag", d.config.Tag)
+	}
+	if d.config.Datacenter != "" {
+		query.Set("dc", d.config.Datacenter)
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", fmt.Sprintf("%ds", int(d.config.WaitTime.Seconds())))
+	}
+	requestURL := fmt.Sprintf("%s/v1/health/service/%s?%s",
+		strings.TrimSuffix(d.config.Address, "/"),
+		url.PathEscape(d.config.ServiceName),
+		query.Encode())
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to create request")
+	}
+	if d.config.Token != "" {
+		request.Header.Set("X-Consul-Token", d.config.Token)
+	}
+
+	response, err := d.config.HTTPClient.Do(request)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to send request to Consul")
+	}
+	defer response.Body.Close() // nolint: errcheck
+	if response.StatusCode != http.StatusOK {
+		return 0, errors.Errorf("Received unexpected status code from Consul: %d", response.StatusCode)
+	}
+
+	var serviceEntries []serviceEntry
+	if err := json.NewDecoder(response.Body).Decode(&serviceEntries); err != nil {
+		return 0, errors.Wrap(err, "Failed to decode service instances")
+	}
+	nextIndex, err := strconv.ParseUint(response.Header.Get("X-Consul-Index"), 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(err, "Failed to parse Consul index")
+	}
+
+	d.updateEndpoints(ctx, serviceEntries)
+	return nextIndex, nil
+}
+
+// updateEndpoints sets the endpoints to the addresses of the given service instances
+func (d *Discovery) updateEndpoints(ctx context.Context, serviceEntries []serviceEntry) {
+	endpoints := make([]string, 0, len(serviceEntries))
+	for _, serviceEntry := range serviceEntries {
+
+		// instances registered without an address are reached by their node address
+		address := serviceEntry.Service.Address
+		if address == "" {
+			address = serviceEntry.Node.Address
+		}
+		endpoints = append(endpoints,
+			fmt.Sprintf("%s://%s", d.config.Scheme, net.JoinHostPort(address, strconv.Itoa(serviceEntry.Service.Port))))
+	}
+	slices.Sort(endpoints)
+	endpoints = slices.Compact(endpoints)
+
+	d.lock.Lock()
+	changed := !slices.Equal(endpoints, d.endpoints)
+	d.endpoints = endpoints
+	d.lock.Unlock()
+
+	if changed {
+		d.logger.InfoWithCtx(ctx, "Updated OPA endpoints",
+			"service", d.config.ServiceName,
+			"endpoints", endpoints)
+	}
+}
+
+// the subset of a Consul health service entry used for discovery
+type serviceEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+}
@@ -0,0 +1,120 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package consuldiscovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	nucliozap "github.com/nuclio/zap"
+	"github.com/stretchr/testify/suite"
+)
+
+type DiscoveryTestSuite struct {
+	suite.Suite
+	ctx            context.Context
+	cancel         context.CancelFunc
+	consulServer   *httptest.Server
+	watchIndexes   chan string
+	serviceUpdates chan string
+	discovery      *Discovery
+}
+
+func (suite *DiscoveryTestSuite) SetupTest() {
+	loggerInstance, err := nucliozap.NewNuclioZapTest("consul-discovery-test")
+	suite.Require().NoError(err)
+
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.watchIndexes = make(chan string, 10)
+	suite.serviceUpdates = make(chan string, 10)
+	index := 1
+	suite.consulServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.Require().Equal("/v1/health/service/opa", r.URL.Path)
+		suite.Require().Equal("true", r.URL.Query().Get("passing"))
+		suite.Require().Equal("authz", r.URL.Query().Get("tag"))
+		suite.Require().Equal("consul-token", r.Header.Get("X-Consul-Token"))
+
+		serviceEntries := testServiceEntries("10.0.0.1")
+		if r.URL.Query().Get("index") != "" {
+			suite.watchIndexes <- r.URL.Query().Get("index")
+
+			// block until the instances change
+			select {
+			case <-r.Context().Done():
+				return
+			case serviceEntries = <-suite.serviceUpdates:
+				index++
+			}
+		}
+		w.Header().Set("X-Consul-Index", fmt.Sprint(index))
+		_, err := w.Write([]byte(serviceEntries))
+		suite.Require().NoError(err)
+	}))
+
+	suite.discovery, err = NewDiscovery(loggerInstance, Config{
+		Address:     suite.consulServer.URL,
+		Token:       "consul-token",
+		ServiceName: "opa",
+		Tag:         "authz",
+		HTTPClient:  suite.consulServer.Client(),
+	})
+	suite.Require().NoError(err)
+}
+
+func (suite *DiscoveryTestSuite) TearDownTest() {
+	suite.cancel()
+	suite.consulServer.Close()
+}
+
+func (suite *DiscoveryTestSuite) TestWatch() {
+	err := suite.discovery.Start(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"http://10.0.0.1:8181"}, suite.discovery.Endpoints())
+	suite.Require().Equal("1", <-suite.watchIndexes)
+
+	// an instance registered without an address is reached by its node address
+	suite.serviceUpdates <- testServiceEntries("10.0.0.1", "")
+	suite.Require().Equal("2", <-suite.watchIndexes)
+	suite.Require().Equal([]string{"http://10.0.0.1:8181", "http://10.1.0.2:8181"}, suite.discovery.Endpoints())
+
+	// an instance deregistered (or failing its health checks)
+	suite.serviceUpdates <- testServiceEntries("")
+	suite.Require().Equal("3", <-suite.watchIndexes)
+	suite.Require().Equal([]string{"http://10.1.0.1:8181"}, suite.discovery.Endpoints())
+}
+
+// testServiceEntries returns the health entries of service instances with the given addresses (on nodes 10.1.0.x)
+func testServiceEntries(serviceAddresses ...string) string {
+	serviceEntries := make([]string, 0, len(serviceAddresses))
+	for serviceIdx, serviceAddress := range serviceAddresses {
+		serviceEntries = append(serviceEntries, fmt.Sprintf(`{
+			"Node": {"Node": "node-%d", "Address": "10.1.0.%d"},
+			"Service": {"ID": "opa-%d", "Service": "opa", "Address": %q, "Port": 8181}
+		}`, serviceIdx+1, serviceIdx+1, serviceIdx+1, serviceAddress))
+	}
+	return "[" + strings.Join(serviceEntries, ",") + "]"
+}
+
+func TestDiscoveryTestSuite(t *testing.T) {
+	suite.Run(t, new(DiscoveryTestSuite))
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import "sync/atomic"
+
+// DebugState is a snapshot of the client internal state, free of secrets, to be exposed under debug endpoints
+// (e.g.: expvar.Publish("opa", expvar.Func(func() any { return client.DebugState() })))
+type DebugState struct {
+	ClientKind            ClientKind        `json:"clientKind"`
+	Address               string            `json:"address,omitempty"`
+	Endpoints             []string          `json:"endpoints,omitempty"`
+	PermissionQueryPath   string            `json:"permissionQueryPath,omitempty"`
+	PermissionFilterPath  string            `json:"permissionFilterPath,omitempty"`
+	ResourceActionsPath   string            `json:"resourceActionsPath,omitempty"`
+	RequestTimeout        string            `json:"requestTimeout,omitempty"`
+	EnforcementMode       EnforcementMode   `json:"enforcementMode,omitempty"`
+	ResourceScope         string            `json:"resourceScope,omitempty"`
+	ShadowAddress         string            `json:"shadowAddress,omitempty"`
+	CanaryQueryPath       string            `json:"canaryQueryPath,omitempty"`
+	CanaryPercentage      float64           `json:"canaryPercentage,omitempty"`
+	OverrideEnabled       bool              `json:"overrideEnabled"`
+	Authenticated         bool              `json:"authenticated"`
+	CacheEnabled          bool              `json:"cacheEnabled"`
+	CacheTTL              string            `json:"cacheTTL,omitempty"`
+	CacheActionTTLs       map[Action]string `json:"cacheActionTTLs,omitempty"`
+	PolicyRevision        string            `json:"policyRevision,omitempty"`
+	HealthState           HealthState       `json:"healthState,omitempty"`
+	CacheStats            CacheStats        `json:"cacheStats"`
+	QueryStats            QueryStats        `json:"queryStats"`
+	MaxConcurrentRequests int               `json:"maxConcurrentRequests,omitempty"`
+	InFlightRequests      int               `json:"inFlightRequests,omitempty"`
+}
+
+// QueryStats counts the queries sent to OPA
+type QueryStats struct {
+	Queries  int64 `json:"queries"`
+	Failures int64 `json:"failures"`
+	Retries  int64 `json:"retries"`
+}
+
+// queryCounters counts the queries a client sent to OPA
+type queryCounters struct {
+	queries  atomic.Int64
+	failures atomic.Int64
+	retries  atomic.Int64
+}
+
+// DebugState returns a snapshot of the client internal state (configuration summary, cache and query statistics)
+func (c *HTTPClient) DebugState() DebugState {
+	acceptedOverrideValues, overrideTokenKeys := c.acceptedOverrides()
+	debugState := DebugState{
+		ClientKind:           ClientKindHTTP,
+		Address:              c.address,
+		PermissionQueryPath:  c.permissionQueryPath,
+		PermissionFilterPath: c.permissionFilterPath,
+		ResourceActionsPath:  c.permissionResourceActionsPath,
+		RequestTimeout:       c.httpClient.Timeout.String(),
+		EnforcementMode:      c.enforcementMode,
+		ResourceScope:        c.resourceScope,
+		OverrideEnabled:      len(acceptedOverrideValues) > 0 || len(overrideTokenKeys) > 0,
+		Authenticated:        c.tokenSource != nil,
+		CacheEnabled:         c.decisionCache != nil,
+		CacheStats:           c.CacheStats(),
+		PolicyRevision:       c.policyRevision.get(),
+		QueryStats: QueryStats{
+			Queries:  c.queryCounters.queries.Load(),
+			Failures: c.queryCounters.failures.Load(),
+			Retries:  c.queryCounters.retries.Load(),
+		},
+	}
+	if c.requestSlots != nil {
+		debugState.MaxConcurrentRequests = c.requestSlots.capacity
+		debugState.InFlightRequests = c.requestSlots.inUse()
+	}
+	if c.healthProber != nil {
+		debugState.HealthState = c.healthProber.get().State
+	}
+	if c.endpointProvider != nil {
+		debugState.Endpoints = c.endpointProvider.Endpoints()
+	}
+	if c.decisionCache != nil {
+		debugState.CacheTTL = c.cacheTTL.String()
+		if len(c.cacheActionTTLs) > 0 {
+			debugState.CacheActionTTLs = map[Action]string{}
+			for action, cacheActionTTL := range c.cacheActionTTLs {
+				debugState.CacheActionTTLs[action] = cacheActionTTL.String()
+			}
+		}
+	}
+	if c.shadowClient != nil {
+		debugState.ShadowAddress = c.shadowClient.address
+	}
+	if c.canary != nil {
+		debugState.CanaryQueryPath = c.canary.client.permissionQueryPath
+		debugState.CanaryPercentage = c.canary.percentage
+	}
+	return debugState
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const (
+
+	// DecisionIDHeader is the request header the decision id is sent to OPA in
+	DecisionIDHeader = "X-Decision-ID"
+
+	// DecisionIDInputField is the query input field the decision id is sent to OPA in, for policies to echo into
+	// their decision logs
+	DecisionIDInputField = "decision_id"
+)
+
+type decisionIDContextKey struct{}
+
+// ContextWithDecisionID returns a context whose queries are sent to OPA with the given decision id, rather than
+// a generated one (see WithDecisionIDs) - e.g.: to correlate them with the request id of the application logs
+func ContextWithDecisionID(ctx context.Context, decisionID string) context.Context {
+	return context.WithValue(ctx, decisionIDContextKey{}, decisionID)
+}
+
+// DecisionIDFromContext returns the decision id carried by the given context, if any
+func DecisionIDFromContext(ctx context.Context) string {
+	decisionID, _ := ctx.Value(decisionIDContextKey{}).(string)
+	return decisionID
+}
+
+func newDecisionID() string {
+	decisionID := make([]byte, 16)
+	_, _ = rand.Read(decisionID)
+	return hex.EncodeToString(decisionID)
+}
+
+// queryExtraInput returns the extra input fields of a query - those of the permission options, along with the
+// decision id (if any). The decision id is left out of the permission options, as they key the decision cache
+func queryExtraInput(ctx context.Context, permissionOptions *PermissionOptions) map[string]any {
+	decisionID := DecisionIDFromContext(ctx)
+	if decisionID == "" {
+		return permissionOptions.ExtraInput
+	}
+
+	extraInput := make(map[string]any, len(permissionOptions.ExtraInput)+1)
+	for fieldName, fieldValue := range permissionOptions.ExtraInput {
+		extraInput[fieldName] = fieldValue
+	}
+	extraInput[DecisionIDInputField] = decisionID
+	return extraInput
+}
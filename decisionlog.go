@@ -0,0 +1,383 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+// DecisionRecord describes a single permission decision
+type DecisionRecord struct {
+	Timestamp   time.Time   `json:"timestamp"`
+	Resource    string      `json:"resource"`
+	Action      Action      `json:"action"`
+	MemberIds   []string    `json:"memberIds,omitempty"`
+	Subject     *Subject    `json:"subject,omitempty"`
+	Allowed     bool        `json:"allowed"`
+	Reason      string      `json:"reason,omitempty"`
+	Obligations Obligations `json:"obligations,omitempty"`
+	Cached      bool        `json:"cached,omitempty"`
+	Provenance  *Provenance `json:"provenance,omitempty"`
+	DecisionID  string      `json:"decisionId,omitempty"`
+	Stale       bool        `json:"stale,omitempty"`
+	Fallback    bool        `json:"fallback,omitempty"`
+	Monitored   bool        `json:"monitored,omitempty"`
+	Error       string      `json:"error,omitempty"`
+
+	// Overridden is set for decisions allowed by the override, along with the override token issuer (if any).
+	// These records are always recorded, regardless of verbosity (see BufferedDecisionLogSink for when they're
+	// dropped)
+	Overridden     bool   `json:"overridden,omitempty"`
+	OverrideIssuer string `json:"overrideIssuer,omitempty"`
+}
+
+// newDecisionRecord returns the record of the decision, timestamped by the client clock
+func newDecisionRecord(clock Clock, decision *Decision, permissionOptions *PermissionOptions, err error) DecisionRecord {
+	decisionRecord := DecisionRecord{
+		Timestamp:   clock.Now(),
+		Resource:    decision.Resource,
+		Action:      decision.Action,
+		MemberIds:   permissionOptions.memberIds(),
+		Subject:     permissionOptions.Subject,
+		Allowed:     decision.Allowed,
+		Reason:      decision.Reason,
+		Obligations: decision.Obligations,
+		Cached:      decision.Cached,
+		Provenance:  decision.Provenance,
+		DecisionID:  decision.DecisionID,
+		Stale:       decision.Stale,
+		Fallback:    decision.Fallback,
+		Overridden:  decision.Overridden,
+	}
+	if err != nil {
+		decisionRecord.Error = err.Error()
+	}
+	return decisionRecord
+}
+
+// DecisionLogSink receives the decision records of the client
+type DecisionLogSink interface {
+
+	// WriteDecisions writes a batch of decision records
+	WriteDecisions(ctx context.Context, records []DecisionRecord) error
+
+	// Close flushes and releases the sink resources
+	Close() error
+}
+
+// BufferedDecisionLogSink queues decision records in a bounded queue and writes them in batches to the
+// underlying sink from a background goroutine, so decision logging never blocks the request path.
+// Records are dropped (and counted) when the queue is full or the sink is closed. Dropped overridden records are
+// counted separately, and logged right away, so bypassed authorization is never dropped unnoticed
+type BufferedDecisionLogSink struct {
+	logger                   logger.Logger
+	sink                     DecisionLogSink
+	queue                    chan DecisionRecord
+	batchSize                int
+	flushInterval            time.Duration
+	dropped                  atomic.Int64
+	droppedOverrides         atomic.Int64
+	reportedDropped          int64
+	reportedDroppedOverrides int64
+	closedLock               sync.RWMutex
+	closed                   bool
+	closeOnce                sync.Once
+	stopChan                 chan struct{}
+	doneChan                 chan struct{}
+}
+
+func NewBufferedDecisionLogSink(parentLogger logger.Logger,
+	sink DecisionLogSink,
+	queueSize int,
+	batchSize int,
+	flushInterval time.Duration) *BufferedDecisionLogSink {
+
+	if queueSize <= 0 {
+		queueSize = DefaultDecisionLogQueueSize
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultDecisionLogBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultDecisionLogFlushInterval
+	}
+
+	newSink := BufferedDecisionLogSink{
+		logger:        childLogger(parentLogger, "opa-decision-log"),
+		sink:          sink,
+		queue:         make(chan DecisionRecord, queueSize),
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		stopChan:      make(chan struct{}),
+		doneChan:      make(chan struct{}),
+	}
+
+	go newSink.run()
+
+	return &newSink
+}
+
+// WriteDecisions queues the decision records without blocking
+func (s *BufferedDecisionLogSink) WriteDecisions(ctx context.Context, records []DecisionRecord) error {
+
+	// writers hold the lock while queueing (which never blocks), so once closed, none queues after the drain
+	s.closedLock.RLock()
+	defer s.closedLock.RUnlock()
+
+	if s.closed {
+		for _, record := range records {
+			s.drop(record)
+		}
+		return errors.New("Decision log sink is closed")
+	}
+
+	for _, record := range records {
+		select {
+		case s.queue <- record:
+		default:
+			s.drop(record)
+		}
+	}
+	return nil
+}
+
+// Close flushes the queued decision records and closes the underlying sink
+func (s *BufferedDecisionLogSink) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.closedLock.Lock()
+		s.closed = true
+		s.closedLock.Unlock()
+
+		close(s.stopChan)
+		<-s.doneChan
+		err = s.sink.Close()
+	})
+	return err
+}
+
+// Dropped returns the number of decision records dropped since the queue was full or the sink closed
+// (overridden records included)
+func (s *BufferedDecisionLogSink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// DroppedOverrides returns the number of overridden decision records dropped
+func (s *BufferedDecisionLogSink) DroppedOverrides() int64 {
+	return s.droppedOverrides.Load()
+}
+
+// drop counts the dropped record. An overridden record is logged, as the audit trail of the bypassed authorization
+func (s *BufferedDecisionLogSink) drop(record DecisionRecord) {
+	s.dropped.Add(1)
+	if !record.Overridden {
+		return
+	}
+
+	s.droppedOverrides.Add(1)
+	s.logger.WarnWith("Dropped overridden decision record",
+		"resource", record.Resource,
+		"action", record.Action,
+		"memberIds", record.MemberIds,
+		"overrideIssuer", record.OverrideIssuer)
+}
+
+func (s *BufferedDecisionLogSink) run() {
+	defer close(s.doneChan)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]DecisionRecord, 0, s.batchSize)
+	for {
+		select {
+		case record := <-s.queue:
+			batch = append(batch, record)
+			if len(batch) >= s.batchSize {
+				batch = s.flush(batch)
+			}
+
+		case <-ticker.C:
+			batch = s.flush(batch)
+
+		case <-s.stopChan:
+
+			// drain the queue before returning
+			for {
+				select {
+				case record := <-s.queue:
+					batch = append(batch, record)
+					if len(batch) >= s.batchSize {
+						batch = s.flush(batch)
+					}
+				default:
+					s.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes the batch to the underlying sink, and returns a new batch to fill
+func (s *BufferedDecisionLogSink) flush(batch []DecisionRecord) []DecisionRecord {
+	if dropped := s.dropped.Load(); dropped > s.reportedDropped {
+		s.logger.WarnWith("Dropped decision records, queue is full",
+			"dropped", dropped-s.reportedDropped)
+		s.reportedDropped = dropped
+	}
+	if droppedOverrides := s.droppedOverrides.Load(); droppedOverrides > s.reportedDroppedOverrides {
+		s.logger.WarnWith("Dropped overridden decision records",
+			"dropped", droppedOverrides-s.reportedDroppedOverrides)
+		s.reportedDroppedOverrides = droppedOverrides
+	}
+
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := s.sink.WriteDecisions(context.Background(), batch); err != nil {
+		s.logger.WarnWith("Failed to write decision records",
+			"records", len(batch),
+			"err", err.Error())
+	}
+	return make([]DecisionRecord, 0, s.batchSize)
+}
+
+// FileDecisionLogSink writes decision records as JSON lines to a local file,
+// rotating it once it reaches its maximum size
+type FileDecisionLogSink struct {
+	lock       sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// NewFileDecisionLogSink creates a file decision log sink.
+// Once the file exceeds maxSize bytes, it is rotated to <path>.1 (shifting older backups), keeping up to maxBackups
+func NewFileDecisionLogSink(path string, maxSize int64, maxBackups int) (*FileDecisionLogSink, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultDecisionLogMaxSize
+	}
+
+	newSink := FileDecisionLogSink{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := newSink.openFile(); err != nil {
+		return nil, err
+	}
+	return &newSink, nil
+}
+
+func (s *FileDecisionLogSink) WriteDecisions(ctx context.Context, records []DecisionRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return errors.New("Decision log file is closed")
+	}
+
+	for _, record := range records {
+		encodedRecord, err := json.Marshal(record)
+		if err != nil {
+			return errors.Wrap(err, "Failed to encode decision record")
+		}
+		encodedRecord = append(encodedRecord, '\n')
+
+		if s.size > 0 && s.size+int64(len(encodedRecord)) > s.maxSize {
+			if err := s.rotate(); err != nil {
+				return errors.Wrap(err, "Failed to rotate decision log file")
+			}
+		}
+
+		written, err := s.file.Write(encodedRecord)
+		s.size += int64(written)
+		if err != nil {
+			return errors.Wrap(err, "Failed to write decision record")
+		}
+	}
+	return nil
+}
+
+func (s *FileDecisionLogSink) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *FileDecisionLogSink) openFile() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "Failed to open decision log file")
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close() // nolint: errcheck
+		return errors.Wrap(err, "Failed to stat decision log file")
+	}
+
+	s.file = file
+	s.size = fileInfo.Size()
+	return nil
+}
+
+// rotate shifts the backups (<path>.1 -> <path>.2, ...), moves the current file to <path>.1 and reopens it
+func (s *FileDecisionLogSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return errors.Wrap(err, "Failed to close decision log file")
+	}
+	s.file = nil
+
+	if s.maxBackups > 0 {
+		for backupIdx := s.maxBackups - 1; backupIdx > 0; backupIdx-- {
+			backupPath := fmt.Sprintf("%s.%d", s.path, backupIdx)
+			if _, err := os.Stat(backupPath); err == nil {
+				if err := os.Rename(backupPath, fmt.Sprintf("%s.%d", s.path, backupIdx+1)); err != nil {
+					return errors.Wrap(err, "Failed to shift decision log backup")
+				}
+			}
+		}
+		if err := os.Rename(s.path, s.path+".1"); err != nil {
+			return errors.Wrap(err, "Failed to back up decision log file")
+		}
+	} else if err := os.Remove(s.path); err != nil {
+		return errors.Wrap(err, "Failed to remove decision log file")
+	}
+
+	return s.openFile()
+}
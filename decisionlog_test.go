@@ -0,0 +1,267 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nuclio/logger"
+	nucliozap "github.com/nuclio/zap"
+	"github.com/stretchr/testify/suite"
+)
+
+type FileDecisionLogSinkTestSuite struct {
+	suite.Suite
+	ctx     context.Context
+	logPath string
+}
+
+func (suite *FileDecisionLogSinkTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.logPath = filepath.Join(suite.T().TempDir(), "decisions.log")
+}
+
+func (suite *FileDecisionLogSinkTestSuite) TestWriteDecisions() {
+	sink, err := NewFileDecisionLogSink(suite.logPath, 0, 0)
+	suite.Require().NoError(err)
+
+	err = sink.WriteDecisions(suite.ctx, []DecisionRecord{
+		{Timestamp: time.Now(), Resource: "/projects/p1", Action: ActionRead, Allowed: true},
+		{Timestamp: time.Now(), Resource: "/projects/p2", Action: ActionRead, Allowed: false},
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(sink.Close())
+
+	records := suite.readRecords(suite.logPath)
+	suite.Require().Len(records, 2)
+	suite.Require().Equal("/projects/p1", records[0].Resource)
+	suite.Require().True(records[0].Allowed)
+	suite.Require().Equal("/projects/p2", records[1].Resource)
+	suite.Require().False(records[1].Allowed)
+}
+
+func (suite *FileDecisionLogSinkTestSuite) TestRotation() {
+	record := DecisionRecord{Timestamp: time.Now(), Resource: "/projects/p1", Action: ActionRead, Allowed: true}
+	encodedRecord, err := json.Marshal(record)
+	suite.Require().NoError(err)
+
+	// room for two records per file
+	sink, err := NewFileDecisionLogSink(suite.logPath, int64(2*(len(encodedRecord)+1)), 2)
+	suite.Require().NoError(err)
+
+	for range 7 {
+		suite.Require().NoError(sink.WriteDecisions(suite.ctx, []DecisionRecord{record}))
+	}
+	suite.Require().NoError(sink.Close())
+
+	// 7 records: 1 in the current file, 2 in each backup, and the oldest 2 dropped
+	suite.Require().Len(suite.readRecords(suite.logPath), 1)
+	suite.Require().Len(suite.readRecords(suite.logPath+".1"), 2)
+	suite.Require().Len(suite.readRecords(suite.logPath+".2"), 2)
+	suite.Require().NoFileExists(suite.logPath + ".3")
+}
+
+func (suite *FileDecisionLogSinkTestSuite) TestBuffered() {
+	fileSink, err := NewFileDecisionLogSink(suite.logPath, 0, 0)
+	suite.Require().NoError(err)
+
+	loggerInstance, err := nucliozap.NewNuclioZapTest("opa-test")
+	suite.Require().NoError(err)
+
+	// a long flush interval, so records are written only once a batch is full or on close
+	sink := NewBufferedDecisionLogSink(loggerInstance, fileSink, 10, 3, time.Hour)
+	for range 4 {
+		err = sink.WriteDecisions(suite.ctx, []DecisionRecord{{Resource: "/projects/p1", Action: ActionRead}})
+		suite.Require().NoError(err)
+	}
+	suite.Require().Eventually(func() bool {
+		return len(suite.readRecords(suite.logPath)) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+
+	suite.Require().NoError(sink.Close())
+	suite.Require().Len(suite.readRecords(suite.logPath), 4)
+	suite.Require().Zero(sink.Dropped())
+
+	// closed sink drops records
+	suite.Require().Error(sink.WriteDecisions(suite.ctx, []DecisionRecord{{Resource: "/projects/p1"}}))
+	suite.Require().Equal(int64(1), sink.Dropped())
+}
+
+func (suite *FileDecisionLogSinkTestSuite) TestBufferedOverrides() {
+	loggerInstance, err := nucliozap.NewNuclioZapTest("opa-test")
+	suite.Require().NoError(err)
+
+	blockingSink := &blockingDecisionLogSink{
+		writing: make(chan struct{}, 1),
+		unblock: make(chan struct{}),
+	}
+	sink := NewBufferedDecisionLogSink(loggerInstance, blockingSink, 1, 1, time.Hour)
+
+	// the first record is being written, and the second fills the queue
+	err = sink.WriteDecisions(suite.ctx, []DecisionRecord{{Resource: "/projects/p1"}})
+	suite.Require().NoError(err)
+	<-blockingSink.writing
+	err = sink.WriteDecisions(suite.ctx, []DecisionRecord{{Resource: "/projects/p2"}})
+	suite.Require().NoError(err)
+
+	// an overridden record doesn't wait for the full queue either, but is counted separately
+	err = sink.WriteDecisions(suite.ctx, []DecisionRecord{
+		{Resource: "/projects/p3"},
+		{Resource: "/projects/p4", Overridden: true},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal(int64(2), sink.Dropped())
+	suite.Require().Equal(int64(1), sink.DroppedOverrides())
+
+	close(blockingSink.unblock)
+	suite.Require().NoError(sink.Close())
+	suite.Require().Len(blockingSink.records, 2)
+
+	// and so is one written to the closed sink
+	suite.Require().Error(sink.WriteDecisions(suite.ctx, []DecisionRecord{{Resource: "/projects/p5", Overridden: true}}))
+	suite.Require().Equal(int64(3), sink.Dropped())
+	suite.Require().Equal(int64(2), sink.DroppedOverrides())
+}
+
+func (suite *FileDecisionLogSinkTestSuite) TestBufferedConcurrentClose() {
+	loggerInstance, err := nucliozap.NewNuclioZapTest("opa-test")
+	suite.Require().NoError(err)
+
+	for range 20 {
+		testSink := &testDecisionLogSink{}
+		sink := NewBufferedDecisionLogSink(loggerInstance, testSink, 1000, 10, time.Hour)
+
+		// every record written while closing is either flushed or counted as dropped
+		var writersGroup sync.WaitGroup
+		for range 10 {
+			writersGroup.Add(1)
+			go func() {
+				defer writersGroup.Done()
+				for range 10 {
+					sink.WriteDecisions(suite.ctx, []DecisionRecord{{Resource: "/projects/p1"}}) // nolint: errcheck
+				}
+			}()
+		}
+		suite.Require().NoError(sink.Close())
+		writersGroup.Wait()
+
+		suite.Require().Equal(100, len(testSink.records)+int(sink.Dropped()))
+	}
+}
+
+func (suite *FileDecisionLogSinkTestSuite) readRecords(path string) []DecisionRecord {
+	file, err := os.Open(path)
+	suite.Require().NoError(err)
+	defer file.Close() // nolint: errcheck
+
+	var records []DecisionRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := DecisionRecord{}
+		suite.Require().NoError(json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+	suite.Require().NoError(scanner.Err())
+	return records
+}
+
+func TestFileDecisionLogSinkTestSuite(t *testing.T) {
+	suite.Run(t, new(FileDecisionLogSinkTestSuite))
+}
+
+type HTTPDecisionLogSinkTestSuite struct {
+	suite.Suite
+	logger         logger.Logger
+	ctx            context.Context
+	testHTTPServer *httptest.Server
+	requestsCount  atomic.Int64
+	batches        [][]DecisionRecord
+}
+
+func (suite *HTTPDecisionLogSinkTestSuite) SetupTest() {
+	var err error
+	suite.logger, err = nucliozap.NewNuclioZapTest("opa-test")
+	suite.Require().NoError(err)
+
+	suite.ctx = context.Background()
+	suite.testHTTPServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		// fail the first request, to be retried
+		if suite.requestsCount.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var batch []DecisionRecord
+		suite.Require().NoError(json.NewDecoder(r.Body).Decode(&batch))
+		suite.batches = append(suite.batches, batch)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+}
+
+func (suite *HTTPDecisionLogSinkTestSuite) TearDownTest() {
+	suite.testHTTPServer.Close()
+}
+
+func (suite *HTTPDecisionLogSinkTestSuite) TestWriteDecisions() {
+	sink := NewHTTPDecisionLogSink(suite.logger, suite.testHTTPServer.URL, nil, 2, 5*time.Second)
+
+	err := sink.WriteDecisions(suite.ctx, []DecisionRecord{
+		{Resource: "/projects/p1", Action: ActionRead, Allowed: true},
+		{Resource: "/projects/p2", Action: ActionRead, Allowed: true},
+		{Resource: "/projects/p3", Action: ActionRead, Allowed: false},
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(sink.Close())
+
+	suite.Require().Equal(int64(3), suite.requestsCount.Load())
+	suite.Require().Len(suite.batches, 2)
+	suite.Require().Len(suite.batches[0], 2)
+	suite.Require().Equal("/projects/p3", suite.batches[1][0].Resource)
+}
+
+func TestHTTPDecisionLogSinkTestSuite(t *testing.T) {
+	suite.Run(t, new(HTTPDecisionLogSinkTestSuite))
+}
+
+// blockingDecisionLogSink signals each write, and blocks it until unblocked
+type blockingDecisionLogSink struct {
+	testDecisionLogSink
+	writing chan struct{}
+	unblock chan struct{}
+}
+
+func (s *blockingDecisionLogSink) WriteDecisions(ctx context.Context, records []DecisionRecord) error {
+	select {
+	case s.writing <- struct{}{}:
+	default:
+	}
+	<-s.unblock
+	return s.testDecisionLogSink.WriteDecisions(ctx, records)
+}
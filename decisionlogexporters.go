@@ -0,0 +1,212 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+const (
+	DefaultDecisionLogBatchSize     = 500
+	DefaultDecisionLogRetryTimeout  = 10 * time.Second
+	DefaultDecisionLogQueueSize     = 10000
+	DefaultDecisionLogFlushInterval = 5 * time.Second
+)
+
+// HTTPDecisionLogSink posts decision records as JSON arrays to a generic HTTP collector,
+// in batches of up to batchSize records, retrying failed batches until retryTimeout is exceeded
+type HTTPDecisionLogSink struct {
+	logger       logger.Logger
+	url          string
+	headers      map[string]string
+	batchSize    int
+	retryTimeout time.Duration
+	httpClient   *http.Client
+}
+
+func NewHTTPDecisionLogSink(parentLogger logger.Logger,
+	url string,
+	headers map[string]string,
+	batchSize int,
+	retryTimeout time.Duration) *HTTPDecisionLogSink {
+
+	if batchSize <= 0 {
+		batchSize = DefaultDecisionLogBatchSize
+	}
+	if retryTimeout <= 0 {
+		retryTimeout = DefaultDecisionLogRetryTimeout
+	}
+
+	return &HTTPDecisionLogSink{
+		logger:       childLogger(parentLogger, "opa-decision-log"),
+		url:          url,
+		headers:      headers,
+		batchSize:    batchSize,
+		retryTimeout: retryTimeout,
+		httpClient: &http.Client{
+			Timeout: DefaultRequestTimeOut,
+		},
+	}
+}
+
+func (s *HTTPDecisionLogSink) WriteDecisions(ctx context.Context, records []DecisionRecord) error {
+	headers := map[string]string{
+		"Content-Type": "application/json",
+		"User-Agent":   UserAgent,
+	}
+	for headerKey, headerValue := range s.headers {
+		headers[headerKey] = headerValue
+	}
+
+	for batchStart := 0; batchStart < len(records); batchStart += s.batchSize {
+		batch := records[batchStart:min(batchStart+s.batchSize, len(records))]
+
+		requestBody, err := json.Marshal(batch)
+		if err != nil {
+			return errors.Wrap(err, "Failed to encode decision records")
+		}
+
+		if err := retryUntilSuccessful(ctx,
+			SystemClock{},
+			s.retryTimeout,
+			1*time.Second,
+			func() error {
+
+				// collectors may respond with any 2xx status code
+				_, resp, err := sendHTTPRequest(ctx,
+					s.httpClient,
+					http.MethodPost,
+					s.url,
+					requestBody,
+					headers,
+					[]*http.Cookie{},
+					0,
+					DefaultMaxResponseSize)
+				if err != nil {
+					return err
+				}
+				if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+					return errors.Errorf("Got unexpected response status code: %d", resp.StatusCode)
+				}
+				return nil
+			},
+			func(attempt int, err error, nextDelay time.Duration) {
+				s.logger.WarnWithCtx(ctx, "Failed to send decision records, retrying",
+					"attempt", attempt,
+					"err", err.Error())
+			},
+			nil); err != nil {
+			return errors.Wrapf(err, "Failed to send %d decision records", len(batch))
+		}
+	}
+	return nil
+}
+
+func (s *HTTPDecisionLogSink) Close() error {
+	s.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// KafkaProducer publishes messages to a Kafka topic. It is implemented by adapting the application's
+// Kafka client (e.g.: sarama, franz-go), so this package doesn't depend on a specific one
+type KafkaProducer interface {
+
+	// Produce publishes the given messages (keyed) to the topic
+	Produce(ctx context.Context, topic string, messages []KafkaMessage) error
+
+	// Close flushes and closes the producer
+	Close() error
+}
+
+type KafkaMessage struct {
+	Key   []byte
+	Value []byte
+}
+
+// KafkaDecisionLogSink publishes every decision record as a JSON message to a Kafka topic,
+// keyed by resource so decisions of the same resource are kept in order
+type KafkaDecisionLogSink struct {
+	producer KafkaProducer
+	topic    string
+}
+
+func NewKafkaDecisionLogSink(producer KafkaProducer, topic string) *KafkaDecisionLogSink {
+	return &KafkaDecisionLogSink{
+		producer: producer,
+		topic:    topic,
+	}
+}
+
+func (s *KafkaDecisionLogSink) WriteDecisions(ctx context.Context, records []DecisionRecord) error {
+	messages := make([]KafkaMessage, len(records))
+	for recordIdx, record := range records {
+		encodedRecord, err := json.Marshal(record)
+		if err != nil {
+			return errors.Wrap(err, "Failed to encode decision record")
+		}
+		messages[recordIdx] = KafkaMessage{
+			Key:   []byte(record.Resource),
+			Value: encodedRecord,
+		}
+	}
+
+	if err := s.producer.Produce(ctx, s.topic, messages); err != nil {
+		return errors.Wrapf(err, "Failed to publish decision records to topic %s", s.topic)
+	}
+	return nil
+}
+
+func (s *KafkaDecisionLogSink) Close() error {
+	return s.producer.Close()
+}
+
+// MultiDecisionLogSink writes the decision records to several sinks
+type MultiDecisionLogSink struct {
+	sinks []DecisionLogSink
+}
+
+func NewMultiDecisionLogSink(sinks ...DecisionLogSink) *MultiDecisionLogSink {
+	return &MultiDecisionLogSink{
+		sinks: sinks,
+	}
+}
+
+func (s *MultiDecisionLogSink) WriteDecisions(ctx context.Context, records []DecisionRecord) error {
+	var firstErr error
+	for _, sink := range s.sinks {
+		if err := sink.WriteDecisions(ctx, records); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (s *MultiDecisionLogSink) Close() error {
+	var firstErr error
+	for _, sink := range s.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
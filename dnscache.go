@@ -0,0 +1,127 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+)
+
+// CachingResolver caches host name resolutions for a TTL, and re-resolves a host once connecting to all of its
+// cached addresses failed (e.g.: OPA behind a headless service was redeployed, and its pod IPs changed)
+type CachingResolver struct {
+	ttl        time.Duration
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	lock    sync.Mutex
+	entries map[string]cachedAddresses
+}
+
+type cachedAddresses struct {
+	addresses []string
+	expiresAt time.Time
+}
+
+func NewCachingResolver(ttl time.Duration) *CachingResolver {
+	return &CachingResolver{
+		ttl:        ttl,
+		lookupHost: net.DefaultResolver.LookupHost,
+		entries:    map[string]cachedAddresses{},
+	}
+}
+
+// LookupHost returns the cached addresses of the given host, resolving it if not cached or expired
+func (r *CachingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	r.lock.Lock()
+	entry, found := r.entries[host]
+	r.lock.Unlock()
+	if found && time.Now().Before(entry.expiresAt) {
+		return entry.addresses, nil
+	}
+
+	addresses, err := r.lookupHost(ctx, host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to resolve %s", host)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.entries[host] = cachedAddresses{
+		addresses: addresses,
+		expiresAt: time.Now().Add(r.ttl),
+	}
+	return addresses, nil
+}
+
+// Invalidate drops the cached addresses of the given host, so it is re-resolved on next lookup
+func (r *CachingResolver) Invalidate(host string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.entries, host)
+}
+
+// DialContext returns a dial function (see http.Transport.DialContext) connecting through the given dialer to the
+// cached addresses. If connecting to all of them fails, the host is re-resolved and connecting is retried once
+func (r *CachingResolver) DialContext(dialer *net.Dialer) func(ctx context.Context,
+	network string,
+	address string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		connection, err := r.dialHost(ctx, dialer, network, host, port)
+		if err == nil {
+			return connection, nil
+		}
+
+		// the cached addresses may be outdated
+		r.Invalidate(host)
+		return r.dialHost(ctx, dialer, network, host, port)
+	}
+}
+
+func (r *CachingResolver) dialHost(ctx context.Context,
+	dialer *net.Dialer,
+	network string,
+	host string,
+	port string) (net.Conn, error) {
+	addresses, err := r.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialErr error
+	for _, address := range addresses {
+		connection, err := dialer.DialContext(ctx, network, net.JoinHostPort(address, port))
+		if err == nil {
+			return connection, nil
+		}
+		dialErr = err
+	}
+	if dialErr == nil {
+		dialErr = errors.Errorf("No addresses resolved for %s", host)
+	}
+	return nil, dialErr
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// redactedHeaders are the request headers whose values are left out of request dumps
+var redactedHeaders = []string{
+	"Authorization",
+	SignatureHeader,
+}
+
+type requestDumpContextKey struct{}
+
+// ContextWithRequestDump returns a context whose queries are dumped to the request dump writer
+// (see WithRequestDump)
+func ContextWithRequestDump(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestDumpContextKey{}, true)
+}
+
+// requestDumpFromContext returns true if the queries of the given context are to be dumped
+func requestDumpFromContext(ctx context.Context) bool {
+	dump, _ := ctx.Value(requestDumpContextKey{}).(bool)
+	return dump
+}
+
+// RequestDump is the fully rendered request sent to OPA along with its response, as dumped (see WithRequestDump)
+type RequestDump struct {
+	Time     time.Time           `json:"time"`
+	Attempt  int                 `json:"attempt"`
+	Duration string              `json:"duration"`
+	Request  RequestDumpRequest  `json:"request"`
+	Response RequestDumpResponse `json:"response"`
+}
+
+type RequestDumpRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    any               `json:"body,omitempty"`
+}
+
+type RequestDumpResponse struct {
+	StatusCode int               `json:"statusCode,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       any               `json:"body,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// requestDumper writes the dumps of requests to a writer, one at a time
+type requestDumper struct {
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+// dumpRequest writes the dump of an attempt to send a request to OPA, if the context asks for it
+func (c *HTTPClient) dumpRequest(ctx context.Context,
+	attempt int,
+	method string,
+	requestURL string,
+	headers map[string]string,
+	requestBody []byte,
+	response *http.Response,
+	responseBody []byte,
+	requestErr error,
+	duration time.Duration) {
+
+	if c.requestDumper == nil || !requestDumpFromContext(ctx) {
+		return
+	}
+
+	requestDump := RequestDump{
+		Time:     c.clock.Now(),
+		Attempt:  attempt,
+		Duration: duration.String(),
+		Request: RequestDumpRequest{
+			Method:  method,
+			URL:     requestURL,
+			Headers: redactHeaders(headers),
+		},
+	}
+	if len(requestBody) > 0 {
+		requestDump.Request.Body = c.dumpableBody(requestBody)
+	}
+	if response != nil {
+		responseHeaders := map[string]string{}
+		for headerKey := range response.Header {
+			responseHeaders[headerKey] = response.Header.Get(headerKey)
+		}
+		requestDump.Response.StatusCode = response.StatusCode
+		requestDump.Response.Headers = responseHeaders
+	}
+	if len(responseBody) > 0 {
+		requestDump.Response.Body = c.dumpableBody(responseBody)
+	}
+	if requestErr != nil {
+		requestDump.Response.Error = requestErr.Error()
+	}
+
+	encodedRequestDump, err := json.MarshalIndent(requestDump, "", "  ")
+	if err != nil {
+		c.logger.WarnWithCtx(ctx, "Failed to encode request dump", "err", err.Error())
+		return
+	}
+
+	c.requestDumper.lock.Lock()
+	defer c.requestDumper.lock.Unlock()
+	if _, err := c.requestDumper.writer.Write(append(encodedRequestDump, '\n')); err != nil {
+		c.logger.WarnWithCtx(ctx, "Failed to write request dump", "err", err.Error())
+	}
+}
+
+// dumpableBody returns the body as JSON, to be pretty printed, or as a loggable string if it isn't JSON
+func (c *HTTPClient) dumpableBody(body []byte) any {
+	if json.Valid(body) {
+		return json.RawMessage(body)
+	}
+	return c.loggableBody(body)
+}
+
+// redactHeaders returns a copy of the headers, with the values of secret ones redacted
+func redactHeaders(headers map[string]string) map[string]string {
+	redacted := make(map[string]string, len(headers))
+	for headerKey, headerValue := range headers {
+		redacted[headerKey] = headerValue
+		for _, redactedHeader := range redactedHeaders {
+			if http.CanonicalHeaderKey(headerKey) == http.CanonicalHeaderKey(redactedHeader) {
+				redacted[headerKey] = redactedValue
+			}
+		}
+	}
+	return redacted
+}
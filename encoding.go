@@ -0,0 +1,92 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/nuclio/errors"
+)
+
+// maxNestingDepth is the deepest nesting of arrays and maps decoded, so corrupt responses cannot exhaust the stack
+const maxNestingDepth = 1000
+
+// RequestEncoder encodes the query requests sent to OPA (or an OPA-compatible gateway), and decodes their responses.
+// OPA accepts JSON alone (see JSONEncoder), so other encodings are for gateways in front of it accepting them
+type RequestEncoder interface {
+
+	// ContentType returns the media type of the encoded requests (and expected responses)
+	ContentType() string
+
+	// Encode returns the encoding of the given value
+	Encode(value any) ([]byte, error)
+
+	// Decode decodes the given data into the value
+	Decode(data []byte, value any) error
+}
+
+// JSONEncoder encodes requests as JSON, which OPA accepts
+type JSONEncoder struct{}
+
+func (JSONEncoder) ContentType() string {
+	return "application/json"
+}
+
+func (JSONEncoder) Encode(value any) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONEncoder) Decode(data []byte, value any) error {
+	if err := validateJSON(data); err != nil {
+		return errors.Wrap(err, "Failed to decode json")
+	}
+	return json.Unmarshal(data, value)
+}
+
+// validateJSON rejects data which is not valid UTF-8 (which encoding/json would silently replace), or which is
+// nested deeper than maxNestingDepth
+func validateJSON(data []byte) error {
+	if !utf8.Valid(data) {
+		return errors.New("Invalid UTF-8 data")
+	}
+
+	depth := 0
+	inString, escaped := false, false
+	for _, dataByte := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch dataByte {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case dataByte == '"':
+			inString = true
+		case dataByte == '{' || dataByte == '[':
+			if depth++; depth > maxNestingDepth {
+				return errors.Errorf("Data is nested deeper than %d levels", maxNestingDepth)
+			}
+		case dataByte == '}' || dataByte == ']':
+			depth--
+		}
+	}
+	return nil
+}
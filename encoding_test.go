@@ -0,0 +1,141 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/stretchr/testify/suite"
+)
+
+type RequestEncoderTestSuite struct {
+	suite.Suite
+}
+
+func (suite *RequestEncoderTestSuite) TestRoundTrip() {
+	request := PermissionFilterRequest{
+		Input: PermissionFilterRequestInput{
+			Resources: []string{"/projects/p1", strings.Repeat("r", 300)},
+			Action:    string(ActionRead),
+			Ids:       []string{"user1"},
+			Extra:     map[string]any{"tenant": "t1"},
+		},
+	}
+	requestEncoder := JSONEncoder{}
+	encoded, err := requestEncoder.Encode(request)
+	suite.Require().NoError(err)
+
+	// extra input is merged
+	var decodedInput struct {
+		Input map[string]any `json:"input"`
+	}
+	suite.Require().NoError(requestEncoder.Decode(encoded, &decodedInput))
+	suite.Require().Equal("t1", decodedInput.Input["tenant"])
+
+	var decodedRequest PermissionFilterRequest
+	suite.Require().NoError(requestEncoder.Decode(encoded, &decodedRequest))
+	suite.Require().Equal(request.Input.Resources, decodedRequest.Input.Resources)
+	suite.Require().Equal(request.Input.Ids, decodedRequest.Input.Ids)
+
+	// rich results are parsed
+	encoded, err = requestEncoder.Encode(map[string]any{
+		"result": map[string]any{"allow": false, "reason": "not a member"},
+	})
+	suite.Require().NoError(err)
+	var response PermissionQueryResponse
+	suite.Require().NoError(requestEncoder.Decode(encoded, &response))
+	suite.Require().False(response.Result)
+	suite.Require().Equal("not a member", response.Reason)
+}
+
+func (suite *RequestEncoderTestSuite) TestDecodeHardening() {
+	nestedArrays := func(depth int) []byte {
+		return []byte(strings.Repeat("[", depth) + strings.Repeat("]", depth))
+	}
+
+	var decoded any
+	suite.Require().NoError(JSONEncoder{}.Decode(nestedArrays(maxNestingDepth), &decoded))
+	err := JSONEncoder{}.Decode(nestedArrays(maxNestingDepth+1), &decoded)
+	suite.Require().Error(err)
+	suite.Require().Contains(errors.RootCause(err).Error(), "nested deeper")
+
+	// rather than replaced by encoding/json
+	var response PermissionFilterResponse
+	err = JSONEncoder{}.Decode([]byte("{\"result\": [\"\xff\"]}"), &response)
+	suite.Require().Error(err)
+	suite.Require().Contains(errors.RootCause(err).Error(), "UTF-8")
+}
+
+func (suite *RequestEncoderTestSuite) TestQuery() {
+	var contentType string
+	testHTTPServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		requestBody, err := io.ReadAll(r.Body)
+		suite.Require().NoError(err)
+
+		var permissionRequest PermissionFilterRequest
+		suite.Require().NoError(testRequestEncoder{}.Decode(requestBody, &permissionRequest))
+
+		responseBody, err := testRequestEncoder{}.Encode(PermissionFilterResponse{
+			Result: permissionRequest.Input.Resources[:1],
+		})
+		suite.Require().NoError(err)
+		w.Header().Set("Content-Type", contentType)
+		_, err = w.Write(responseBody)
+		suite.Require().NoError(err)
+	}))
+	defer testHTTPServer.Close()
+
+	httpClient := NewHTTPClient(nil,
+		testHTTPServer.URL,
+		"/v1/data/authz/allow",
+		"/v1/data/authz/filter_allowed",
+		time.Second,
+		true,
+		"",
+		false,
+		WithRequestEncoder(testRequestEncoder{}))
+	results, err := httpClient.QueryPermissionsMultiResources(context.Background(),
+		[]string{"resource-1", "resource-2"},
+		ActionRead,
+		&PermissionOptions{MemberIds: []string{"user1"}})
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, false}, results)
+	suite.Require().Equal("application/vnd.test+json", contentType)
+}
+
+func TestRequestEncoderTestSuite(t *testing.T) {
+	suite.Run(t, new(RequestEncoderTestSuite))
+}
+
+// testRequestEncoder encodes as JSON, under a content type of its own
+type testRequestEncoder struct {
+	JSONEncoder
+}
+
+func (testRequestEncoder) ContentType() string {
+	return "application/vnd.test+json"
+}
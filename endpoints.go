@@ -0,0 +1,186 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/nuclio/errors"
+)
+
+// EndpointProvider provides the addresses of the OPA servers to balance queries between
+// (e.g.: discovered by k8sdiscovery.Discovery)
+type EndpointProvider interface {
+
+	// Endpoints returns the current OPA server addresses (e.g.: http://10.0.0.1:8181)
+	Endpoints() []string
+}
+
+// StaticEndpoints is a fixed list of OPA server addresses
+type StaticEndpoints []string
+
+func (e StaticEndpoints) Endpoints() []string {
+	return e
+}
+
+// endpointAddress returns the address to send the next request to, round-robin between the provided endpoints
+// (skipping those failing the health probe, if probed). The configured address is used while no endpoints are provided
+func (c *HTTPClient) endpointAddress() string {
+	if c.endpointProvider == nil {
+		return c.address
+	}
+
+	endpoints := c.endpointProvider.Endpoints()
+	if len(endpoints) == 0 {
+		return c.address
+	}
+	if c.healthProber != nil {
+		endpoints = c.healthProber.healthyEndpoints(endpoints)
+	}
+	return endpoints[(c.nextEndpoint.Add(1)-1)%uint64(len(endpoints))]
+}
+
+// EndpointTLSConfig is the TLS configuration of a single OPA server address, overriding the client-wide one
+type EndpointTLSConfig struct {
+
+	// client certificate and key files, and CA file to verify the server by (reloaded once changed)
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	CAFile   string `json:"caFile,omitempty"`
+
+	// SkipVerify indicates whether to skip verifying the server (for development purposes only)
+	SkipVerify bool `json:"skipVerify,omitempty"`
+}
+
+// endpointTLSDialer establishes the TLS connections to the OPA servers, by their per-address TLS configuration,
+// falling back to the client-wide one
+type endpointTLSDialer struct {
+	transport  *http.Transport
+	tlsConfigs map[string]*tls.Config
+
+	// tlsErr (if set) fails the connections by the client-wide configuration, and tlsErrs those of the addresses
+	// whose configuration failed to load
+	tlsErr  error
+	tlsErrs map[string]error
+}
+
+func newEndpointTLSDialer(transport *http.Transport) *endpointTLSDialer {
+	return &endpointTLSDialer{
+		transport:  transport,
+		tlsConfigs: map[string]*tls.Config{},
+		tlsErrs:    map[string]error{},
+	}
+}
+
+// DialTLSContext dials the address, and completes the TLS handshake by its TLS configuration
+// (see http.Transport.DialTLSContext)
+func (d *endpointTLSDialer) DialTLSContext(ctx context.Context, network string, address string) (net.Conn, error) {
+	if tlsErr, found := d.tlsErrs[address]; found {
+		return nil, &TLSConfigurationError{Address: address, err: tlsErr}
+	}
+	tlsConfig, found := d.tlsConfigs[address]
+	if !found {
+		if d.tlsErr != nil {
+			return nil, &TLSConfigurationError{Address: address, err: d.tlsErr}
+		}
+		tlsConfig = d.transport.TLSClientConfig
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	tlsConfig = tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to parse address")
+		}
+		tlsConfig.ServerName = host
+	}
+
+	dialContext := d.transport.DialContext
+	if dialContext == nil {
+		dialContext = (&net.Dialer{}).DialContext
+	}
+	connection, err := dialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.transport.TLSHandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.transport.TLSHandshakeTimeout)
+		defer cancel()
+	}
+	tlsConnection := tls.Client(connection, tlsConfig)
+	if err := tlsConnection.HandshakeContext(ctx); err != nil {
+		connection.Close() // nolint: errcheck
+		return nil, errors.Wrap(err, "Failed to complete TLS handshake")
+	}
+	return tlsConnection, nil
+}
+
+// endpointHostPort returns the host:port of an OPA server address (e.g.: https://opa:8443), as dialed
+func endpointHostPort(address string) (string, error) {
+	parsedAddress, err := url.Parse(address)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to parse address")
+	}
+	if parsedAddress.Host == "" {
+		return "", errors.Errorf("Address %s has no host", address)
+	}
+	if parsedAddress.Port() != "" {
+		return parsedAddress.Host, nil
+	}
+	if parsedAddress.Scheme == "http" {
+		return net.JoinHostPort(parsedAddress.Hostname(), "80"), nil
+	}
+	return net.JoinHostPort(parsedAddress.Hostname(), "443"), nil
+}
+
+// failTLS fails the TLS connections by the client-wide configuration with the given error (e.g.: its certificates
+// failed to load), rather than connecting without it
+func (c *HTTPClient) failTLS(err error) {
+	c.ensureEndpointTLSDialer().tlsErr = err
+}
+
+// failEndpointTLS fails the TLS connections to the given OPA server address with the given error (e.g.: its
+// certificates failed to load), rather than connecting by the client-wide configuration
+func (c *HTTPClient) failEndpointTLS(address string, err error) {
+	hostPort, parseErr := endpointHostPort(address)
+	if parseErr != nil {
+		c.logger.WarnWith("Failed to parse endpoint address, failing the TLS connections by the client-wide configuration",
+			"address", address,
+			"err", parseErr.Error())
+		c.failTLS(err)
+		return
+	}
+	c.ensureEndpointTLSDialer().tlsErrs[hostPort] = err
+}
+
+func (c *HTTPClient) ensureEndpointTLSDialer() *endpointTLSDialer {
+	if c.endpointTLSDialer == nil {
+		c.endpointTLSDialer = newEndpointTLSDialer(c.transport)
+		c.transport.DialTLSContext = c.endpointTLSDialer.DialTLSContext
+	}
+	return c.endpointTLSDialer
+}
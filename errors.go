@@ -0,0 +1,350 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nuclio/errors"
+)
+
+// ErrForbidden is matched (using errors.Is) by the error returned when a permission query is denied
+// and PermissionOptions.RaiseForbidden is set
+var ErrForbidden = errors.New("Forbidden")
+
+// ForbiddenError is returned when a permission query is denied and PermissionOptions.RaiseForbidden is set.
+// It carries the deny reason and violations, if returned by the policy
+type ForbiddenError struct {
+	Resource   string
+	Action     Action
+	Reason     string
+	Violations []string
+}
+
+func newForbiddenError(decision *Decision) *ForbiddenError {
+	return &ForbiddenError{
+		Resource:   decision.Resource,
+		Action:     decision.Action,
+		Reason:     decision.Reason,
+		Violations: decision.Violations,
+	}
+}
+
+func (e *ForbiddenError) Error() string {
+	message := fmt.Sprintf("Forbidden to %s resource %s", e.Action, e.Resource)
+	if e.Reason != "" {
+		message += ": " + e.Reason
+	}
+	return message
+}
+
+func (e *ForbiddenError) Is(target error) bool {
+	return target == ErrForbidden
+}
+
+// ErrOverloaded is matched (using errors.Is) by the error returned when a query is rejected locally, the request
+// queue being full (see WithRequestQueue), so callers may shed load rather than time out
+var ErrOverloaded = errors.New("Overloaded")
+
+// OverloadedError is returned (wrapped) when a query is rejected locally, the request queue being full
+type OverloadedError struct {
+	Priority  Priority
+	QueueSize int
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("Request queue is full (%d requests wait for a slot), rejecting %s priority request",
+		e.QueueSize,
+		e.Priority)
+}
+
+func (e *OverloadedError) Is(target error) bool {
+	return target == ErrOverloaded
+}
+
+// ErrConnectionTimeout is matched (using errors.Is) by the error returned when a request to OPA timed out before it
+// was sent - dialing, TLS handshaking or awaiting a connection. Its remediation is fixing the network path to OPA
+var ErrConnectionTimeout = errors.New("Connection timeout")
+
+// ErrEvaluationTimeout is matched (using errors.Is) by the error returned when a request to OPA timed out after it
+// was sent, awaiting the response - typically while OPA evaluated the policy. Its remediation is scaling OPA
+// (or optimizing the policy)
+var ErrEvaluationTimeout = errors.New("Evaluation timeout")
+
+type TimeoutPhase string
+
+const (
+	TimeoutPhaseConnection TimeoutPhase = "connection"
+	TimeoutPhaseEvaluation TimeoutPhase = "evaluation"
+)
+
+// TimeoutError is returned (wrapped) when a request to OPA timed out, matching either ErrConnectionTimeout or
+// ErrEvaluationTimeout by the phase it timed out in. It unwraps to the timeout error (e.g.: context.DeadlineExceeded)
+type TimeoutError struct {
+	Phase    TimeoutPhase
+	Endpoint string
+
+	err error
+}
+
+// newTimeoutError returns the timeout error of a failed request to the given endpoint, by whether the request
+// was sent, or nil if the request didn't time out
+func newTimeoutError(err error, endpoint string, requestSent bool) *TimeoutError {
+	if !isTimeoutError(err) {
+		return nil
+	}
+
+	phase := TimeoutPhaseConnection
+	if requestSent {
+		phase = TimeoutPhaseEvaluation
+	}
+	return &TimeoutError{
+		Phase:    phase,
+		Endpoint: endpoint,
+		err:      err,
+	}
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Phase == TimeoutPhaseEvaluation {
+		return fmt.Sprintf("Timed out awaiting the response of %s", e.Endpoint)
+	}
+	return fmt.Sprintf("Timed out connecting to %s", e.Endpoint)
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	switch e.Phase {
+	case TimeoutPhaseConnection:
+		return target == ErrConnectionTimeout
+	case TimeoutPhaseEvaluation:
+		return target == ErrEvaluationTimeout
+	default:
+		return false
+	}
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.err
+}
+
+// isTimeoutError returns true if the error was caused by a deadline, or by a network timeout
+func isTimeoutError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	for ; err != nil; err = unwrapError(err) {
+		if timeoutErr, ok := err.(interface{ Timeout() bool }); ok && timeoutErr.Timeout() {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnavailableError returns true if the query failed since OPA is unavailable - on transport errors, timeouts,
+// 5xx responses or requests rejected locally by load shedding or throttling - rather than by an error the query
+// itself would repeat (e.g.: an invalid input, a missing policy path, a policy error or an unauthorized request)
+func isUnavailableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrTLSConfiguration) {
+		return false
+	}
+	if errors.Is(err, ErrOverloaded) || errors.Is(err, ErrUnreachable) || isTimeoutError(err) {
+		return true
+	}
+	for ; err != nil; err = unwrapError(err) {
+		switch typedErr := err.(type) {
+		case *UnexpectedStatusError:
+			return typedErr.StatusCode >= http.StatusInternalServerError
+		case *url.Error:
+			return true
+		}
+	}
+	return false
+}
+
+func unwrapError(err error) error {
+	if wrappingErr, ok := err.(interface{ Unwrap() error }); ok {
+		return wrappingErr.Unwrap()
+	}
+	return nil
+}
+
+// ErrTLSConfiguration is matched (using errors.Is) by the error returned when a request to OPA over TLS is failed
+// locally, since its configured client certificate or CA failed to load. Its remediation is fixing the configured
+// files, so it isn't retried, nor decided by stale decisions or the fallback policy
+var ErrTLSConfiguration = errors.New("TLS configuration failed to load")
+
+// TLSConfigurationError is returned (wrapped) when a request to OPA over TLS is failed locally, since its configured
+// client certificate or CA failed to load - rather than connecting without them. It unwraps to the load error
+type TLSConfigurationError struct {
+	Address string
+
+	err error
+}
+
+func (e *TLSConfigurationError) Error() string {
+	return fmt.Sprintf("TLS configuration of %s failed to load: %s", e.Address, errors.RootCause(e.err).Error())
+}
+
+func (e *TLSConfigurationError) Is(target error) bool {
+	return target == ErrTLSConfiguration
+}
+
+func (e *TLSConfigurationError) Unwrap() error {
+	return e.err
+}
+
+// UnexpectedStatusError is returned (wrapped) when a server responds with an unexpected status code.
+// It can be matched using errors.As, along with the standard library errors of failed requests (e.g.: *url.Error)
+type UnexpectedStatusError struct {
+	StatusCode         int
+	ExpectedStatusCode int
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("Got unexpected response status code: %d. Expected: %d", e.StatusCode, e.ExpectedStatusCode)
+}
+
+// OPAError is returned (wrapped) when OPA responds with an unexpected status code along with its standard error
+// body (e.g.: {"code": "invalid_parameter", "message": "..."}). It unwraps to the UnexpectedStatusError
+type OPAError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+
+	statusError *UnexpectedStatusError
+}
+
+// opaResponseError returns the OPA error described by the response body of a request failed on an unexpected status,
+// or else the request error as is
+func opaResponseError(responseBody []byte, requestErr error) error {
+	statusError, ok := requestErr.(*UnexpectedStatusError)
+	if !ok {
+		return requestErr
+	}
+
+	opaError := &OPAError{}
+	if err := json.Unmarshal(responseBody, opaError); err != nil || opaError.Code == "" {
+		return requestErr
+	}
+	opaError.StatusCode = statusError.StatusCode
+	opaError.statusError = statusError
+	return opaError
+}
+
+func (e *OPAError) Error() string {
+	return fmt.Sprintf("OPA responded with status code %d (%s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *OPAError) Unwrap() error {
+	return e.statusError
+}
+
+// ErrPolicyPathNotFound is matched (using errors.Is) by the error returned when OPA responds a queried policy path is
+// not found (e.g.: a typo in the configured path). Its remediation is fixing the path, so it isn't retried
+var ErrPolicyPathNotFound = errors.New("Policy path not found")
+
+// PolicyPathNotFoundError is returned (wrapped) when OPA responds a queried policy path is not found.
+// It unwraps to the OPAError (or UnexpectedStatusError) of the response
+type PolicyPathNotFoundError struct {
+	Path     string
+	Endpoint string
+
+	err error
+}
+
+// newPolicyPathNotFoundError returns the error of a request to the policy path failed on a not found status,
+// or nil if the request failed otherwise
+func newPolicyPathNotFoundError(responseBody []byte, requestErr error, path string, endpoint string) *PolicyPathNotFoundError {
+	statusError, ok := requestErr.(*UnexpectedStatusError)
+	if !ok || statusError.StatusCode != http.StatusNotFound {
+		return nil
+	}
+	return &PolicyPathNotFoundError{
+		Path:     path,
+		Endpoint: endpoint,
+		err:      opaResponseError(responseBody, requestErr),
+	}
+}
+
+func (e *PolicyPathNotFoundError) Error() string {
+	return fmt.Sprintf("Policy path %s not found at %s", e.Path, e.Endpoint)
+}
+
+func (e *PolicyPathNotFoundError) Is(target error) bool {
+	return target == ErrPolicyPathNotFound
+}
+
+func (e *PolicyPathNotFoundError) Unwrap() error {
+	return e.err
+}
+
+// PolicyError is returned (wrapped) when OPA fails to evaluate the policy (e.g.: a builtin failed, with
+// strict builtin errors - see WithStrictBuiltinErrors, or conflicting rule values), rather than deciding.
+// Policy errors recur, so they aren't retried
+type PolicyError struct {
+	Code    string              `json:"code"`
+	Message string              `json:"message"`
+	Errors  []PolicyErrorDetail `json:"errors,omitempty"`
+}
+
+// PolicyErrorDetail describes a single policy evaluation error, and where in the policy it occurred
+type PolicyErrorDetail struct {
+	Code     string               `json:"code"`
+	Message  string               `json:"message"`
+	Location *PolicyErrorLocation `json:"location,omitempty"`
+}
+
+type PolicyErrorLocation struct {
+	File string `json:"file"`
+	Row  int    `json:"row"`
+	Col  int    `json:"col"`
+}
+
+// parsePolicyError parses an OPA error response, returning nil unless it describes policy evaluation errors
+func parsePolicyError(responseBody []byte) *PolicyError {
+	policyError := &PolicyError{}
+	if err := json.Unmarshal(responseBody, policyError); err != nil {
+		return nil
+	}
+	for _, errorDetail := range policyError.Errors {
+		if strings.HasPrefix(errorDetail.Code, "eval_") {
+			return policyError
+		}
+	}
+	return nil
+}
+
+func (e *PolicyError) Error() string {
+	var errorDetails []string
+	for _, errorDetail := range e.Errors {
+		if errorDetail.Location != nil {
+			errorDetails = append(errorDetails, fmt.Sprintf("%s:%d:%d: %s",
+				errorDetail.Location.File,
+				errorDetail.Location.Row,
+				errorDetail.Location.Col,
+				errorDetail.Message))
+			continue
+		}
+		errorDetails = append(errorDetails, errorDetail.Message)
+	}
+	return fmt.Sprintf("Policy evaluation failed: %s", strings.Join(errorDetails, "; "))
+}
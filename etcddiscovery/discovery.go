@@ -0,0 +1,346 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package etcddiscovery discovers the OPA servers registered under an etcd key prefix, by watching the keys (using
+// the etcd v3 JSON gateway), so the client balances queries between them as OPA instances come and go.
+package etcddiscovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	opaclient "github.com/nuclio/opa-client"
+)
+
+const (
+	DefaultAddress = "http://127.0.0.1:2379"
+
+	// DefaultRetryInterval is the period to wait before re-watching, once watching failed
+	DefaultRetryInterval = 5 * time.Second
+)
+
+type Config struct {
+
+	// etcd server address, and the credentials to authenticate by (if auth is enabled)
+	Address  string
+	Username string
+	Password string
+
+	// Prefix of the keys the OPA servers are registered under (e.g.: /services/opa/), whose values are the server
+	// addresses (e.g.: http://10.0.0.1:8181) - either plain, or as the Addr of a JSON endpoint
+	// (as registered by the etcd naming endpoints manager)
+	Prefix string
+
+	// HTTP client to query etcd by (watches are long-lived, so it must not time out)
+	HTTPClient *http.Client
+
+	// period to wait before re-watching, once watching failed
+	RetryInterval time.Duration
+}
+
+// Discovery watches the keys the OPA servers are registered under, and provides their addresses.
+// It implements opaclient.EndpointProvider
+type Discovery struct {
+	logger logger.Logger
+	config Config
+
+	lock         sync.RWMutex
+	keyEndpoints map[string]string
+	endpoints    []string
+}
+
+func NewDiscovery(parentLogger logger.Logger, config Config) (*Discovery, error) {
+	if config.Prefix == "" {
+		return nil, errors.New("Prefix must be set")
+	}
+	if config.Address == "" {
+		config.Address = DefaultAddress
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{}
+	}
+	if config.RetryInterval == 0 {
+		config.RetryInterval = DefaultRetryInterval
+	}
+	if parentLogger == nil {
+		parentLogger = opaclient.NopLogger{}
+	}
+
+	return &Discovery{
+		logger:       parentLogger.GetChild("opa-etcd-discovery"),
+		config:       config,
+		keyEndpoints: map[string]string{},
+	}, nil
+}
+
+// Start lists the registered OPA servers, and keeps watching them in the background until the context is done
+func (d *Discovery) Start(ctx context.Context) error {
+	revision, err := d.list(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Failed to list keys")
+	}
+
+	go d.watch(ctx, revision)
+	return nil
+}
+
+// Endpoints returns the addresses of the registered OPA servers
+func (d *Discovery) Endpoints() []string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return d.endpoints
+}
+
+// list reads the keys under the prefix, and returns the revision they were read at
+func (d *Discovery) list(ctx context.Context) (int64, error) {
+	response, err := d.sendRequest(ctx, "/v3/kv/range", rangeRequest{
+		Key:      base64String(d.config.Prefix),
+		RangeEnd: base64String(prefixRangeEnd(d.config.Prefix)),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close() // nolint: errcheck
+
+	keyValues := rangeResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&keyValues); err != nil {
+		return 0, errors.Wrap(err, "Failed to decode keys")
+	}
+
+	keyEndpoints := map[string]string{}
+	for _, keyValue := range keyValues.KeyValues {
+		keyEndpoints[string(keyValue.Key)] = endpointAddress(keyValue.Value)
+	}
+
+	d.lock.Lock()
+	d.keyEndpoints = keyEndpoints
+	d.lock.Unlock()
+
+	d.updateEndpoints(ctx)
+	return keyValues.Header.revision(), nil
+}
+
+// watch keeps watching the keys, re-listing them once the watch cannot be resumed
+func (d *Discovery) watch(ctx context.Context, revision int64) {
+	for {
+		err := d.watchEvents(ctx, &revision)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+
+			// the watch stream was closed
+			continue
+		}
+
+		d.logger.WarnWithCtx(ctx, "Failed to watch keys, retrying",
+			"prefix", d.config.Prefix,
+			"err", err.Error())
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.config.RetryInterval):
+			}
+
+			if revision, err = d.list(ctx); err == nil {
+				break
+			}
+			d.logger.WarnWithCtx(ctx, "Failed to list keys, retrying",
+				"prefix", d.config.Prefix,
+				"err", err.Error())
+		}
+	}
+}
+
+func (d *Discovery) watchEvents(ctx context.Context, revision *int64) error {
+	response, err := d.sendRequest(ctx, "/v3/watch", watchRequest{
+		CreateRequest: watchCreateRequest{
+			Key:           base64String(d.config.Prefix),
+			RangeEnd:      base64String(prefixRangeEnd(d.config.Prefix)),
+			StartRevision: strconv.FormatInt(*revision+1, 10),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close() // nolint: errcheck
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		watchResponse := watchResponse{}
+		if err := decoder.Decode(&watchResponse); err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return errors.Wrap(err, "Failed to decode watch response")
+		}
+		if watchResponse.Error != nil {
+			return errors.Errorf("Received watch error: %s", watchResponse.Error.Message)
+		}
+
+		// e.g.: the revision was compacted, so watching cannot be resumed from it
+		if watchResponse.Result.Canceled {
+			return errors.Errorf("Watch canceled: %s", watchResponse.Result.CancelReason)
+		}
+
+		if len(watchResponse.Result.Events) == 0 {
+			continue
+		}
+		d.lock.Lock()
+		for _, event := range watchResponse.Result.Events {
+			if event.Type == watchEventTypeDelete {
+				delete(d.keyEndpoints, string(event.KeyValue.Key))
+			} else {
+				d.keyEndpoints[string(event.KeyValue.Key)] = endpointAddress(event.KeyValue.Value)
+			}
+		}
+		d.lock.Unlock()
+		*revision = watchResponse.Result.Header.revision()
+
+		d.updateEndpoints(ctx)
+	}
+}
+
+func (d *Discovery) sendRequest(ctx context.Context, path string, body any) (*http.Response, error) {
+	encodedBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to encode request")
+	}
+
+	request, err := http.NewRequestWithContext(ctx,
+		http.MethodPost,
+		strings.TrimSuffix(d.config.Address, "/")+path,
+		bytes.NewReader(encodedBody))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create request")
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if d.config.Username != "" {
+
+		// authenticate anew on every request, as tokens expire
+		token, err := d.authenticate(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to authenticate")
+		}
+		request.Header.Set("Authorization", token)
+	}
+
+	response, err := d.config.HTTPClient.Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to send request to etcd")
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close() // nolint: errcheck
+		return nil, errors.Errorf("Received unexpected status code from etcd: %d", response.StatusCode)
+	}
+	return response, nil
+}
+
+// authenticate returns a token of the configured user
+func (d *Discovery) authenticate(ctx context.Context) (string, error) {
+	encodedBody, err := json.Marshal(authenticateRequest{
+		Name:     d.config.Username,
+		Password: d.config.Password,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to encode request")
+	}
+
+	request, err := http.NewRequestWithContext(ctx,
+		http.MethodPost,
+		strings.TrimSuffix(d.config.Address, "/")+"/v3/auth/authenticate",
+		bytes.NewReader(encodedBody))
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to create request")
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := d.config.HTTPClient.Do(request)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to send request to etcd")
+	}
+	defer response.Body.Close() // nolint: errcheck
+	if response.StatusCode != http.StatusOK {
+		return "", errors.Errorf("Received unexpected status code from etcd: %d", response.StatusCode)
+	}
+
+	authenticateResponse := authenticateResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&authenticateResponse); err != nil {
+		return "", errors.Wrap(err, "Failed to decode token")
+	}
+	return authenticateResponse.Token, nil
+}
+
+// updateEndpoints merges the endpoints of all keys (several may register the same address)
+func (d *Discovery) updateEndpoints(ctx context.Context) {
+	d.lock.Lock()
+	endpoints := make([]string, 0, len(d.keyEndpoints))
+	for _, endpoint := range d.keyEndpoints {
+		if endpoint != "" {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	slices.Sort(endpoints)
+	endpoints = slices.Compact(endpoints)
+
+	changed := !slices.Equal(endpoints, d.endpoints)
+	d.endpoints = endpoints
+	d.lock.Unlock()
+
+	if changed {
+		d.logger.InfoWithCtx(ctx, "Updated OPA endpoints",
+			"prefix", d.config.Prefix,
+			"endpoints", endpoints)
+	}
+}
+
+// endpointAddress returns the address registered in a key value - either plain, or the Addr of a JSON endpoint
+func endpointAddress(value []byte) string {
+	endpoint := struct {
+		Addr string `json:"Addr"`
+	}{}
+	if err := json.Unmarshal(value, &endpoint); err == nil {
+		return endpoint.Addr
+	}
+	return strings.TrimSpace(string(value))
+}
+
+// prefixRangeEnd returns the end of the key range of the given prefix (the prefix, with its last byte incremented)
+func prefixRangeEnd(prefix string) string {
+	rangeEnd := []byte(prefix)
+	for byteIdx := len(rangeEnd) - 1; byteIdx >= 0; byteIdx-- {
+		if rangeEnd[byteIdx] < 0xff {
+			rangeEnd[byteIdx]++
+			return string(rangeEnd[:byteIdx+1])
+		}
+	}
+
+	// all keys
+	return "\x00"
+}
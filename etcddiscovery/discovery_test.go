@@ -0,0 +1,147 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcddiscovery
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	nucliozap "github.com/nuclio/zap"
+	"github.com/stretchr/testify/suite"
+)
+
+type DiscoveryTestSuite struct {
+	suite.Suite
+	ctx            context.Context
+	cancel         context.CancelFunc
+	etcdServer     *httptest.Server
+	watchRevisions chan string
+	watchResponses chan string
+	discovery      *Discovery
+}
+
+func (suite *DiscoveryTestSuite) SetupTest() {
+	loggerInstance, err := nucliozap.NewNuclioZapTest("etcd-discovery-test")
+	suite.Require().NoError(err)
+
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.watchRevisions = make(chan string, 10)
+	suite.watchResponses = make(chan string, 10)
+	suite.etcdServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v3/auth/authenticate" {
+			credentials := authenticateRequest{}
+			suite.Require().NoError(json.NewDecoder(r.Body).Decode(&credentials))
+			suite.Require().Equal(authenticateRequest{Name: "opa-client", Password: "secret"}, credentials)
+			_, err := w.Write([]byte(`{"token": "etcd-token"}`))
+			suite.Require().NoError(err)
+			return
+		}
+		suite.Require().Equal("etcd-token", r.Header.Get("Authorization"))
+
+		// range requests and watch create requests range over the keys alike
+		rangeRequest := map[string]string{}
+		if r.URL.Path == "/v3/kv/range" {
+			suite.Require().NoError(json.NewDecoder(r.Body).Decode(&rangeRequest))
+		} else {
+			suite.Require().Equal("/v3/watch", r.URL.Path)
+			watchRequest := map[string]map[string]string{}
+			suite.Require().NoError(json.NewDecoder(r.Body).Decode(&watchRequest))
+			rangeRequest = watchRequest["create_request"]
+		}
+		suite.Require().Equal(testBase64("/services/opa/"), rangeRequest["key"])
+		suite.Require().Equal(testBase64("/services/opa0"), rangeRequest["range_end"])
+
+		if r.URL.Path == "/v3/kv/range" {
+			_, err := fmt.Fprintf(w, `{"header": {"revision": "10"}, "kvs": [%s]}`,
+				testKeyValue("/services/opa/1", "http://10.0.0.1:8181"))
+			suite.Require().NoError(err)
+			return
+		}
+
+		suite.watchRevisions <- rangeRequest["start_revision"]
+		_, err := fmt.Fprintln(w, `{"result": {"header": {"revision": "10"}, "created": true}}`)
+		suite.Require().NoError(err)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case watchResponse := <-suite.watchResponses:
+				_, err := fmt.Fprintln(w, watchResponse)
+				suite.Require().NoError(err)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+
+	suite.discovery, err = NewDiscovery(loggerInstance, Config{
+		Address:    suite.etcdServer.URL,
+		Username:   "opa-client",
+		Password:   "secret",
+		Prefix:     "/services/opa/",
+		HTTPClient: suite.etcdServer.Client(),
+	})
+	suite.Require().NoError(err)
+}
+
+func (suite *DiscoveryTestSuite) TearDownTest() {
+	suite.cancel()
+	suite.etcdServer.Close()
+}
+
+func (suite *DiscoveryTestSuite) TestWatch() {
+	err := suite.discovery.Start(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"http://10.0.0.1:8181"}, suite.discovery.Endpoints())
+	suite.Require().Equal("11", <-suite.watchRevisions)
+
+	// an instance registered by the etcd naming endpoints manager
+	suite.watchResponses <- fmt.Sprintf(`{"result": {"header": {"revision": "11"}, "events": [{"kv": %s}]}}`,
+		testKeyValue("/services/opa/2", `{"Op": 0, "Addr": "http://10.0.0.2:8181"}`))
+	suite.Require().Eventually(func() bool {
+		return len(suite.discovery.Endpoints()) == 2
+	}, time.Second, 10*time.Millisecond)
+	suite.Require().Equal([]string{"http://10.0.0.1:8181", "http://10.0.0.2:8181"}, suite.discovery.Endpoints())
+
+	// an instance deregistered
+	suite.watchResponses <- fmt.Sprintf(`{"result": {"header": {"revision": "12"}, "events": [{"type": "DELETE", "kv": %s}]}}`,
+		testKeyValue("/services/opa/1", ""))
+	suite.Require().Eventually(func() bool {
+		return len(suite.discovery.Endpoints()) == 1
+	}, time.Second, 10*time.Millisecond)
+	suite.Require().Equal([]string{"http://10.0.0.2:8181"}, suite.discovery.Endpoints())
+}
+
+func testKeyValue(key string, value string) string {
+	return fmt.Sprintf(`{"key": %q, "value": %q}`, testBase64(key), testBase64(value))
+}
+
+func testBase64(value string) string {
+	return base64.StdEncoding.EncodeToString([]byte(value))
+}
+
+func TestDiscoveryTestSuite(t *testing.T) {
+	suite.Run(t, new(DiscoveryTestSuite))
+}
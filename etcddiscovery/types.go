@@ -0,0 +1,101 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package etcddiscovery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+)
+
+// the subset of the etcd v3 JSON gateway API used for discovery - bytes fields are encoded in base64,
+// and 64 bit integers as strings
+
+const watchEventTypeDelete = "DELETE"
+
+// base64String is a string sent encoded in base64
+type base64String string
+
+func (s base64String) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.StdEncoding.EncodeToString([]byte(s)))
+}
+
+type responseHeader struct {
+	Revision string `json:"revision,omitempty"`
+}
+
+func (h responseHeader) revision() int64 {
+	revision, _ := strconv.ParseInt(h.Revision, 10, 64)
+	return revision
+}
+
+type keyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value,omitempty"`
+}
+
+type rangeRequest struct {
+	Key      base64String `json:"key"`
+	RangeEnd base64String `json:"range_end"`
+}
+
+type rangeResponse struct {
+	Header    responseHeader `json:"header"`
+	KeyValues []keyValue     `json:"kvs"`
+}
+
+type watchRequest struct {
+	CreateRequest watchCreateRequest `json:"create_request"`
+}
+
+type watchCreateRequest struct {
+	Key           base64String `json:"key"`
+	RangeEnd      base64String `json:"range_end"`
+	StartRevision string       `json:"start_revision"`
+}
+
+type watchResponse struct {
+	Result watchResult `json:"result"`
+	Error  *watchError `json:"error,omitempty"`
+}
+
+type watchResult struct {
+	Header       responseHeader `json:"header"`
+	Created      bool           `json:"created,omitempty"`
+	Canceled     bool           `json:"canceled,omitempty"`
+	CancelReason string         `json:"cancel_reason,omitempty"`
+	Events       []watchEvent   `json:"events,omitempty"`
+}
+
+// watchEvent is a change of a key - its type is omitted for puts (the default)
+type watchEvent struct {
+	Type     string   `json:"type,omitempty"`
+	KeyValue keyValue `json:"kv"`
+}
+
+type watchError struct {
+	Message string `json:"message"`
+}
+
+type authenticateRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+type authenticateResponse struct {
+	Token string `json:"token"`
+}
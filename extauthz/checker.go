@@ -0,0 +1,205 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package extauthz is a transport-agnostic adapter of Envoy ext_authz check requests, translating them into
+// permission queries, so sidecar proxies may enforce the same policies as the application.
+//
+// The package does not implement the envoy.service.auth.v3.Authorization gRPC service: to keep the client free of
+// gRPC and Envoy dependencies, it mirrors the subset of the check messages it uses, and leaves serving them
+// (e.g.: by a gRPC service converting the envoy messages) to the application.
+package extauthz
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	opaclient "github.com/nuclio/opa-client"
+)
+
+const (
+
+	// ResourceContextExtension and ActionContextExtension are the context extensions the resource and action of
+	// a route may be configured by, instead of the request path and method
+	ResourceContextExtension = "resource"
+	ActionContextExtension   = "action"
+)
+
+// RequestMapper returns the resource and action the checked request is authorized against
+type RequestMapper func(ctx context.Context, request *CheckRequest) (string, opaclient.Action, error)
+
+// PermissionOptionsFunc returns the permission options the checked request is authorized with
+type PermissionOptionsFunc func(ctx context.Context, request *CheckRequest) (*opaclient.PermissionOptions, error)
+
+type Config struct {
+
+	// Client to query permissions with
+	Client opaclient.Client
+
+	// RequestMapper maps requests to resources and actions (DefaultRequestMapper, unless set)
+	RequestMapper RequestMapper
+
+	// PermissionOptions returns the permission options of requests, whose member ids must come from a trusted
+	// source (e.g.: a verified token) rather than a header any caller may set
+	PermissionOptions PermissionOptionsFunc
+}
+
+// Checker decides check requests, the way the Check method of the envoy.service.auth.v3.Authorization service does
+type Checker struct {
+	logger logger.Logger
+	config Config
+}
+
+func NewChecker(parentLogger logger.Logger, config Config) (*Checker, error) {
+	if config.Client == nil {
+		return nil, errors.New("Client must be set")
+	}
+	if config.PermissionOptions == nil {
+		return nil, errors.New("Permission options must be set")
+	}
+	if config.RequestMapper == nil {
+		config.RequestMapper = DefaultRequestMapper
+	}
+	if parentLogger == nil {
+		parentLogger = opaclient.NopLogger{}
+	}
+
+	return &Checker{
+		logger: parentLogger.GetChild("opa-ext-authz"),
+		config: config,
+	}, nil
+}
+
+// Check authorizes the request by its permission query, allowing it with an OK status, or denying it with a
+// PERMISSION_DENIED status and a 403 response carrying the deny reason. Requests which cannot be mapped are denied
+// with an INVALID_ARGUMENT status and a 400 response (carrying the status text only, so internal errors are not
+// exposed to the caller). Failing to query the permission fails the check, leaving the request to the failure mode
+// of the ext_authz filter (see failure_mode_allow)
+func (c *Checker) Check(ctx context.Context, request *CheckRequest) (*CheckResponse, error) {
+	if request.httpRequest() == nil {
+		c.logger.DebugWithCtx(ctx, "Check request has no HTTP attributes")
+		return badRequestResponse(), nil
+	}
+
+	resource, action, err := c.config.RequestMapper(ctx, request)
+	if err != nil {
+		c.logger.DebugWithCtx(ctx, "Failed to map check request",
+			"id", request.httpRequest().ID,
+			"err", err.Error())
+		return badRequestResponse(), nil
+	}
+
+	permissionOptions, err := c.config.PermissionOptions(ctx, request)
+	if err != nil {
+		c.logger.DebugWithCtx(ctx, "Failed to resolve permission options of check request",
+			"id", request.httpRequest().ID,
+			"err", err.Error())
+		return badRequestResponse(), nil
+	}
+
+	decision, err := opaclient.QueryDecision(ctx, c.config.Client, resource, action, permissionOptions)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to query permission to %s resource %s", action, resource)
+	}
+
+	if !decision.Allowed {
+		c.logger.DebugWithCtx(ctx, "Denied check request",
+			"id", request.httpRequest().ID,
+			"resource", resource,
+			"action", action,
+			"reason", decision.Reason)
+
+		reason := decision.Reason
+		if reason == "" {
+			reason = http.StatusText(http.StatusForbidden)
+		}
+		return deniedResponse(codePermissionDenied, http.StatusForbidden, reason), nil
+	}
+
+	return &CheckResponse{
+		Status:     &Status{Code: codeOK},
+		OkResponse: &OkHTTPResponse{},
+	}, nil
+}
+
+// DefaultRequestMapper authorizes the request path (without the query string) against the action of the request
+// method (see opaclient.ActionFromHTTPMethod), unless the route configures them by the resource and action
+// context extensions. Paths with dot segments or repeated slashes are rejected, since the upstream may resolve them
+// to another resource than the one authorized
+func DefaultRequestMapper(ctx context.Context, request *CheckRequest) (string, opaclient.Action, error) {
+	httpRequest := request.httpRequest()
+	contextExtensions := request.Attributes.ContextExtensions
+
+	resource := contextExtensions[ResourceContextExtension]
+	if resource == "" {
+		requestPath, _, _ := strings.Cut(httpRequest.Path, "?")
+		if requestPath == "" {
+			return "", "", errors.New("Request has no path")
+		}
+		if !isCleanPath(requestPath) {
+			return "", "", errors.Errorf("Request path %s is not clean", requestPath)
+		}
+		resource = requestPath
+	}
+
+	action := opaclient.Action(contextExtensions[ActionContextExtension])
+	if action == "" {
+		methodAction, found := opaclient.ActionFromHTTPMethod(httpRequest.Method)
+		if !found {
+			return "", "", errors.Errorf("Request method %s maps to no action", httpRequest.Method)
+		}
+		action = methodAction
+	}
+
+	return resource, action, nil
+}
+
+// isCleanPath returns true if the path is absolute and has neither dot segments nor repeated slashes
+// (a trailing slash is allowed). Envoy forwards the path as is, unless its normalize_path option is set
+func isCleanPath(requestPath string) bool {
+	if !strings.HasPrefix(requestPath, "/") {
+		return false
+	}
+	cleanedPath := path.Clean(requestPath)
+	return requestPath == cleanedPath || (cleanedPath != "/" && requestPath == cleanedPath+"/")
+}
+
+func (r *CheckRequest) httpRequest() *HTTPRequest {
+	if r == nil || r.Attributes == nil || r.Attributes.Request == nil {
+		return nil
+	}
+	return r.Attributes.Request.HTTP
+}
+
+func badRequestResponse() *CheckResponse {
+	return deniedResponse(codeInvalidArgument, http.StatusBadRequest, http.StatusText(http.StatusBadRequest))
+}
+
+func deniedResponse(code int32, httpStatusCode int32, body string) *CheckResponse {
+	return &CheckResponse{
+		Status: &Status{
+			Code:    code,
+			Message: body,
+		},
+		DeniedResponse: &DeniedHTTPResponse{
+			Status: &HTTPStatus{Code: httpStatusCode},
+			Body:   body,
+		},
+	}
+}
@@ -0,0 +1,191 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extauthz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/nuclio/errors"
+	opaclient "github.com/nuclio/opa-client"
+	nucliozap "github.com/nuclio/zap"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type CheckerTestSuite struct {
+	suite.Suite
+	ctx     context.Context
+	client  *opaclient.MockClient
+	checker *Checker
+}
+
+func (suite *CheckerTestSuite) SetupTest() {
+	loggerInstance, err := nucliozap.NewNuclioZapTest("ext-authz-test")
+	suite.Require().NoError(err)
+
+	suite.ctx = context.Background()
+	suite.client = &opaclient.MockClient{}
+	suite.checker, err = NewChecker(loggerInstance, Config{
+		Client:            suite.client,
+		PermissionOptions: permissionOptionsFromHeaders,
+	})
+	suite.Require().NoError(err)
+}
+
+func (suite *CheckerTestSuite) TestCheckAllowed() {
+	suite.client.
+		On("QueryDecision",
+			mock.Anything,
+			"/projects/p1/functions/f1",
+			opaclient.ActionUpdate,
+			mock.MatchedBy(func(permissionOptions *opaclient.PermissionOptions) bool {
+				return len(permissionOptions.MemberIds) == 2 &&
+					permissionOptions.MemberIds[0] == "user1" &&
+					permissionOptions.MemberIds[1] == "group1"
+			})).
+		Return(&opaclient.Decision{Allowed: true}, nil).
+		Once()
+
+	// as converted from the envoy message by its JSON encoding
+	checkRequest := &CheckRequest{}
+	suite.Require().NoError(json.Unmarshal([]byte(`{
+		"attributes": {
+			"request": {
+				"http": {
+					"id": "r1",
+					"method": "PATCH",
+					"path": "/projects/p1/functions/f1?force=true",
+					"headers": {"x-member-ids": "user1, group1", "x-request-id": "r1"}
+				}
+			}
+		}
+	}`), checkRequest))
+
+	checkResponse, err := suite.checker.Check(suite.ctx, checkRequest)
+	suite.Require().NoError(err)
+	suite.Require().Equal(codeOK, checkResponse.Status.Code)
+	suite.Require().NotNil(checkResponse.OkResponse)
+	suite.Require().Nil(checkResponse.DeniedResponse)
+	suite.client.AssertExpectations(suite.T())
+}
+
+func (suite *CheckerTestSuite) TestCheckDenied() {
+	suite.client.
+		On("QueryDecision", mock.Anything, "/projects/p1", opaclient.ActionDelete, mock.Anything).
+		Return(&opaclient.Decision{Allowed: false, Reason: "project is locked"}, nil).
+		Once()
+
+	// the route configures the resource and action by context extensions
+	checkResponse, err := suite.checker.Check(suite.ctx, &CheckRequest{
+		Attributes: &AttributeContext{
+			Request: &AttributeContextRequest{
+				HTTP: &HTTPRequest{Method: http.MethodPost, Path: "/api/projects/p1/archive"},
+			},
+			ContextExtensions: map[string]string{
+				ResourceContextExtension: "/projects/p1",
+				ActionContextExtension:   string(opaclient.ActionDelete),
+			},
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal(codePermissionDenied, checkResponse.Status.Code)
+	suite.Require().Equal(int32(http.StatusForbidden), checkResponse.DeniedResponse.Status.Code)
+	suite.Require().Equal("project is locked", checkResponse.DeniedResponse.Body)
+	suite.client.AssertExpectations(suite.T())
+}
+
+func (suite *CheckerTestSuite) TestCheckInvalidRequest() {
+	for _, checkRequest := range []*CheckRequest{
+		{},
+		{Attributes: &AttributeContext{Request: &AttributeContextRequest{
+			HTTP: &HTTPRequest{Method: http.MethodConnect, Path: "/projects/p1"},
+		}}},
+		{Attributes: &AttributeContext{Request: &AttributeContextRequest{
+			HTTP: &HTTPRequest{Method: http.MethodGet},
+		}}},
+	} {
+		checkResponse, err := suite.checker.Check(suite.ctx, checkRequest)
+		suite.Require().NoError(err)
+		suite.Require().Equal(codeInvalidArgument, checkResponse.Status.Code)
+		suite.Require().Equal(int32(http.StatusBadRequest), checkResponse.DeniedResponse.Status.Code)
+	}
+	suite.client.AssertNotCalled(suite.T(), "QueryDecision")
+}
+
+func (suite *CheckerTestSuite) TestCheckUncleanPath() {
+	for _, testCase := range []struct {
+		name string
+		path string
+	}{
+		{name: "dotDot", path: "/projects/p1/../p2?force=true"},
+		{name: "dot", path: "/projects/./p1"},
+		{name: "repeatedSlashes", path: "/projects//p1"},
+		{name: "relative", path: "projects/p1"},
+	} {
+		suite.Run(testCase.name, func() {
+			checkResponse, err := suite.checker.Check(suite.ctx, &CheckRequest{
+				Attributes: &AttributeContext{Request: &AttributeContextRequest{
+					HTTP: &HTTPRequest{Method: http.MethodGet, Path: testCase.path},
+				}},
+			})
+			suite.Require().NoError(err)
+			suite.Require().Equal(codeInvalidArgument, checkResponse.Status.Code)
+			suite.Require().Equal(int32(http.StatusBadRequest), checkResponse.DeniedResponse.Status.Code)
+			suite.Require().Equal(http.StatusText(http.StatusBadRequest), checkResponse.DeniedResponse.Body)
+		})
+	}
+	suite.client.AssertNotCalled(suite.T(), "QueryDecision")
+}
+
+func (suite *CheckerTestSuite) TestRequirePermissionOptions() {
+	_, err := NewChecker(nil, Config{Client: suite.client})
+	suite.Require().Error(err)
+}
+
+func (suite *CheckerTestSuite) TestCheckQueryFailure() {
+	suite.client.
+		On("QueryDecision", mock.Anything, "/projects/p1", opaclient.ActionRead, mock.Anything).
+		Return((*opaclient.Decision)(nil), errors.New("OPA is unavailable")).
+		Once()
+
+	_, err := suite.checker.Check(suite.ctx, &CheckRequest{
+		Attributes: &AttributeContext{Request: &AttributeContextRequest{
+			HTTP: &HTTPRequest{Method: http.MethodGet, Path: "/projects/p1"},
+		}},
+	})
+	suite.Require().Error(err)
+	suite.Require().Equal("OPA is unavailable", errors.RootCause(err).Error())
+}
+
+// permissionOptionsFromHeaders reads the member ids from the x-member-ids header, standing for a trusted
+// identity source
+func permissionOptionsFromHeaders(ctx context.Context, request *CheckRequest) (*opaclient.PermissionOptions, error) {
+	return &opaclient.PermissionOptions{
+		MemberIds: opaclient.MemberIDsFromHeader(http.Header{
+			"X-Member-Ids": {request.Attributes.Request.HTTP.Headers["x-member-ids"]},
+		}, "x-member-ids"),
+	}, nil
+}
+
+func TestCheckerTestSuite(t *testing.T) {
+	suite.Run(t, new(CheckerTestSuite))
+}
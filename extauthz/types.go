@@ -0,0 +1,91 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package extauthz
+
+// the subset of the envoy.service.auth.v3 check messages used for authorization. Fields are tagged by their proto3
+// JSON names, so the envoy messages convert to and from them by their JSON encoding (see protojson)
+
+// gRPC status codes of check responses
+const (
+	codeOK               int32 = 0
+	codeInvalidArgument  int32 = 3
+	codePermissionDenied int32 = 7
+)
+
+type CheckRequest struct {
+	Attributes *AttributeContext `json:"attributes,omitempty"`
+}
+
+type AttributeContext struct {
+	Request *AttributeContextRequest `json:"request,omitempty"`
+
+	// ContextExtensions are set per route (or virtual host) by the ext_authz filter configuration
+	ContextExtensions map[string]string `json:"contextExtensions,omitempty"`
+}
+
+type AttributeContextRequest struct {
+	HTTP *HTTPRequest `json:"http,omitempty"`
+}
+
+type HTTPRequest struct {
+	ID     string `json:"id,omitempty"`
+	Method string `json:"method,omitempty"`
+
+	// Headers are keyed by lower-case header names
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Path is the request path, including the query string
+	Path     string `json:"path,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Scheme   string `json:"scheme,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+type CheckResponse struct {
+	Status         *Status             `json:"status,omitempty"`
+	DeniedResponse *DeniedHTTPResponse `json:"deniedResponse,omitempty"`
+	OkResponse     *OkHTTPResponse     `json:"okResponse,omitempty"`
+}
+
+// Status is a google.rpc.Status, whose code is OK for allowed requests
+type Status struct {
+	Code    int32  `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type DeniedHTTPResponse struct {
+	Status  *HTTPStatus         `json:"status,omitempty"`
+	Headers []HeaderValueOption `json:"headers,omitempty"`
+	Body    string              `json:"body,omitempty"`
+}
+
+type OkHTTPResponse struct {
+	Headers []HeaderValueOption `json:"headers,omitempty"`
+}
+
+type HTTPStatus struct {
+	Code int32 `json:"code,omitempty"`
+}
+
+type HeaderValueOption struct {
+	Header *HeaderValue `json:"header,omitempty"`
+}
+
+type HeaderValue struct {
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+}
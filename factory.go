@@ -17,25 +17,327 @@ limitations under the License.
 package opaclient
 
 import (
+	"crypto/tls"
 	"time"
 
 	"github.com/nuclio/logger"
 )
 
-// CreateOpaClient creates an OPA client by a given configuration
+// CreateOpaClient creates an OPA client by a given configuration. A nil logger discards the client logs
 func CreateOpaClient(parentLogger logger.Logger, opaConfiguration *Config) Client {
 	var newOpaClient Client
 
+	if parentLogger == nil {
+		parentLogger = NopLogger{}
+	}
+
 	switch opaConfiguration.ClientKind {
 	case ClientKindHTTP:
+		options := []Option{
+			WithTransportTimeouts(time.Duration(opaConfiguration.DialTimeout)*time.Second,
+				time.Duration(opaConfiguration.TLSHandshakeTimeout)*time.Second,
+				time.Duration(opaConfiguration.ResponseHeaderTimeout)*time.Second),
+		}
+		if opaConfiguration.AdaptiveTimeoutPercentile > 0 {
+			multiplier := opaConfiguration.AdaptiveTimeoutMultiplier
+			if multiplier <= 0 {
+				multiplier = DefaultAdaptiveTimeoutMultiplier
+			}
+			minTimeout := time.Duration(opaConfiguration.AdaptiveTimeoutMinMillis) * time.Millisecond
+			if minTimeout <= 0 {
+				minTimeout = DefaultAdaptiveTimeoutMin
+			}
+			options = append(options,
+				WithAdaptiveTimeout(opaConfiguration.AdaptiveTimeoutPercentile, multiplier, minTimeout))
+		}
+		if opaConfiguration.AdaptiveThrottling {
+			options = append(options,
+				WithAdaptiveThrottling(time.Duration(opaConfiguration.AdaptiveThrottlingWindow)*time.Second,
+					opaConfiguration.AdaptiveThrottlingMultiplier))
+		}
+		if opaConfiguration.MaxConcurrentRequests > 0 {
+			options = append(options,
+				WithRequestQueue(opaConfiguration.MaxConcurrentRequests, opaConfiguration.RequestQueueSize))
+		}
+		if opaConfiguration.FilterChunkSize > 0 {
+			options = append(options,
+				WithFilterChunking(opaConfiguration.FilterChunkSize, opaConfiguration.FilterChunkConcurrency))
+		}
+		if opaConfiguration.WarmupConnections > 0 {
+			options = append(options, WithWarmup(opaConfiguration.WarmupConnections))
+		}
+		if opaConfiguration.DNSCacheTTL > 0 {
+			options = append(options,
+				WithCachingResolver(NewCachingResolver(time.Duration(opaConfiguration.DNSCacheTTL)*time.Second)))
+		}
+		if opaConfiguration.HTTPClient != nil {
+			options = append(options, WithHTTPClient(opaConfiguration.HTTPClient))
+		} else if opaConfiguration.RoundTripper != nil {
+			options = append(options, WithRoundTripper(opaConfiguration.RoundTripper))
+		}
+		if opaConfiguration.TLSCertFile != "" || opaConfiguration.TLSCAFile != "" {
+			certificateReloader, err := NewCertificateReloader(parentLogger,
+				opaConfiguration.TLSCertFile,
+				opaConfiguration.TLSKeyFile,
+				opaConfiguration.TLSCAFile)
+			if err != nil {
+				parentLogger.ErrorWith("Failed to load certificates, failing the requests over TLS",
+					"tlsCertFile", opaConfiguration.TLSCertFile,
+					"tlsCAFile", opaConfiguration.TLSCAFile,
+					"err", err.Error())
+				options = append(options, func(c *HTTPClient) {
+					c.failTLS(err)
+				})
+			} else {
+				options = append(options, WithCertificateReloader(certificateReloader))
+			}
+		}
+		for address, endpointTLSConfig := range opaConfiguration.EndpointTLS {
+			tlsConfig, err := createEndpointTLSConfig(parentLogger, endpointTLSConfig)
+			if err != nil {
+				parentLogger.ErrorWith("Failed to load endpoint certificates, failing the requests to the endpoint",
+					"address", address,
+					"err", err.Error())
+				options = append(options, func(c *HTTPClient) {
+					c.failEndpointTLS(address, err)
+				})
+				continue
+			}
+			options = append(options, WithEndpointTLS(address, tlsConfig))
+		}
+
+		// secrets given as references are resolved by the client, and re-resolved as they rotate
+		secretResolvers := opaConfiguration.SecretResolvers
+		if secretResolvers == nil {
+			secretResolvers = DefaultSecretResolvers()
+		}
+		secretReferences, hasSecretReferences := splitSecretReferences(opaConfiguration, secretResolvers)
+
+		if opaConfiguration.OAuth2TokenURL != "" {
+
+			// a referenced client secret is resolved (and rotated) along with the other secrets
+			options = append(options, WithTokenSource(NewClientCredentialsTokenSource(nil,
+				opaConfiguration.OAuth2TokenURL,
+				opaConfiguration.OAuth2ClientID,
+				literalSecret(opaConfiguration.OAuth2ClientSecret, secretResolvers),
+				opaConfiguration.OAuth2Scopes)))
+		}
+		if opaConfiguration.SPNEGOProvider != nil {
+			options = append(options, WithSPNEGO(opaConfiguration.SPNEGOProvider, opaConfiguration.SPNEGOPreemptive))
+		}
+		if opaConfiguration.HealthProbeInterval > 0 {
+			options = append(options,
+				WithHealthProbing(time.Duration(opaConfiguration.HealthProbeInterval)*time.Second,
+					opaConfiguration.HealthListeners...))
+		}
+		if opaConfiguration.MaxResponseSize > 0 {
+			options = append(options, WithMaxResponseSize(opaConfiguration.MaxResponseSize))
+		}
+		if opaConfiguration.OverrideHeaderName != "" || len(opaConfiguration.OverrideHeaderValues) > 0 {
+			options = append(options, WithOverride(opaConfiguration.OverrideHeaderName,
+				literalSecrets(opaConfiguration.OverrideHeaderValues, secretResolvers)...))
+		}
+		if opaConfiguration.RequestSigningKey != "" && !secretResolvers.IsReference(opaConfiguration.RequestSigningKey) {
+			options = append(options, WithRequestSigning([]byte(opaConfiguration.RequestSigningKey)))
+		}
+		if len(opaConfiguration.OverrideTokenKeys) > 0 {
+			var overrideTokenKeys [][]byte
+			for _, overrideTokenKey := range literalSecrets(opaConfiguration.OverrideTokenKeys, secretResolvers) {
+				overrideTokenKeys = append(overrideTokenKeys, []byte(overrideTokenKey))
+			}
+			options = append(options, WithOverrideTokens(overrideTokenKeys, opaConfiguration.OverrideTokenIssuers...))
+		}
+		if hasSecretReferences {
+			secretRefreshInterval := time.Duration(opaConfiguration.SecretRefreshInterval) * time.Second
+			if secretRefreshInterval == 0 {
+				secretRefreshInterval = DefaultSecretRefreshInterval
+			}
+			options = append(options, WithSecretReferences(secretReferences, secretResolvers, secretRefreshInterval))
+		}
+		if opaConfiguration.ForwardIdentity {
+			options = append(options, WithIdentityForwarding())
+		}
+		if opaConfiguration.EndpointProvider != nil {
+			options = append(options, WithEndpointProvider(opaConfiguration.EndpointProvider))
+		}
+		inputValidators := opaConfiguration.InputValidators
+		if opaConfiguration.ValidateInput {
+			inputValidators = append([]InputValidator{StandardInputValidator}, inputValidators...)
+		}
+		if len(inputValidators) > 0 {
+			options = append(options, WithInputValidators(inputValidators...))
+		}
+		if len(opaConfiguration.ResourceNormalization) > 0 || opaConfiguration.ResourceNormalizer != nil {
+			resourceNormalizer, err := NewResourceNormalizer(opaConfiguration.ResourceNormalization...)
+			if err != nil {
+				parentLogger.WarnWith("Failed to create resource normalizer, querying resources as given",
+					"resourceNormalization", opaConfiguration.ResourceNormalization,
+					"err", err.Error())
+			} else {
+				if opaConfiguration.ResourceNormalizer != nil {
+					resourceNormalizer = ChainResourceNormalizers(resourceNormalizer, opaConfiguration.ResourceNormalizer)
+				}
+				options = append(options, WithResourceNormalizer(resourceNormalizer))
+			}
+		}
+		if len(opaConfiguration.Interceptors) > 0 {
+			options = append(options, WithInterceptors(opaConfiguration.Interceptors...))
+		}
+		if opaConfiguration.CacheTTL > 0 || len(opaConfiguration.CacheActionTTLs) > 0 {
+			options = append(options, WithDecisionCache(NewMemoryDecisionCache(opaConfiguration.CacheSize),
+				time.Duration(opaConfiguration.CacheTTL)*time.Second))
+		}
+		if opaConfiguration.CacheDenyTTL != nil {
+			options = append(options, WithCacheDenyTTL(time.Duration(*opaConfiguration.CacheDenyTTL)*time.Second))
+		}
+		if len(opaConfiguration.CacheActionTTLs) > 0 {
+			cacheActionTTLs := map[Action]time.Duration{}
+			for action, cacheActionTTL := range opaConfiguration.CacheActionTTLs {
+				cacheActionTTLs[action] = time.Duration(cacheActionTTL) * time.Second
+			}
+			options = append(options, WithCacheActionTTLs(cacheActionTTLs))
+		}
+		if opaConfiguration.CacheRefreshWindow > 0 {
+			options = append(options,
+				WithCacheRefreshWindow(time.Duration(opaConfiguration.CacheRefreshWindow)*time.Second))
+		}
+
+		if opaConfiguration.PermissionResourceActionsPath != "" {
+			options = append(options, WithResourceActionsPath(opaConfiguration.PermissionResourceActionsPath))
+		}
+		if opaConfiguration.PermissionAllowedActionsPath != "" {
+			options = append(options, WithAllowedActionsPath(opaConfiguration.PermissionAllowedActionsPath))
+		}
+		if opaConfiguration.PermissionMultiSubjectsPath != "" {
+			options = append(options, WithMultiSubjectsPath(opaConfiguration.PermissionMultiSubjectsPath))
+		}
+		if opaConfiguration.PermissionPaginatedFilterPath != "" {
+			options = append(options, WithPaginatedFilterPath(opaConfiguration.PermissionPaginatedFilterPath,
+				opaConfiguration.FilterPageSize))
+		}
+		if opaConfiguration.Provenance {
+			options = append(options, WithProvenance())
+		}
+		if opaConfiguration.RevisionPollInterval > 0 {
+			options = append(options,
+				WithRevisionPolling(time.Duration(opaConfiguration.RevisionPollInterval)*time.Second))
+		}
+		if opaConfiguration.StrictBuiltinErrors {
+			options = append(options, WithStrictBuiltinErrors())
+		}
+		if opaConfiguration.Instrument {
+			options = append(options, WithInstrumentation())
+		}
+
+		if opaConfiguration.CacheMaxStaleness > 0 {
+			options = append(options,
+				WithStaleDecisions(time.Duration(opaConfiguration.CacheMaxStaleness)*time.Second))
+		}
+		if opaConfiguration.FallbackPolicy != nil {
+			options = append(options, WithFallbackPolicy(opaConfiguration.FallbackPolicy))
+		}
+		if opaConfiguration.EnforcementMode != "" {
+			options = append(options, WithEnforcementMode(opaConfiguration.EnforcementMode))
+		}
+		if opaConfiguration.ShadowAddress != "" ||
+			opaConfiguration.ShadowPermissionQueryPath != "" ||
+			opaConfiguration.ShadowPermissionFilterPath != "" {
+			options = append(options, WithShadow(opaConfiguration.ShadowAddress,
+				opaConfiguration.ShadowPermissionQueryPath,
+				opaConfiguration.ShadowPermissionFilterPath))
+		}
+		if opaConfiguration.CanaryPercentage > 0 {
+			options = append(options, WithCanary(opaConfiguration.CanaryPermissionQueryPath,
+				opaConfiguration.CanaryPermissionFilterPath,
+				opaConfiguration.CanaryPercentage))
+		}
+
+		var decisionLogSinks []DecisionLogSink
+		if opaConfiguration.DecisionLogPath != "" {
+			decisionLogSink, err := NewFileDecisionLogSink(opaConfiguration.DecisionLogPath,
+				int64(opaConfiguration.DecisionLogMaxSizeMB)*1024*1024,
+				opaConfiguration.DecisionLogMaxBackups)
+			if err != nil {
+				parentLogger.WarnWith("Failed to create decision log sink, decisions will not be logged to file",
+					"decisionLogPath", opaConfiguration.DecisionLogPath,
+					"err", err.Error())
+			} else {
+				decisionLogSinks = append(decisionLogSinks, decisionLogSink)
+			}
+		}
+		if opaConfiguration.DecisionLogCollectorURL != "" {
+			decisionLogSinks = append(decisionLogSinks, NewHTTPDecisionLogSink(parentLogger,
+				opaConfiguration.DecisionLogCollectorURL,
+				nil,
+				0,
+				0))
+		}
+		if len(decisionLogSinks) > 0 {
+			var decisionLogSink DecisionLogSink = NewMultiDecisionLogSink(decisionLogSinks...)
+			if len(decisionLogSinks) == 1 {
+				decisionLogSink = decisionLogSinks[0]
+			}
+			options = append(options, WithDecisionLogSink(NewBufferedDecisionLogSink(parentLogger,
+				decisionLogSink,
+				opaConfiguration.DecisionLogQueueSize,
+				0,
+				time.Duration(opaConfiguration.DecisionLogFlushInterval)*time.Second)))
+		}
+		if opaConfiguration.StatsdAddress != "" {
+			metricsSink, err := NewStatsdMetricsSink(parentLogger,
+				opaConfiguration.StatsdAddress,
+				opaConfiguration.StatsdPrefix,
+				opaConfiguration.StatsdTags)
+			if err != nil {
+				parentLogger.WarnWith("Failed to create statsd metrics sink, not reporting metrics",
+					"statsdAddress", opaConfiguration.StatsdAddress,
+					"err", err.Error())
+			} else {
+				options = append(options, WithMetricsSink(metricsSink))
+			}
+		}
+		if len(opaConfiguration.DecisionHooks) > 0 {
+			options = append(options, WithDecisionHooks(opaConfiguration.DecisionHooks...))
+		}
+		if opaConfiguration.OnRetry != nil {
+			options = append(options, WithRetryHook(opaConfiguration.OnRetry))
+		}
+		if opaConfiguration.RetryBudgetRatio > 0 {
+			options = append(options, WithRetryBudget(opaConfiguration.RetryBudgetRatio,
+				time.Duration(opaConfiguration.RetryBudgetWindow)*time.Second,
+				opaConfiguration.RetryBudgetMinRetries))
+		}
+		if opaConfiguration.StatsWindow > 0 {
+			options = append(options, WithStatsWindow(time.Duration(opaConfiguration.StatsWindow)*time.Second))
+		}
+		if opaConfiguration.DecisionIDs {
+			options = append(options, WithDecisionIDs())
+		}
+		if opaConfiguration.GETQueryMaxInputSize > 0 {
+			options = append(options, WithGETQueries(opaConfiguration.GETQueryMaxInputSize))
+		}
+		if len(opaConfiguration.Routes) > 0 {
+			options = append(options, WithRoutes(opaConfiguration.Routes...))
+		}
+		if opaConfiguration.SidecarDetection {
+			options = append(options, WithSidecarDetection(opaConfiguration.SidecarAddresses...))
+		}
+		if opaConfiguration.ValidatePolicyPaths {
+			options = append(options, WithPolicyPathValidation())
+		}
+		if opaConfiguration.RequestDumpWriter != nil {
+			options = append(options, WithRequestDump(opaConfiguration.RequestDumpWriter))
+		}
+
 		newOpaClient = NewHTTPClient(parentLogger,
 			opaConfiguration.Address,
 			opaConfiguration.PermissionQueryPath,
 			opaConfiguration.PermissionFilterPath,
 			time.Duration(opaConfiguration.RequestTimeout)*time.Second,
 			opaConfiguration.Verbose,
-			opaConfiguration.OverrideHeaderValue,
-			opaConfiguration.SkipTLSVerify)
+			literalSecret(opaConfiguration.OverrideHeaderValue, secretResolvers),
+			opaConfiguration.SkipTLSVerify,
+			options...)
 
 	case ClientKindMock:
 		newOpaClient = &MockClient{}
@@ -49,3 +351,76 @@ func CreateOpaClient(parentLogger logger.Logger, opaConfiguration *Config) Clien
 
 	return newOpaClient
 }
+
+// createEndpointTLSConfig creates the TLS configuration of an OPA server address, by its configuration
+func createEndpointTLSConfig(parentLogger logger.Logger, endpointTLSConfig *EndpointTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: endpointTLSConfig.SkipVerify,
+	}
+	if endpointTLSConfig.CertFile == "" && endpointTLSConfig.CAFile == "" {
+		return tlsConfig, nil
+	}
+
+	certificateReloader, err := NewCertificateReloader(parentLogger,
+		endpointTLSConfig.CertFile,
+		endpointTLSConfig.KeyFile,
+		endpointTLSConfig.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	certificateReloader.ConfigureTLS(tlsConfig)
+	return tlsConfig, nil
+}
+
+// splitSecretReferences returns the secrets of the configuration given as references (along with the bearer token,
+// unless authenticating by OAuth2), and whether there are any
+func splitSecretReferences(opaConfiguration *Config, secretResolvers SecretResolvers) (SecretReferences, bool) {
+	secretReferences := SecretReferences{}
+	if opaConfiguration.OAuth2TokenURL == "" {
+		secretReferences.BearerToken = opaConfiguration.BearerToken
+	}
+	for _, overrideHeaderValue := range append([]string{opaConfiguration.OverrideHeaderValue},
+		opaConfiguration.OverrideHeaderValues...) {
+		if secretResolvers.IsReference(overrideHeaderValue) {
+			secretReferences.OverrideHeaderValues = append(secretReferences.OverrideHeaderValues, overrideHeaderValue)
+		}
+	}
+	for _, overrideTokenKey := range opaConfiguration.OverrideTokenKeys {
+		if secretResolvers.IsReference(overrideTokenKey) {
+			secretReferences.OverrideTokenKeys = append(secretReferences.OverrideTokenKeys, overrideTokenKey)
+		}
+	}
+	if secretResolvers.IsReference(opaConfiguration.RequestSigningKey) {
+		secretReferences.RequestSigningKey = opaConfiguration.RequestSigningKey
+	}
+	if opaConfiguration.OAuth2TokenURL != "" && secretResolvers.IsReference(opaConfiguration.OAuth2ClientSecret) {
+		secretReferences.OAuth2ClientSecret = opaConfiguration.OAuth2ClientSecret
+	}
+
+	hasSecretReferences := secretReferences.BearerToken != "" ||
+		len(secretReferences.OverrideHeaderValues) > 0 ||
+		len(secretReferences.OverrideTokenKeys) > 0 ||
+		secretReferences.RequestSigningKey != "" ||
+		secretReferences.OAuth2ClientSecret != ""
+	return secretReferences, hasSecretReferences
+}
+
+// literalSecrets returns the secrets which aren't references
+func literalSecrets(secrets []string, secretResolvers SecretResolvers) []string {
+	var literals []string
+	for _, secret := range secrets {
+		if literal := literalSecret(secret, secretResolvers); literal != "" {
+			literals = append(literals, literal)
+		}
+	}
+	return literals
+}
+
+// literalSecret returns the secret, or an empty one if it's a reference
+func literalSecret(secret string, secretResolvers SecretResolvers) string {
+	if secretResolvers.IsReference(secret) {
+		return ""
+	}
+	return secret
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"path"
+	"slices"
+)
+
+// FallbackPolicy is a local rule set, consulted only when OPA is unavailable (see WithFallbackPolicy)
+type FallbackPolicy struct {
+
+	// Rules are evaluated in order, and the first matching rule decides
+	Rules []FallbackRule `json:"rules,omitempty"`
+}
+
+// FallbackRule allows or denies actions on resources matching a pattern
+type FallbackRule struct {
+
+	// Resource is a pattern (see path.Match) the resource must match. An empty pattern matches any resource
+	Resource string `json:"resource,omitempty"`
+
+	// Actions the rule applies to. No actions match any action
+	Actions []Action `json:"actions,omitempty"`
+
+	Allow bool `json:"allow,omitempty"`
+}
+
+// Evaluate returns the decision of the first rule matching the given resource and action,
+// and whether any rule matched
+func (p *FallbackPolicy) Evaluate(resource string, action Action) (bool, bool) {
+	for _, rule := range p.Rules {
+		if rule.matches(resource, action) {
+			return rule.Allow, true
+		}
+	}
+	return false, false
+}
+
+func (r *FallbackRule) matches(resource string, action Action) bool {
+	if len(r.Actions) > 0 && !slices.Contains(r.Actions, action) {
+		return false
+	}
+	if r.Resource == "" {
+		return true
+	}
+	matched, err := path.Match(r.Resource, resource)
+	return err == nil && matched
+}
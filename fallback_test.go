@@ -0,0 +1,65 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type FallbackPolicyTestSuite struct {
+	suite.Suite
+}
+
+func (suite *FallbackPolicyTestSuite) TestEvaluate() {
+
+	// allow reading p1 and its functions, and deny writes
+	fallbackPolicy := &FallbackPolicy{
+		Rules: []FallbackRule{
+			{Resource: "/projects/p1/functions/*", Actions: []Action{ActionRead}, Allow: true},
+			{Resource: "/projects/p1", Actions: []Action{ActionRead}, Allow: true},
+			{Actions: []Action{ActionCreate, ActionUpdate, ActionDelete}, Allow: false},
+		},
+	}
+
+	for _, testCase := range []struct {
+		name            string
+		resource        string
+		action          Action
+		expectedAllowed bool
+		expectedMatched bool
+	}{
+		{name: "project", resource: mustResource(ProjectResource("p1")), action: ActionRead, expectedAllowed: true, expectedMatched: true},
+		{name: "function", resource: mustResource(FunctionResource("p1", "f1")), action: ActionRead, expectedAllowed: true, expectedMatched: true},
+		{name: "apiGateway", resource: mustResource(APIGatewayResource("p1", "gw1")), action: ActionRead, expectedAllowed: false, expectedMatched: false},
+		{name: "otherProject", resource: mustResource(ProjectResource("p2")), action: ActionRead, expectedAllowed: false, expectedMatched: false},
+		{name: "write", resource: mustResource(ProjectResource("p1")), action: ActionUpdate, expectedAllowed: false, expectedMatched: true},
+	} {
+		suite.Run(testCase.name, func() {
+			allowed, matched := fallbackPolicy.Evaluate(testCase.resource, testCase.action)
+			suite.Require().Equal(testCase.expectedAllowed, allowed)
+			suite.Require().Equal(testCase.expectedMatched, matched)
+		})
+	}
+}
+
+func TestFallbackPolicyTestSuite(t *testing.T) {
+	suite.Run(t, new(FallbackPolicyTestSuite))
+}
@@ -0,0 +1,90 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"slices"
+	"testing"
+	"unicode/utf8"
+)
+
+// the fuzz targets run their seeds with the unit tests. To fuzz, run e.g.:
+// go test -tags test_unit -run '^$' -fuzz FuzzPermissionQueryResponse
+
+func FuzzPermissionQueryResponse(f *testing.F) {
+	for _, seed := range []string{
+		`{"result": true}`,
+		`{"result": false, "provenance": {"version": "0.70.0", "bundles": {"authz": {"revision": "rev-1"}}}}`,
+		`{"result": {"allow": false, "reason": "not a member", "violations": ["v1"], "ttl_seconds": 30}}`,
+		`{"result": {"allow": true, "ttl_seconds": 1e300}}`,
+		`{"result": {"allow": true, "ttl_seconds": -1}}`,
+		`{"result": null, "metrics": {"timer_rego_query_eval_ns": 1000}}`,
+		`{}`,
+		`{"result": "true"}`,
+		`[[[[[[[[[[]]]]]]]]]]`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var response PermissionQueryResponse
+		if err := (JSONEncoder{}).Decode(data, &response); err != nil {
+			return
+		}
+		if response.CacheTTL != nil && (*response.CacheTTL < 0 || *response.CacheTTL > maxCacheTTLHint) {
+			t.Fatalf("Cache TTL %s is out of range", *response.CacheTTL)
+		}
+		if !utf8.ValidString(response.Reason) {
+			t.Fatalf("Reason %q is not valid UTF-8", response.Reason)
+		}
+	})
+}
+
+func FuzzPermissionFilterResponse(f *testing.F) {
+	for _, seed := range []string{
+		`{"result": ["/projects/p1", "/projects/p2"]}`,
+		`{"result": [], "provenance": {"revision": "rev-1"}}`,
+		`{"result": null}`,
+		`{"result": ["é😀"]}`,
+		`{"result": [1, 2]}`,
+		`{"result": "/projects/p1"}`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var response PermissionFilterResponse
+		if err := (JSONEncoder{}).Decode(data, &response); err != nil {
+			return
+		}
+
+		// decoded responses are encoded and decoded back as is
+		encoded, err := JSONEncoder{}.Encode(response)
+		if err != nil {
+			t.Fatalf("Failed to encode: %v", err)
+		}
+		var decodedResponse PermissionFilterResponse
+		if err := (JSONEncoder{}).Decode(encoded, &decodedResponse); err != nil {
+			t.Fatalf("Failed to decode: %v", err)
+		}
+		if !slices.Equal(response.Result, decodedResponse.Result) {
+			t.Fatalf("Decoded result %q differs from %q", decodedResponse.Result, response.Result)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// DefaultGETQueryMaxInputSize is the max size of the url-encoded input of a query sent as a GET request
+const DefaultGETQueryMaxInputSize = 1024
+
+// getQueryInput returns the (JSON encoded) input of a single-resource query to send as a GET request
+// (see WithGETQueries), or false if it is to be sent as a POST request
+func (c *HTTPClient) getQueryInput(path string, request any) (string, bool) {
+	if c.getQueryMaxInputSize <= 0 || path != c.permissionQueryPath {
+		return "", false
+	}
+
+	// the input is sent as is, so it must be JSON
+	if _, isJSON := c.requestEncoder.(JSONEncoder); !isJSON {
+		return "", false
+	}
+	permissionQueryRequest, ok := request.(*PermissionQueryRequest)
+	if !ok {
+		return "", false
+	}
+
+	encodedInput, err := json.Marshal(permissionQueryRequest.Input)
+	if err != nil || len(url.QueryEscape(string(encodedInput))) > c.getQueryMaxInputSize {
+		return "", false
+	}
+	return string(encodedInput), true
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+)
+
+type HealthState string
+
+const (
+
+	// HealthStateUnknown is the state until the endpoints are probed (or if health probing is disabled)
+	HealthStateUnknown HealthState = "unknown"
+
+	// HealthStateHealthy is the state when all endpoints pass the probe
+	HealthStateHealthy HealthState = "healthy"
+
+	// HealthStateDegraded is the state when some of the endpoints fail the probe
+	HealthStateDegraded HealthState = "degraded"
+
+	// HealthStateDown is the state when all endpoints fail the probe
+	HealthStateDown HealthState = "down"
+)
+
+// Health is the health of the OPA endpoints, as last probed
+type Health struct {
+	State HealthState `json:"state"`
+
+	// UnhealthyEndpoints maps the endpoints failing the probe to their errors
+	UnhealthyEndpoints map[string]string `json:"unhealthyEndpoints,omitempty"`
+
+	ProbedAt time.Time `json:"probedAt,omitempty"`
+}
+
+// HealthListener is notified once the health state changes (e.g.: to fail the service readiness while OPA is down)
+type HealthListener func(ctx context.Context, previousHealth Health, health Health)
+
+// healthProber holds the health of the endpoints, as last probed, shared by clients derived from each other
+type healthProber struct {
+	interval  time.Duration
+	listeners []HealthListener
+
+	lock   sync.Mutex
+	health Health
+}
+
+func newHealthProber(interval time.Duration, listeners []HealthListener) *healthProber {
+	return &healthProber{
+		interval:  interval,
+		listeners: listeners,
+		health: Health{
+			State: HealthStateUnknown,
+		},
+	}
+}
+
+func (p *healthProber) get() Health {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.health
+}
+
+// update stores the probed health, returning the previous one
+func (p *healthProber) update(health Health) Health {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	previousHealth := p.health
+	p.health = health
+	return previousHealth
+}
+
+// healthyEndpoints returns the endpoints which passed the last probe, or all of them if none did
+// (so queries are still attempted, rather than failed outright)
+func (p *healthProber) healthyEndpoints(endpoints []string) []string {
+	health := p.get()
+	if len(health.UnhealthyEndpoints) == 0 {
+		return endpoints
+	}
+
+	healthyEndpoints := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if _, unhealthy := health.UnhealthyEndpoints[endpoint]; !unhealthy {
+			healthyEndpoints = append(healthyEndpoints, endpoint)
+		}
+	}
+	if len(healthyEndpoints) == 0 {
+		return endpoints
+	}
+	return healthyEndpoints
+}
+
+// Health returns the health of the OPA endpoints, as last probed (see WithHealthProbing)
+func (c *HTTPClient) Health() Health {
+	if c.healthProber == nil {
+		return Health{State: HealthStateUnknown}
+	}
+	return c.healthProber.get()
+}
+
+// probeHealth probes all endpoints at once, and notifies the listeners if the health state changed
+func (c *HTTPClient) probeHealth(ctx context.Context) {
+	endpoints := []string{c.address}
+	if c.endpointProvider != nil {
+		if providedEndpoints := c.endpointProvider.Endpoints(); len(providedEndpoints) > 0 {
+			endpoints = providedEndpoints
+		}
+	}
+
+	var lock sync.Mutex
+	var waitGroup sync.WaitGroup
+	unhealthyEndpoints := map[string]string{}
+	for _, endpoint := range endpoints {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			if err := c.probeEndpoint(ctx, endpoint); err != nil {
+				lock.Lock()
+				unhealthyEndpoints[endpoint] = err.Error()
+				lock.Unlock()
+			}
+		}()
+	}
+	waitGroup.Wait()
+
+	health := Health{
+		State:    HealthStateHealthy,
+		ProbedAt: c.clock.Now(),
+	}
+	if len(unhealthyEndpoints) > 0 {
+		health.UnhealthyEndpoints = unhealthyEndpoints
+		health.State = HealthStateDegraded
+		if len(unhealthyEndpoints) == len(endpoints) {
+			health.State = HealthStateDown
+		}
+	}
+
+	previousHealth := c.healthProber.update(health)
+	if previousHealth.State == health.State {
+		return
+	}
+
+	c.logger.InfoWithCtx(ctx, "OPA health state changed",
+		"previousState", previousHealth.State,
+		"state", health.State,
+		"unhealthyEndpoints", health.UnhealthyEndpoints)
+	for _, listener := range c.healthProber.listeners {
+		listener(ctx, previousHealth, health)
+	}
+}
+
+// probeEndpoint queries OPA's health API of the endpoint
+func (c *HTTPClient) probeEndpoint(ctx context.Context, endpoint string) error {
+	probeCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	headers, err := c.requestHeaders(probeCtx)
+	if err != nil {
+		return err
+	}
+
+	responseBody, _, err := sendHTTPRequest(probeCtx,
+		c.httpClient,
+		http.MethodGet,
+		endpoint+DefaultHealthPath,
+		nil,
+		headers,
+		[]*http.Cookie{},
+		http.StatusOK,
+		c.maxResponseSize)
+	if err != nil {
+		return errors.Wrap(opaResponseError(responseBody, err), "Failed to probe OPA health")
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import "context"
+
+// DecisionHooks are callbacks invoked with the record of every permission decision, letting applications wire custom
+// alerting (e.g.: on an error rate spike, or on repeated denies of a subject).
+// Hooks are invoked synchronously on the request path, so they must not block. Unset hooks are skipped
+type DecisionHooks struct {
+
+	// OnAllow is invoked with the record of an allowed decision
+	OnAllow func(ctx context.Context, record DecisionRecord)
+
+	// OnDeny is invoked with the record of a denied decision
+	OnDeny func(ctx context.Context, record DecisionRecord)
+
+	// OnError is invoked with the record of a failed decision (with its error set)
+	OnError func(ctx context.Context, record DecisionRecord)
+}
+
+func (h *DecisionHooks) invoke(ctx context.Context, record DecisionRecord) {
+	var hook func(ctx context.Context, record DecisionRecord)
+	switch {
+	case record.Error != "":
+		hook = h.OnError
+	case record.Allowed:
+		hook = h.OnAllow
+	default:
+		hook = h.OnDeny
+	}
+
+	if hook != nil {
+		hook(ctx, record)
+	}
+}
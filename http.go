@@ -21,23 +21,101 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
+	"maps"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nuclio/errors"
 	"github.com/nuclio/logger"
 )
 
+const (
+	queryRetryTimeout  = 6 * time.Second
+	queryRetryInterval = 1 * time.Second
+)
+
 type HTTPClient struct {
-	logger               logger.Logger
-	address              string
-	permissionQueryPath  string
-	permissionFilterPath string
-	requestTimeout       time.Duration
-	verbose              bool
-	overrideHeaderValue  string
-	httpClient           *http.Client
+	logger                        logger.Logger
+	address                       string
+	permissionQueryPath           string
+	permissionFilterPath          string
+	permissionResourceActionsPath string
+	permissionPaginatedFilterPath string
+	permissionMultiSubjectsPath   string
+	permissionAllowedActionsPath  string
+	filterPageSize                int
+	requestTimeout                time.Duration
+	verbose                       bool
+	overrideHeaderName            string
+	overrideHeaderValues          []string
+	overrideTokenKeys             [][]byte
+	overrideTokenIssuers          []string
+	httpClient                    *http.Client
+	transport                     *http.Transport
+	endpointTLSDialer             *endpointTLSDialer
+	dialer                        *net.Dialer
+	decisionCache                 DecisionCache
+	cacheTTL                      time.Duration
+	cacheDenyTTL                  *time.Duration
+	cacheActionTTLs               map[Action]time.Duration
+	cacheRefreshWindow            time.Duration
+	refreshingDecisions           *sync.Map
+	cacheCounters                 *cacheCounters
+	metricsSink                   MetricsSink
+	decisionLogSink               DecisionLogSink
+	requestEncoder                RequestEncoder
+	maxResponseSize               int64
+	provenance                    bool
+	policyRevision                *policyRevision
+	revisionPollInterval          time.Duration
+	strictBuiltinErrors           bool
+	instrument                    bool
+	shadowClient                  *HTTPClient
+	canary                        *canary
+	enforcementMode               EnforcementMode
+	fallbackPolicy                *FallbackPolicy
+	maxStaleness                  time.Duration
+	tokenSource                   TokenSource
+	forwardIdentity               bool
+	subjectResolver               SubjectResolver
+	interceptors                  []Interceptor
+	endpointProvider              EndpointProvider
+	healthProber                  *healthProber
+	nextEndpoint                  *atomic.Uint64
+	backgroundTasks               *backgroundTasks
+	defaultPermissionOptions      *PermissionOptions
+	resourceScope                 string
+	requestSlots                  *prioritySemaphore
+	adaptiveTimeout               *adaptiveTimeout
+	decisionHooks                 []DecisionHooks
+	queryCounters                 *queryCounters
+	clock                         Clock
+	onRetry                       func(attempt int, err error, nextDelay time.Duration)
+	warmupConnections             int
+	requestSigningKey             []byte
+	inputValidators               []InputValidator
+	resourceNormalizer            ResourceNormalizer
+	filterChunkSize               int
+	filterChunkConcurrency        int
+	adaptiveThrottling            *adaptiveThrottling
+	retryBudget                   *retryBudget
+	queryStats                    *queryStats
+	requestDumper                 *requestDumper
+	decisionIDs                   bool
+	getQueryMaxInputSize          int
+	routes                        []Route
+	routedClients                 []*routedClient
+	sidecarAddresses              []string
+	validatePolicyPaths           bool
+	secretRotation                *secretRotation
 }
 
 func NewHTTPClient(parentLogger logger.Logger,
@@ -48,6 +126,7 @@ func NewHTTPClient(parentLogger logger.Logger,
 	verbose bool,
 	overrideHeaderValue string,
 	skipTLSVerify bool,
+	options ...Option,
 ) *HTTPClient {
 
 	// enrich request timeout with a default value if not set
@@ -55,7 +134,10 @@ func NewHTTPClient(parentLogger logger.Logger,
 		requestTimeout = DefaultRequestTimeOut
 	}
 
-	transport := &http.Transport{}
+	dialer := &net.Dialer{}
+	transport := &http.Transport{
+		DialContext: dialer.DialContext,
+	}
 
 	// Enable this only for development purposes
 	if skipTLSVerify {
@@ -66,18 +148,82 @@ func NewHTTPClient(parentLogger logger.Logger,
 	}
 
 	newClient := HTTPClient{
-		logger:               parentLogger.GetChild("opa"),
+		logger:               childLogger(parentLogger, "opa"),
 		address:              address,
 		permissionQueryPath:  permissionQueryPath,
 		permissionFilterPath: permissionFilterPath,
 		requestTimeout:       requestTimeout,
 		verbose:              verbose,
-		overrideHeaderValue:  overrideHeaderValue,
+		refreshingDecisions:  &sync.Map{},
+		backgroundTasks:      newBackgroundTasks(),
+		cacheCounters:        &cacheCounters{},
+		queryCounters:        &queryCounters{},
+		queryStats:           newQueryStats(DefaultStatsWindow),
+		policyRevision:       &policyRevision{},
+		metricsSink:          NopMetricsSink{},
+		requestEncoder:       JSONEncoder{},
+		maxResponseSize:      DefaultMaxResponseSize,
+		clock:                SystemClock{},
+		transport:            transport,
+		dialer:               dialer,
 		httpClient: &http.Client{
 			Timeout:   requestTimeout,
 			Transport: transport,
 		},
 	}
+	if overrideHeaderValue != "" {
+		newClient.overrideHeaderValues = []string{overrideHeaderValue}
+	}
+
+	for _, option := range options {
+		option(&newClient)
+	}
+
+	// the OAuth2 client secret rotates along with the other secrets, whichever order the options were applied in
+	if newClient.secretRotation != nil && newClient.secretRotation.references.OAuth2ClientSecret != "" {
+		if clientCredentialsTokenSource, ok := newClient.tokenSource.(*ClientCredentialsTokenSource); ok {
+			clientCredentialsTokenSource.clientSecretSource = newClient.secretRotation.oauth2ClientSecret
+		}
+	}
+
+	// the sidecar is detected before deriving the routed clients, so those without an address query it as well
+	if len(newClient.sidecarAddresses) > 0 {
+		newClient.detectSidecar(context.Background())
+	}
+
+	// the routed clients are derived once all options are applied
+	if len(newClient.routes) > 0 {
+		newClient.buildRoutedClients()
+	}
+	newClient.buildBackgroundQueryClients()
+
+	if newClient.validatePolicyPaths {
+		if err := newClient.ValidatePolicyPaths(context.Background()); err != nil {
+			newClient.logger.ErrorWith("Failed to validate policy paths",
+				"err", err.Error())
+		}
+	}
+	if newClient.warmupConnections > 0 {
+		newClient.warmUp(context.Background())
+	}
+	if newClient.revisionPollInterval > 0 {
+		newClient.backgroundTasks.runPeriodically(newClient.clock,
+			newClient.revisionPollInterval,
+			newClient.pollPolicyRevision)
+	}
+	if newClient.healthProber != nil {
+		newClient.backgroundTasks.runPeriodically(newClient.clock,
+			newClient.healthProber.interval,
+			newClient.probeHealth)
+	}
+	if newClient.secretRotation != nil && newClient.secretRotation.refreshInterval > 0 {
+		newClient.backgroundTasks.runPeriodically(newClient.clock,
+			newClient.secretRotation.refreshInterval,
+			func(ctx context.Context) {
+				newClient.secretRotation.refresh(ctx, newClient.logger)
+			})
+	}
+
 	return &newClient
 }
 
@@ -85,171 +231,1410 @@ func NewHTTPClient(parentLogger logger.Logger,
 // The response is a list of booleans indicating for each resource if the action against such resource
 // is allowed or not.
 // Therefore, it is guaranteed that len(resources) and len(results) are equal and
-// resources[i] query permission is at results[i]
+// resources[i] query permission is at results[i].
+// Duplicate resources are queried once, and empty resources are rejected
 func (c *HTTPClient) QueryPermissionsMultiResources(ctx context.Context,
 	resources []string,
 	action Action,
 	permissionOptions *PermissionOptions) ([]bool, error) {
 
-	// initialize results
+	if err := validateResources(resources); err != nil {
+		return nil, err
+	}
+	scopedResources, err := c.scopeResources(resources)
+	if err != nil {
+		return nil, err
+	}
+	ctx, permissionOptions, err = c.resolvePermissionOptions(ctx, permissionOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	uniqueResources, uniqueResourceIdxs := deduplicateResources(scopedResources)
+	uniqueResult, err := c.queryUniqueResources(ctx, uniqueResources, action, permissionOptions)
+	if err != nil {
+		return nil, err
+	}
+
 	results := make([]bool, len(resources))
+	for resourceIdx, uniqueResourceIdx := range uniqueResourceIdxs {
+		results[resourceIdx] = uniqueResult.Results[uniqueResourceIdx]
+	}
+	return results, nil
+}
 
-	// If the override header value matches the configured override header value, allow without checking
-	if c.overrideHeaderValue != "" && permissionOptions.OverrideHeaderValue == c.overrideHeaderValue {
+// queryUniqueResources decides the given (unique) resources - by the override, the cached decisions and querying OPA.
+// The result is returned along with the error of the first failed chunk, if any (unless in monitor enforcement mode)
+func (c *HTTPClient) queryUniqueResources(ctx context.Context,
+	resources []string,
+	action Action,
+	permissionOptions *PermissionOptions) (*MultiResourceResult, error) {
+	var err error
+
+	// initialize results
+	multiResourceResult := &MultiResourceResult{
+		Results:   make([]bool, len(resources)),
+		Evaluated: make([]bool, len(resources)),
+	}
+	results := multiResourceResult.Results
+
+	// If the override header value matches any accepted override header value, allow without checking
+	if overrideIssuer, overridden := c.overridden(permissionOptions); overridden {
 
 		// allow them all
+		decisions := make([]*Decision, len(resources))
 		for i := 0; i < len(results); i++ {
 			results[i] = true
+			multiResourceResult.Evaluated[i] = true
+			decisions[i] = &Decision{
+				Resource:   resources[i],
+				Action:     action,
+				Allowed:    true,
+				Overridden: true,
+			}
 		}
+		c.auditOverride(ctx, decisions, permissionOptions, overrideIssuer)
 
-		return results, nil
+		return multiResourceResult, nil
 	}
 
-	requestURL := fmt.Sprintf("%s%s", c.address, c.permissionFilterPath)
+	// serve cached decisions, and query only the rest
+	cachedDecisions := c.getCachedDecisions(ctx, resources, action, permissionOptions)
+	decisions := make([]*Decision, len(resources))
+	decisionErrs := make([]error, len(resources))
+	var uncachedResources []string
+	var uncachedResourceIdxs []int
+	for resourceIdx, resource := range resources {
+		if cachedDecision := cachedDecisions[resourceIdx]; cachedDecision != nil {
+			decisions[resourceIdx] = cachedDecision.toDecision(resource, action)
+			continue
+		}
+		uncachedResources = append(uncachedResources, resource)
+		uncachedResourceIdxs = append(uncachedResourceIdxs, resourceIdx)
+	}
 
-	// send the request
-	headers := map[string]string{
-		"Content-Type": "application/json",
-		"User-Agent":   UserAgent,
+	if len(uncachedResources) > 0 {
+		uncachedDecisions, uncachedDecisionErrs, chunkErrors := c.queryChunks(ctx,
+			uncachedResources,
+			action,
+			permissionOptions)
+		for uncachedIdx, decision := range uncachedDecisions {
+			decisions[uncachedResourceIdxs[uncachedIdx]] = decision
+			decisionErrs[uncachedResourceIdxs[uncachedIdx]] = uncachedDecisionErrs[uncachedIdx]
+		}
+		multiResourceResult.ChunkErrors = chunkErrors
+		if len(chunkErrors) > 0 {
+			err = chunkErrors[0].Err
+		}
 	}
-	request := PermissionFilterRequest{Input: PermissionFilterRequestInput{
-		resources,
-		string(action),
-		permissionOptions.MemberIds,
-	}}
-	requestBody, err := json.Marshal(request)
+
+	for resourceIdx, decision := range decisions {
+		if decision != nil {
+			results[resourceIdx] = decision.Allowed
+			multiResourceResult.Evaluated[resourceIdx] = true
+		}
+	}
+
+	if c.recordsDecisions() {
+		decisionRecords := make([]DecisionRecord, len(resources))
+		for resourceIdx, resource := range resources {
+			decision := decisions[resourceIdx]
+			if decision == nil {
+				decision = &Decision{
+					Resource: resource,
+					Action:   action,
+				}
+			}
+			decisionRecords[resourceIdx] = newDecisionRecord(c.clock, decision, permissionOptions, decisionErrs[resourceIdx])
+		}
+		c.logDecisions(ctx, decisionRecords)
+	}
+
+	if c.enforcementMode == EnforcementModeMonitor {
+		c.monitorDecisions(ctx, resources, action, results, err)
+		for resourceIdx := range results {
+			results[resourceIdx] = true
+		}
+		return multiResourceResult, nil
+	}
+
+	return multiResourceResult, err
+}
+
+// QueryPermissionsMultiResourcesMap query permissions for multiple resources at once, like
+// QueryPermissionsMultiResources, returning the results keyed by the resources (as given) rather than by their index.
+// Duplicate resources map to a single entry
+func (c *HTTPClient) QueryPermissionsMultiResourcesMap(ctx context.Context,
+	resources []string,
+	action Action,
+	permissionOptions *PermissionOptions) (map[string]bool, error) {
+
+	results, err := c.QueryPermissionsMultiResources(ctx, resources, action, permissionOptions)
 	if err != nil {
-		return nil, errors.Wrap(err, "Failed to generate request body")
+		return nil, err
 	}
+	return resultsByResource(resources, results), nil
+}
 
-	if c.verbose {
-		c.logger.InfoWithCtx(ctx,
-			"Sending request to OPA",
-			"requestBody", string(requestBody),
-			"requestURL", requestURL)
+func (c *HTTPClient) QueryPermissions(ctx context.Context,
+	resource string,
+	action Action,
+	permissionOptions *PermissionOptions) (bool, error) {
+
+	decision, err := c.QueryDecision(ctx, resource, action, permissionOptions)
+	if err != nil {
+		return false, err
 	}
-	var responseBody []byte
-	if err := retryUntilSuccessful(6*time.Second,
-		1*time.Second,
-		func() bool {
-			responseBody, _, err = sendHTTPRequest(ctx,
-				c.httpClient,
-				http.MethodPost,
-				requestURL,
-				requestBody,
-				headers,
-				[]*http.Cookie{},
-				http.StatusOK)
+	return decision.Allowed, nil
+}
+
+// QueryDecision queries permission for a single resource, returning the decision along with its metadata
+// (e.g.: the deny reason, if returned by the policy).
+// If the permission is denied and permissionOptions.RaiseForbidden is set, a ForbiddenError is returned as well
+// (unless in monitor enforcement mode)
+func (c *HTTPClient) QueryDecision(ctx context.Context,
+	resource string,
+	action Action,
+	permissionOptions *PermissionOptions) (*Decision, error) {
+
+	resource, err := c.scopeResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	ctx, permissionOptions, err = c.resolvePermissionOptions(ctx, permissionOptions)
+	if err != nil {
+		return nil, err
+	}
+	decision, err := c.queryDecision(ctx, resource, action, permissionOptions)
+
+	if c.enforcementMode == EnforcementModeMonitor {
+		monitoredDecision := &Decision{
+			Resource: resource,
+			Action:   action,
+		}
+		if decision != nil {
+			monitoredDecision = decision
+		}
+		c.monitorDecisions(ctx, []string{resource}, action, []bool{monitoredDecision.Allowed}, err)
+		monitoredDecision.Allowed = true
+		monitoredDecision.Monitored = true
+		return monitoredDecision, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !decision.Allowed && permissionOptions.RaiseForbidden {
+		return decision, newForbiddenError(decision)
+	}
+	return decision, nil
+}
+
+func (c *HTTPClient) queryDecision(ctx context.Context,
+	resource string,
+	action Action,
+	permissionOptions *PermissionOptions) (*Decision, error) {
+
+	// If the override header value matches any accepted override header value, allow without checking
+	if overrideIssuer, overridden := c.overridden(permissionOptions); overridden {
+		decision := &Decision{
+			Resource:   resource,
+			Action:     action,
+			Allowed:    true,
+			Overridden: true,
+		}
+		c.auditOverride(ctx, []*Decision{decision}, permissionOptions, overrideIssuer)
+		return decision, nil
+	}
+
+	var decision *Decision
+	if cachedDecision := c.getCachedDecisions(ctx, []string{resource}, action, permissionOptions)[0]; cachedDecision != nil {
+		decision = cachedDecision.toDecision(resource, action)
+		if c.recordsDecisions() {
+			c.logDecisions(ctx, []DecisionRecord{newDecisionRecord(c.clock, decision, permissionOptions, nil)})
+		}
+	} else {
+		var err error
+		decision, err = c.queryPermissions(ctx, resource, action, permissionOptions)
+		if err != nil {
+			if failedQueryDecisions, decided := c.decideFailedQuery(ctx,
+				[]string{resource},
+				action,
+				permissionOptions,
+				err); decided {
+				decision, err = failedQueryDecisions[0], nil
+			}
+		}
+		if c.recordsDecisions() {
+			c.logDecisions(ctx, []DecisionRecord{newDecisionRecord(c.clock, decision, permissionOptions, err)})
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// stale and fallback decisions are neither compared nor cached
+		if !decision.Stale && !decision.Fallback {
+			c.shadowQueryPermissions(ctx, decision, permissionOptions)
+			c.canaryQueryPermissions(ctx, decision, permissionOptions)
+			c.cacheDecision(ctx, decision, permissionOptions)
+		}
+	}
+
+	return decision, nil
+}
+
+// Prefetch populates the decision cache with the decisions of the given resources and actions,
+// using a single filter request per action
+func (c *HTTPClient) Prefetch(ctx context.Context,
+	resources []string,
+	actions []Action,
+	permissionOptions *PermissionOptions) error {
+
+	if c.decisionCache == nil {
+		return nil
+	}
+
+	for _, action := range actions {
+		if _, err := c.QueryPermissionsMultiResources(ctx, resources, action, permissionOptions); err != nil {
+			return errors.Wrapf(err, "Failed to prefetch decisions for action %s", action)
+		}
+	}
+	return nil
+}
+
+// resolvePermissionOptions returns the permission options (which may be nil), completed by the client default ones
+// and enriched by the request context
+// (e.g.: the member ids it carries, the resolved subject, the forwarded identity) and client scope,
+// along with the context to query by (carrying the query tenant, priority, verbosity and decision id).
+// The given permission options are left untouched
+func (c *HTTPClient) resolvePermissionOptions(ctx context.Context,
+	permissionOptions *PermissionOptions) (context.Context, *PermissionOptions, error) {
+	if permissionOptions == nil {
+		permissionOptions = &PermissionOptions{}
+	}
+	resolvedPermissionOptions := permissionOptions.withDefaults(c.defaultPermissionOptions)
+
+	if len(resolvedPermissionOptions.MemberIds) == 0 && resolvedPermissionOptions.Subject == nil {
+		if memberIDs := MemberIDsFromContext(ctx); len(memberIDs) > 0 {
+			resolvedPermissionOptions.MemberIds = memberIDs
+		} else if c.subjectResolver != nil {
+			subject, err := c.subjectResolver.ResolveSubject(ctx)
 			if err != nil {
-				c.logger.WarnWithCtx(ctx, "Failed to send HTTP request to OPA, retrying",
-					"err", err.Error())
-				return false
+				return nil, nil, errors.Wrap(err, "Failed to resolve subject")
 			}
-			return true
-		}); err != nil {
-		if c.verbose {
-			c.logger.ErrorWithCtx(ctx,
-				"Failed to send HTTP request to OPA",
-				"err", errors.GetErrorStackString(err, 10))
+			resolvedPermissionOptions.Subject = subject
 		}
-		return nil, errors.Wrap(err, "Failed to send HTTP request to OPA")
 	}
 
-	if c.verbose {
-		c.logger.InfoWithCtx(ctx, "Received response from OPA",
-			"responseBody", string(responseBody))
+	if c.forwardIdentity {
+		if identity := IdentityFromContext(ctx); identity != nil {
+			resolvedPermissionOptions.setExtraInputField(IdentityInputField, identity)
+		}
 	}
 
-	permissionFilterResponse := PermissionFilterResponse{}
-	if err := json.Unmarshal(responseBody, &permissionFilterResponse); err != nil {
-		return nil, errors.Wrap(err, "Failed to unmarshal response body")
+	if c.resourceScope != "" {
+		resolvedPermissionOptions.setExtraInputField(ScopeInputField, c.resourceScope)
+	}
+
+	if tenant := resolvedPermissionOptions.tenant(); tenant != "" {
+		resolvedPermissionOptions.Tenant = tenant
+		resolvedPermissionOptions.setExtraInputField(TenantInputField, tenant)
+		ctx = withTenant(ctx, tenant)
+	}
+
+	// key the resource attributes by the scoped (and normalized) resources, as queried
+	if (c.resourceScope != "" || c.resourceNormalizer != nil) && len(resolvedPermissionOptions.ResourceAttributes) > 0 {
+		scopedResourceAttributes := make(map[string]map[string]any, len(resolvedPermissionOptions.ResourceAttributes))
+		for resource, attributes := range resolvedPermissionOptions.ResourceAttributes {
+			if scopedResource, err := c.scopeResource(resource); err == nil {
+				scopedResourceAttributes[scopedResource] = attributes
+			}
+		}
+		resolvedPermissionOptions.ResourceAttributes = scopedResourceAttributes
 	}
 
-	if c.verbose {
-		c.logger.InfoWithCtx(ctx, "Successfully unmarshalled permission filter response",
-			"permissionFilterResponse", permissionFilterResponse)
+	if resolvedPermissionOptions.Priority != "" {
+		ctx = withPriority(ctx, resolvedPermissionOptions.Priority)
+	}
+	if resolvedPermissionOptions.Verbose != nil {
+		ctx = withVerbose(ctx, *resolvedPermissionOptions.Verbose)
+	}
+	if c.decisionIDs && DecisionIDFromContext(ctx) == "" {
+		ctx = ContextWithDecisionID(ctx, newDecisionID())
+	}
+
+	return ctx, &resolvedPermissionOptions, nil
+}
+
+func (c *HTTPClient) queryPermissionsMultiResources(ctx context.Context,
+	resources []string,
+	action Action,
+	permissionOptions *PermissionOptions) ([]bool, *Provenance, error) {
+
+	if len(c.routedClients) > 0 {
+		return c.queryRoutedMultiResources(ctx, resources, action, permissionOptions)
+	}
+
+	results := make([]bool, len(resources))
+
+	requestInput := PermissionFilterRequestInput{
+		Resources: resources,
+		Action:    string(action),
+		Ids:       permissionOptions.memberIds(),
+		Subject:   permissionOptions.Subject,
+		Extra:     queryExtraInput(ctx, permissionOptions),
+	}
+
+	for _, resource := range resources {
+		if IsWildcardResource(resource) {
+			if requestInput.Prefixes == nil {
+				requestInput.Prefixes = map[string]string{}
+			}
+			requestInput.Prefixes[resource] = resourcePrefix(resource)
+		}
+	}
+
+	switch permissionOptions.HierarchyMode {
+	case HierarchyModeInput:
+		requestInput.Ancestors = map[string][]string{}
+		for _, resource := range resources {
+			requestInput.Ancestors[resource] = resourceAncestors(resource)
+		}
+
+	case HierarchyModeClient:
+
+		// query the resources along with all of their ancestors in a single request
+		var hierarchyResources []string
+		for _, resource := range resources {
+			for _, hierarchyResource := range append([]string{resource}, resourceAncestors(resource)...) {
+				if !slices.Contains(hierarchyResources, hierarchyResource) {
+					hierarchyResources = append(hierarchyResources, hierarchyResource)
+				}
+			}
+		}
+		requestInput.Resources = hierarchyResources
+	}
+	requestInput.Attributes = permissionOptions.resourceAttributes(requestInput.Resources)
+
+	allowedResources, provenance, err := c.queryFilter(ctx, requestInput)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	for resourceIdx, resource := range resources {
-		if slices.Contains(permissionFilterResponse.Result, resource) {
+		if slices.Contains(allowedResources, resource) {
 			results[resourceIdx] = true
+			continue
+		}
+
+		// a resource is allowed if any of its ancestors is allowed
+		if permissionOptions.HierarchyMode == HierarchyModeClient {
+			for _, ancestor := range resourceAncestors(resource) {
+				if slices.Contains(allowedResources, ancestor) {
+					results[resourceIdx] = true
+					break
+				}
+			}
 		}
 	}
-	return results, nil
+	return results, provenance, nil
 }
 
-func (c *HTTPClient) QueryPermissions(ctx context.Context,
+func (c *HTTPClient) queryPermissions(ctx context.Context,
 	resource string,
 	action Action,
-	permissionOptions *PermissionOptions) (bool, error) {
+	permissionOptions *PermissionOptions) (*Decision, error) {
 
-	// If the override header value matches the configured override header value, allow without checking
-	if c.overrideHeaderValue != "" && permissionOptions.OverrideHeaderValue == c.overrideHeaderValue {
-		return true, nil
+	if routeClient := c.routeClient(resource, action); routeClient != c {
+		return routeClient.queryPermissions(ctx, resource, action, permissionOptions)
 	}
 
-	requestURL := fmt.Sprintf("%s%s", c.address, c.permissionQueryPath)
+	decision := &Decision{
+		Resource:   resource,
+		Action:     action,
+		DecisionID: DecisionIDFromContext(ctx),
+	}
 
-	// send the request
-	headers := map[string]string{
-		"Content-Type": "application/json",
-		"User-Agent":   UserAgent,
+	// evaluate the resource and its ancestors in a single filter request
+	if permissionOptions.HierarchyMode == HierarchyModeClient {
+		results, provenance, err := c.queryPermissionsMultiResources(ctx, []string{resource}, action, permissionOptions)
+		if err != nil {
+			return decision, err
+		}
+		decision.Allowed = results[0]
+		decision.Provenance = provenance
+		return decision, nil
 	}
+
 	request := PermissionQueryRequest{Input: PermissionQueryRequestInput{
-		resource,
-		string(action),
-		permissionOptions.MemberIds,
+		Resource:   resource,
+		Action:     string(action),
+		Ids:        permissionOptions.memberIds(),
+		Subject:    permissionOptions.Subject,
+		Attributes: permissionOptions.ResourceAttributes[resource],
+		Extra:      queryExtraInput(ctx, permissionOptions),
 	}}
-	requestBody, err := json.Marshal(request)
+	if permissionOptions.HierarchyMode == HierarchyModeInput {
+		request.Input.Ancestors = resourceAncestors(resource)
+	}
+	if IsWildcardResource(resource) {
+		request.Input.Prefix = resourcePrefix(resource)
+	}
+
+	permissionResponse := PermissionQueryResponse{}
+	if err := c.sendQuery(ctx, c.permissionQueryPath, &request, &permissionResponse); err != nil {
+		return decision, err
+	}
+
+	decision.Allowed = permissionResponse.Result
+	decision.Reason = permissionResponse.Reason
+	decision.Violations = permissionResponse.Violations
+	decision.Obligations = permissionResponse.Obligations
+	decision.CacheTTL = permissionResponse.CacheTTL
+	decision.Provenance = permissionResponse.Provenance
+	decision.Metrics = permissionResponse.Metrics
+	return decision, nil
+}
+
+// backgroundQueryClient returns a copy of the client querying the given address and paths - authenticated, signed,
+// intercepted and balanced alike - to send the background (shadow and canary) queries by.
+// The copy neither caches, logs, reports nor routes its decisions, and has request slots, throttling and a retry
+// budget of its own, so failing background queries never hold back the client's own queries
+func (c *HTTPClient) backgroundQueryClient(name string,
+	address string,
+	permissionQueryPath string,
+	permissionFilterPath string) *HTTPClient {
+	client := *c
+	client.logger = c.logger.GetChild(name)
+	if address != c.address {
+		client.address = address
+		client.endpointProvider = nil
+	}
+	client.permissionQueryPath = permissionQueryPath
+	client.permissionFilterPath = permissionFilterPath
+	client.metricsSink = NopMetricsSink{}
+	client.decisionCache = nil
+	client.decisionLogSink = nil
+	client.decisionHooks = nil
+	client.shadowClient = nil
+	client.canary = nil
+	client.routes = nil
+	client.routedClients = nil
+	client.queryCounters = &queryCounters{}
+	client.queryStats = newQueryStats(DefaultStatsWindow)
+	client.onRetry = nil
+	if c.requestSlots != nil {
+		client.requestSlots = c.requestSlots.empty()
+	}
+	if c.adaptiveThrottling != nil {
+		client.adaptiveThrottling = c.adaptiveThrottling.empty()
+	}
+	if c.retryBudget != nil {
+		client.retryBudget = c.retryBudget.empty()
+	}
+	return &client
+}
+
+// buildBackgroundQueryClients derives the shadow and canary clients anew from the client, as configured by all options
+func (c *HTTPClient) buildBackgroundQueryClients() {
+	if c.shadowClient != nil {
+		c.shadowClient = c.backgroundQueryClient("shadow",
+			c.shadowClient.address,
+			c.shadowClient.permissionQueryPath,
+			c.shadowClient.permissionFilterPath)
+	}
+	if c.canary != nil {
+		c.canary = &canary{
+			client: c.backgroundQueryClient("canary",
+				c.address,
+				c.canary.client.permissionQueryPath,
+				c.canary.client.permissionFilterPath),
+			percentage: c.canary.percentage,
+		}
+	}
+}
+
+// shadowQueryPermissions queries the shadow in the background, and reports its divergence from the given decision
+func (c *HTTPClient) shadowQueryPermissions(ctx context.Context,
+	decision *Decision,
+	permissionOptions *PermissionOptions) {
+	if c.shadowClient == nil {
+		return
+	}
+
+	// the caller may reuse its options once we return
+	shadowPermissionOptions := *permissionOptions
+
+	c.backgroundTasks.run(ctx, func(shadowCtx context.Context) {
+		shadowDecision, err := c.shadowClient.queryPermissions(shadowCtx,
+			decision.Resource,
+			decision.Action,
+			&shadowPermissionOptions)
+		if err != nil {
+			c.reportShadowFailure(shadowCtx, err)
+			return
+		}
+		c.reportShadowDivergences(shadowCtx,
+			[]string{decision.Resource},
+			decision.Action,
+			[]bool{decision.Allowed},
+			[]bool{shadowDecision.Allowed})
+	})
+}
+
+// shadowQueryPermissionsMultiResources queries the shadow in the background, and reports its divergences
+// from the given results
+func (c *HTTPClient) shadowQueryPermissionsMultiResources(ctx context.Context,
+	resources []string,
+	action Action,
+	permissionOptions *PermissionOptions,
+	results []bool) {
+	if c.shadowClient == nil {
+		return
+	}
+
+	// the caller may reuse its options once we return
+	shadowPermissionOptions := *permissionOptions
+
+	c.backgroundTasks.run(ctx, func(shadowCtx context.Context) {
+		shadowResults, _, err := c.shadowClient.queryPermissionsMultiResources(shadowCtx,
+			resources,
+			action,
+			&shadowPermissionOptions)
+		if err != nil {
+			c.reportShadowFailure(shadowCtx, err)
+			return
+		}
+		c.reportShadowDivergences(shadowCtx, resources, action, results, shadowResults)
+	})
+}
+
+func (c *HTTPClient) reportShadowFailure(ctx context.Context, err error) {
+	c.metricsSink.IncrementCounter(MetricShadowFailures, 1, nil)
+	c.logger.WarnWithCtx(ctx, "Failed to query shadow",
+		"shadowAddress", c.shadowClient.address,
+		"err", err.Error())
+}
+
+func (c *HTTPClient) reportShadowDivergences(ctx context.Context,
+	resources []string,
+	action Action,
+	results []bool,
+	shadowResults []bool) {
+	var divergences int64
+	for resourceIdx, resource := range resources {
+		if results[resourceIdx] == shadowResults[resourceIdx] {
+			continue
+		}
+		divergences++
+		c.logger.WarnWithCtx(ctx, "Shadow decision diverged from primary decision",
+			"resource", resource,
+			"action", action,
+			"allowed", results[resourceIdx],
+			"shadowAllowed", shadowResults[resourceIdx])
+	}
+	if divergences > 0 {
+		c.metricsSink.IncrementCounter(MetricShadowDivergences, divergences, nil)
+	}
+}
+
+// getCachedDecisions returns the cached decisions of the given resources (nil for uncached ones)
+func (c *HTTPClient) getCachedDecisions(ctx context.Context,
+	resources []string,
+	action Action,
+	permissionOptions *PermissionOptions) []*CachedDecision {
+	cachedDecisions := make([]*CachedDecision, len(resources))
+	if c.decisionCache == nil {
+		return cachedDecisions
+	}
+
+	cacheKeys := make([]string, len(resources))
+	for resourceIdx, resource := range resources {
+		cacheKeys[resourceIdx] = c.cacheKey(resource, action, permissionOptions, c.policyRevision.get())
+	}
+
+	// get all decisions at once, if supported by the cache
+	if multiDecisionCache, ok := c.decisionCache.(MultiDecisionCache); ok && len(cacheKeys) > 1 {
+		cachedDecisionsByKey := multiDecisionCache.GetMulti(ctx, cacheKeys)
+		for resourceIdx, cacheKey := range cacheKeys {
+			cachedDecisions[resourceIdx] = cachedDecisionsByKey[cacheKey]
+		}
+	} else {
+		for resourceIdx, cacheKey := range cacheKeys {
+			cachedDecisions[resourceIdx], _ = c.decisionCache.Get(ctx, cacheKey)
+		}
+	}
+
+	var hits int64
+	for resourceIdx, cachedDecision := range cachedDecisions {
+		if cachedDecision == nil {
+			continue
+		}
+		hits++
+
+		// refresh cached decisions in the background if they are about to expire
+		if c.cacheRefreshWindow > 0 && cachedDecision.ExpiresAt.Sub(c.clock.Now()) < c.cacheRefreshWindow {
+			c.refreshCachedDecision(ctx, cacheKeys[resourceIdx], resources[resourceIdx], action, permissionOptions)
+		}
+	}
+
+	misses := int64(len(cachedDecisions)) - hits
+	c.cacheCounters.hits.Add(hits)
+	c.cacheCounters.misses.Add(misses)
+	c.metricsSink.IncrementCounter(MetricCacheHits, hits, nil)
+	c.metricsSink.IncrementCounter(MetricCacheMisses, misses, nil)
+
+	return cachedDecisions
+}
+
+// refreshCachedDecision queries and caches a decision in the background, unless it is already being refreshed
+func (c *HTTPClient) refreshCachedDecision(ctx context.Context,
+	cacheKey string,
+	resource string,
+	action Action,
+	permissionOptions *PermissionOptions) {
+	if _, refreshing := c.refreshingDecisions.LoadOrStore(cacheKey, struct{}{}); refreshing {
+		return
+	}
+
+	// the caller may reuse its options once we return
+	refreshPermissionOptions := *permissionOptions
+
+	// the refresh outlives the request it was triggered by
+	if !c.backgroundTasks.run(withPriority(ctx, PriorityLow), func(refreshCtx context.Context) {
+		defer c.refreshingDecisions.Delete(cacheKey)
+
+		decision, err := c.queryPermissions(refreshCtx, resource, action, &refreshPermissionOptions)
+		if err != nil {
+			c.cacheCounters.refreshFailures.Add(1)
+			c.metricsSink.IncrementCounter(MetricCacheRefreshFailures, 1, nil)
+			c.logger.WarnWithCtx(refreshCtx, "Failed to refresh cached decision",
+				"resource", resource,
+				"action", action,
+				"err", err.Error())
+			return
+		}
+
+		c.cacheDecision(refreshCtx, decision, &refreshPermissionOptions)
+	}) {
+		c.refreshingDecisions.Delete(cacheKey)
+	}
+}
+
+func (c *HTTPClient) cacheDecision(ctx context.Context, decision *Decision, permissionOptions *PermissionOptions) {
+	if c.decisionCache == nil {
+		return
+	}
+
+	ttl := c.cacheTTL
+	if !decision.Allowed && c.cacheDenyTTL != nil {
+		ttl = *c.cacheDenyTTL
+	}
+
+	// the staleness an action tolerates depends on its blast radius, regardless of the decision
+	if actionTTL, found := c.cacheActionTTLs[decision.Action]; found {
+		ttl = actionTTL
+	}
+
+	// the policy controls the freshness of its decisions
+	if decision.CacheTTL != nil {
+		ttl = *decision.CacheTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	// decisions are cached under the revision that produced them, flushing those of a previous one
+	revision := c.policyRevision.get()
+	if c.provenance {
+		revision = provenanceRevision(decision.Provenance)
+		c.observePolicyRevision(ctx, revision)
+	}
+
+	c.decisionCache.Set(ctx, c.cacheKey(decision.Resource, decision.Action, permissionOptions, revision), &CachedDecision{
+		Allowed:     decision.Allowed,
+		Reason:      decision.Reason,
+		Violations:  decision.Violations,
+		Obligations: decision.Obligations,
+		Provenance:  decision.Provenance,
+		ExpiresAt:   c.clock.Now().Add(ttl),
+	})
+
+	if instrumentedDecisionCache, ok := c.decisionCache.(InstrumentedDecisionCache); ok {
+		c.metricsSink.SetGauge(MetricCacheSize, float64(instrumentedDecisionCache.Len()), nil)
+
+		// report the evictions since last reported
+		evictions := instrumentedDecisionCache.Evictions()
+		if reportedEvictions := c.cacheCounters.reportedEvictions.Swap(evictions); evictions > reportedEvictions {
+			c.metricsSink.IncrementCounter(MetricCacheEvictions, evictions-reportedEvictions, nil)
+		}
+	}
+}
+
+// decideFailedQuery decides the given resources following a query failed since OPA is unavailable - by their
+// stale cached decisions (if enabled), or else by the fallback policy (if configured).
+// Returns false if the query failed otherwise, or if any of the resources cannot be decided
+func (c *HTTPClient) decideFailedQuery(ctx context.Context,
+	resources []string,
+	action Action,
+	permissionOptions *PermissionOptions,
+	queryErr error) ([]*Decision, bool) {
+	staleDecisionCache, staleEnabled := c.decisionCache.(StaleDecisionCache)
+	staleEnabled = staleEnabled && c.maxStaleness > 0
+	if !staleEnabled && c.fallbackPolicy == nil {
+		return nil, false
+	}
+
+	// queries failed by the policy or by the query itself (e.g.: a typo'd policy path) would fail against OPA as well
+	if !isUnavailableError(queryErr) {
+		return nil, false
+	}
+
+	decisions := make([]*Decision, len(resources))
+	var staleDecisions, fallbackDecisions int64
+	for resourceIdx, resource := range resources {
+		if staleEnabled {
+			if cachedDecision, found := staleDecisionCache.GetStale(ctx,
+				c.cacheKey(resource, action, permissionOptions, c.policyRevision.get()),
+				c.maxStaleness); found {
+				decisions[resourceIdx] = cachedDecision.toDecision(resource, action)
+				decisions[resourceIdx].Stale = true
+				staleDecisions++
+				continue
+			}
+		}
+
+		if c.fallbackPolicy != nil {
+			if allowed, matched := c.fallbackPolicy.Evaluate(resource, action); matched {
+				decisions[resourceIdx] = &Decision{
+					Resource: resource,
+					Action:   action,
+					Allowed:  allowed,
+					Fallback: true,
+				}
+				fallbackDecisions++
+				continue
+			}
+		}
+
+		return nil, false
+	}
+
+	c.metricsSink.IncrementCounter(MetricStaleDecisions, staleDecisions, nil)
+	c.metricsSink.IncrementCounter(MetricFallbackDecisions, fallbackDecisions, nil)
+	c.logger.WarnWithCtx(ctx, "Failed to query OPA, decided by stale decisions and fallback policy",
+		"resources", resources,
+		"action", action,
+		"staleDecisions", staleDecisions,
+		"fallbackDecisions", fallbackDecisions,
+		"err", queryErr.Error())
+	return decisions, true
+}
+
+// monitorDecisions reports the decisions that would have been denied (or failed) if they were enforced
+func (c *HTTPClient) monitorDecisions(ctx context.Context,
+	resources []string,
+	action Action,
+	results []bool,
+	err error) {
+	if err != nil {
+		c.metricsSink.IncrementCounter(MetricMonitoredFailures, 1, nil)
+		c.logger.WarnWithCtx(ctx, "Allowing failed permission query (monitor mode)",
+			"resources", resources,
+			"action", action,
+			"err", err.Error())
+		return
+	}
+
+	var deniedResources []string
+	for resourceIdx, resource := range resources {
+		if !results[resourceIdx] {
+			deniedResources = append(deniedResources, resource)
+		}
+	}
+	if len(deniedResources) == 0 {
+		return
+	}
+
+	c.metricsSink.IncrementCounter(MetricMonitoredDenies, int64(len(deniedResources)), nil)
+	if c.isVerbose(ctx) {
+		c.logger.InfoWithCtx(ctx, "Allowing denied permission query (monitor mode)",
+			"resources", deniedResources,
+			"action", action)
+	}
+}
+
+// logDecisions invokes the decision hooks with the decision records, and writes them to the decision log
+func (c *HTTPClient) logDecisions(ctx context.Context, decisionRecords []DecisionRecord) {
+	if c.enforcementMode == EnforcementModeMonitor {
+		for recordIdx := range decisionRecords {
+			decisionRecords[recordIdx].Monitored = true
+		}
+	}
+
+	for _, decisionHooks := range c.decisionHooks {
+		for _, decisionRecord := range decisionRecords {
+			decisionHooks.invoke(ctx, decisionRecord)
+		}
+	}
+
+	outcomeCounts := map[string]int64{}
+	for _, decisionRecord := range decisionRecords {
+		switch {
+		case decisionRecord.Error != "":
+			outcomeCounts["error"]++
+		case decisionRecord.Allowed:
+			outcomeCounts["allow"]++
+		default:
+			outcomeCounts["deny"]++
+		}
+	}
+	for outcome, count := range outcomeCounts {
+		c.metricsSink.IncrementCounter(MetricDecisions, count, map[string]string{"outcome": outcome})
+	}
+
+	if c.decisionLogSink == nil {
+		return
+	}
+	if err := c.decisionLogSink.WriteDecisions(ctx, decisionRecords); err != nil {
+		c.logger.WarnWithCtx(ctx, "Failed to write decision records",
+			"err", err.Error())
+	}
+}
+
+// recordsDecisions returns true if decision records are consumed - by the decision log, hooks or metrics
+func (c *HTTPClient) recordsDecisions() bool {
+	_, nopMetricsSink := c.metricsSink.(NopMetricsSink)
+	return c.decisionLogSink != nil || len(c.decisionHooks) > 0 || !nopMetricsSink
+}
+
+// CacheStats returns the decision cache statistics
+func (c *HTTPClient) CacheStats() CacheStats {
+	cacheStats := CacheStats{
+		Hits:            c.cacheCounters.hits.Load(),
+		Misses:          c.cacheCounters.misses.Load(),
+		RefreshFailures: c.cacheCounters.refreshFailures.Load(),
+	}
+
+	if instrumentedDecisionCache, ok := c.decisionCache.(InstrumentedDecisionCache); ok {
+		cacheStats.Size = instrumentedDecisionCache.Len()
+		cacheStats.Evictions = instrumentedDecisionCache.Evictions()
+	}
+	return cacheStats
+}
+
+func (c *HTTPClient) queryFilter(ctx context.Context,
+	requestInput PermissionFilterRequestInput) ([]string, *Provenance, error) {
+	permissionFilterResponse := PermissionFilterResponse{}
+	if err := c.sendQuery(ctx,
+		c.permissionFilterPath,
+		&PermissionFilterRequest{Input: requestInput},
+		&permissionFilterResponse); err != nil {
+		return nil, nil, err
+	}
+
+	return permissionFilterResponse.Result, permissionFilterResponse.Provenance, nil
+}
+
+// sendQuery sends a query request to the given OPA path, retrying on failures, and unmarshals the response
+func (c *HTTPClient) sendQuery(ctx context.Context, path string, request any, response any) error {
+	interceptedRequest := InterceptedRequest{
+		Path:            path,
+		Request:         request,
+		Headers:         map[string]string{},
+		QueryParameters: url.Values{},
+	}
+	if c.provenance {
+		interceptedRequest.QueryParameters.Set("provenance", "true")
+	}
+	if c.strictBuiltinErrors {
+		interceptedRequest.QueryParameters.Set("strict-builtin-errors", "true")
+	}
+	if c.instrument {
+		interceptedRequest.QueryParameters.Set("instrument", "true")
+	}
+	for _, interceptor := range c.interceptors {
+		if interceptor.BeforeRequest != nil {
+			if err := interceptor.BeforeRequest(ctx, &interceptedRequest); err != nil {
+				return errors.Wrap(err, "Failed to intercept request")
+			}
+		}
+	}
+
+	if len(c.inputValidators) > 0 {
+		if err := c.validateInput(ctx, path, interceptedRequest.Request); err != nil {
+			return errors.Wrap(err, "Failed to validate query input")
+		}
+	}
+
+	// send small single-resource queries as GET requests, which intermediaries may cache
+	method := http.MethodPost
+	getQueryInput, isGETQuery := c.getQueryInput(path, interceptedRequest.Request)
+	if isGETQuery {
+		method = http.MethodGet
+		interceptedRequest.QueryParameters.Set("input", getQueryInput)
+	}
+
+	requestPath, err := expandTenantPath(ctx, path)
 	if err != nil {
-		return false, errors.Wrap(err, "Failed to generate request body")
+		return errors.Wrap(err, "Failed to expand policy path")
+	}
+	if len(interceptedRequest.QueryParameters) > 0 {
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+		requestPath += separator + interceptedRequest.QueryParameters.Encode()
 	}
 
-	if c.verbose {
-		c.logger.InfoWithCtx(ctx, "Sending request to OPA",
-			"requestBody", string(requestBody),
-			"requestURL", requestURL)
+	// send the request
+	var requestBody []byte
+	if !isGETQuery {
+		requestBody, err = c.requestEncoder.Encode(interceptedRequest.Request)
+		if err != nil {
+			return errors.Wrap(err, "Failed to generate request body")
+		}
+	}
+
+	if c.isVerbose(ctx) {
+		c.logger.InfoWithCtx(ctx,
+			"Sending request to OPA",
+			"requestBody", c.loggableBody(requestBody),
+			"requestPath", requestPath)
 	}
 	var responseBody []byte
-	if err := retryUntilSuccessful(6*time.Second,
-		1*time.Second,
-		func() bool {
-			responseBody, _, err = sendHTTPRequest(ctx,
+	queryStartTime := time.Now()
+	attemptsLeft := int(queryRetryTimeout/queryRetryInterval) + 1
+	attempt := 0
+	if c.retryBudget != nil {
+		c.retryBudget.deposit(c.clock.Now())
+	}
+	if err := retryUntilSuccessful(ctx,
+		c.clock,
+		queryRetryTimeout,
+		queryRetryInterval,
+		func() error {
+
+			// split the caller's deadline budget across the attempts left, rather than exhausting it on the first
+			attemptCtx, cancelAttempt := attemptContext(ctx, attemptsLeft, queryRetryInterval)
+			defer cancelAttempt()
+			attemptsLeft--
+			attempt++
+
+			// reject the attempt locally while OPA fails most requests, rather than adding to its load
+			if c.adaptiveThrottling != nil {
+				priority := priorityFromContext(ctx)
+				if allowed, rejectionProbability := c.adaptiveThrottling.allow(c.clock.Now(), priority); !allowed {
+					c.metricsSink.IncrementCounter(MetricThrottledRequests, 1, map[string]string{
+						"path":     path,
+						"priority": string(priority),
+					})
+					return &permanentError{err: errors.Wrapf(ErrUnreachable,
+						"Request rejected by adaptive throttling (rejection probability %.2f)",
+						rejectionProbability)}
+				}
+			}
+
+			headers, err := c.requestHeaders(ctx)
+			if err != nil {
+				return errors.Wrap(err, "Failed to prepare HTTP request to OPA")
+			}
+			if !isGETQuery {
+				headers["Content-Type"] = c.requestEncoder.ContentType()
+			}
+			headers["Accept"] = c.requestEncoder.ContentType()
+			if decisionID := DecisionIDFromContext(ctx); decisionID != "" {
+				headers[DecisionIDHeader] = decisionID
+			}
+			for headerKey, headerValue := range interceptedRequest.Headers {
+				headers[headerKey] = headerValue
+			}
+
+			releaseRequestSlot, err := c.acquireRequestSlot(ctx)
+			if err != nil {
+
+				// retrying would only add to the load
+				if errors.Is(err, ErrOverloaded) {
+					return &permanentError{err: errors.Wrap(err, "Failed to acquire request slot")}
+				}
+				return errors.Wrap(err, "Failed to acquire request slot")
+			}
+			defer releaseRequestSlot()
+
+			// balance retries between the endpoints as well
+			endpoint := c.endpointAddress()
+			if requestSigningKey := c.signingKey(); requestSigningKey != nil {
+				requestURL, err := url.Parse(endpoint + requestPath)
+				if err != nil {
+					return errors.Wrap(err, "Failed to parse request URL")
+				}
+				maps.Copy(headers, SignRequest(requestSigningKey,
+					method,
+					requestURL.RequestURI(),
+					requestBody,
+					c.clock.Now()))
+			}
+			if c.adaptiveTimeout != nil {
+				if adaptiveTimeout, found := c.adaptiveTimeout.timeout(endpoint); found {
+					var cancelAdaptiveTimeout context.CancelFunc
+					attemptCtx, cancelAdaptiveTimeout = context.WithTimeout(attemptCtx, adaptiveTimeout)
+					defer cancelAdaptiveTimeout()
+				}
+			}
+
+			// track whether the request was sent, to tell evaluation timeouts from connection timeouts
+			var requestSent atomic.Bool
+			attemptCtx = httptrace.WithClientTrace(attemptCtx, &httptrace.ClientTrace{
+				WroteRequest: func(wroteRequestInfo httptrace.WroteRequestInfo) {
+					requestSent.Store(wroteRequestInfo.Err == nil)
+				},
+			})
+
+			requestStartTime := time.Now()
+			var response *http.Response
+			responseBody, response, err = sendHTTPRequest(attemptCtx,
 				c.httpClient,
-				http.MethodPost,
-				requestURL,
+				method,
+				endpoint+requestPath,
 				requestBody,
 				headers,
 				[]*http.Cookie{},
-				http.StatusOK)
+				http.StatusOK,
+				c.maxResponseSize)
+			c.dumpRequest(ctx,
+				attempt,
+				method,
+				endpoint+requestPath,
+				headers,
+				requestBody,
+				response,
+				responseBody,
+				err,
+				time.Since(requestStartTime))
+			if c.adaptiveThrottling != nil && (err == nil || isAnsweredRequestError(err)) {
+				c.adaptiveThrottling.accept(c.clock.Now())
+			}
 			if err != nil {
-				c.logger.WarnWithCtx(ctx, "Failed to send HTTP request to OPA, retrying",
-					"err", err.Error())
-				return false
+
+				// policy evaluation errors would recur
+				if policyError := parsePolicyError(responseBody); policyError != nil {
+					return &permanentError{err: errors.Wrapf(policyError, "Failed to evaluate policy at %s", endpoint)}
+				}
+
+				// as would a missing policy path (e.g.: a typo in the configured path)
+				if pathNotFoundError := newPolicyPathNotFoundError(responseBody, err, path, endpoint); pathNotFoundError != nil {
+					return &permanentError{err: errors.Wrap(pathNotFoundError, "Failed to query policy")}
+				}
+				// as would a TLS configuration which failed to load
+				if errors.Is(err, ErrTLSConfiguration) {
+					return &permanentError{err: errors.Wrapf(err, "Failed to connect to %s", endpoint)}
+				}
+				if timeoutError := newTimeoutError(err, endpoint, requestSent.Load()); timeoutError != nil {
+					c.reportTimeout(path, timeoutError)
+					return errors.Wrapf(timeoutError, "Failed to send HTTP request to %s", endpoint)
+				}
+				return errors.Wrapf(opaResponseError(responseBody, err), "Failed to send HTTP request to %s", endpoint)
 			}
-			return true
-		}); err != nil {
-		if c.verbose {
-			c.logger.ErrorWithCtx(ctx, "Failed to send HTTP request to OPA",
+			if c.adaptiveTimeout != nil {
+				c.adaptiveTimeout.observe(endpoint, time.Since(requestStartTime))
+			}
+			return nil
+		},
+		func(attempt int, err error, nextDelay time.Duration) {
+			c.reportRetry(ctx, path, attempt, err, nextDelay)
+		},
+		c.withdrawRetryBudget(path)); err != nil {
+		c.reportQuery(path, queryStartTime, "failure")
+		if c.isVerbose(ctx) {
+			c.logger.ErrorWithCtx(ctx,
+				"Failed to send HTTP request to OPA",
 				"err", errors.GetErrorStackString(err, 10))
 		}
-		return false, errors.Wrap(err, "Failed to send HTTP request to OPA")
+		return errors.Wrap(err, "Failed to send HTTP request to OPA")
 	}
+	c.reportQuery(path, queryStartTime, "success")
 
-	if c.verbose {
+	if c.isVerbose(ctx) {
 		c.logger.InfoWithCtx(ctx, "Received response from OPA",
+			"responseBody", c.loggableBody(responseBody))
+	}
+
+	interceptedResponse := InterceptedResponse{
+		Path: path,
+		Body: responseBody,
+	}
+	for _, interceptor := range c.interceptors {
+		if interceptor.AfterResponse != nil {
+			if err := interceptor.AfterResponse(ctx, &interceptedResponse); err != nil {
+				return errors.Wrap(err, "Failed to intercept response")
+			}
+		}
+	}
+	responseBody = interceptedResponse.Body
+
+	if err := c.requestEncoder.Decode(responseBody, response); err != nil {
+		return errors.Wrap(err, "Failed to unmarshal response body")
+	}
+	if c.instrument {
+		c.reportInstrumentation(path, responseBody)
+	}
+
+	if c.isVerbose(ctx) {
+		c.logger.InfoWithCtx(ctx, "Successfully unmarshalled response",
+			"response", response)
+	}
+
+	return nil
+}
+
+// With returns a derived client with the given options applied (e.g.: WithPermissionPaths, to query a different
+// policy package), sharing the transport, decision cache, sinks and background work of the client.
+// Transport options applied to the derived client affect the shared transport
+func (c *HTTPClient) With(options ...Option) *HTTPClient {
+	derivedClient := *c
+	for _, option := range options {
+		option(&derivedClient)
+	}
+	return &derivedClient
+}
+
+// Close drains the background cache refreshes and shadow queries (canceling them once the context is done),
+// flushes the decision log, closes the metrics sink (if closable) and closes the idle connections
+func (c *HTTPClient) Close(ctx context.Context) error {
+	closeErr := c.backgroundTasks.close(ctx)
+
+	if c.decisionLogSink != nil {
+		if err := c.decisionLogSink.Close(); err != nil && closeErr == nil {
+			closeErr = errors.Wrap(err, "Failed to close decision log sink")
+		}
+	}
+
+	if closer, ok := c.metricsSink.(io.Closer); ok {
+		if err := closer.Close(); err != nil && closeErr == nil {
+			closeErr = errors.Wrap(err, "Failed to close metrics sink")
+		}
+	}
+
+	c.httpClient.CloseIdleConnections()
+	return closeErr
+}
+
+// reportQuery reports the count and duration (including retries) of a query sent to the given path
+func (c *HTTPClient) reportQuery(path string, queryStartTime time.Time, status string) {
+	c.queryCounters.queries.Add(1)
+	if status == "failure" {
+		c.queryCounters.failures.Add(1)
+	}
+	queryDuration := time.Since(queryStartTime)
+	c.queryStats.observe(c.clock.Now(), queryDuration, status == "failure")
+
+	labels := map[string]string{
+		"path":   path,
+		"status": status,
+	}
+	c.metricsSink.IncrementCounter(MetricQueries, 1, labels)
+	c.metricsSink.ObserveDuration(MetricQueryDuration, queryDuration, labels)
+}
+
+// reportTimeout reports a request to the given path which timed out, by the phase it timed out in
+func (c *HTTPClient) reportTimeout(path string, timeoutError *TimeoutError) {
+	c.metricsSink.IncrementCounter(MetricTimeouts, 1, map[string]string{
+		"path":  path,
+		"phase": string(timeoutError.Phase),
+	})
+}
+
+// loggableBody returns a query request or response body to log - as is if encoded as JSON, or else its size
+func (c *HTTPClient) loggableBody(body []byte) string {
+	if _, isJSON := c.requestEncoder.(JSONEncoder); isJSON {
+		return string(body)
+	}
+	return fmt.Sprintf("<%d bytes of %s>", len(body), c.requestEncoder.ContentType())
+}
+
+// reportInstrumentation reports the policy evaluation duration, out of the instrumentation metrics of a response
+func (c *HTTPClient) reportInstrumentation(path string, responseBody []byte) {
+	instrumentedResponse := struct {
+		Metrics struct {
+			EvalNanoseconds int64 `json:"timer_rego_query_eval_ns"`
+		} `json:"metrics"`
+	}{}
+	if err := c.requestEncoder.Decode(responseBody, &instrumentedResponse); err != nil ||
+		instrumentedResponse.Metrics.EvalNanoseconds == 0 {
+		return
+	}
+	c.metricsSink.ObserveDuration(MetricPolicyEvalDuration,
+		time.Duration(instrumentedResponse.Metrics.EvalNanoseconds),
+		map[string]string{"path": path})
+}
+
+// withdrawRetryBudget returns the function telling whether a failed query to the given path may be retried,
+// withdrawing the retry from the retry budget (nil if no retry budget is set)
+func (c *HTTPClient) withdrawRetryBudget(path string) func() bool {
+	if c.retryBudget == nil {
+		return nil
+	}
+	return func() bool {
+		if c.retryBudget.withdraw(c.clock.Now()) {
+			return true
+		}
+		c.metricsSink.IncrementCounter(MetricRetryBudgetExhausted, 1, map[string]string{"path": path})
+		return false
+	}
+}
+
+// reportRetry logs, counts and reports a failed attempt that is about to be retried,
+// and invokes the retry hook (if set)
+func (c *HTTPClient) reportRetry(ctx context.Context, path string, attempt int, err error, nextDelay time.Duration) {
+	c.logger.WarnWithCtx(ctx, "Failed to query OPA, retrying",
+		"path", path,
+		"attempt", attempt,
+		"nextDelay", nextDelay.String(),
+		"err", err.Error())
+
+	c.queryCounters.retries.Add(1)
+	c.metricsSink.IncrementCounter(MetricRetries, 1, map[string]string{
+		"path": path,
+	})
+	if c.onRetry != nil {
+		c.onRetry(attempt, err, nextDelay)
+	}
+}
+
+// acquireRequestSlot waits for a request slot, if the concurrent requests are limited, and returns its release function
+func (c *HTTPClient) acquireRequestSlot(ctx context.Context) (func(), error) {
+	if c.requestSlots == nil {
+		return func() {}, nil
+	}
+
+	waitStartTime := time.Now()
+	priority := priorityFromContext(ctx)
+	if err := c.requestSlots.acquire(ctx, priority); err != nil {
+		if errors.Is(err, ErrOverloaded) {
+			c.metricsSink.IncrementCounter(MetricOverloadedRequests, 1, map[string]string{"priority": string(priority)})
+		}
+		return nil, err
+	}
+	c.metricsSink.ObserveDuration(MetricRequestWait, time.Since(waitStartTime), nil)
+	return c.requestSlots.release, nil
+}
+
+// DefaultTransport returns the internally built transport of the client, so it can be wrapped
+func (c *HTTPClient) DefaultTransport() *http.Transport {
+	return c.transport
+}
+
+// requestHeaders returns the headers common to all requests to OPA
+func (c *HTTPClient) requestHeaders(ctx context.Context) (map[string]string, error) {
+	headers := map[string]string{
+		"User-Agent": UserAgent,
+	}
+	if c.tokenSource != nil {
+		token, err := c.tokenSource.Token(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to get OPA access token")
+		}
+		headers["Authorization"] = "Bearer " + token
+	}
+	return headers, nil
+}
+
+// Status queries OPA's status API and returns the state of the activated bundles and plugins
+func (c *HTTPClient) Status(ctx context.Context) (*ServerStatus, error) {
+	requestURL := fmt.Sprintf("%s%s", c.endpointAddress(), DefaultStatusPath)
+
+	headers, err := c.requestHeaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, _, err := sendHTTPRequest(ctx,
+		c.httpClient,
+		http.MethodGet,
+		requestURL,
+		nil,
+		headers,
+		[]*http.Cookie{},
+		http.StatusOK,
+		c.maxResponseSize)
+	if err != nil {
+		return nil, errors.Wrap(opaResponseError(responseBody, err), "Failed to query OPA status")
+	}
+
+	if c.isVerbose(ctx) {
+		c.logger.InfoWithCtx(ctx, "Received status response from OPA",
 			"responseBody", string(responseBody))
 	}
 
-	permissionResponse := PermissionQueryResponse{}
-	if err := json.Unmarshal(responseBody, &permissionResponse); err != nil {
-		return false, errors.Wrap(err, "Failed to unmarshal response body")
+	statusResponse := StatusResponse{}
+	if err := json.Unmarshal(responseBody, &statusResponse); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal status response body")
+	}
+
+	return &statusResponse.Result, nil
+}
+
+// ServerInfo queries OPA's config API and returns the server version and enabled features
+func (c *HTTPClient) ServerInfo(ctx context.Context) (*ServerInfo, error) {
+	requestURL := fmt.Sprintf("%s%s", c.endpointAddress(), DefaultConfigPath)
+
+	headers, err := c.requestHeaders(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, _, err := sendHTTPRequest(ctx,
+		c.httpClient,
+		http.MethodGet,
+		requestURL,
+		nil,
+		headers,
+		[]*http.Cookie{},
+		http.StatusOK,
+		c.maxResponseSize)
+	if err != nil {
+		return nil, errors.Wrap(opaResponseError(responseBody, err), "Failed to query OPA config")
+	}
+
+	configResponse := ConfigResponse{}
+	if err := json.Unmarshal(responseBody, &configResponse); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal config response body")
+	}
+
+	serverInfo := ServerInfo{
+		Labels: map[string]string{},
+	}
+	if rawLabels, found := configResponse.Result["labels"]; found {
+		if err := json.Unmarshal(rawLabels, &serverInfo.Labels); err != nil {
+			return nil, errors.Wrap(err, "Failed to unmarshal server labels")
+		}
+	}
+	serverInfo.Version = serverInfo.Labels["version"]
+
+	// built-in features are enabled when their configuration section is set
+	for _, feature := range []string{"bundles", "decision_logs", "status", "discovery"} {
+		if rawSection, found := configResponse.Result[feature]; found && string(rawSection) != "null" {
+			serverInfo.Features = append(serverInfo.Features, feature)
+		}
+	}
+
+	// custom plugins are reported by name
+	if rawPlugins, found := configResponse.Result["plugins"]; found {
+		plugins := map[string]json.RawMessage{}
+		if err := json.Unmarshal(rawPlugins, &plugins); err != nil {
+			return nil, errors.Wrap(err, "Failed to unmarshal server plugins")
+		}
+		for pluginName := range plugins {
+			serverInfo.Features = append(serverInfo.Features, pluginName)
+		}
 	}
+	slices.Sort(serverInfo.Features)
 
-	if c.verbose {
-		c.logger.InfoWithCtx(ctx, "Successfully unmarshalled permission response",
-			"permissionResponse", permissionResponse)
+	if c.isVerbose(ctx) {
+		c.logger.InfoWithCtx(ctx, "Received server info from OPA",
+			"serverInfo", serverInfo)
 	}
 
-	return permissionResponse.Result, nil
+	return &serverInfo, nil
 }
@@ -19,10 +19,24 @@ limitations under the License.
 package opaclient
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -31,12 +45,32 @@ import (
 	"github.com/stretchr/testify/suite"
 )
 
+const (
+	shadowAllowPath  = "/v1/data/authz/shadow/allow"
+	shadowFilterPath = "/v1/data/authz/shadow/filter_allowed"
+
+	resourceActionsPath = "/v1/data/authz/allowed_resource_actions"
+)
+
 type HTTPClientTestSuite struct {
 	suite.Suite
 	logger         logger.Logger
 	ctx            context.Context
 	testHTTPServer *httptest.Server
 	httpClient     *HTTPClient
+
+	lastPermissionQueryInput  PermissionQueryRequestInput
+	lastPermissionFilterInput PermissionFilterRequestInput
+	lastAuthorizationHeader   string
+	lastRawPermissionInput    map[string]any
+	lastQueryParameters       url.Values
+	permissionRequestsCount   atomic.Int64
+
+	// the policy bundle revision reported by provenance and status
+	bundleRevision atomic.Value
+
+	// respond to permission queries with malformed responses
+	failPermissionQueries atomic.Bool
 }
 
 func (suite *HTTPClientTestSuite) SetupTest() {
@@ -45,23 +79,74 @@ func (suite *HTTPClientTestSuite) SetupTest() {
 	suite.Require().NoError(err)
 
 	suite.ctx = context.Background()
+	suite.permissionRequestsCount.Store(0)
+	suite.failPermissionQueries.Store(false)
+	suite.bundleRevision.Store("rev-1")
 
 	allowPath := "/v1/data/authz/allow"
 	filterPath := "/v1/data/authz/filter_allowed"
 
 	// Create test HTTP server
 	suite.testHTTPServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if suite.failPermissionQueries.Load() && (r.URL.Path == allowPath || r.URL.Path == filterPath) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
 		switch r.URL.Path {
 		case allowPath:
+			requestBody, err := io.ReadAll(r.Body)
+			suite.Require().NoError(err)
 			var permissionRequest PermissionQueryRequest
-			err := json.NewDecoder(r.Body).Decode(&permissionRequest)
+			err = json.Unmarshal(requestBody, &permissionRequest)
 			suite.Require().NoError(err)
+			rawPermissionRequest := map[string]map[string]any{}
+			err = json.Unmarshal(requestBody, &rawPermissionRequest)
+			suite.Require().NoError(err)
+			suite.lastRawPermissionInput = rawPermissionRequest["input"]
+			suite.lastPermissionQueryInput = permissionRequest.Input
+			suite.lastAuthorizationHeader = r.Header.Get("Authorization")
+			suite.lastQueryParameters = r.URL.Query()
+			suite.permissionRequestsCount.Add(1)
+
+			// For testing, deny resources prefixed with "violating" with a rich result
+			if strings.HasPrefix(permissionRequest.Input.Resource, "violating") {
+				w.Header().Set("Content-Type", "application/json")
+				_, err := w.Write([]byte(`{"result": {
+					"allow": false,
+					"reason": "resource is locked",
+					"violations": ["locked", "not-owner"]
+				}}`))
+				suite.Require().NoError(err)
+				return
+			}
+
+			// For testing, allow resources prefixed with "obligated" with obligations
+			if strings.HasPrefix(permissionRequest.Input.Resource, "obligated") {
+				w.Header().Set("Content-Type", "application/json")
+				_, err := w.Write([]byte(`{"result": {
+					"allow": true,
+					"obligations": [
+						{"type": "mask", "fields": ["email", "phone"]},
+						{"type": "row_limit", "limit": 100},
+						{"type": "row_limit", "limit": 50},
+						{"type": "mask", "fields": ["email"]},
+						{"type": "watermark", "parameters": {"text": "internal"}}
+					]
+				}}`))
+				suite.Require().NoError(err)
+				return
+			}
 
-			// For testing, allow if resource starts with "allow"
-			allowed := len(permissionRequest.Input.Resource) > 0 && permissionRequest.Input.Resource[0:5] == "allow"
+			// For testing, allow if resource (or any of its ancestors) is allowed
+			allowed := isTestResourceAllowed(permissionRequest.Input.Resource)
+			for _, ancestor := range permissionRequest.Input.Ancestors {
+				allowed = allowed || isTestResourceAllowed(ancestor)
+			}
 
 			permissionResponse := PermissionQueryResponse{
-				Result: allowed,
+				Result:     allowed,
+				Provenance: testProvenance(r, suite.bundleRevision.Load().(string)),
 			}
 			w.Header().Set("Content-Type", "application/json")
 			err = json.NewEncoder(w).Encode(permissionResponse)
@@ -71,21 +156,88 @@ func (suite *HTTPClientTestSuite) SetupTest() {
 			var permissionRequest PermissionFilterRequest
 			err := json.NewDecoder(r.Body).Decode(&permissionRequest)
 			suite.Require().NoError(err)
+			suite.lastPermissionFilterInput = permissionRequest.Input
+			suite.permissionRequestsCount.Add(1)
 
-			// For testing, allow resources that start with "allow"
+			// For testing, allow resources that are allowed (or that any of their ancestors is allowed)
 			var allowedResources []string
 			for _, resource := range permissionRequest.Input.Resources {
-				if len(resource) > 0 && resource[0:5] == "allow" {
+				allowed := isTestResourceAllowed(resource)
+				for _, ancestor := range permissionRequest.Input.Ancestors[resource] {
+					allowed = allowed || isTestResourceAllowed(ancestor)
+				}
+				if allowed {
 					allowedResources = append(allowedResources, resource)
 				}
 			}
 
 			permissionResponse := PermissionFilterResponse{
-				Result: allowedResources,
+				Result:     allowedResources,
+				Provenance: testProvenance(r, suite.bundleRevision.Load().(string)),
 			}
 			w.Header().Set("Content-Type", "application/json")
 			err = json.NewEncoder(w).Encode(permissionResponse)
 			suite.Require().NoError(err)
+
+		// the shadow policy allows everything
+		case resourceActionsPath:
+			var permissionRequest PermissionResourceActionsRequest
+			err := json.NewDecoder(r.Body).Decode(&permissionRequest)
+			suite.Require().NoError(err)
+			suite.permissionRequestsCount.Add(1)
+
+			// For testing, allow any action but delete of the allowed resources
+			allowedResourceActions := []ResourceAction{}
+			for _, resourceAction := range permissionRequest.Input.ResourceActions {
+				if isTestResourceAllowed(resourceAction.Resource) && resourceAction.Action != ActionDelete {
+					allowedResourceActions = append(allowedResourceActions, resourceAction)
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(PermissionResourceActionsResponse{Result: allowedResourceActions})
+			suite.Require().NoError(err)
+
+		case shadowAllowPath:
+			w.Header().Set("Content-Type", "application/json")
+			err := json.NewEncoder(w).Encode(PermissionQueryResponse{Result: true})
+			suite.Require().NoError(err)
+
+		case shadowFilterPath:
+			var permissionRequest PermissionFilterRequest
+			err := json.NewDecoder(r.Body).Decode(&permissionRequest)
+			suite.Require().NoError(err)
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(PermissionFilterResponse{Result: permissionRequest.Input.Resources})
+			suite.Require().NoError(err)
+
+		case DefaultStatusPath:
+			statusResponse := StatusResponse{
+				Result: ServerStatus{
+					Bundles: map[string]BundleStatus{
+						"authz": {
+							Name:                     "authz",
+							ActiveRevision:           suite.bundleRevision.Load().(string),
+							LastSuccessfulActivation: time.Now(),
+						},
+					},
+					Plugins: map[string]PluginStatus{
+						"bundle": {State: "OK"},
+					},
+				},
+			}
+			w.Header().Set("Content-Type", "application/json")
+			err := json.NewEncoder(w).Encode(statusResponse)
+			suite.Require().NoError(err)
+
+		case DefaultConfigPath:
+			w.Header().Set("Content-Type", "application/json")
+			_, err := w.Write([]byte(`{"result": {
+				"labels": {"id": "opa-1", "version": "0.38.1"},
+				"bundles": {"authz": {"service": "bundles"}},
+				"decision_logs": null,
+				"plugins": {"envoy_ext_authz_grpc": {}}
+			}}`))
+			suite.Require().NoError(err)
 		}
 	}))
 
@@ -152,6 +304,126 @@ func (suite *HTTPClientTestSuite) TestQueryPermissions_WithOverride() {
 	suite.Require().True(allowed)
 }
 
+func (suite *HTTPClientTestSuite) TestQueryPermissions_WithOverrideHeader() {
+	WithOverride("X-Opa-Override", "service-a-value", "service-b-value")(suite.httpClient)
+
+	for overrideValue, expectedAllowed := range map[string]bool{
+		"test-override-value": true,
+		"service-b-value":     true,
+		"service-c-value":     false,
+		"":                    false,
+	} {
+		requestHeaders := http.Header{}
+		requestHeaders.Set("X-Opa-Override", overrideValue)
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+			MemberIds:      []string{"user1"},
+			RequestHeaders: requestHeaders,
+		})
+		suite.Require().NoError(err)
+		suite.Require().Equal(expectedAllowed, allowed, overrideValue)
+	}
+
+	// an explicit override value takes precedence over the request headers
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+		MemberIds:           []string{"user1"},
+		OverrideHeaderValue: "service-a-value",
+		RequestHeaders:      http.Header{"X-Opa-Override": []string{"service-c-value"}},
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_WithOverrideTokens() {
+	clock := newTestClock()
+	WithClock(clock)(suite.httpClient)
+	WithOverrideTokens([][]byte{[]byte("old-key"), []byte("new-key")}, "service-a")(suite.httpClient)
+
+	signToken := func(key string, issuer string, ttl time.Duration) string {
+		token, err := SignOverrideToken([]byte(key), OverrideTokenClaims{
+			Issuer:    issuer,
+			ExpiresAt: clock.Now().Add(ttl).Unix(),
+		})
+		suite.Require().NoError(err)
+		return token
+	}
+	validToken := signToken("new-key", "service-a", time.Hour)
+
+	for name, testCase := range map[string]struct {
+		token           string
+		expectedAllowed bool
+	}{
+		"valid":             {token: validToken, expectedAllowed: true},
+		"rotated key":       {token: signToken("old-key", "service-a", time.Hour), expectedAllowed: true},
+		"unknown key":       {token: signToken("other-key", "service-a", time.Hour), expectedAllowed: false},
+		"unaccepted issuer": {token: signToken("new-key", "service-b", time.Hour), expectedAllowed: false},
+		"expired":           {token: signToken("new-key", "service-a", -time.Second), expectedAllowed: false},
+		"tampered":          {token: "x" + validToken, expectedAllowed: false},
+		"malformed":         {token: "not-a-token", expectedAllowed: false},
+	} {
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+			MemberIds:           []string{"user1"},
+			OverrideHeaderValue: testCase.token,
+		})
+		suite.Require().NoError(err)
+		suite.Require().Equal(testCase.expectedAllowed, allowed, name)
+	}
+
+	// a leaked token cannot be replayed once it expires
+	clock.advance(time.Hour)
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+		MemberIds:           []string{"user1"},
+		OverrideHeaderValue: validToken,
+	})
+	suite.Require().NoError(err)
+	suite.Require().False(allowed)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_OverrideAudit() {
+	metricsSink := newTestMetricsSink()
+	decisionLogSink := &testDecisionLogSink{}
+	WithMetricsSink(metricsSink)(suite.httpClient)
+	WithDecisionLogSink(decisionLogSink)(suite.httpClient)
+	WithOverrideTokens([][]byte{[]byte("key")})(suite.httpClient)
+
+	token, err := SignOverrideToken([]byte("key"), OverrideTokenClaims{
+		Issuer:    "service-a",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+	suite.Require().NoError(err)
+
+	decision, err := suite.httpClient.QueryDecision(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+		MemberIds:           []string{"user1"},
+		OverrideHeaderValue: token,
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(decision.Allowed)
+	suite.Require().True(decision.Overridden)
+
+	_, err = suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"deny-resource-1", "deny-resource-2"},
+		ActionRead,
+		&PermissionOptions{
+			MemberIds:           []string{"user1"},
+			OverrideHeaderValue: "test-override-value",
+		})
+	suite.Require().NoError(err)
+
+	// flush the queued records
+	suite.Require().NoError(suite.httpClient.decisionLogSink.Close())
+
+	records := decisionLogSink.records
+	suite.Require().Len(records, 3)
+	suite.Require().Equal("deny-resource", records[0].Resource)
+	suite.Require().True(records[0].Overridden)
+	suite.Require().Equal("service-a", records[0].OverrideIssuer)
+	suite.Require().Equal([]string{"user1"}, records[0].MemberIds)
+	suite.Require().Equal("deny-resource-2", records[2].Resource)
+	suite.Require().True(records[2].Overridden)
+	suite.Require().Empty(records[2].OverrideIssuer)
+	suite.Require().Equal(int64(3), metricsSink.counter(MetricOverrides))
+	suite.Require().Zero(suite.permissionRequestsCount.Load())
+}
+
 func (suite *HTTPClientTestSuite) TestQueryPermissionsMultiResources() {
 	resources := []string{
 		"allow-resource-1",
@@ -177,6 +449,79 @@ func (suite *HTTPClientTestSuite) TestQueryPermissionsMultiResources() {
 	suite.Require().False(permissions[3]) // deny-resource-2
 }
 
+func (suite *HTTPClientTestSuite) TestQueryPermissionsMultiResources_Duplicates() {
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	results, err := suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", "deny-resource-1", "allow-resource-1"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, false, true}, results)
+	suite.Require().Equal([]string{"allow-resource-1", "deny-resource-1"}, suite.lastPermissionFilterInput.Resources)
+
+	_, err = suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", ""},
+		ActionRead,
+		permissionOptions)
+	suite.Require().ErrorContains(err, "Resource at index 1 is empty")
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissionsResourceActions() {
+	resourceActions := []ResourceAction{
+		{Resource: "allow-resource-1", Action: ActionRead},
+		{Resource: "allow-resource-1", Action: ActionDelete},
+		{Resource: "deny-resource-1", Action: ActionRead},
+		{Resource: "allow-resource-2", Action: ActionUpdate},
+		{Resource: "allow-resource-1", Action: ActionRead},
+	}
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// while no resource actions path is set, the resources of each action are queried together
+	// (by the filter policy, which ignores the action)
+	results, err := suite.httpClient.QueryPermissionsResourceActions(suite.ctx, resourceActions, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, true, false, true, true}, results)
+	suite.Require().Equal(int64(3), suite.permissionRequestsCount.Load())
+
+	// in a single request, along with the cached decisions
+	suite.permissionRequestsCount.Store(0)
+	WithResourceActionsPath(resourceActionsPath)(suite.httpClient)
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+	results, err = suite.httpClient.QueryPermissionsResourceActions(suite.ctx, resourceActions, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, false, false, true, true}, results)
+	suite.Require().Equal(int64(1), suite.permissionRequestsCount.Load())
+
+	results, err = suite.httpClient.QueryPermissionsResourceActions(suite.ctx, resourceActions, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, false, false, true, true}, results)
+	suite.Require().Equal(int64(1), suite.permissionRequestsCount.Load())
+
+	_, err = suite.httpClient.QueryPermissionsResourceActions(suite.ctx,
+		[]ResourceAction{{Resource: "allow-resource-1"}},
+		permissionOptions)
+	suite.Require().Error(err)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissionsMultiResourcesMap() {
+	results, err := suite.httpClient.QueryPermissionsMultiResourcesMap(suite.ctx,
+		[]string{"deny-resource-1", "allow-resource-1", "deny-resource-1"},
+		ActionRead,
+		&PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+	suite.Require().NoError(err)
+	suite.Require().Equal(map[string]bool{
+		"allow-resource-1": true,
+		"deny-resource-1":  false,
+	}, results)
+}
+
 func (suite *HTTPClientTestSuite) TestQueryPermissionsMultiResources_WithOverride() {
 	resources := []string{
 		"allow-resource-1",
@@ -203,6 +548,4015 @@ func (suite *HTTPClientTestSuite) TestQueryPermissionsMultiResources_WithOverrid
 	suite.Require().True(permissions[3])
 }
 
-func TestHTTPClientTestSuite(t *testing.T) {
-	suite.Run(t, new(HTTPClientTestSuite))
+func (suite *HTTPClientTestSuite) TestQueryPermissionsMultiResources_EmptyWithOverride() {
+	permissionOptions := &PermissionOptions{
+		MemberIds:           []string{"user1"},
+		OverrideHeaderValue: "test-override-value",
+	}
+
+	permissions, err := suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Empty(permissions)
+
+	permissions, err = suite.httpClient.QueryPermissionsResourceActions(suite.ctx,
+		[]ResourceAction{},
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Empty(permissions)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryDecisionByClient() {
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// decision queriers return the decision metadata
+	decision, err := QueryDecision(suite.ctx, suite.httpClient, "violating-resource", ActionUpdate, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().False(decision.Allowed)
+	suite.Require().Equal("resource is locked", decision.Reason)
+
+	// other clients are queried for the permission
+	decision, err = QueryDecision(suite.ctx, testPermissionsClient{}, "resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal(&Decision{Resource: "resource", Action: ActionRead, Allowed: true}, decision)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryDecision_Reason() {
+	decision, err := suite.httpClient.QueryDecision(suite.ctx,
+		"violating-resource",
+		ActionUpdate,
+		&PermissionOptions{MemberIds: []string{"user1"}})
+	suite.Require().NoError(err)
+	suite.Require().False(decision.Allowed)
+	suite.Require().Equal("resource is locked", decision.Reason)
+	suite.Require().Equal([]string{"locked", "not-owner"}, decision.Violations)
+
+	// boolean results are still supported
+	decision, err = suite.httpClient.QueryDecision(suite.ctx,
+		"allow-resource",
+		ActionUpdate,
+		&PermissionOptions{MemberIds: []string{"user1"}})
+	suite.Require().NoError(err)
+	suite.Require().True(decision.Allowed)
+	suite.Require().Empty(decision.Reason)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissionsWithObligations() {
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// the obligations are kept along with cached decisions
+	for range 2 {
+		allowed, obligations, err := suite.httpClient.QueryPermissionsWithObligations(suite.ctx,
+			"obligated-resource",
+			ActionRead,
+			permissionOptions)
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+		suite.Require().Len(obligations, 5)
+		suite.Require().Equal([]string{"email", "phone"}, obligations.MaskedFields())
+		rowLimit, found := obligations.RowLimit()
+		suite.Require().True(found)
+		suite.Require().Equal(50, rowLimit)
+		suite.Require().Equal(map[string]any{"text": "internal"},
+			obligations.OfType("watermark")[0].Parameters)
+	}
+	suite.Require().Equal(int64(1), suite.permissionRequestsCount.Load())
+
+	allowed, obligations, err := suite.httpClient.QueryPermissionsWithObligations(suite.ctx,
+		"allow-resource",
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Empty(obligations)
+	_, found := obligations.RowLimit()
+	suite.Require().False(found)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_RaiseForbidden() {
+	permissionOptions := &PermissionOptions{
+		MemberIds:      []string{"user1"},
+		RaiseForbidden: true,
+	}
+
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "violating-resource", ActionDelete, permissionOptions)
+	suite.Require().Error(err)
+	suite.Require().False(allowed)
+	suite.Require().True(errors.Is(err, ErrForbidden))
+
+	var forbiddenError *ForbiddenError
+	suite.Require().True(errors.As(err, &forbiddenError))
+	suite.Require().Equal("resource is locked", forbiddenError.Reason)
+	suite.Require().Equal([]string{"locked", "not-owner"}, forbiddenError.Violations)
+
+	allowed, err = suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionDelete, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+}
+
+func (suite *HTTPClientTestSuite) TestStatus() {
+	status, err := suite.httpClient.Status(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Require().Equal("OK", status.Plugins["bundle"].State)
+	suite.Require().True(status.IsBundleActive("authz", ""))
+	suite.Require().True(status.IsBundleActive("authz", "rev-1"))
+	suite.Require().False(status.IsBundleActive("authz", "rev-2"))
+	suite.Require().False(status.IsBundleActive("other", ""))
+}
+
+func (suite *HTTPClientTestSuite) TestServerInfo() {
+	serverInfo, err := suite.httpClient.ServerInfo(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Require().Equal("0.38.1", serverInfo.Version)
+	suite.Require().Equal([]string{"bundles", "envoy_ext_authz_grpc"}, serverInfo.Features)
+	suite.Require().True(serverInfo.HasFeature("bundles"))
+	suite.Require().False(serverInfo.HasFeature("decision_logs"))
+	suite.Require().True(serverInfo.AtLeastVersion("0.38.0"))
+	suite.Require().True(serverInfo.AtLeastVersion("v0.38.1"))
+	suite.Require().False(serverInfo.AtLeastVersion("0.40.0-dev"))
+	suite.Require().NoError(serverInfo.RequireVersion("something", "0.20.0"))
+
+	err = serverInfo.RequireVersion("compile API", "1.0.0")
+	suite.Require().Error(err)
+	suite.Require().Contains(err.Error(), "OPA server 0.38.1 does not support compile API")
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_Subject() {
+	subject := &Subject{
+		UserID:   "user1",
+		GroupIDs: []string{"group1"},
+		Roles:    []string{"admin"},
+		Tenant:   "tenant1",
+	}
+
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		Subject: subject,
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal(subject, suite.lastPermissionQueryInput.Subject)
+
+	// member ids default to the subject user and groups
+	suite.Require().Equal([]string{"user1", "group1"}, suite.lastPermissionQueryInput.Ids)
+
+	_, err = suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource"},
+		ActionRead,
+		&PermissionOptions{
+			MemberIds: []string{"member1"},
+			Subject:   subject,
+		})
+	suite.Require().NoError(err)
+	suite.Require().Equal(subject, suite.lastPermissionFilterInput.Subject)
+	suite.Require().Equal([]string{"member1"}, suite.lastPermissionFilterInput.Ids)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_ExtraInput() {
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+
+	for _, sourceIP := range []string{"10.0.0.1", "10.0.0.2"} {
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+			ExtraInput: map[string]any{
+				"sourceIP": sourceIP,
+				"resource": "overridden-resource",
+			},
+		})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+
+		// extra input is merged, without overriding the input fields
+		suite.Require().Equal(sourceIP, suite.lastRawPermissionInput["sourceIP"])
+		suite.Require().Equal("allow-resource", suite.lastRawPermissionInput["resource"])
+	}
+
+	// decisions are cached per extra input
+	suite.Require().Equal(int64(2), suite.permissionRequestsCount.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_ResourceAttributes() {
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+
+	for _, sensitivity := range []string{"public", "restricted"} {
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+			ResourceAttributes: map[string]map[string]any{
+				"allow-resource": {"owner": "user2", "sensitivity": sensitivity},
+			},
+		})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+		suite.Require().Equal(map[string]any{"owner": "user2", "sensitivity": sensitivity},
+			suite.lastPermissionQueryInput.Attributes)
+	}
+
+	// decisions are cached per resource attributes
+	suite.Require().Equal(int64(2), suite.permissionRequestsCount.Load())
+
+	// only the attributes of the queried resources are sent, keyed by the resources as scoped
+	_, err := suite.httpClient.Scoped(mustResource(ProjectResource("p1"))).QueryPermissionsMultiResources(suite.ctx,
+		[]string{"functions/f1", "functions/f2"},
+		ActionRead,
+		&PermissionOptions{
+			MemberIds: []string{"user1"},
+			ResourceAttributes: map[string]map[string]any{
+				"functions/f1": {"labels": map[string]any{"tier": "gold"}},
+				"functions/f3": {"labels": map[string]any{"tier": "bronze"}},
+			},
+		})
+	suite.Require().NoError(err)
+	suite.Require().Equal(map[string]map[string]any{
+		mustResource(ProjectResource("p1")) + "/functions/f1": {"labels": map[string]any{"tier": "gold"}},
+	}, suite.lastPermissionFilterInput.Attributes)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_SubjectResolver() {
+	type sessionContextKey struct{}
+	var resolvesCount atomic.Int64
+	WithSubjectResolver(NewCachingSubjectResolver(SubjectResolverFunc(func(ctx context.Context) (*Subject, error) {
+		resolvesCount.Add(1)
+		return &Subject{
+			UserID:   "user-of-" + ctx.Value(sessionContextKey{}).(string),
+			GroupIDs: []string{"group1"},
+		}, nil
+	}), func(ctx context.Context) string {
+		return ctx.Value(sessionContextKey{}).(string)
+	}, time.Minute, 0))(suite.httpClient)
+
+	sessionCtx := context.WithValue(suite.ctx, sessionContextKey{}, "session1")
+	for range 2 {
+		allowed, err := suite.httpClient.QueryPermissions(sessionCtx, "allow-resource", ActionRead, &PermissionOptions{})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+		suite.Require().Equal([]string{"user-of-session1", "group1"}, suite.lastPermissionQueryInput.Ids)
+	}
+	suite.Require().Equal(int64(1), resolvesCount.Load())
+
+	// explicit member ids are not resolved
+	_, err := suite.httpClient.QueryPermissions(sessionCtx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"user1"}, suite.lastPermissionQueryInput.Ids)
+	suite.Require().Nil(suite.lastPermissionQueryInput.Subject)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_MemberIDsFromContext() {
+	memberIDsCtx := WithMemberIDs(suite.ctx, []string{"user1", "group1"})
+
+	allowed, err := suite.httpClient.QueryPermissions(memberIDsCtx, "allow-resource", ActionRead, nil)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal([]string{"user1", "group1"}, suite.lastPermissionQueryInput.Ids)
+
+	_, err = suite.httpClient.QueryPermissionsMultiResources(memberIDsCtx,
+		[]string{"allow-resource"},
+		ActionRead,
+		&PermissionOptions{})
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"user1", "group1"}, suite.lastPermissionFilterInput.Ids)
+
+	// explicitly set member ids take precedence
+	_, err = suite.httpClient.QueryPermissions(memberIDsCtx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user2"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"user2"}, suite.lastPermissionQueryInput.Ids)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_IdentityForwarding() {
+	identityCtx := ContextWithIdentity(suite.ctx, &Identity{
+		Token:  "header.payload.signature",
+		Claims: map[string]any{"sub": "user1"},
+	})
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// not forwarded by default
+	_, err := suite.httpClient.QueryPermissions(identityCtx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().NotContains(suite.lastRawPermissionInput, IdentityInputField)
+
+	WithIdentityForwarding()(suite.httpClient)
+	_, err = suite.httpClient.QueryPermissions(identityCtx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal(map[string]any{
+		"token":  "header.payload.signature",
+		"claims": map[string]any{"sub": "user1"},
+	}, suite.lastRawPermissionInput[IdentityInputField])
+	suite.Require().Nil(permissionOptions.ExtraInput)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_Hierarchy() {
+	for _, testCase := range []struct {
+		name          string
+		hierarchyMode HierarchyMode
+		resource      string
+		expected      bool
+	}{
+		{name: "none", hierarchyMode: HierarchyModeNone, resource: "projects/p1/functions/f1", expected: false},
+		{name: "input", hierarchyMode: HierarchyModeInput, resource: "projects/p1/functions/f1", expected: true},
+		{name: "client", hierarchyMode: HierarchyModeClient, resource: "projects/p1/functions/f1", expected: true},
+		{name: "inputOtherProject", hierarchyMode: HierarchyModeInput, resource: "projects/p2/functions/f1", expected: false},
+		{name: "clientOtherProject", hierarchyMode: HierarchyModeClient, resource: "projects/p2/functions/f1", expected: false},
+	} {
+		suite.Run(testCase.name, func() {
+			allowed, err := suite.httpClient.QueryPermissions(suite.ctx,
+				testCase.resource,
+				ActionRead,
+				&PermissionOptions{
+					MemberIds:     []string{"user1"},
+					HierarchyMode: testCase.hierarchyMode,
+				})
+			suite.Require().NoError(err)
+			suite.Require().Equal(testCase.expected, allowed)
+		})
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissionsMultiResources_Hierarchy() {
+	resources := []string{
+		"projects/p1/functions/f1",
+		"projects/p2/functions/f1",
+		"allow-resource-1",
+	}
+
+	for _, hierarchyMode := range []HierarchyMode{HierarchyModeInput, HierarchyModeClient} {
+		suite.Run(string(hierarchyMode), func() {
+			permissions, err := suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+				resources,
+				ActionRead,
+				&PermissionOptions{
+					MemberIds:     []string{"user1"},
+					HierarchyMode: hierarchyMode,
+				})
+			suite.Require().NoError(err)
+			suite.Require().Equal([]bool{true, false, true}, permissions)
+		})
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_Wildcard() {
+	resource := WildcardResource(mustResource(ProjectResource("p1")))
+	suite.Require().Equal("/projects/p1/*", resource)
+
+	_, err := suite.httpClient.QueryPermissions(suite.ctx,
+		resource,
+		ActionRead,
+		&PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+	suite.Require().NoError(err)
+	suite.Require().Equal("/projects/p1/", suite.lastPermissionQueryInput.Prefix)
+
+	_, err = suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{resource, mustResource(ProjectResource("p2"))},
+		ActionRead,
+		&PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+	suite.Require().NoError(err)
+	suite.Require().Equal(map[string]string{resource: "/projects/p1/"}, suite.lastPermissionFilterInput.Prefixes)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_Cache() {
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1", "group1"},
+	}
+
+	for range 2 {
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+	}
+	suite.Require().Equal(int64(1), suite.permissionRequestsCount.Load())
+
+	// member ids order does not matter
+	_, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"group1", "user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal(int64(1), suite.permissionRequestsCount.Load())
+
+	// only the uncached resources are queried
+	permissions, err := suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"deny-resource", "allow-resource"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{false, true}, permissions)
+	suite.Require().Equal(int64(2), suite.permissionRequestsCount.Load())
+	suite.Require().Equal([]string{"deny-resource"}, suite.lastPermissionFilterInput.Resources)
+
+	// a different action is not cached
+	_, err = suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionDelete, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal(int64(3), suite.permissionRequestsCount.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestCacheStats() {
+	metricsSink := newTestMetricsSink()
+	WithDecisionCache(NewMemoryDecisionCache(1), time.Minute)(suite.httpClient)
+	WithMetricsSink(metricsSink)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	for _, resource := range []string{"allow-resource-1", "allow-resource-1", "allow-resource-2"} {
+		_, err := suite.httpClient.QueryPermissions(suite.ctx, resource, ActionRead, permissionOptions)
+		suite.Require().NoError(err)
+	}
+
+	suite.Require().Equal(CacheStats{
+		Hits:      1,
+		Misses:    2,
+		Evictions: 1,
+		Size:      1,
+	}, suite.httpClient.CacheStats())
+	suite.Require().Equal(int64(1), metricsSink.counter(MetricCacheHits))
+	suite.Require().Equal(int64(2), metricsSink.counter(MetricCacheMisses))
+	suite.Require().Equal(int64(1), metricsSink.counter(MetricCacheEvictions))
+	suite.Require().Equal(float64(1), metricsSink.gauge(MetricCacheSize))
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_CacheDenyTTL() {
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+	WithCacheDenyTTL(0)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	for range 2 {
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+
+		allowed, err = suite.httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, permissionOptions)
+		suite.Require().NoError(err)
+		suite.Require().False(allowed)
+	}
+
+	// allow decision was cached, deny decision was not
+	suite.Require().Equal(int64(3), suite.permissionRequestsCount.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_CacheActionTTLs() {
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+	WithCacheDenyTTL(0)(suite.httpClient)
+	WithCacheActionTTLs(map[Action]time.Duration{
+		ActionRead:   5 * time.Minute,
+		ActionDelete: 0,
+	})(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	for range 2 {
+		for _, action := range []Action{ActionRead, ActionDelete, ActionUpdate} {
+			allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", action, permissionOptions)
+			suite.Require().NoError(err)
+			suite.Require().True(allowed)
+		}
+
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, permissionOptions)
+		suite.Require().NoError(err)
+		suite.Require().False(allowed)
+	}
+
+	// read decisions (including denies) and update decisions were cached, delete decisions were not
+	suite.Require().Equal(int64(5), suite.permissionRequestsCount.Load())
+	suite.Require().Equal(map[Action]string{
+		ActionRead:   "5m0s",
+		ActionDelete: "0s",
+	}, suite.httpClient.DebugState().CacheActionTTLs)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissionsMultiSubjects() {
+	var requestsCount atomic.Int64
+	var lastMultiSubjectsInput PermissionMultiSubjectsRequestInput
+	subjectsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsCount.Add(1)
+
+		// admins (and only them) are allowed
+		switch r.URL.Path {
+		case suite.httpClient.permissionQueryPath:
+			var permissionRequest PermissionQueryRequest
+			suite.Require().NoError(json.NewDecoder(r.Body).Decode(&permissionRequest))
+			suite.Require().NoError(json.NewEncoder(w).Encode(PermissionQueryResponse{
+				Result: slices.Contains(permissionRequest.Input.Ids, "admins"),
+			}))
+		case "/v1/data/authz/allowed_subjects":
+			var permissionMultiSubjectsRequest PermissionMultiSubjectsRequest
+			suite.Require().NoError(json.NewDecoder(r.Body).Decode(&permissionMultiSubjectsRequest))
+			lastMultiSubjectsInput = permissionMultiSubjectsRequest.Input
+			permissionMultiSubjectsResponse := PermissionMultiSubjectsResponse{Result: [][]string{}}
+			for _, subject := range permissionMultiSubjectsRequest.Input.Subjects {
+				if slices.Contains(subject, "admins") {
+					permissionMultiSubjectsResponse.Result = append(permissionMultiSubjectsResponse.Result, subject)
+				}
+			}
+			suite.Require().NoError(json.NewEncoder(w).Encode(permissionMultiSubjectsResponse))
+		}
+	}))
+	defer subjectsServer.Close()
+
+	subjects := [][]string{
+		{"user1", "admins"},
+		{"user2", "developers"},
+		{"user3"},
+	}
+	permissionOptions := &PermissionOptions{
+		MemberIds:           []string{"caller"},
+		OverrideHeaderValue: "override",
+	}
+	for _, testCase := range []struct {
+		name             string
+		options          []Option
+		expectedRequests int64
+	}{
+		{
+			name:             "BySubject",
+			expectedRequests: 3,
+		},
+		{
+			name:             "SingleRequest",
+			options:          []Option{WithMultiSubjectsPath("/v1/data/authz/allowed_subjects")},
+			expectedRequests: 1,
+		},
+	} {
+		suite.Run(testCase.name, func() {
+			requestsCount.Store(0)
+			httpClient := NewHTTPClient(suite.logger,
+				subjectsServer.URL,
+				suite.httpClient.permissionQueryPath,
+				suite.httpClient.permissionFilterPath,
+				5*time.Second,
+				false,
+				"override",
+				false,
+				append([]Option{
+					WithClock(newTestClock()),
+					WithDecisionCache(NewMemoryDecisionCache(0), time.Minute),
+				}, testCase.options...)...)
+
+			// the caller's override does not apply to the queried subjects, whose decisions are cached
+			for range 2 {
+				results, err := httpClient.QueryPermissionsMultiSubjects(suite.ctx,
+					"/projects/p1",
+					ActionRead,
+					subjects,
+					permissionOptions)
+				suite.Require().NoError(err)
+				suite.Require().Equal([]bool{true, false, false}, results)
+			}
+			suite.Require().Equal(testCase.expectedRequests, requestsCount.Load())
+
+			_, err := httpClient.QueryPermissionsMultiSubjects(suite.ctx,
+				"/projects/p1",
+				ActionRead,
+				[][]string{{"user1"}, {}},
+				permissionOptions)
+			suite.Require().Error(err)
+		})
+	}
+	suite.Require().Equal("/projects/p1", lastMultiSubjectsInput.Resource)
+	suite.Require().Equal(subjects, lastMultiSubjectsInput.Subjects)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissionsMultiSubjects_Hierarchy() {
+	var lock sync.Mutex
+	queriedResourceSubjects := map[string][][]string{}
+	subjectsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var permissionMultiSubjectsRequest PermissionMultiSubjectsRequest
+		suite.Require().NoError(json.NewDecoder(r.Body).Decode(&permissionMultiSubjectsRequest))
+		input := permissionMultiSubjectsRequest.Input
+		lock.Lock()
+		queriedResourceSubjects[input.Resource] = input.Subjects
+		lock.Unlock()
+
+		// admins are allowed anywhere, developers on the project, and the allowed member ids are reordered
+		permissionMultiSubjectsResponse := PermissionMultiSubjectsResponse{Result: [][]string{}}
+		for _, subject := range input.Subjects {
+			if slices.Contains(subject, "admins") ||
+				(slices.Contains(subject, "developers") && input.Resource == "/projects/p1") {
+				reorderedSubject := slices.Clone(subject)
+				slices.Reverse(reorderedSubject)
+				permissionMultiSubjectsResponse.Result = append(permissionMultiSubjectsResponse.Result, reorderedSubject)
+			}
+		}
+		suite.Require().NoError(json.NewEncoder(w).Encode(permissionMultiSubjectsResponse))
+	}))
+	defer subjectsServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		subjectsServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithMultiSubjectsPath("/v1/data/authz/allowed_subjects"))
+
+	// subjects are matched regardless of the member ids order, and allowed by any ancestor
+	results, err := httpClient.QueryPermissionsMultiSubjects(suite.ctx,
+		"/projects/p1/functions/f1",
+		ActionRead,
+		[][]string{{"user1", "admins"}, {"user2", "developers"}, {"user3"}},
+		&PermissionOptions{HierarchyMode: HierarchyModeClient})
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, true, false}, results)
+
+	// the ancestors are queried for the subjects which are not allowed yet
+	suite.Require().Equal(map[string][][]string{
+		"/projects/p1/functions/f1": {{"user1", "admins"}, {"user2", "developers"}, {"user3"}},
+		"/projects/p1/functions":    {{"user2", "developers"}, {"user3"}},
+		"/projects/p1":              {{"user2", "developers"}, {"user3"}},
+		"/projects":                 {{"user3"}},
+	}, queriedResourceSubjects)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissionsMultiSubjects_BoundedConcurrency() {
+	var inflightRequests, maxInflightRequests atomic.Int64
+	subjectsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inflight := inflightRequests.Add(1)
+		defer inflightRequests.Add(-1)
+		for {
+			maxInflight := maxInflightRequests.Load()
+			if inflight <= maxInflight || maxInflightRequests.CompareAndSwap(maxInflight, inflight) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer subjectsServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		subjectsServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false)
+
+	subjects := make([][]string, 4*DefaultMultiSubjectsConcurrency)
+	for subjectIdx := range subjects {
+		subjects[subjectIdx] = []string{fmt.Sprintf("user%d", subjectIdx)}
+	}
+	results, err := httpClient.QueryPermissionsMultiSubjects(suite.ctx, "/projects/p1", ActionRead, subjects, nil)
+	suite.Require().NoError(err)
+	suite.Require().Len(results, len(subjects))
+	suite.Require().NotContains(results, false)
+	suite.Require().LessOrEqual(maxInflightRequests.Load(), int64(DefaultMultiSubjectsConcurrency))
+}
+
+func (suite *HTTPClientTestSuite) TestAllowedActions() {
+	var lastAllowedActionsInput PermissionAllowedActionsRequestInput
+	actionsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var permissionAllowedActionsRequest PermissionAllowedActionsRequest
+		suite.Require().NoError(json.NewDecoder(r.Body).Decode(&permissionAllowedActionsRequest))
+		lastAllowedActionsInput = permissionAllowedActionsRequest.Input
+
+		permissionAllowedActionsResponse := PermissionAllowedActionsResponse{}
+		if strings.HasPrefix(lastAllowedActionsInput.Resource, "/projects/p1") {
+			permissionAllowedActionsResponse.Result = []Action{ActionUpdate, ActionRead, "deploy", ActionRead}
+		}
+		suite.Require().NoError(json.NewEncoder(w).Encode(permissionAllowedActionsResponse))
+	}))
+	defer actionsServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		actionsServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"override",
+		false,
+		WithClock(newTestClock()),
+		WithAllowedActionsPath("/v1/data/authz/allowed_actions"))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	allowedActions, err := httpClient.AllowedActions(suite.ctx, "/projects/p1/functions/f1", permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]Action{"deploy", ActionRead, ActionUpdate}, allowedActions)
+	suite.Require().Equal([]string{"user1"}, lastAllowedActionsInput.Ids)
+
+	// relative to the scope of scoped clients
+	allowedActions, err = httpClient.Scoped(mustResource(ProjectResource("p2"))).AllowedActions(suite.ctx,
+		"functions/f1",
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Empty(allowedActions)
+	suite.Require().Equal("/projects/p2/functions/f1", lastAllowedActionsInput.Resource)
+
+	// the override allows the standard actions
+	allowedActions, err = httpClient.AllowedActions(suite.ctx, "/projects/p2", &PermissionOptions{
+		MemberIds:           []string{"user1"},
+		OverrideHeaderValue: "override",
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal([]Action{ActionCreate, ActionDelete, ActionList, ActionRead, ActionUpdate}, allowedActions)
+
+	// querying requires the allowed actions path
+	_, err = suite.httpClient.AllowedActions(suite.ctx, "/projects/p1", permissionOptions)
+	suite.Require().Error(err)
+}
+
+func (suite *HTTPClientTestSuite) TestListAllowedResources() {
+	var requestInputs []PermissionPageRequestInput
+	pageServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var permissionPageRequest PermissionPageRequest
+		suite.Require().NoError(json.NewDecoder(r.Body).Decode(&permissionPageRequest))
+		requestInputs = append(requestInputs, permissionPageRequest.Input)
+
+		// the policy enumerates 5 allowed resources, one of them outside of project p1
+		allowedResources := []string{
+			"/projects/p1/functions/f1",
+			"/projects/p2/functions/f2",
+			"/projects/p1/functions/f3",
+			"/projects/p1/functions/f4",
+			"/projects/p1/functions/f5",
+		}
+		offset, limit := permissionPageRequest.Input.Offset, permissionPageRequest.Input.Limit
+		result := PermissionPageResult{
+			Resources: allowedResources[offset:min(offset+limit, len(allowedResources))],
+		}
+		if offset+limit < len(allowedResources) {
+			nextOffset := offset + limit
+			result.NextOffset = &nextOffset
+		}
+		suite.Require().NoError(json.NewEncoder(w).Encode(PermissionPageResponse{Result: result}))
+	}))
+	defer pageServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		pageServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(newTestClock()),
+		WithPaginatedFilterPath("/v1/data/authz/list_allowed", 2))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	var pages [][]string
+	suite.Require().NoError(httpClient.ListAllowedResources(suite.ctx,
+		ActionRead,
+		permissionOptions,
+		func(resources []string) error {
+			pages = append(pages, resources)
+			return nil
+		}))
+	suite.Require().Equal([][]string{
+		{"/projects/p1/functions/f1", "/projects/p2/functions/f2"},
+		{"/projects/p1/functions/f3", "/projects/p1/functions/f4"},
+		{"/projects/p1/functions/f5"},
+	}, pages)
+	suite.Require().Len(requestInputs, 3)
+	suite.Require().Equal(4, requestInputs[2].Offset)
+	suite.Require().Equal(2, requestInputs[2].Limit)
+	suite.Require().Equal("read", requestInputs[2].Action)
+	suite.Require().Equal([]string{"user1"}, requestInputs[2].Ids)
+
+	// a scoped client lists the resources within its scope only
+	var scopedResources []string
+	suite.Require().NoError(httpClient.Scoped(mustResource(ProjectResource("p1"))).ListAllowedResources(suite.ctx,
+		ActionRead,
+		permissionOptions,
+		func(resources []string) error {
+			scopedResources = append(scopedResources, resources...)
+			return nil
+		}))
+	suite.Require().NotContains(scopedResources, "/projects/p2/functions/f2")
+	suite.Require().Len(scopedResources, 4)
+
+	// the page function stops listing
+	requestInputs = nil
+	stopErr := errors.New("stop")
+	err := httpClient.ListAllowedResources(suite.ctx,
+		ActionRead,
+		permissionOptions,
+		func(resources []string) error {
+			return stopErr
+		})
+	suite.Require().ErrorIs(err, stopErr)
+	suite.Require().Len(requestInputs, 1)
+
+	// listing requires the paginated filter path
+	suite.Require().Error(suite.httpClient.ListAllowedResources(suite.ctx,
+		ActionRead,
+		permissionOptions,
+		func(resources []string) error {
+			return nil
+		}))
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_CacheRefresh() {
+
+	// every cached decision is within the refresh window
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+	WithCacheRefreshWindow(2 * time.Minute)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal(int64(1), suite.permissionRequestsCount.Load())
+
+	// served from the cache, and refreshed in the background
+	allowed, err = suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Eventually(func() bool {
+		return suite.permissionRequestsCount.Load() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (suite *HTTPClientTestSuite) TestDecisionLog() {
+	decisionLogSink := &testDecisionLogSink{}
+	clock := newTestClock()
+	WithClock(clock)(suite.httpClient)
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+	WithDecisionLogSink(decisionLogSink)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	_, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	_, err = suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource", "deny-resource"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+
+	// flush the queued records
+	suite.Require().NoError(suite.httpClient.decisionLogSink.Close())
+
+	records := decisionLogSink.records
+	suite.Require().Len(records, 3)
+	suite.Require().Equal("allow-resource", records[0].Resource)
+	suite.Require().Equal([]string{"user1"}, records[0].MemberIds)
+	suite.Require().True(records[0].Allowed)
+	suite.Require().False(records[0].Cached)
+	suite.Require().Equal("allow-resource", records[1].Resource)
+	suite.Require().True(records[1].Cached)
+	suite.Require().Equal("deny-resource", records[2].Resource)
+	suite.Require().False(records[2].Allowed)
+	suite.Require().False(records[2].Cached)
+
+	// the records are timestamped by the client clock
+	for _, record := range records {
+		suite.Require().Equal(clock.Now(), record.Timestamp)
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestWith() {
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().False(allowed)
+
+	// the derived client queries its own policy, rather than the decisions cached for the other
+	shadowPolicyClient := suite.httpClient.With(WithPermissionPaths(shadowAllowPath, shadowFilterPath))
+	allowed, err = shadowPolicyClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+
+	allowed, err = suite.httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().False(allowed)
+	suite.Require().Equal(int64(1), suite.httpClient.CacheStats().Hits)
+
+	// default permission options complete the unset ones
+	defaultOptionsClient := suite.httpClient.With(WithDefaultPermissionOptions(&PermissionOptions{
+		MemberIds:  []string{"user2"},
+		ExtraInput: map[string]any{"component": "scheduler", "region": "us"},
+	}))
+	allowed, err = defaultOptionsClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		ExtraInput: map[string]any{"region": "eu"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal([]string{"user2"}, suite.lastPermissionQueryInput.Ids)
+	suite.Require().Equal("scheduler", suite.lastRawPermissionInput["component"])
+	suite.Require().Equal("eu", suite.lastRawPermissionInput["region"])
+}
+
+func (suite *HTTPClientTestSuite) TestScoped() {
+	scopedClient := suite.httpClient.Scoped("projects/p1")
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	decision, err := scopedClient.QueryDecision(suite.ctx, "functions/f1", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal("/projects/p1/functions/f1", decision.Resource)
+	suite.Require().Equal("/projects/p1/functions/f1", suite.lastPermissionQueryInput.Resource)
+	suite.Require().Equal("/projects/p1", suite.lastRawPermissionInput[ScopeInputField])
+
+	// nested scopes are relative
+	_, err = scopedClient.Scoped("functions").QueryPermissions(suite.ctx, "f2", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal("/projects/p1/functions/f2", suite.lastPermissionQueryInput.Resource)
+
+	_, err = scopedClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"functions/f1", mustResource(FunctionResource("p1", "f2"))},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"/projects/p1/functions/f1", "/projects/p1/functions/f2"},
+		suite.lastPermissionFilterInput.Resources)
+
+	// resources outside of the scope are rejected
+	for _, resource := range []string{mustResource(FunctionResource("p2", "f1")), "/projects/p10", "../p2/functions/f1"} {
+		_, err = scopedClient.QueryPermissions(suite.ctx, resource, ActionRead, permissionOptions)
+		suite.Require().ErrorIs(err, ErrOutOfScope, resource)
+	}
+	_, err = scopedClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"functions/f1", mustResource(FunctionResource("p2", "f1"))},
+		ActionRead,
+		permissionOptions)
+	suite.Require().ErrorIs(err, ErrOutOfScope)
+}
+
+func (suite *HTTPClientTestSuite) TestTenant() {
+	var requestPaths []string
+	var requestTenants []any
+	tenantServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		permissionRequest := map[string]map[string]any{}
+		suite.Require().NoError(json.NewDecoder(r.Body).Decode(&permissionRequest))
+		requestPaths = append(requestPaths, r.URL.EscapedPath())
+		requestTenants = append(requestTenants, permissionRequest["input"][TenantInputField])
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer tenantServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		tenantServer.URL,
+		"/v1/data/tenants/{tenant}/authz/allow",
+		"/v1/data/tenants/{tenant}/authz/filter_allowed",
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithDecisionCache(NewMemoryDecisionCache(0), time.Minute))
+
+	// the tenant is sent in the input and expands the policy path, and is part of the cache key
+	for _, tenant := range []string{"t1", "t2", "t1"} {
+		allowed, err := httpClient.QueryPermissions(suite.ctx, "resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+			Tenant:    tenant,
+		})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+	}
+	suite.Require().Equal([]string{"/v1/data/tenants/t1/authz/allow", "/v1/data/tenants/t2/authz/allow"}, requestPaths)
+	suite.Require().Equal([]any{"t1", "t2"}, requestTenants)
+
+	// the subject tenant is used unless set, and tenants are escaped
+	_, err := httpClient.QueryPermissions(suite.ctx, "resource", ActionRead, &PermissionOptions{
+		Subject: &Subject{UserID: "user1", Tenant: "t 3"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal("/v1/data/tenants/t%203/authz/allow", requestPaths[2])
+	suite.Require().Equal("t 3", requestTenants[2])
+
+	// tenants escaping their path segment are rejected
+	for _, tenant := range []string{".", "..", "t/3", "../authz"} {
+		_, err = httpClient.QueryPermissions(suite.ctx, "resource", ActionRead, &PermissionOptions{
+			Subject: &Subject{UserID: "user1", Tenant: tenant},
+		})
+		suite.Require().ErrorIs(err, ErrInvalidInput, tenant)
+	}
+
+	// tenant policy paths cannot be queried without a tenant
+	_, err = httpClient.QueryPermissions(suite.ctx, "resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().ErrorIs(err, ErrTenantRequired)
+	suite.Require().Len(requestPaths, 3)
+}
+
+func (suite *HTTPClientTestSuite) TestClose() {
+	unblockChan := make(chan struct{})
+	blockingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblockChan
+	}))
+	defer blockingServer.Close()
+	defer close(unblockChan)
+
+	decisionLogSink := &testDecisionLogSink{}
+	WithShadow(blockingServer.URL, "", "")(suite.httpClient)
+	WithDecisionLogSink(decisionLogSink)(suite.httpClient)
+
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+
+	// the blocked shadow query is canceled once draining times out
+	closeCtx, cancel := context.WithTimeout(suite.ctx, 100*time.Millisecond)
+	defer cancel()
+	err = suite.httpClient.Close(closeCtx)
+	suite.Require().ErrorIs(err, context.DeadlineExceeded)
+
+	// the decision log is flushed, and no more background work is run
+	suite.Require().Len(decisionLogSink.records, 1)
+	suite.Require().False(suite.httpClient.backgroundTasks.run(suite.ctx, func(ctx context.Context) {}))
+}
+
+func (suite *HTTPClientTestSuite) TestStatsdMetricsSink() {
+	statsdConnection, err := net.ListenPacket("udp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	defer statsdConnection.Close() // nolint: errcheck
+
+	metricsSink, err := NewStatsdMetricsSink(suite.logger,
+		statsdConnection.LocalAddr().String(),
+		"svc.",
+		map[string]string{"env": "test"})
+	suite.Require().NoError(err)
+	WithMetricsSink(metricsSink)(suite.httpClient)
+
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().NoError(suite.httpClient.Close(suite.ctx))
+
+	var metrics []string
+	buffer := make([]byte, 1024)
+	suite.Require().NoError(statsdConnection.SetReadDeadline(time.Now().Add(time.Second)))
+	for len(metrics) < 3 {
+		readBytes, _, err := statsdConnection.ReadFrom(buffer)
+		suite.Require().NoError(err)
+		metrics = append(metrics, string(buffer[:readBytes]))
+	}
+	suite.Require().Equal("svc.opa_client_queries_total:1|c|#env:test,path:/v1/data/authz/allow,status:success",
+		metrics[0])
+	suite.Require().Regexp(`^svc\.opa_client_query_duration_seconds:[0-9.]+\|ms\|#env:test,path:/v1/data/authz/allow,status:success$`,
+		metrics[1])
+	suite.Require().Equal("svc.opa_client_decisions_total:1|c|#env:test,outcome:allow", metrics[2])
+}
+
+func (suite *HTTPClientTestSuite) TestDebugState() {
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	for range 2 {
+		_, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+		suite.Require().NoError(err)
+	}
+
+	debugState := suite.httpClient.DebugState()
+	suite.Require().Equal(ClientKindHTTP, debugState.ClientKind)
+	suite.Require().Equal(suite.testHTTPServer.URL, debugState.Address)
+	suite.Require().Equal("5s", debugState.RequestTimeout)
+	suite.Require().True(debugState.OverrideEnabled)
+	suite.Require().Equal("1m0s", debugState.CacheTTL)
+	suite.Require().Equal(int64(1), debugState.CacheStats.Hits)
+	suite.Require().Equal(QueryStats{Queries: 1}, debugState.QueryStats)
+
+	// secrets are left out
+	encodedDebugState, err := json.Marshal(debugState)
+	suite.Require().NoError(err)
+	suite.Require().NotContains(string(encodedDebugState), "test-override-value")
+}
+
+func (suite *HTTPClientTestSuite) TestDecisionHooks() {
+	var allowedResources, deniedResources, failedResources []string
+	WithDecisionHooks(DecisionHooks{
+		OnAllow: func(ctx context.Context, record DecisionRecord) {
+			allowedResources = append(allowedResources, record.Resource)
+		},
+		OnDeny: func(ctx context.Context, record DecisionRecord) {
+			suite.Require().Equal([]string{"user1"}, record.MemberIds)
+			deniedResources = append(deniedResources, record.Resource)
+		},
+		OnError: func(ctx context.Context, record DecisionRecord) {
+			suite.Require().NotEmpty(record.Error)
+			failedResources = append(failedResources, record.Resource)
+		},
+	})(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	_, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	_, err = suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", "deny-resource-1"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+
+	// rather than retrying the failed query for the retry timeout
+	suite.failPermissionQueries.Store(true)
+	queryCtx, cancel := context.WithTimeout(suite.ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err = suite.httpClient.QueryPermissions(queryCtx, "allow-resource-2", ActionRead, permissionOptions)
+	suite.Require().Error(err)
+
+	suite.Require().Equal([]string{"allow-resource", "allow-resource-1"}, allowedResources)
+	suite.Require().Equal([]string{"deny-resource-1"}, deniedResources)
+	suite.Require().Equal([]string{"allow-resource-2"}, failedResources)
+}
+
+func (suite *HTTPClientTestSuite) TestProvenance() {
+	decisionLogSink := &testDecisionLogSink{}
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+	WithDecisionLogSink(decisionLogSink)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// not requested by default
+	decision, err := suite.httpClient.QueryDecision(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Nil(decision.Provenance)
+
+	WithProvenance()(suite.httpClient)
+	decision, err = suite.httpClient.QueryDecision(suite.ctx, "allow-resource", ActionUpdate, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().NotNil(decision.Provenance)
+	suite.Require().Equal("rev-1", decision.Provenance.BundleRevision("authz"))
+
+	// served from cache along with its provenance
+	decision, err = suite.httpClient.QueryDecision(suite.ctx, "allow-resource", ActionUpdate, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(decision.Cached)
+	suite.Require().Equal("rev-1", decision.Provenance.BundleRevision("authz"))
+
+	_, err = suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", "deny-resource-1"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+
+	// flush the queued records
+	suite.Require().NoError(suite.httpClient.decisionLogSink.Close())
+
+	records := decisionLogSink.records
+	suite.Require().Len(records, 5)
+	suite.Require().Nil(records[0].Provenance)
+	for _, record := range records[1:] {
+		suite.Require().Equal("0.38.1", record.Provenance.Version)
+		suite.Require().Equal("rev-1", record.Provenance.BundleRevision("authz"))
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestPolicyRevision() {
+	metricsSink := newTestMetricsSink()
+	decisionCache := NewMemoryDecisionCache(0)
+	WithMetricsSink(metricsSink)(suite.httpClient)
+	WithDecisionCache(decisionCache, time.Minute)(suite.httpClient)
+	WithProvenance()(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	decision, err := suite.httpClient.QueryDecision(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().False(decision.Cached)
+	decision, err = suite.httpClient.QueryDecision(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(decision.Cached)
+
+	// a new revision detected by the status flushes the cache
+	suite.bundleRevision.Store("rev-2")
+	suite.Require().NoError(suite.httpClient.refreshPolicyRevision(suite.ctx))
+	suite.Require().Zero(decisionCache.Len())
+	suite.Require().Equal(int64(1), metricsSink.counter(MetricPolicyRevisionChanges))
+
+	decision, err = suite.httpClient.QueryDecision(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().False(decision.Cached)
+	suite.Require().Equal("rev-2", decision.Provenance.BundleRevision("authz"))
+
+	// a new revision detected by a decision flushes the cache as well
+	suite.bundleRevision.Store("rev-3")
+	decision, err = suite.httpClient.QueryDecision(suite.ctx, "allow-other-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal("rev-3", decision.Provenance.BundleRevision("authz"))
+	suite.Require().Equal(int64(2), metricsSink.counter(MetricPolicyRevisionChanges))
+
+	decision, err = suite.httpClient.QueryDecision(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().False(decision.Cached)
+	suite.Require().Equal("rev-3", decision.Provenance.BundleRevision("authz"))
+
+	// the same revision keeps the cache
+	suite.Require().NoError(suite.httpClient.refreshPolicyRevision(suite.ctx))
+	suite.Require().Equal(2, decisionCache.Len())
+
+	// polled in the background, until closed
+	pollingClient := NewHTTPClient(suite.logger,
+		suite.testHTTPServer.URL,
+		"/v1/data/authz/allow",
+		"/v1/data/authz/filter_allowed",
+		time.Second,
+		false,
+		"",
+		false,
+		WithMetricsSink(metricsSink),
+		WithRevisionPolling(10*time.Millisecond))
+	suite.Require().Eventually(func() bool {
+		return pollingClient.policyRevision.get() == "rev-3"
+	}, time.Second, 10*time.Millisecond)
+
+	suite.bundleRevision.Store("rev-4")
+	suite.Require().Eventually(func() bool {
+		return metricsSink.counter(MetricPolicyRevisionChanges) == 3
+	}, time.Second, 10*time.Millisecond)
+	suite.Require().NoError(pollingClient.Close(suite.ctx))
+}
+
+func (suite *HTTPClientTestSuite) TestShadow() {
+	metricsSink := newTestMetricsSink()
+	WithMetricsSink(metricsSink)(suite.httpClient)
+	WithShadow("", shadowAllowPath, shadowFilterPath)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// the primary decision is enforced
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	allowed, err = suite.httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().False(allowed)
+
+	permissions, err := suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", "deny-resource-1", "deny-resource-2"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, false, false}, permissions)
+
+	// every deny diverges from the shadow decision
+	suite.Require().Eventually(func() bool {
+		return metricsSink.counter(MetricShadowDivergences) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	suite.Require().Zero(metricsSink.counter(MetricShadowFailures))
+}
+
+func (suite *HTTPClientTestSuite) TestFailingShadowDoesNotThrottlePrimary() {
+	var primaryRequestsCount atomic.Int64
+	opaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == shadowAllowPath {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		primaryRequestsCount.Add(1)
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer opaServer.Close()
+
+	for _, testCase := range []struct {
+		name    string
+		options []Option
+	}{
+		{
+			name:    "adaptiveThrottling",
+			options: []Option{WithAdaptiveThrottling(time.Minute, 2)},
+		},
+		{
+			name:    "retryBudget",
+			options: []Option{WithRetryBudget(0.1, time.Minute, 0)},
+		},
+	} {
+		suite.Run(testCase.name, func() {
+			primaryRequestsCount.Store(0)
+			metricsSink := newTestMetricsSink()
+			httpClient := NewHTTPClient(suite.logger,
+				opaServer.URL,
+				suite.httpClient.permissionQueryPath,
+				suite.httpClient.permissionFilterPath,
+				5*time.Second,
+				false,
+				"",
+				false,
+				append(testCase.options,
+					WithClock(newTestClock()),
+					WithMetricsSink(metricsSink),
+					WithShadow("", shadowAllowPath, shadowFilterPath))...)
+			if httpClient.adaptiveThrottling != nil {
+				httpClient.adaptiveThrottling.random = func() float64 { return 0.5 }
+			}
+			permissionOptions := &PermissionOptions{
+				MemberIds: []string{"user1"},
+			}
+
+			// every shadow query fails, while the primary ones keep succeeding unthrottled
+			for queryIdx := 0; queryIdx < 10; queryIdx++ {
+				allowed, err := httpClient.QueryPermissions(suite.ctx,
+					fmt.Sprintf("allow-resource-%d", queryIdx),
+					ActionRead,
+					permissionOptions)
+				suite.Require().NoError(err)
+				suite.Require().True(allowed)
+				suite.Require().Eventually(func() bool {
+					return metricsSink.counter(MetricShadowFailures) == int64(queryIdx+1)
+				}, 5*time.Second, 10*time.Millisecond)
+			}
+			suite.Require().Equal(int64(10), primaryRequestsCount.Load())
+			suite.Require().Zero(metricsSink.counter(MetricThrottledRequests))
+
+			// nor did the shadow queries spend the primary retry budget
+			if httpClient.retryBudget != nil {
+				suite.Require().True(httpClient.retryBudget.withdraw(httpClient.clock.Now()))
+			}
+		})
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestCanary() {
+	metricsSink := newTestMetricsSink()
+	WithMetricsSink(metricsSink)(suite.httpClient)
+	WithCanary(shadowAllowPath, shadowFilterPath, 100)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// the primary decision is enforced
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().False(allowed)
+
+	permissions, err := suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", "allow-resource-2", "deny-resource-1"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, true, false}, permissions)
+
+	// the canary policy allows all, agreeing with every allow
+	suite.Require().Eventually(func() bool {
+		return metricsSink.counter(MetricCanaryComparisons) == 4
+	}, 5*time.Second, 10*time.Millisecond)
+	suite.Require().Equal(int64(2), metricsSink.counter(MetricCanaryComparisons+"{outcome=agree}"))
+	suite.Require().Equal(int64(2), metricsSink.counter(MetricCanaryComparisons+"{outcome=disagree}"))
+	suite.Require().Zero(metricsSink.counter(MetricCanaryFailures))
+
+	// unsampled queries aren't sent to the canary policy
+	WithCanary(shadowAllowPath, shadowFilterPath, 0)(suite.httpClient)
+	_, err = suite.httpClient.QueryPermissions(suite.ctx, "deny-resource-2", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().NoError(suite.httpClient.Close(suite.ctx))
+	suite.Require().Equal(int64(4), metricsSink.counter(MetricCanaryComparisons))
+}
+
+func (suite *HTTPClientTestSuite) TestShadowAndCanaryQueryAlike() {
+	var lock sync.Mutex
+	authorizationHeaders := map[string]string{}
+	opaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		authorizationHeaders[r.URL.Path] = r.Header.Get("Authorization")
+		lock.Unlock()
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer opaServer.Close()
+
+	// the shadow and canary clients query alike, regardless of the options order
+	metricsSink := newTestMetricsSink()
+	httpClient := NewHTTPClient(suite.logger,
+		opaServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithShadow("", shadowAllowPath, shadowFilterPath),
+		WithCanary("/v1/data/authz/canary/allow", "/v1/data/authz/canary/filter_allowed", 100),
+		WithMetricsSink(metricsSink),
+		WithSecretReferences(SecretReferences{BearerToken: "token"}, nil, 0))
+
+	_, err := httpClient.QueryPermissions(suite.ctx, "resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().NoError(httpClient.Close(suite.ctx))
+
+	suite.Require().Equal(map[string]string{
+		suite.httpClient.permissionQueryPath: "Bearer token",
+		shadowAllowPath:                      "Bearer token",
+		"/v1/data/authz/canary/allow":        "Bearer token",
+	}, authorizationHeaders)
+	suite.Require().Zero(metricsSink.counter(MetricShadowFailures))
+	suite.Require().Equal(int64(1), metricsSink.counter(MetricCanaryComparisons+"{outcome=agree}"))
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_CacheTTLHints() {
+	var requestsCount atomic.Int64
+	policyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsCount.Add(1)
+		var permissionRequest PermissionQueryRequest
+		suite.Require().NoError(json.NewDecoder(r.Body).Decode(&permissionRequest))
+
+		// the policy tells how long its decisions remain fresh
+		result := `{"allow": true, "ttl_seconds": 300}`
+		switch permissionRequest.Input.Resource {
+		case "volatile-resource":
+			result = `{"allow": true, "ttl_seconds": 0}`
+		case "default-resource":
+			result = `{"allow": true}`
+		}
+		_, err := w.Write([]byte(`{"result": ` + result + `}`))
+		suite.Require().NoError(err)
+	}))
+	defer policyServer.Close()
+
+	clock := newTestClock()
+	decisionCache := NewMemoryDecisionCache(0)
+	decisionCache.SetClock(clock)
+	httpClient := NewHTTPClient(suite.logger,
+		policyServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(clock),
+		WithDecisionCache(decisionCache, time.Minute))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+	queryDecision := func(resource string) *Decision {
+		decision, err := httpClient.QueryDecision(suite.ctx, resource, ActionRead, permissionOptions)
+		suite.Require().NoError(err)
+		suite.Require().True(decision.Allowed)
+		return decision
+	}
+
+	decision := queryDecision("resource")
+	suite.Require().Equal(5*time.Minute, *decision.CacheTTL)
+	queryDecision("volatile-resource")
+	queryDecision("default-resource")
+	suite.Require().Equal(int64(3), requestsCount.Load())
+
+	// the hinted TTL outlives the configured one
+	clock.advance(2 * time.Minute)
+	suite.Require().True(queryDecision("resource").Cached)
+	suite.Require().False(queryDecision("default-resource").Cached)
+
+	// a zero TTL is never cached
+	suite.Require().False(queryDecision("volatile-resource").Cached)
+
+	clock.advance(4 * time.Minute)
+	suite.Require().False(queryDecision("resource").Cached)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPermissions_StaleDecisions() {
+	decisionLogSink := &testDecisionLogSink{}
+	clock := newTestClock()
+	decisionCache := NewMemoryDecisionCache(0)
+	decisionCache.SetClock(clock)
+	WithClock(clock)(suite.httpClient)
+	WithDecisionCache(decisionCache, 50*time.Millisecond)(suite.httpClient)
+	WithStaleDecisions(time.Minute)(suite.httpClient)
+	WithFallbackPolicy(&FallbackPolicy{
+		Rules: []FallbackRule{
+			{Actions: []Action{ActionRead}, Allow: true},
+		},
+	})(suite.httpClient)
+	WithDecisionLogSink(decisionLogSink)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	_, err := suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", "deny-resource-1"},
+		ActionUpdate,
+		permissionOptions)
+	suite.Require().NoError(err)
+
+	// let the decisions expire, and fail OPA
+	clock.advance(100 * time.Millisecond)
+	suite.failPermissionQueries.Store(true)
+
+	decision, err := suite.httpClient.QueryDecision(suite.ctx, "allow-resource-1", ActionUpdate, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(decision.Allowed)
+	suite.Require().True(decision.Stale)
+
+	// stale decisions are served first, then fallback decisions
+	permissions, err := suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", "deny-resource-1"},
+		ActionUpdate,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, false}, permissions)
+
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "deny-resource-1", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+
+	// no stale nor fallback decision
+	_, err = suite.httpClient.QueryPermissions(suite.ctx, "deny-resource-2", ActionUpdate, permissionOptions)
+	suite.Require().Error(err)
+
+	// flush the queued records
+	suite.Require().NoError(suite.httpClient.decisionLogSink.Close())
+
+	records := decisionLogSink.records
+	suite.Require().Len(records, 7)
+	for _, record := range records[2:5] {
+		suite.Require().True(record.Stale)
+	}
+	suite.Require().True(records[5].Fallback)
+	suite.Require().NotEmpty(records[6].Error)
+}
+
+func (suite *HTTPClientTestSuite) TestEnforcementModeMonitor() {
+	metricsSink := newTestMetricsSink()
+	decisionLogSink := &testDecisionLogSink{}
+	WithMetricsSink(metricsSink)(suite.httpClient)
+	WithDecisionLogSink(decisionLogSink)(suite.httpClient)
+	WithEnforcementMode(EnforcementModeMonitor)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds:      []string{"user1"},
+		RaiseForbidden: true,
+	}
+
+	decision, err := suite.httpClient.QueryDecision(suite.ctx, "violating-resource", ActionDelete, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(decision.Allowed)
+	suite.Require().True(decision.Monitored)
+	suite.Require().Equal("resource is locked", decision.Reason)
+
+	permissions, err := suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", "deny-resource-1"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, true}, permissions)
+	suite.Require().Equal(int64(2), metricsSink.counter(MetricMonitoredDenies))
+
+	// flush the queued records
+	suite.Require().NoError(suite.httpClient.decisionLogSink.Close())
+
+	// the policy decisions are recorded
+	records := decisionLogSink.records
+	suite.Require().Len(records, 3)
+	suite.Require().False(records[0].Allowed)
+	suite.Require().True(records[1].Allowed)
+	suite.Require().False(records[2].Allowed)
+	for _, record := range records {
+		suite.Require().True(record.Monitored)
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestTransportTimeouts() {
+	WithTransportTimeouts(time.Second, 2*time.Second, 3*time.Second)(suite.httpClient)
+
+	transport := suite.httpClient.httpClient.Transport.(*http.Transport)
+	suite.Require().NotNil(transport.DialContext)
+	suite.Require().Equal(2*time.Second, transport.TLSHandshakeTimeout)
+	suite.Require().Equal(3*time.Second, transport.ResponseHeaderTimeout)
+
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+}
+
+func (suite *HTTPClientTestSuite) TestCachingResolver() {
+	serverURL, err := url.Parse(suite.testHTTPServer.URL)
+	suite.Require().NoError(err)
+
+	// resolve to an outdated address first, nothing listens on
+	var lookupsCount atomic.Int64
+	cachingResolver := NewCachingResolver(time.Minute)
+	cachingResolver.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		suite.Require().Equal("opa.test", host)
+		if lookupsCount.Add(1) == 1 {
+			return []string{"127.0.0.3"}, nil
+		}
+		return []string{serverURL.Hostname()}, nil
+	}
+
+	httpClient := NewHTTPClient(suite.logger,
+		"http://opa.test:"+serverURL.Port(),
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		true,
+		"",
+		false,
+		WithCachingResolver(cachingResolver))
+
+	for range 2 {
+		allowed, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+	}
+
+	// re-resolved once connecting failed, and cached afterwards
+	suite.Require().Equal(int64(2), lookupsCount.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestEndpointProvider() {
+	var secondServerRequestsCount atomic.Int64
+	secondServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondServerRequestsCount.Add(1)
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer secondServer.Close()
+
+	WithEndpointProvider(StaticEndpoints{suite.testHTTPServer.URL, secondServer.URL})(suite.httpClient)
+
+	for range 4 {
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+	}
+
+	// balanced round-robin
+	suite.Require().Equal(int64(2), suite.permissionRequestsCount.Load())
+	suite.Require().Equal(int64(2), secondServerRequestsCount.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestHealthProbing() {
+	var secondServerHealthy atomic.Bool
+	var secondServerRequestsCount atomic.Int64
+	secondServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == DefaultHealthPath {
+			if !secondServerHealthy.Load() {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
+			return
+		}
+		secondServerRequestsCount.Add(1)
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer secondServer.Close()
+	secondServerHealthy.Store(true)
+
+	var lock sync.Mutex
+	var stateChanges []string
+	healthListener := func(ctx context.Context, previousHealth Health, health Health) {
+		lock.Lock()
+		defer lock.Unlock()
+		stateChanges = append(stateChanges, string(previousHealth.State)+"->"+string(health.State))
+	}
+	waitForState := func(httpClient *HTTPClient, state HealthState) {
+		suite.Require().Eventually(func() bool {
+			return httpClient.Health().State == state
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	httpClient := NewHTTPClient(suite.logger,
+		suite.testHTTPServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		time.Second,
+		false,
+		"",
+		false,
+		WithEndpointProvider(StaticEndpoints{suite.testHTTPServer.URL, secondServer.URL}),
+		WithHealthProbing(10*time.Millisecond, healthListener))
+	waitForState(httpClient, HealthStateHealthy)
+
+	// queries fail over to the healthy endpoints
+	secondServerHealthy.Store(false)
+	waitForState(httpClient, HealthStateDegraded)
+	suite.Require().Contains(httpClient.Health().UnhealthyEndpoints, secondServer.URL)
+	suite.Require().Equal(HealthStateDegraded, httpClient.DebugState().HealthState)
+	for range 4 {
+		allowed, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+	}
+	suite.Require().Equal(int64(4), suite.permissionRequestsCount.Load())
+	suite.Require().Zero(secondServerRequestsCount.Load())
+
+	secondServerHealthy.Store(true)
+	waitForState(httpClient, HealthStateHealthy)
+	suite.Require().NoError(httpClient.Close(suite.ctx))
+
+	lock.Lock()
+	suite.Require().Equal([]string{"unknown->healthy", "healthy->degraded", "degraded->healthy"}, stateChanges)
+	lock.Unlock()
+
+	// down once no endpoint is healthy
+	secondServerHealthy.Store(false)
+	downClient := NewHTTPClient(suite.logger,
+		secondServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		time.Second,
+		false,
+		"",
+		false,
+		WithHealthProbing(10*time.Millisecond))
+	waitForState(downClient, HealthStateDown)
+	suite.Require().NoError(downClient.Close(suite.ctx))
+
+	suite.Require().Equal(HealthStateUnknown, suite.httpClient.Health().State)
+}
+
+func (suite *HTTPClientTestSuite) TestEndpointTLS() {
+	var tlsServerRequestsCount atomic.Int64
+	tlsServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tlsServerRequestsCount.Add(1)
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer tlsServer.Close()
+	otherTLSServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer otherTLSServer.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(tlsServer.Certificate())
+	WithEndpointProvider(StaticEndpoints{suite.testHTTPServer.URL, tlsServer.URL})(suite.httpClient)
+	WithEndpointTLS(tlsServer.URL, &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    rootCAs,
+	})(suite.httpClient)
+
+	// the plaintext server along with the server verified by its own TLS configuration
+	for range 4 {
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+	}
+	suite.Require().Equal(int64(2), suite.permissionRequestsCount.Load())
+	suite.Require().Equal(int64(2), tlsServerRequestsCount.Load())
+
+	// other addresses are connected to by the client-wide TLS configuration, which doesn't trust the server
+	_, err := suite.httpClient.endpointTLSDialer.DialTLSContext(suite.ctx,
+		"tcp",
+		otherTLSServer.Listener.Addr().String())
+	var unknownAuthorityError x509.UnknownAuthorityError
+	suite.Require().ErrorAs(err, &unknownAuthorityError)
+}
+
+func (suite *HTTPClientTestSuite) TestInterceptors() {
+	var capturedResponseBodies []string
+	WithInterceptors(Interceptor{
+		BeforeRequest: func(ctx context.Context, request *InterceptedRequest) error {
+			permissionRequest := request.Request.(*PermissionQueryRequest)
+			permissionRequest.Input.Ids = append(permissionRequest.Input.Ids, "intercepted-member")
+			request.Headers["Authorization"] = "Bearer intercepted"
+			request.QueryParameters.Set("explain", "notes")
+			return nil
+		},
+		AfterResponse: func(ctx context.Context, response *InterceptedResponse) error {
+			capturedResponseBodies = append(capturedResponseBodies, string(response.Body))
+			return nil
+		},
+	})(suite.httpClient)
+
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal([]string{"user1", "intercepted-member"}, suite.lastPermissionQueryInput.Ids)
+	suite.Require().Equal("Bearer intercepted", suite.lastAuthorizationHeader)
+	suite.Require().Equal("notes", suite.lastQueryParameters.Get("explain"))
+	suite.Require().Len(capturedResponseBodies, 1)
+	suite.Require().JSONEq(`{"result": true}`, capturedResponseBodies[0])
+}
+
+func (suite *HTTPClientTestSuite) TestClientCredentialsTokenSource() {
+	var tokenRequestsCount atomic.Int64
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		suite.Require().Equal("client", clientID)
+		suite.Require().Equal("secret", clientSecret)
+		suite.Require().NoError(r.ParseForm())
+		suite.Require().Equal("client_credentials", r.PostForm.Get("grant_type"))
+		suite.Require().Equal("opa:query", r.PostForm.Get("scope"))
+
+		tokenRequestsCount.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"access_token": "token-1", "token_type": "Bearer", "expires_in": 3600}`))
+		suite.Require().NoError(err)
+	}))
+	defer tokenServer.Close()
+
+	WithTokenSource(NewClientCredentialsTokenSource(nil,
+		tokenServer.URL,
+		"client",
+		"secret",
+		[]string{"opa:query"}))(suite.httpClient)
+
+	for range 2 {
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+		suite.Require().Equal("Bearer token-1", suite.lastAuthorizationHeader)
+	}
+
+	// the token is reused until it expires
+	suite.Require().Equal(int64(1), tokenRequestsCount.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestRoundTripper() {
+	var roundTripsCount atomic.Int64
+	WithRoundTripper(testRoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		roundTripsCount.Add(1)
+		return suite.httpClient.DefaultTransport().RoundTrip(request)
+	}))(suite.httpClient)
+
+	allowed, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal(int64(1), roundTripsCount.Load())
+	suite.Require().Equal(5*time.Second, suite.httpClient.httpClient.Timeout)
+}
+
+func (suite *HTTPClientTestSuite) TestRetries() {
+	var requestsCount, failedRequestsCount atomic.Int64
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requestsCount.Add(1) <= failedRequestsCount.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer failingServer.Close()
+
+	var retriedAttempts []int
+	var retryDelays []time.Duration
+	clock := newTestClock()
+	metricsSink := newTestMetricsSink()
+	httpClient := NewHTTPClient(suite.logger,
+		failingServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(clock),
+		WithMetricsSink(metricsSink),
+		WithRetryHook(func(attempt int, err error, nextDelay time.Duration) {
+			var unexpectedStatusError *UnexpectedStatusError
+			suite.Require().ErrorAs(err, &unexpectedStatusError)
+			suite.Require().Equal(http.StatusServiceUnavailable, unexpectedStatusError.StatusCode)
+			retriedAttempts = append(retriedAttempts, attempt)
+			retryDelays = append(retryDelays, nextDelay)
+		}))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// retried at the retry interval, without waiting for it
+	startTime := clock.Now()
+	failedRequestsCount.Store(2)
+	allowed, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal(int64(3), requestsCount.Load())
+	suite.Require().Equal(2*queryRetryInterval, clock.Now().Sub(startTime))
+	suite.Require().Equal([]int{1, 2}, retriedAttempts)
+	suite.Require().Equal([]time.Duration{queryRetryInterval, queryRetryInterval}, retryDelays)
+	suite.Require().Equal(int64(2), metricsSink.counter(MetricRetries))
+	suite.Require().Equal(int64(2), httpClient.DebugState().QueryStats.Retries)
+
+	// retried until the retry timeout
+	requestsCount.Store(0)
+	failedRequestsCount.Store(100)
+	_, err = httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().Error(err)
+	suite.Require().Equal(int64(queryRetryTimeout/queryRetryInterval)+1, requestsCount.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestAdaptiveThrottling() {
+	var requestsCount atomic.Int64
+	var failing atomic.Bool
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsCount.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer failingServer.Close()
+
+	clock := newTestClock()
+	metricsSink := newTestMetricsSink()
+	httpClient := NewHTTPClient(suite.logger,
+		failingServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(clock),
+		WithMetricsSink(metricsSink),
+		WithAdaptiveThrottling(time.Minute, 2))
+	httpClient.adaptiveThrottling.random = func() float64 { return 0.5 }
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// once OPA fails, retries are rejected locally as the rejection probability grows (0, 1/2, 2/3)
+	failing.Store(true)
+	_, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().ErrorIs(err, ErrUnreachable)
+	suite.Require().Equal(int64(2), requestsCount.Load())
+
+	// and so are further queries, of derived clients as well
+	_, err = httpClient.With(WithPermissionPaths("/v1/data/other/allow", "")).QueryPermissions(suite.ctx,
+		"allow-resource",
+		ActionRead,
+		permissionOptions)
+	suite.Require().ErrorIs(err, ErrUnreachable)
+	suite.Require().Equal(int64(2), requestsCount.Load())
+	suite.Require().Equal(int64(2), metricsSink.counter(MetricThrottledRequests))
+
+	// the failures age out of the window
+	failing.Store(false)
+	clock.advance(time.Minute)
+	for queryIdx := 0; queryIdx < 10; queryIdx++ {
+		allowed, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+	}
+	suite.Require().Equal(int64(12), requestsCount.Load())
+
+	// having succeeded, a few failures are retried rather than throttled
+	failing.Store(true)
+	_, err = httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NotErrorIs(err, ErrUnreachable)
+	suite.Require().Equal(int64(12+queryRetryTimeout/queryRetryInterval+1), requestsCount.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestRetryBudget() {
+	var requestsCount atomic.Int64
+	failingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsCount.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failingServer.Close()
+
+	clock := newTestClock()
+	metricsSink := newTestMetricsSink()
+	httpClient := NewHTTPClient(suite.logger,
+		failingServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(clock),
+		WithMetricsSink(metricsSink),
+		WithRetryBudget(0.5, 10*time.Second, 1))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// retried while the retries are within the budget (1 + 0.5 per query)
+	_, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().Error(err)
+	suite.Require().Equal(int64(3), requestsCount.Load())
+	suite.Require().Equal(int64(1), metricsSink.counter(MetricRetryBudgetExhausted))
+
+	// the budget is shared by derived clients
+	_, err = httpClient.With(WithPermissionPaths("/v1/data/other/allow", "")).QueryPermissions(suite.ctx,
+		"allow-resource",
+		ActionRead,
+		permissionOptions)
+	suite.Require().Error(err)
+	suite.Require().Equal(int64(4), requestsCount.Load())
+	suite.Require().Equal(int64(2), metricsSink.counter(MetricRetryBudgetExhausted))
+	suite.Require().Equal(int64(2), metricsSink.counter(MetricRetries))
+
+	// the retries age out of the window
+	clock.advance(10 * time.Second)
+	requestsCount.Store(0)
+	_, err = httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().Error(err)
+	suite.Require().Equal(int64(3), requestsCount.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestStats() {
+	statsServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != suite.httpClient.permissionQueryPath {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer statsServer.Close()
+
+	clock := newTestClock()
+	httpClient := NewHTTPClient(suite.logger,
+		statsServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(clock),
+		WithStatsWindow(time.Minute))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	stats := httpClient.Stats()
+	suite.Require().Zero(stats.Queries)
+	suite.Require().Zero(stats.QPS)
+	suite.Require().Zero(stats.ErrorRate)
+
+	firstQueryTime := clock.Now()
+	for queryIdx := 0; queryIdx < 3; queryIdx++ {
+		_, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+		suite.Require().NoError(err)
+	}
+
+	// the statistics are shared by derived clients
+	_, err := httpClient.With(WithPermissionPaths("/v1/data/missing/allow", "")).QueryPermissions(suite.ctx,
+		"allow-resource",
+		ActionRead,
+		permissionOptions)
+	suite.Require().Error(err)
+
+	// the rate is over the time since the first query, while shorter than the window
+	clock.advance(10 * time.Second)
+	stats = httpClient.Stats()
+	suite.Require().Equal(int64(4), stats.Queries)
+	suite.Require().Equal(int64(1), stats.Failures)
+	suite.Require().Equal(0.25, stats.ErrorRate)
+	suite.Require().Equal(clock.Now().Sub(firstQueryTime), stats.Window)
+	suite.Require().InDelta(4/stats.Window.Seconds(), stats.QPS, 0.001)
+	suite.Require().Positive(stats.LatencyP50)
+	suite.Require().LessOrEqual(stats.LatencyP50, stats.LatencyP90)
+	suite.Require().LessOrEqual(stats.LatencyP90, stats.LatencyP99)
+	suite.Require().LessOrEqual(stats.LatencyP99, stats.LatencyMax)
+
+	// the queries age out of the window
+	clock.advance(2 * time.Minute)
+	stats = httpClient.Stats()
+	suite.Require().Zero(stats.Queries)
+	suite.Require().Zero(stats.ErrorRate)
+	suite.Require().Zero(stats.LatencyP99)
+	suite.Require().Equal(time.Minute, stats.Window)
+}
+
+func (suite *HTTPClientTestSuite) TestRequestDump() {
+	var requestDump bytes.Buffer
+	httpClient := NewHTTPClient(suite.logger,
+		suite.testHTTPServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithRequestSigning([]byte("signing-key")),
+		WithRequestDump(&requestDump))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// queries are dumped only on demand
+	allowed, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Zero(requestDump.Len())
+
+	allowed, err = httpClient.QueryPermissions(ContextWithRequestDump(suite.ctx),
+		"allow-resource",
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Contains(requestDump.String(), "\n    \"body\": {\n      \"input\": {")
+
+	var dumped RequestDump
+	suite.Require().NoError(json.Unmarshal(requestDump.Bytes(), &dumped))
+	suite.Require().Equal(1, dumped.Attempt)
+	suite.Require().Equal(http.MethodPost, dumped.Request.Method)
+	suite.Require().Equal(suite.testHTTPServer.URL+suite.httpClient.permissionQueryPath, dumped.Request.URL)
+	suite.Require().Equal("<redacted>", dumped.Request.Headers[SignatureHeader])
+	suite.Require().Equal("allow-resource", dumped.Request.Body.(map[string]any)["input"].(map[string]any)["resource"])
+	suite.Require().Equal(http.StatusOK, dumped.Response.StatusCode)
+	suite.Require().Equal(true, dumped.Response.Body.(map[string]any)["result"])
+	suite.Require().Empty(dumped.Response.Error)
+}
+
+func (suite *HTTPClientTestSuite) TestDecisionIDs() {
+	var lastDecisionIDHeader, lastDecisionIDInput string
+	decisionIDServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var permissionRequest struct {
+			Input map[string]any `json:"input"`
+		}
+		suite.Require().NoError(json.NewDecoder(r.Body).Decode(&permissionRequest))
+		lastDecisionIDHeader = r.Header.Get(DecisionIDHeader)
+		lastDecisionIDInput, _ = permissionRequest.Input[DecisionIDInputField].(string)
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer decisionIDServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		decisionIDServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithDecisionIDs(),
+		WithDecisionCache(NewMemoryDecisionCache(100), time.Minute))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	decision, err := httpClient.QueryDecision(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Len(decision.DecisionID, 32)
+	suite.Require().Equal(decision.DecisionID, lastDecisionIDHeader)
+	suite.Require().Equal(decision.DecisionID, lastDecisionIDInput)
+
+	// the decision id doesn't key the decision cache
+	cachedDecision, err := httpClient.QueryDecision(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(cachedDecision.Cached)
+	suite.Require().Empty(cachedDecision.DecisionID)
+
+	// every query is sent with a decision id of its own, unless the context carries one
+	firstDecisionID := decision.DecisionID
+	decision, err = httpClient.QueryDecision(suite.ctx, "other-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().NotEqual(firstDecisionID, decision.DecisionID)
+	suite.Require().Equal(decision.DecisionID, lastDecisionIDInput)
+
+	decision, err = httpClient.QueryDecision(ContextWithDecisionID(suite.ctx, "request-1"),
+		"another-resource",
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal("request-1", decision.DecisionID)
+	suite.Require().Equal("request-1", lastDecisionIDHeader)
+	suite.Require().Equal("request-1", lastDecisionIDInput)
+}
+
+func (suite *HTTPClientTestSuite) TestGETQueries() {
+	var lastMethod string
+	var lastInput map[string]any
+	getQueryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastMethod = r.Method
+		lastInput = nil
+		if r.Method == http.MethodGet {
+			suite.Require().NoError(json.Unmarshal([]byte(r.URL.Query().Get("input")), &lastInput))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == suite.httpClient.permissionFilterPath {
+			_, err := w.Write([]byte(`{"result": []}`))
+			suite.Require().NoError(err)
+			return
+		}
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer getQueryServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		getQueryServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithGETQueries(256))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	allowed, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal(http.MethodGet, lastMethod)
+	suite.Require().Equal("allow-resource", lastInput["resource"])
+	suite.Require().Equal(string(ActionRead), lastInput["action"])
+
+	// queries above the size are sent as POST requests
+	allowed, err = httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds:  []string{"user1"},
+		ExtraInput: map[string]any{"padding": strings.Repeat("x", 256)},
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal(http.MethodPost, lastMethod)
+
+	// as are multi-resource queries
+	_, err = httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"resource-1", "resource-2"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal(http.MethodPost, lastMethod)
+}
+
+func (suite *HTTPClientTestSuite) TestPerQueryVerbosity() {
+	testLogger := &testRecordingLogger{}
+	httpClient := NewHTTPClient(testLogger,
+		suite.testHTTPServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false)
+	verbose := true
+
+	allowed, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Empty(testLogger.messages())
+
+	// a single query can be traced while the client logs quietly
+	allowed, err = httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+		Verbose:   &verbose,
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Contains(testLogger.messages(), "Sending request to OPA")
+	suite.Require().Contains(testLogger.messages(), "Received response from OPA")
+
+	// and a verbose client can quiet a single query
+	testLogger = &testRecordingLogger{}
+	httpClient = NewHTTPClient(testLogger,
+		suite.testHTTPServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		true,
+		"",
+		false)
+	verbose = false
+	_, err = httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+		Verbose:   &verbose,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Empty(testLogger.messages())
+}
+
+func (suite *HTTPClientTestSuite) TestRoutes() {
+	var billingRequestPaths []string
+	var billingRequestPathsLock sync.Mutex
+	billingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		billingRequestPathsLock.Lock()
+		billingRequestPaths = append(billingRequestPaths, r.URL.Path)
+		billingRequestPathsLock.Unlock()
+
+		// the billing policy allows everything
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/v1/data/billing/filter_allowed" {
+			var permissionRequest PermissionFilterRequest
+			suite.Require().NoError(json.NewDecoder(r.Body).Decode(&permissionRequest))
+			suite.Require().NoError(json.NewEncoder(w).Encode(PermissionFilterResponse{
+				Result: permissionRequest.Input.Resources,
+			}))
+			return
+		}
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer billingServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		suite.testHTTPServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithRoutes(Route{
+			ResourcePrefix:       "billing/",
+			Address:              billingServer.URL,
+			PermissionQueryPath:  "/v1/data/billing/allow",
+			PermissionFilterPath: "/v1/data/billing/filter_allowed",
+		}, Route{
+			Actions:             []Action{ActionDelete},
+			Address:             billingServer.URL,
+			PermissionQueryPath: "/v1/data/billing/deletion/allow",
+		}))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	allowed, err := httpClient.QueryPermissions(suite.ctx, "billing/invoice-1", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal([]string{"/v1/data/billing/allow"}, billingRequestPaths)
+	suite.Require().Zero(suite.permissionRequestsCount.Load())
+
+	allowed, err = httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionDelete, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal("/v1/data/billing/deletion/allow", billingRequestPaths[1])
+
+	// unrouted queries are queried by the client
+	allowed, err = httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().False(allowed)
+	suite.Require().Equal(int64(1), suite.permissionRequestsCount.Load())
+
+	// multi-resource queries are split by the routes
+	results, err := httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource", "billing/invoice-2", "deny-resource", "billing/invoice-3"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, true, false, true}, results)
+	suite.Require().Equal("/v1/data/billing/filter_allowed", billingRequestPaths[2])
+	suite.Require().Len(billingRequestPaths, 3)
+	suite.Require().Equal(int64(2), suite.permissionRequestsCount.Load())
+	suite.Require().Equal([]string{"allow-resource", "deny-resource"}, suite.lastPermissionFilterInput.Resources)
+}
+
+func (suite *HTTPClientTestSuite) TestRouteMatches() {
+	for _, testCase := range []struct {
+		name           string
+		resourcePrefix string
+		resource       string
+		matches        bool
+	}{
+		{name: "NoPrefix", resourcePrefix: "", resource: "/projects/p1", matches: true},
+		{name: "Prefix", resourcePrefix: "/projects/p1", resource: "/projects/p1", matches: true},
+		{name: "UnderPrefix", resourcePrefix: "/projects/p1", resource: "/projects/p1/functions/f1", matches: true},
+		{name: "SiblingOfPrefix", resourcePrefix: "/projects/p1", resource: "/projects/p10/functions/f1", matches: false},
+		{name: "UnderSlashedPrefix", resourcePrefix: "billing/", resource: "billing/invoice-1", matches: true},
+		{name: "OtherResource", resourcePrefix: "/projects/p1", resource: "/projects", matches: false},
+	} {
+		suite.Run(testCase.name, func() {
+			route := Route{ResourcePrefix: testCase.resourcePrefix}
+			suite.Require().Equal(testCase.matches, route.matches(testCase.resource, ActionRead))
+		})
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestSidecarDetection() {
+
+	// the sidecar listens on a unix domain socket, and allows everything
+	var sidecarRequestPaths []string
+	var sidecarRequestPathsLock sync.Mutex
+	sidecarServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sidecarRequestPathsLock.Lock()
+		sidecarRequestPaths = append(sidecarRequestPaths, r.URL.Path)
+		sidecarRequestPathsLock.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	socketPath := suite.T().TempDir() + "/opa.sock"
+	listener, err := net.Listen("unix", socketPath)
+	suite.Require().NoError(err)
+	sidecarServer.Listener = listener
+	sidecarServer.Start()
+	defer sidecarServer.Close()
+
+	// nothing listens on the closed server's address
+	closedServer := httptest.NewServer(http.NotFoundHandler())
+	closedServer.Close()
+
+	newClient := func(sidecarAddresses ...string) *HTTPClient {
+		return NewHTTPClient(suite.logger,
+			suite.testHTTPServer.URL,
+			suite.httpClient.permissionQueryPath,
+			suite.httpClient.permissionFilterPath,
+			5*time.Second,
+			false,
+			"",
+			false,
+			WithSidecarDetection(sidecarAddresses...))
+	}
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// the first healthy sidecar address is queried
+	httpClient := newClient(closedServer.URL, "unix://"+socketPath)
+	allowed, err := httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal([]string{DefaultHealthPath, suite.httpClient.permissionQueryPath}, sidecarRequestPaths)
+	suite.Require().Zero(suite.permissionRequestsCount.Load())
+
+	// the configured address is queried once no sidecar is detected
+	httpClient = newClient(closedServer.URL)
+	allowed, err = httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().False(allowed)
+	suite.Require().Equal(int64(1), suite.permissionRequestsCount.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestOPAError() {
+	errorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == suite.httpClient.permissionFilterPath {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusBadRequest)
+		_, err := w.Write([]byte(`{"code": "invalid_parameter", "message": "missing input document"}`))
+		suite.Require().NoError(err)
+	}))
+	defer errorServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		errorServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(newTestClock()))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// the error body is parsed, and the status error is still matched
+	_, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	var opaError *OPAError
+	suite.Require().ErrorAs(err, &opaError)
+	suite.Require().Equal(http.StatusBadRequest, opaError.StatusCode)
+	suite.Require().Equal("invalid_parameter", opaError.Code)
+	suite.Require().Equal("missing input document", opaError.Message)
+	var unexpectedStatusError *UnexpectedStatusError
+	suite.Require().ErrorAs(err, &unexpectedStatusError)
+	suite.Require().Equal(http.StatusBadRequest, unexpectedStatusError.StatusCode)
+
+	_, err = httpClient.Status(suite.ctx)
+	suite.Require().ErrorAs(err, &opaError)
+	suite.Require().Equal("invalid_parameter", opaError.Code)
+
+	// responses without an error body fail on their status only
+	_, err = httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", "allow-resource-2"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().ErrorAs(err, &unexpectedStatusError)
+	suite.Require().Equal(http.StatusBadGateway, unexpectedStatusError.StatusCode)
+	suite.Require().False(errors.As(err, &opaError))
+}
+
+func (suite *HTTPClientTestSuite) TestPolicyPathNotFound() {
+	typoPath := "/v1/data/authz/alow"
+	var requestsCount atomic.Int64
+	policyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsCount.Add(1)
+		if r.URL.Path == typoPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, err := w.Write([]byte(`{"result": false}`))
+		suite.Require().NoError(err)
+	}))
+	defer policyServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		policyServer.URL,
+		typoPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(newTestClock()))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// the missing path is surfaced, rather than retried
+	_, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().ErrorIs(err, ErrPolicyPathNotFound)
+	var pathNotFoundError *PolicyPathNotFoundError
+	suite.Require().ErrorAs(err, &pathNotFoundError)
+	suite.Require().Equal(typoPath, pathNotFoundError.Path)
+	suite.Require().Equal(policyServer.URL, pathNotFoundError.Endpoint)
+	var unexpectedStatusError *UnexpectedStatusError
+	suite.Require().ErrorAs(err, &unexpectedStatusError)
+	suite.Require().Equal(http.StatusNotFound, unexpectedStatusError.StatusCode)
+	suite.Require().Equal(int64(1), requestsCount.Load())
+
+	// validation fails on the missing path only
+	err = httpClient.ValidatePolicyPaths(suite.ctx)
+	suite.Require().ErrorIs(err, ErrPolicyPathNotFound)
+	suite.Require().ErrorAs(err, &pathNotFoundError)
+	suite.Require().Equal(typoPath, pathNotFoundError.Path)
+
+	validClient := httpClient.With(WithPermissionPaths(suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath))
+	suite.Require().NoError(validClient.ValidatePolicyPaths(suite.ctx))
+}
+
+func (suite *HTTPClientTestSuite) TestFallbackOnUnavailableOnly() {
+	var statusCode atomic.Int64
+	var responseBody atomic.Value
+	policyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(statusCode.Load()))
+		_, err := w.Write(responseBody.Load().([]byte))
+		suite.Require().NoError(err)
+	}))
+	defer policyServer.Close()
+	closedServer := httptest.NewServer(http.NotFoundHandler())
+	closedServer.Close()
+
+	tenantQueryPath := "/v1/data/tenants/{tenant}/authz/allow"
+	for _, testCase := range []struct {
+		name              string
+		address           string
+		queryPath         string
+		tenant            string
+		statusCode        int
+		responseBody      string
+		expectedFallback  bool
+		expectedErrTarget error
+	}{
+		{name: "unavailable", statusCode: http.StatusServiceUnavailable, expectedFallback: true},
+		{name: "badGateway", statusCode: http.StatusBadGateway, expectedFallback: true},
+		{name: "connectionRefused", address: closedServer.URL, expectedFallback: true},
+		{
+			name:              "policyPathNotFound",
+			statusCode:        http.StatusNotFound,
+			expectedErrTarget: ErrPolicyPathNotFound,
+		},
+		{
+			name:       "policyError",
+			statusCode: http.StatusInternalServerError,
+			responseBody: `{"code": "internal_error", "message": "error(s) occurred while evaluating query",
+				"errors": [{"code": "eval_conflict_error", "message": "complete rules must not produce multiple outputs"}]}`,
+		},
+		{name: "unauthorized", statusCode: http.StatusUnauthorized},
+		{name: "forbidden", statusCode: http.StatusForbidden},
+		{name: "badRequest", statusCode: http.StatusBadRequest},
+		{name: "tenantRequired", queryPath: tenantQueryPath, expectedErrTarget: ErrTenantRequired},
+		{name: "invalidTenant", queryPath: tenantQueryPath, tenant: "..", expectedErrTarget: ErrInvalidInput},
+	} {
+		suite.Run(testCase.name, func() {
+			statusCode.Store(int64(testCase.statusCode))
+			responseBody.Store([]byte(testCase.responseBody))
+			address := policyServer.URL
+			if testCase.address != "" {
+				address = testCase.address
+			}
+			queryPath := suite.httpClient.permissionQueryPath
+			if testCase.queryPath != "" {
+				queryPath = testCase.queryPath
+			}
+
+			// the fallback policy would allow anything
+			httpClient := NewHTTPClient(suite.logger,
+				address,
+				queryPath,
+				suite.httpClient.permissionFilterPath,
+				5*time.Second,
+				false,
+				"",
+				false,
+				WithClock(newTestClock()),
+				WithFallbackPolicy(&FallbackPolicy{Rules: []FallbackRule{{Allow: true}}}))
+
+			decision, err := httpClient.QueryDecision(suite.ctx, "resource", ActionRead, &PermissionOptions{
+				Subject: &Subject{UserID: "user1", Tenant: testCase.tenant},
+			})
+			if testCase.expectedFallback {
+				suite.Require().NoError(err)
+				suite.Require().True(decision.Fallback)
+				return
+			}
+			suite.Require().Error(err)
+			if testCase.expectedErrTarget != nil {
+				suite.Require().ErrorIs(err, testCase.expectedErrTarget)
+			}
+		})
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestSelfCheck() {
+	var queryResult, filterResult atomic.Value
+	var statusCode atomic.Int64
+	policyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == DefaultHealthPath {
+			return
+		}
+		w.WriteHeader(int(statusCode.Load()))
+		result := queryResult.Load().(string)
+		if r.URL.Path == suite.httpClient.permissionFilterPath {
+			result = filterResult.Load().(string)
+		}
+		_, err := w.Write([]byte(result))
+		suite.Require().NoError(err)
+	}))
+	defer policyServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		policyServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(newTestClock()))
+
+	for _, testCase := range []struct {
+		name          string
+		statusCode    int
+		queryResult   string
+		filterResult  string
+		expectedError string
+	}{
+		{
+			name:         "boolean",
+			statusCode:   http.StatusOK,
+			queryResult:  `{"result": false}`,
+			filterResult: `{"result": ["opa-client/self-check"]}`,
+		},
+		{
+			name:         "rich",
+			statusCode:   http.StatusOK,
+			queryResult:  `{"result": {"allow": false, "reason": "no roles"}}`,
+			filterResult: `{}`,
+		},
+		{
+			name:          "unauthenticated",
+			statusCode:    http.StatusUnauthorized,
+			queryResult:   `{"code": "unauthorized", "message": "missing token"}`,
+			filterResult:  `{}`,
+			expectedError: "Failed to authenticate with OPA",
+		},
+		{
+			name:          "undefinedDecision",
+			statusCode:    http.StatusOK,
+			queryResult:   `{}`,
+			filterResult:  `{}`,
+			expectedError: "Result is undefined",
+		},
+		{
+			name:          "malformedDecision",
+			statusCode:    http.StatusOK,
+			queryResult:   `{"result": {"allowed": true}}`,
+			filterResult:  `{}`,
+			expectedError: "Rich result has no boolean allow field",
+		},
+		{
+			name:          "malformedFilter",
+			statusCode:    http.StatusOK,
+			queryResult:   `{"result": true}`,
+			filterResult:  `{"result": true}`,
+			expectedError: "Result is not a list of resources",
+		},
+	} {
+		suite.Run(testCase.name, func() {
+			statusCode.Store(int64(testCase.statusCode))
+			queryResult.Store(testCase.queryResult)
+			filterResult.Store(testCase.filterResult)
+
+			err := httpClient.SelfCheck(suite.ctx)
+			if testCase.expectedError == "" {
+				suite.Require().NoError(err)
+				return
+			}
+			suite.Require().ErrorContains(err, testCase.expectedError)
+		})
+	}
+
+	// nothing listens on the closed server's address
+	closedServer := httptest.NewServer(http.NotFoundHandler())
+	closedServer.Close()
+	httpClient = NewHTTPClient(suite.logger,
+		closedServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false)
+	err := httpClient.SelfCheck(suite.ctx)
+	suite.Require().ErrorContains(err, "Failed to connect to OPA")
+}
+
+func (suite *HTTPClientTestSuite) TestMaxResponseSize() {
+	hugeResponseServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte(`{"result": ["` + strings.Repeat("r", 1024) + `"]}`))
+		suite.Require().NoError(err)
+	}))
+	defer hugeResponseServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		hugeResponseServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(newTestClock()),
+		WithMaxResponseSize(1024))
+	_, err := httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", "allow-resource-2"},
+		ActionRead,
+		&PermissionOptions{MemberIds: []string{"user1"}})
+	suite.Require().Error(err)
+	for errors.Unwrap(err) != nil {
+		err = errors.Unwrap(err)
+	}
+	suite.Require().Equal("Response body exceeds the max size of 1024 bytes", err.Error())
+
+	httpClient.maxResponseSize = 2048
+	_, err = httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource-1", "allow-resource-2"},
+		ActionRead,
+		&PermissionOptions{MemberIds: []string{"user1"}})
+	suite.Require().NoError(err)
+}
+
+func (suite *HTTPClientTestSuite) TestDeadlineBudget() {
+	var requestsCount atomic.Int64
+	unblockChan := make(chan struct{})
+	blockingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsCount.Add(1)
+		<-unblockChan
+	}))
+	defer blockingServer.Close()
+	defer close(unblockChan)
+
+	httpClient := NewHTTPClient(suite.logger,
+		blockingServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		true,
+		"",
+		false)
+
+	// the budget is split across the attempts which may start before the deadline, rather than spent on the first
+	timeoutCtx, cancel := context.WithTimeout(suite.ctx, 1500*time.Millisecond)
+	defer cancel()
+	_, err := httpClient.QueryPermissions(timeoutCtx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().Error(err)
+	suite.Require().Equal(int64(2), requestsCount.Load())
+	suite.Require().ErrorIs(err, context.DeadlineExceeded)
+}
+
+func (suite *HTTPClientTestSuite) TestTimeoutClassification() {
+
+	// OPA accepts the request, but never responds
+	unblockChan := make(chan struct{})
+	blockingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblockChan
+	}))
+	defer blockingServer.Close()
+	defer close(unblockChan)
+
+	// the TLS handshake never completes
+	silentListener, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	defer silentListener.Close() // nolint: errcheck
+	go func() {
+		for {
+			if _, err := silentListener.Accept(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, testCase := range []struct {
+		name          string
+		address       string
+		expectedErr   error
+		unexpectedErr error
+		expectedPhase TimeoutPhase
+	}{
+		{
+			name:          "evaluation",
+			address:       blockingServer.URL,
+			expectedErr:   ErrEvaluationTimeout,
+			unexpectedErr: ErrConnectionTimeout,
+			expectedPhase: TimeoutPhaseEvaluation,
+		},
+		{
+			name:          "connection",
+			address:       "https://" + silentListener.Addr().String(),
+			expectedErr:   ErrConnectionTimeout,
+			unexpectedErr: ErrEvaluationTimeout,
+			expectedPhase: TimeoutPhaseConnection,
+		},
+	} {
+		suite.Run(testCase.name, func() {
+			metricsSink := newTestMetricsSink()
+			httpClient := NewHTTPClient(suite.logger,
+				testCase.address,
+				suite.httpClient.permissionQueryPath,
+				suite.httpClient.permissionFilterPath,
+				5*time.Second,
+				false,
+				"",
+				false)
+			WithMetricsSink(metricsSink)(httpClient)
+
+			timeoutCtx, cancel := context.WithTimeout(suite.ctx, 300*time.Millisecond)
+			defer cancel()
+			_, err := httpClient.QueryPermissions(timeoutCtx, "allow-resource", ActionRead, &PermissionOptions{
+				MemberIds: []string{"user1"},
+			})
+			suite.Require().ErrorIs(err, testCase.expectedErr)
+			suite.Require().NotErrorIs(err, testCase.unexpectedErr)
+			suite.Require().ErrorIs(err, context.DeadlineExceeded)
+
+			var timeoutError *TimeoutError
+			suite.Require().ErrorAs(err, &timeoutError)
+			suite.Require().Equal(testCase.expectedPhase, timeoutError.Phase)
+			suite.Require().Equal(testCase.address, timeoutError.Endpoint)
+
+			metricsSink.lock.Lock()
+			defer metricsSink.lock.Unlock()
+			suite.Require().Positive(metricsSink.counters[fmt.Sprintf("%s{phase=%s}",
+				MetricTimeouts,
+				testCase.expectedPhase)])
+		})
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestWarmup() {
+	var newConnections, healthRequests atomic.Int64
+	opaServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case DefaultHealthPath:
+			healthRequests.Add(1)
+
+			// hold the probes, so each establishes a connection of its own
+			time.Sleep(50 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		default:
+			_, err := w.Write([]byte(`{"result": true}`))
+			suite.Require().NoError(err)
+		}
+	}))
+	opaServer.Config.ConnState = func(conn net.Conn, connState http.ConnState) {
+		if connState == http.StateNew {
+			newConnections.Add(1)
+		}
+	}
+	opaServer.Start()
+	defer opaServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		opaServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithWarmup(3))
+	suite.Require().Equal(int64(3), healthRequests.Load())
+	suite.Require().Equal(int64(3), newConnections.Load())
+
+	// the first queries reuse the warmed up connections
+	var waitGroup sync.WaitGroup
+	for range 3 {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			allowed, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+				MemberIds: []string{"user1"},
+			})
+			suite.Require().NoError(err)
+			suite.Require().True(allowed)
+		}()
+	}
+	waitGroup.Wait()
+	suite.Require().Equal(int64(3), newConnections.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestSecretReferences() {
+	tokenPath := suite.T().TempDir() + "/token"
+	suite.Require().NoError(os.WriteFile(tokenPath, []byte("token-1\n"), 0600))
+	suite.T().Setenv("TEST_OPA_OVERRIDE_VALUE", "override-1")
+
+	var signingKey atomic.Value
+	signingKey.Store("key-1")
+	vaultServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.Require().Equal("/v1/secret/data/opa-client", r.URL.Path)
+		suite.Require().Equal("vault-token", r.Header.Get("X-Vault-Token"))
+		_, err := fmt.Fprintf(w, `{"data": {"data": {"signing_key": %q}}}`, signingKey.Load())
+		suite.Require().NoError(err)
+	}))
+	defer vaultServer.Close()
+
+	var authorizationHeader atomic.Value
+	var verificationErr atomic.Value
+	opaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		suite.Require().NoError(err)
+		authorizationHeader.Store(r.Header.Get("Authorization"))
+		verificationErr.Store(fmt.Sprint(VerifyRequestSignature([][]byte{[]byte(signingKey.Load().(string))},
+			r,
+			body,
+			time.Now(),
+			time.Minute)))
+		_, err = w.Write([]byte(`{"result": false}`))
+		suite.Require().NoError(err)
+	}))
+	defer opaServer.Close()
+
+	secretResolvers := DefaultSecretResolvers()
+	secretResolvers[SecretSchemeVault] = NewVaultSecretResolver(vaultServer.URL, "vault-token")
+	httpClient := NewHTTPClient(suite.logger,
+		opaServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithSecretReferences(SecretReferences{
+			BearerToken:          "file://" + tokenPath,
+			OverrideHeaderValues: []string{"env://TEST_OPA_OVERRIDE_VALUE"},
+			RequestSigningKey:    "vault://secret/opa-client#signing_key",
+		}, secretResolvers, 10*time.Millisecond))
+	defer httpClient.Close(suite.ctx) // nolint: errcheck
+
+	allowed, err := httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().False(allowed)
+	suite.Require().Equal("Bearer token-1", authorizationHeader.Load())
+	suite.Require().Equal("<nil>", verificationErr.Load())
+
+	allowed, err = httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+		MemberIds:           []string{"user1"},
+		OverrideHeaderValue: "override-1",
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+
+	// rotated secrets take effect once re-resolved
+	suite.Require().NoError(os.WriteFile(tokenPath, []byte("token-2\n"), 0600))
+	suite.T().Setenv("TEST_OPA_OVERRIDE_VALUE", "override-2")
+	signingKey.Store("key-2")
+	suite.Require().Eventually(func() bool {
+		_, err := httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+		suite.Require().NoError(err)
+		return authorizationHeader.Load() == "Bearer token-2" && verificationErr.Load() == "<nil>"
+	}, time.Second, 20*time.Millisecond)
+	allowed, err = httpClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+		MemberIds:           []string{"user1"},
+		OverrideHeaderValue: "override-2",
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+
+	// references in the configuration are resolved by the factory
+	configuredClient := CreateOpaClient(suite.logger, &Config{
+		ClientKind:          ClientKindHTTP,
+		Address:             opaServer.URL,
+		PermissionQueryPath: suite.httpClient.permissionQueryPath,
+		BearerToken:         "file://" + tokenPath,
+		OverrideHeaderValue: "env://TEST_OPA_OVERRIDE_VALUE",
+	})
+	defer configuredClient.(Closer).Close(suite.ctx) // nolint: errcheck
+	allowed, err = configuredClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().False(allowed)
+	suite.Require().Equal("Bearer token-2", authorizationHeader.Load())
+	allowed, err = configuredClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+		MemberIds:           []string{"user1"},
+		OverrideHeaderValue: "override-2",
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+
+	// queries fail rather than go out unauthenticated, while the bearer token or OAuth2 client secret do not resolve
+	authorizationHeader.Store("unsent")
+	for _, unresolvedClient := range []Client{
+		CreateOpaClient(suite.logger, &Config{
+			ClientKind:          ClientKindHTTP,
+			Address:             opaServer.URL,
+			PermissionQueryPath: suite.httpClient.permissionQueryPath,
+			BearerToken:         "env://TEST_OPA_MISSING_TOKEN",
+		}),
+		CreateOpaClient(suite.logger, &Config{
+			ClientKind:          ClientKindHTTP,
+			Address:             opaServer.URL,
+			PermissionQueryPath: suite.httpClient.permissionQueryPath,
+			OAuth2TokenURL:      opaServer.URL + "/token",
+			OAuth2ClientID:      "opa-client",
+			OAuth2ClientSecret:  "env://TEST_OPA_MISSING_SECRET",
+		}),
+	} {
+		queryCtx, cancel := context.WithTimeout(suite.ctx, 100*time.Millisecond)
+		_, err = unresolvedClient.QueryPermissions(queryCtx, "deny-resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+		cancel()
+		suite.Require().Error(err)
+		suite.Require().NoError(unresolvedClient.(Closer).Close(suite.ctx))
+	}
+	suite.Require().Equal("unsent", authorizationHeader.Load())
+
+	// secrets resolve independently, so an unresolved override token key leaves the bearer token resolved
+	partiallyResolvedClient := NewHTTPClient(suite.logger,
+		opaServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithSecretReferences(SecretReferences{
+			BearerToken:       "file://" + tokenPath,
+			OverrideTokenKeys: []string{"env://TEST_OPA_MISSING_KEY"},
+		}, secretResolvers, 0))
+	defer partiallyResolvedClient.Close(suite.ctx) // nolint: errcheck
+	_, err = partiallyResolvedClient.QueryPermissions(suite.ctx, "deny-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal("Bearer token-2", authorizationHeader.Load())
+	_, overrideTokenKeys := partiallyResolvedClient.acceptedOverrides()
+	suite.Require().Empty(overrideTokenKeys)
+}
+
+func (suite *HTTPClientTestSuite) TestOAuth2ClientSecretRotation() {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, clientSecret, _ := r.BasicAuth()
+		if clientSecret != "secret-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, err := w.Write([]byte(`{"access_token": "oauth2-token", "expires_in": 3600}`))
+		suite.Require().NoError(err)
+	}))
+	defer tokenServer.Close()
+
+	var authorizationHeader atomic.Value
+	authorizationHeader.Store("unsent")
+	opaServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizationHeader.Store(r.Header.Get("Authorization"))
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer opaServer.Close()
+
+	// the client secret is rotated into the token source, whichever order the options are applied in
+	httpClient := NewHTTPClient(suite.logger,
+		opaServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithSecretReferences(SecretReferences{
+			OAuth2ClientSecret: "env://TEST_OPA_CLIENT_SECRET",
+		}, DefaultSecretResolvers(), 10*time.Millisecond),
+		WithTokenSource(NewClientCredentialsTokenSource(nil, tokenServer.URL, "opa-client", "", nil)))
+	defer httpClient.Close(suite.ctx) // nolint: errcheck
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// queries fail while the client secret does not resolve
+	queryCtx, cancel := context.WithTimeout(suite.ctx, 100*time.Millisecond)
+	defer cancel()
+	_, err := httpClient.QueryPermissions(queryCtx, "resource", ActionRead, permissionOptions)
+	suite.Require().Error(err)
+	suite.Require().Equal("unsent", authorizationHeader.Load())
+
+	suite.T().Setenv("TEST_OPA_CLIENT_SECRET", "secret-1")
+	suite.Require().Eventually(func() bool {
+		queryCtx, cancel := context.WithTimeout(suite.ctx, 100*time.Millisecond)
+		defer cancel()
+		allowed, err := httpClient.QueryPermissions(queryCtx, "resource", ActionRead, permissionOptions)
+		return err == nil && allowed
+	}, time.Second, 20*time.Millisecond)
+	suite.Require().Equal("Bearer oauth2-token", authorizationHeader.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestRequestSigning() {
+	key := []byte("key")
+	var verificationErrs []error
+	gatewayServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		suite.Require().NoError(err)
+		verificationErrs = append(verificationErrs,
+			VerifyRequestSignature([][]byte{[]byte("previous-key"), key}, r, body, time.Now(), time.Minute))
+		_, err = w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer gatewayServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		gatewayServer.URL+"/opa",
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithRequestSigning(key),
+		WithProvenance())
+	allowed, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().True(allowed)
+	suite.Require().Equal([]error{nil}, verificationErrs)
+
+	// tampered, stale and unsigned requests are rejected
+	signRequest := func(body string, signedAt time.Time) *http.Request {
+		request := httptest.NewRequest(http.MethodPost, "/v1/data/authz/allow?provenance=true", strings.NewReader(body))
+		for headerName, headerValue := range SignRequest(key, request.Method, request.URL.RequestURI(), []byte(body), signedAt) {
+			request.Header.Set(headerName, headerValue)
+		}
+		return request
+	}
+	suite.Require().NoError(VerifyRequestSignature([][]byte{key},
+		signRequest(`{"input": {}}`, time.Now()),
+		[]byte(`{"input": {}}`),
+		time.Now(),
+		time.Minute))
+	suite.Require().Error(VerifyRequestSignature([][]byte{key},
+		signRequest(`{"input": {}}`, time.Now()),
+		[]byte(`{"input": {"ids": ["admin"]}}`),
+		time.Now(),
+		time.Minute))
+	suite.Require().Error(VerifyRequestSignature([][]byte{[]byte("other-key")},
+		signRequest(`{"input": {}}`, time.Now()),
+		[]byte(`{"input": {}}`),
+		time.Now(),
+		time.Minute))
+	suite.Require().Error(VerifyRequestSignature([][]byte{key},
+		signRequest(`{"input": {}}`, time.Now().Add(-2*time.Minute)),
+		[]byte(`{"input": {}}`),
+		time.Now(),
+		time.Minute))
+	suite.Require().Error(VerifyRequestSignature([][]byte{key},
+		httptest.NewRequest(http.MethodPost, "/v1/data/authz/allow", nil),
+		nil,
+		time.Now(),
+		time.Minute))
+}
+
+func (suite *HTTPClientTestSuite) TestSPNEGO() {
+	var requests []string
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		suite.Require().NoError(err)
+		suite.Require().Contains(string(body), "allow-resource")
+
+		authorization := r.Header.Get("Authorization")
+		requests = append(requests, authorization)
+		if authorization != "Negotiate "+base64.StdEncoding.EncodeToString([]byte("HTTP/127.0.0.1")) {
+			w.Header().Set("WWW-Authenticate", "Negotiate")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, err = w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+	defer proxyServer.Close()
+
+	for _, preemptive := range []bool{false, true} {
+		requests = nil
+		httpClient := NewHTTPClient(suite.logger,
+			proxyServer.URL,
+			suite.httpClient.permissionQueryPath,
+			suite.httpClient.permissionFilterPath,
+			5*time.Second,
+			false,
+			"",
+			false,
+			WithSPNEGO(testSPNEGOProvider{}, preemptive))
+		allowed, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+
+		// preemptive negotiation saves the challenge round trip
+		expectedRequestsCount := 2
+		if preemptive {
+			expectedRequestsCount = 1
+		}
+		suite.Require().Len(requests, expectedRequestsCount)
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestInputValidation() {
+	var validatedInputs []any
+	WithInputValidators(StandardInputValidator, func(ctx context.Context, path string, input any) error {
+		validatedInputs = append(validatedInputs, input)
+		return nil
+	})(suite.httpClient)
+
+	for _, testCase := range []struct {
+		name              string
+		action            Action
+		permissionOptions *PermissionOptions
+		expectedErr       string
+	}{
+		{
+			name:              "emptyAction",
+			action:            "",
+			permissionOptions: &PermissionOptions{MemberIds: []string{"user1"}},
+			expectedErr:       "Action is empty",
+		},
+		{
+			name:              "noMemberIds",
+			action:            ActionRead,
+			permissionOptions: &PermissionOptions{},
+			expectedErr:       "Input has neither member ids nor a subject",
+		},
+		{
+			name:              "paddedMemberId",
+			action:            ActionRead,
+			permissionOptions: &PermissionOptions{MemberIds: []string{"user1", " group1"}},
+			expectedErr:       `Member id at index 1 (" group1") is padded with whitespace`,
+		},
+	} {
+		suite.Run(testCase.name, func() {
+			_, err := suite.httpClient.QueryPermissions(suite.ctx,
+				"allow-resource",
+				testCase.action,
+				testCase.permissionOptions)
+			suite.Require().Error(err)
+
+			var inputValidationError *InputValidationError
+			suite.Require().ErrorAs(err, &inputValidationError)
+			suite.Require().Equal(suite.httpClient.permissionQueryPath, inputValidationError.Path)
+			suite.Require().Equal(testCase.expectedErr, errors.Unwrap(inputValidationError).Error())
+		})
+	}
+	suite.Require().Zero(suite.permissionRequestsCount.Load())
+	suite.Require().Empty(validatedInputs)
+
+	// invalid queries are not decided by the fallback policy
+	WithFallbackPolicy(&FallbackPolicy{Rules: []FallbackRule{{Allow: true}}})(suite.httpClient)
+	_, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource", "", &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().ErrorIs(err, ErrInvalidInput)
+
+	// valid inputs are sent, having passed every validator
+	results, err := suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"allow-resource", "deny-resource"},
+		ActionRead,
+		&PermissionOptions{Subject: &Subject{UserID: "user1"}})
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, false}, results)
+	suite.Require().Len(validatedInputs, 1)
+	suite.Require().IsType(PermissionFilterRequestInput{}, validatedInputs[0])
+}
+
+func (suite *HTTPClientTestSuite) TestResourceNormalization() {
+	resourceNormalizer, err := NewResourceNormalizer("trim", "lowercase", "nfc", "collapse_slashes")
+	suite.Require().NoError(err)
+	WithResourceNormalizer(resourceNormalizer)(suite.httpClient)
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+
+	// equivalent resources are queried once, in normalized form
+	for _, resource := range []string{" /Projects//P1/Caf\u0065\u0301 ", "/projects/p1/caf\u00e9", "/PROJECTS/p1//CAFÉ"} {
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx, resource, ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+			ResourceAttributes: map[string]map[string]any{
+				resource: {"owner": "user1"},
+			},
+		})
+		suite.Require().NoError(err)
+		suite.Require().False(allowed)
+	}
+	suite.Require().Equal(int64(1), suite.permissionRequestsCount.Load())
+	suite.Require().Equal("/projects/p1/caf\u00e9", suite.lastPermissionQueryInput.Resource)
+	suite.Require().Equal(map[string]any{"owner": "user1"}, suite.lastRawPermissionInput["attributes"])
+
+	results, err := suite.httpClient.QueryPermissionsMultiResources(suite.ctx,
+		[]string{"Allow-Resource-1", "allow-resource-1 ", "DENY-resource-1"},
+		ActionRead,
+		&PermissionOptions{MemberIds: []string{"user1"}})
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, true, false}, results)
+	suite.Require().Equal([]string{"allow-resource-1", "deny-resource-1"}, suite.lastPermissionFilterInput.Resources)
+
+	// resources normalized to nothing are rejected
+	_, err = suite.httpClient.QueryPermissions(suite.ctx, "  ", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+	})
+	suite.Require().ErrorContains(err, "is empty once normalized")
+
+	_, err = NewResourceNormalizer("uppercase")
+	suite.Require().ErrorContains(err, "Unknown resource normalization uppercase")
+}
+
+func (suite *HTTPClientTestSuite) TestFilterChunking() {
+	var requestsCount, concurrentRequests, maxConcurrentRequests atomic.Int64
+	chunkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsCount.Add(1)
+		currentRequests := concurrentRequests.Add(1)
+		defer concurrentRequests.Add(-1)
+		for maxRequests := maxConcurrentRequests.Load(); currentRequests > maxRequests; {
+			if maxConcurrentRequests.CompareAndSwap(maxRequests, currentRequests) {
+				break
+			}
+			maxRequests = maxConcurrentRequests.Load()
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		var permissionRequest PermissionFilterRequest
+		suite.Require().NoError(json.NewDecoder(r.Body).Decode(&permissionRequest))
+
+		// fail the chunks of failing resources
+		allowedResources := []string{}
+		for _, resource := range permissionRequest.Input.Resources {
+			if strings.HasPrefix(resource, "failing") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if isTestResourceAllowed(resource) {
+				allowedResources = append(allowedResources, resource)
+			}
+		}
+		suite.Require().NoError(json.NewEncoder(w).Encode(PermissionFilterResponse{Result: allowedResources}))
+	}))
+	defer chunkServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		chunkServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(newTestClock()),
+		WithFilterChunking(2, 2))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// queried in chunks of 2, up to 2 at a time
+	resources := []string{"allow-resource-1", "deny-resource-1", "allow-resource-2", "allow-resource-3", "allow-resource-1"}
+	results, err := httpClient.QueryPermissionsMultiResources(suite.ctx, resources, ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]bool{true, false, true, true, true}, results)
+	suite.Require().Equal(int64(2), requestsCount.Load())
+	suite.Require().Equal(int64(2), maxConcurrentRequests.Load())
+
+	// a failed chunk fails the whole batch
+	resources = []string{"allow-resource-1", "deny-resource-1", "failing-resource-1", "allow-resource-2", "allow-resource-3"}
+	_, err = httpClient.QueryPermissionsMultiResources(suite.ctx, resources, ActionRead, permissionOptions)
+	var unexpectedStatusError *UnexpectedStatusError
+	suite.Require().ErrorAs(err, &unexpectedStatusError)
+
+	// while the detailed query returns the results of the evaluated chunks
+	multiResourceResult, err := httpClient.QueryPermissionsMultiResourcesDetailed(suite.ctx,
+		append(resources, "allow-resource-1"),
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().False(multiResourceResult.Complete())
+	suite.Require().Equal([]bool{true, false, false, false, true, true}, multiResourceResult.Results)
+	suite.Require().Equal([]bool{true, true, false, false, true, true}, multiResourceResult.Evaluated)
+	suite.Require().Len(multiResourceResult.ChunkErrors, 1)
+	suite.Require().Equal([]string{"failing-resource-1", "allow-resource-2"}, multiResourceResult.ChunkErrors[0].Resources)
+	suite.Require().ErrorAs(multiResourceResult.ChunkErrors[0].Err, &unexpectedStatusError)
+	suite.Require().ErrorAs(multiResourceResult.Err(), &unexpectedStatusError)
+	suite.Require().Contains(multiResourceResult.Err().Error(), "Failed to evaluate 2 resources in 1 chunks")
+
+	// complete results carry no error
+	multiResourceResult, err = httpClient.QueryPermissionsMultiResourcesDetailed(suite.ctx,
+		[]string{"allow-resource-1", "deny-resource-1"},
+		ActionRead,
+		permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(multiResourceResult.Complete())
+	suite.Require().NoError(multiResourceResult.Err())
+	suite.Require().Equal([]bool{true, false}, multiResourceResult.Results)
+}
+
+func (suite *HTTPClientTestSuite) TestNilLogger() {
+	for _, client := range []Client{
+		CreateOpaClient(nil, &Config{
+			ClientKind:           ClientKindHTTP,
+			Address:              suite.testHTTPServer.URL,
+			PermissionQueryPath:  suite.httpClient.permissionQueryPath,
+			PermissionFilterPath: suite.httpClient.permissionFilterPath,
+			Verbose:              true,
+			CacheTTL:             60,
+		}),
+		CreateOpaClient(nil, &Config{
+			ClientKind: ClientKindNop,
+			Verbose:    true,
+		}),
+	} {
+		allowed, err := client.QueryPermissions(suite.ctx, "allow-resource", ActionRead, &PermissionOptions{
+			MemberIds: []string{"user1"},
+		})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+		suite.Require().NoError(client.(Closer).Close(suite.ctx))
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestStrictBuiltinErrorsAndInstrumentation() {
+	var requestsCount atomic.Int64
+	var lastQueryParameters url.Values
+	policyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestsCount.Add(1)
+		lastQueryParameters = r.URL.Query()
+		var permissionRequest PermissionQueryRequest
+		suite.Require().NoError(json.NewDecoder(r.Body).Decode(&permissionRequest))
+
+		// the policy fails parsing tokens of malformed resources
+		if permissionRequest.Input.Resource == "malformed-resource" {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, err := w.Write([]byte(`{
+				"code": "internal_error",
+				"message": "error(s) occurred while evaluating query",
+				"errors": [{
+					"code": "eval_builtin_error",
+					"message": "io.jwt.decode: failed to split token",
+					"location": {"file": "authz.rego", "row": 12, "col": 3}
+				}]
+			}`))
+			suite.Require().NoError(err)
+			return
+		}
+		_, err := w.Write([]byte(`{"result": true, "metrics": {"timer_rego_query_eval_ns": 2000000}}`))
+		suite.Require().NoError(err)
+	}))
+	defer policyServer.Close()
+
+	metricsSink := newTestMetricsSink()
+	httpClient := NewHTTPClient(suite.logger,
+		policyServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithMetricsSink(metricsSink),
+		WithStrictBuiltinErrors(),
+		WithInstrumentation())
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// instrumentation is attached to the decision, and the evaluation duration is reported
+	decision, err := httpClient.QueryDecision(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().True(decision.Allowed)
+	suite.Require().Equal(float64(2000000), decision.Metrics["timer_rego_query_eval_ns"])
+	suite.Require().Equal("true", lastQueryParameters.Get("strict-builtin-errors"))
+	suite.Require().Equal("true", lastQueryParameters.Get("instrument"))
+	suite.Require().Equal([]time.Duration{2 * time.Millisecond}, metricsSink.durations[MetricPolicyEvalDuration])
+
+	// builtin errors fail the query, without retrying
+	_, err = httpClient.QueryPermissions(suite.ctx, "malformed-resource", ActionRead, permissionOptions)
+	var policyError *PolicyError
+	suite.Require().ErrorAs(err, &policyError)
+	suite.Require().Equal("eval_builtin_error", policyError.Errors[0].Code)
+	suite.Require().Equal(12, policyError.Errors[0].Location.Row)
+	suite.Require().Equal("Policy evaluation failed: authz.rego:12:3: io.jwt.decode: failed to split token",
+		policyError.Error())
+	suite.Require().Equal(int64(2), requestsCount.Load())
+}
+
+func (suite *HTTPClientTestSuite) TestErrorCauses() {
+	closedServer := httptest.NewServer(http.NotFoundHandler())
+	closedServer.Close()
+
+	httpClient := NewHTTPClient(suite.logger,
+		closedServer.URL,
+		suite.httpClient.permissionQueryPath,
+		suite.httpClient.permissionFilterPath,
+		5*time.Second,
+		false,
+		"",
+		false,
+		WithClock(newTestClock()))
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	// the cause of the failure is kept along the chain, for the standard library
+	for _, queryFunc := range []func() error{
+		func() error {
+			_, err := httpClient.QueryPermissions(suite.ctx, "allow-resource", ActionRead, permissionOptions)
+			return err
+		},
+		func() error {
+			_, err := httpClient.QueryPermissionsMultiResources(suite.ctx,
+				[]string{"allow-resource-1", "allow-resource-2"},
+				ActionRead,
+				permissionOptions)
+			return err
+		},
+	} {
+		err := queryFunc()
+		suite.Require().Error(err)
+
+		var urlError *url.Error
+		suite.Require().ErrorAs(err, &urlError)
+		suite.Require().Contains(urlError.URL, closedServer.URL)
+
+		var netOpError *net.OpError
+		suite.Require().ErrorAs(err, &netOpError)
+		suite.Require().Equal("dial", netOpError.Op)
+	}
+}
+
+func (suite *HTTPClientTestSuite) TestAdaptiveTimeout() {
+	var roundTripsCount atomic.Int64
+	WithAdaptiveTimeout(0.99, 2, 50*time.Millisecond)(suite.httpClient)
+	WithRoundTripper(testRoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+
+		// hang once enough latencies were observed
+		if roundTripsCount.Add(1) == latencyWindowMinSample+1 {
+			<-request.Context().Done()
+			return nil, request.Context().Err()
+		}
+		return suite.httpClient.DefaultTransport().RoundTrip(request)
+	}))(suite.httpClient)
+
+	for resourceIdx := range latencyWindowMinSample + 1 {
+		allowed, err := suite.httpClient.QueryPermissions(suite.ctx,
+			fmt.Sprintf("allow-resource-%d", resourceIdx),
+			ActionRead,
+			&PermissionOptions{
+				MemberIds: []string{"user1"},
+			})
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+	}
+
+	// the hanging request timed out adaptively (rather than after the request timeout), and was retried
+	suite.Require().Equal(int64(latencyWindowMinSample+2), roundTripsCount.Load())
+	adaptiveTimeout, found := suite.httpClient.adaptiveTimeout.timeout(suite.testHTTPServer.URL)
+	suite.Require().True(found)
+	suite.Require().Equal(50*time.Millisecond, adaptiveTimeout)
+}
+
+func (suite *HTTPClientTestSuite) TestMaxConcurrentRequests() {
+	var inFlightRequests, maxInFlightRequests atomic.Int64
+	metricsSink := newTestMetricsSink()
+	WithMetricsSink(metricsSink)(suite.httpClient)
+	WithMaxConcurrentRequests(2)(suite.httpClient)
+	WithRoundTripper(testRoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		currentInFlightRequests := inFlightRequests.Add(1)
+		defer inFlightRequests.Add(-1)
+		for {
+			maxInFlight := maxInFlightRequests.Load()
+			if currentInFlightRequests <= maxInFlight ||
+				maxInFlightRequests.CompareAndSwap(maxInFlight, currentInFlightRequests) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return suite.httpClient.DefaultTransport().RoundTrip(request)
+	}))(suite.httpClient)
+
+	waitGroup := sync.WaitGroup{}
+	for resourceIdx := range 6 {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			allowed, err := suite.httpClient.QueryPermissions(suite.ctx,
+				fmt.Sprintf("allow-resource-%d", resourceIdx),
+				ActionRead,
+				&PermissionOptions{
+					MemberIds: []string{"user1"},
+				})
+			suite.Require().NoError(err)
+			suite.Require().True(allowed)
+		}()
+	}
+	waitGroup.Wait()
+
+	suite.Require().Equal(int64(2), maxInFlightRequests.Load())
+	suite.Require().Len(metricsSink.durations[MetricRequestWait], 6)
+}
+
+func (suite *HTTPClientTestSuite) TestQueryPriority() {
+	var lock sync.Mutex
+	var queriedResources []string
+	releaseFirstRequest := make(chan struct{})
+	WithMaxConcurrentRequests(1)(suite.httpClient)
+	WithRoundTripper(testRoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		requestBody, err := io.ReadAll(request.Body)
+		suite.Require().NoError(err)
+		var permissionRequest PermissionQueryRequest
+		suite.Require().NoError(json.Unmarshal(requestBody, &permissionRequest))
+		request.Body = io.NopCloser(bytes.NewReader(requestBody))
+
+		lock.Lock()
+		queriedResources = append(queriedResources, permissionRequest.Input.Resource)
+		lock.Unlock()
+		if permissionRequest.Input.Resource == "allow-resource-first" {
+			<-releaseFirstRequest
+		}
+		return suite.httpClient.DefaultTransport().RoundTrip(request)
+	}))(suite.httpClient)
+
+	waitGroup := sync.WaitGroup{}
+	query := func(resource string, priority Priority) {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			allowed, err := suite.httpClient.QueryPermissions(suite.ctx, resource, ActionRead, &PermissionOptions{
+				MemberIds: []string{"user1"},
+				Priority:  priority,
+			})
+			suite.Require().NoError(err)
+			suite.Require().True(allowed)
+		}()
+	}
+	waiters := func() (int, int) {
+		suite.httpClient.requestSlots.lock.Lock()
+		defer suite.httpClient.requestSlots.lock.Unlock()
+		return suite.httpClient.requestSlots.highPriorityWaiters.Len(), suite.httpClient.requestSlots.lowPriorityWaiters.Len()
+	}
+
+	// while the only slot is held, low priority queries wait behind the high priority ones, which arrived later
+	query("allow-resource-first", "")
+	suite.Require().Eventually(func() bool {
+		return suite.httpClient.requestSlots.inUse() == 1
+	}, time.Second, time.Millisecond)
+	query("allow-resource-low", PriorityLow)
+	suite.Require().Eventually(func() bool {
+		_, lowPriorityWaiters := waiters()
+		return lowPriorityWaiters == 1
+	}, time.Second, time.Millisecond)
+	query("allow-resource-high", PriorityHigh)
+	suite.Require().Eventually(func() bool {
+		highPriorityWaiters, _ := waiters()
+		return highPriorityWaiters == 1
+	}, time.Second, time.Millisecond)
+
+	close(releaseFirstRequest)
+	waitGroup.Wait()
+	suite.Require().Equal([]string{"allow-resource-first", "allow-resource-high", "allow-resource-low"}, queriedResources)
+	suite.Require().Zero(suite.httpClient.requestSlots.inUse())
+
+	// under adaptive throttling, low priority requests are rejected first
+	throttling := newAdaptiveThrottling(time.Minute, 2)
+	throttling.random = func() float64 { return 0.2 }
+	now := time.Now()
+	for _, accepted := range []bool{true, false} {
+		allowed, _ := throttling.allow(now, PriorityHigh)
+		suite.Require().True(allowed)
+		if accepted {
+			throttling.accept(now)
+		}
+	}
+	allowed, rejectionProbability := throttling.allow(now, PriorityHigh)
+	suite.Require().True(allowed)
+	suite.Require().Zero(rejectionProbability)
+	allowed, rejectionProbability = throttling.allow(now, PriorityLow)
+	suite.Require().False(allowed)
+	suite.Require().Equal(0.5, rejectionProbability)
+}
+
+func (suite *HTTPClientTestSuite) TestRequestQueue() {
+	var queriedResources []string
+	releaseFirstRequest := make(chan struct{})
+	metricsSink := newTestMetricsSink()
+	WithMetricsSink(metricsSink)(suite.httpClient)
+	WithRequestQueue(1, 1)(suite.httpClient)
+	WithRoundTripper(testRoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+		requestBody, err := io.ReadAll(request.Body)
+		suite.Require().NoError(err)
+		var permissionRequest PermissionQueryRequest
+		suite.Require().NoError(json.Unmarshal(requestBody, &permissionRequest))
+		request.Body = io.NopCloser(bytes.NewReader(requestBody))
+
+		// requests are sent one at a time
+		queriedResources = append(queriedResources, permissionRequest.Input.Resource)
+		if permissionRequest.Input.Resource == "allow-resource-first" {
+			<-releaseFirstRequest
+		}
+		return suite.httpClient.DefaultTransport().RoundTrip(request)
+	}))(suite.httpClient)
+
+	queryErrs := map[string]chan error{}
+	query := func(resource string, priority Priority) {
+		queryErr := make(chan error, 1)
+		queryErrs[resource] = queryErr
+		go func() {
+			_, err := suite.httpClient.QueryPermissions(suite.ctx, resource, ActionRead, &PermissionOptions{
+				MemberIds: []string{"user1"},
+				Priority:  priority,
+			})
+			queryErr <- err
+		}()
+	}
+	queued := func() int {
+		suite.httpClient.requestSlots.lock.Lock()
+		defer suite.httpClient.requestSlots.lock.Unlock()
+		return suite.httpClient.requestSlots.highPriorityWaiters.Len() + suite.httpClient.requestSlots.lowPriorityWaiters.Len()
+	}
+
+	query("allow-resource-first", PriorityHigh)
+	suite.Require().Eventually(func() bool {
+		return suite.httpClient.requestSlots.inUse() == 1
+	}, time.Second, time.Millisecond)
+	query("allow-resource-queued", PriorityLow)
+	suite.Require().Eventually(func() bool {
+		return queued() == 1
+	}, time.Second, time.Millisecond)
+
+	// once the queue is full, further requests are rejected right away
+	_, err := suite.httpClient.QueryPermissions(suite.ctx, "allow-resource-rejected", ActionRead, &PermissionOptions{
+		MemberIds: []string{"user1"},
+		Priority:  PriorityLow,
+	})
+	suite.Require().ErrorIs(err, ErrOverloaded)
+	var overloadedError *OverloadedError
+	suite.Require().ErrorAs(err, &overloadedError)
+	suite.Require().Equal(1, overloadedError.QueueSize)
+
+	// unless of high priority, displacing the queued low priority request
+	query("allow-resource-high", PriorityHigh)
+	suite.Require().ErrorIs(<-queryErrs["allow-resource-queued"], ErrOverloaded)
+	suite.Require().Eventually(func() bool {
+		return queued() == 1
+	}, time.Second, time.Millisecond)
+
+	close(releaseFirstRequest)
+	suite.Require().NoError(<-queryErrs["allow-resource-first"])
+	suite.Require().NoError(<-queryErrs["allow-resource-high"])
+	suite.Require().Equal([]string{"allow-resource-first", "allow-resource-high"}, queriedResources)
+	suite.Require().Equal(int64(2), metricsSink.counter(MetricOverloadedRequests+"{priority=low}"))
+}
+
+func (suite *HTTPClientTestSuite) TestPrefetch() {
+	WithDecisionCache(NewMemoryDecisionCache(0), time.Minute)(suite.httpClient)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+	resources := []string{"allow-resource-1", "deny-resource-1"}
+	actions := []Action{ActionRead, ActionUpdate}
+
+	err := suite.httpClient.Prefetch(suite.ctx, resources, actions, permissionOptions)
+	suite.Require().NoError(err)
+	suite.Require().Equal(int64(2), suite.permissionRequestsCount.Load())
+
+	for _, action := range actions {
+		for _, resource := range resources {
+			allowed, err := suite.httpClient.QueryPermissions(suite.ctx, resource, action, permissionOptions)
+			suite.Require().NoError(err)
+			suite.Require().Equal(isTestResourceAllowed(resource), allowed)
+		}
+	}
+	suite.Require().Equal(int64(2), suite.permissionRequestsCount.Load())
+}
+
+func TestHTTPClientTestSuite(t *testing.T) {
+	suite.Run(t, new(HTTPClientTestSuite))
+}
+
+// isTestResourceAllowed allows resources starting with "allow", and the p1 project
+func isTestResourceAllowed(resource string) bool {
+	return strings.HasPrefix(resource, "allow") || resource == "projects/p1"
+}
+
+type testRoundTripperFunc func(request *http.Request) (*http.Response, error)
+
+func (f testRoundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// testProvenance returns the provenance to respond with, if requested
+func testProvenance(r *http.Request, revision string) *Provenance {
+	if r.URL.Query().Get("provenance") != "true" {
+		return nil
+	}
+	return &Provenance{
+		Version: "0.38.1",
+		Bundles: map[string]ProvenanceBundle{
+			"authz": {Revision: revision},
+		},
+	}
+}
+
+// testClock is a fake clock, whose waits elapse instantly
+type testClock struct {
+	lock sync.Mutex
+	now  time.Time
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Now()}
+}
+
+func (c *testClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *testClock) After(duration time.Duration) <-chan time.Time {
+	c.advance(duration)
+	afterChan := make(chan time.Time, 1)
+	afterChan <- c.Now()
+	return afterChan
+}
+
+func (c *testClock) advance(duration time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(duration)
+}
+
+// testRecordingLogger records the messages logged at info level
+type testRecordingLogger struct {
+	NopLogger
+	lock           sync.Mutex
+	loggedMessages []string
+}
+
+func (l *testRecordingLogger) InfoWithCtx(ctx context.Context, format interface{}, vars ...interface{}) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.loggedMessages = append(l.loggedMessages, fmt.Sprint(format))
+}
+
+func (l *testRecordingLogger) GetChild(name string) logger.Logger {
+	return l
+}
+
+func (l *testRecordingLogger) messages() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return slices.Clone(l.loggedMessages)
+}
+
+// testDecisionLogSink records the written decision records
+type testDecisionLogSink struct {
+	lock    sync.Mutex
+	records []DecisionRecord
+}
+
+func (s *testDecisionLogSink) WriteDecisions(ctx context.Context, records []DecisionRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func (s *testDecisionLogSink) Close() error {
+	return nil
+}
+
+// testPermissionsClient implements the Client interface alone, allowing everything
+type testPermissionsClient struct{}
+
+func (c testPermissionsClient) QueryPermissions(ctx context.Context,
+	resource string,
+	action Action,
+	permissionOptions *PermissionOptions) (bool, error) {
+	return true, nil
+}
+
+func (c testPermissionsClient) QueryPermissionsMultiResources(ctx context.Context,
+	resources []string,
+	action Action,
+	permissionOptions *PermissionOptions) ([]bool, error) {
+	results := make([]bool, len(resources))
+	for resourceIdx := range results {
+		results[resourceIdx] = true
+	}
+	return results, nil
+}
+
+// testSPNEGOProvider returns the service principal of the host as its token
+type testSPNEGOProvider struct{}
+
+func (p testSPNEGOProvider) Token(ctx context.Context, host string) ([]byte, error) {
+	return []byte("HTTP/" + host), nil
+}
+
+// testMetricsSink records the reported metrics
+type testMetricsSink struct {
+	lock      sync.Mutex
+	counters  map[string]int64
+	gauges    map[string]float64
+	durations map[string][]time.Duration
+}
+
+func newTestMetricsSink() *testMetricsSink {
+	return &testMetricsSink{
+		counters:  map[string]int64{},
+		gauges:    map[string]float64{},
+		durations: map[string][]time.Duration{},
+	}
+}
+
+func (s *testMetricsSink) IncrementCounter(name string, value int64, labels map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.counters[name] += value
+
+	// count by every label as well (e.g.: name{outcome=allow})
+	for labelName, labelValue := range labels {
+		s.counters[fmt.Sprintf("%s{%s=%s}", name, labelName, labelValue)] += value
+	}
+}
+
+func (s *testMetricsSink) SetGauge(name string, value float64, labels map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.gauges[name] = value
+}
+
+func (s *testMetricsSink) ObserveDuration(name string, duration time.Duration, labels map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.durations[name] = append(s.durations[name], duration)
+}
+
+func (s *testMetricsSink) counter(name string) int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.counters[name]
+}
+
+func (s *testMetricsSink) gauge(name string) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.gauges[name]
 }
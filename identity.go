@@ -0,0 +1,72 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// IdentityInputField is the query input field the identity is forwarded in
+const IdentityInputField = "identity"
+
+// Identity is the authenticated identity of a request - a raw JWT, and/or its claims,
+// which policies can base their decisions on (e.g.: using io.jwt.decode_verify)
+type Identity struct {
+	Token  string         `json:"token,omitempty"`
+	Claims map[string]any `json:"claims,omitempty"`
+}
+
+type identityContextKey struct{}
+
+type memberIDsContextKey struct{}
+
+// WithMemberIDs returns a context carrying the given member ids, which queries setting neither member ids
+// nor a subject are made with
+func WithMemberIDs(ctx context.Context, memberIDs []string) context.Context {
+	return context.WithValue(ctx, memberIDsContextKey{}, memberIDs)
+}
+
+// MemberIDsFromContext returns the member ids carried by the given context, if any
+func MemberIDsFromContext(ctx context.Context) []string {
+	memberIDs, _ := ctx.Value(memberIDsContextKey{}).([]string)
+	return memberIDs
+}
+
+// ContextWithIdentity returns a context carrying the given identity, to be forwarded to OPA
+// (see WithIdentityForwarding)
+func ContextWithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityContextKey{}, identity)
+}
+
+// IdentityFromContext returns the identity carried by the given context, if any
+func IdentityFromContext(ctx context.Context) *Identity {
+	identity, _ := ctx.Value(identityContextKey{}).(*Identity)
+	return identity
+}
+
+// MemberIDsFromHeader returns the member ids carried (comma separated) by the given request header, if any
+func MemberIDsFromHeader(header http.Header, headerName string) []string {
+	var memberIDs []string
+	for _, memberID := range strings.Split(header.Get(headerName), ",") {
+		if memberID = strings.TrimSpace(memberID); memberID != "" {
+			memberIDs = append(memberIDs, memberID)
+		}
+	}
+	return memberIDs
+}
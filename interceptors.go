@@ -0,0 +1,53 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"net/url"
+)
+
+// Interceptor hooks into every query sent to OPA, letting applications mutate the input, add headers,
+// or capture the payloads. Either function may be nil, and an error fails the query
+type Interceptor struct {
+
+	// BeforeRequest is invoked before the request is marshalled
+	BeforeRequest func(ctx context.Context, request *InterceptedRequest) error
+
+	// AfterResponse is invoked after the response is received, before it is unmarshalled
+	AfterResponse func(ctx context.Context, response *InterceptedResponse) error
+}
+
+type InterceptedRequest struct {
+	Path string
+
+	// Request is a pointer to the request (*PermissionQueryRequest or *PermissionFilterRequest)
+	Request any
+
+	// Headers are added to the request
+	Headers map[string]string
+
+	// QueryParameters are added to the request URL (e.g.: explain=full, to have OPA explain the decision)
+	QueryParameters url.Values
+}
+
+type InterceptedResponse struct {
+	Path string
+
+	// Body is the raw response body (encoded by the request encoder), which may be replaced
+	Body []byte
+}
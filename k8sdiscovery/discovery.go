@@ -0,0 +1,357 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package k8sdiscovery discovers the OPA servers backing a Kubernetes service, by watching its EndpointSlices,
+// so the client balances queries between them as the OPA deployment scales.
+package k8sdiscovery
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	opaclient "github.com/nuclio/opa-client"
+)
+
+const (
+	serviceAccountPath = "/var/run/secrets/kubernetes.io/serviceaccount"
+	serviceNameLabel   = "kubernetes.io/service-name"
+
+	// DefaultRetryInterval is the period to wait before re-watching, once watching failed
+	DefaultRetryInterval = 5 * time.Second
+)
+
+type Config struct {
+
+	// namespace of the service (defaults to the namespace of the pod)
+	Namespace string
+
+	// name of the OPA service
+	ServiceName string
+
+	// name of the port to query OPA at (defaults to the first port of the service)
+	PortName string
+
+	// scheme of the discovered addresses (defaults to http)
+	Scheme string
+
+	// kubernetes API server address, bearer token file (re-read on every request, as tokens are rotated)
+	// and HTTP client (default to the in-cluster ones)
+	APIServerAddress string
+	TokenFile        string
+	HTTPClient       *http.Client
+
+	// period to wait before re-watching, once watching failed
+	RetryInterval time.Duration
+}
+
+// Discovery watches the EndpointSlices of the OPA service, and provides the addresses of its ready endpoints.
+// It implements opaclient.EndpointProvider
+type Discovery struct {
+	logger logger.Logger
+	config Config
+
+	lock           sync.RWMutex
+	sliceEndpoints map[string][]string
+	endpoints      []string
+}
+
+func NewDiscovery(parentLogger logger.Logger, config Config) (*Discovery, error) {
+	if config.ServiceName == "" {
+		return nil, errors.New("Service name must be set")
+	}
+	if config.Scheme == "" {
+		config.Scheme = "http"
+	}
+	if config.RetryInterval == 0 {
+		config.RetryInterval = DefaultRetryInterval
+	}
+	if err := populateInClusterConfig(&config); err != nil {
+		return nil, errors.Wrap(err, "Failed to populate in-cluster configuration")
+	}
+	if parentLogger == nil {
+		parentLogger = opaclient.NopLogger{}
+	}
+
+	return &Discovery{
+		logger:         parentLogger.GetChild("opa-k8s-discovery"),
+		config:         config,
+		sliceEndpoints: map[string][]string{},
+	}, nil
+}
+
+// Start lists the endpoints of the service, and keeps watching them in the background until the context is done
+func (d *Discovery) Start(ctx context.Context) error {
+	resourceVersion, err := d.list(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Failed to list endpoint slices")
+	}
+
+	go d.watch(ctx, resourceVersion)
+	return nil
+}
+
+// Endpoints returns the addresses of the ready endpoints of the service
+func (d *Discovery) Endpoints() []string {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	return d.endpoints
+}
+
+func (d *Discovery) list(ctx context.Context) (string, error) {
+	response, err := d.sendRequest(ctx, url.Values{})
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close() // nolint: errcheck
+
+	endpointSlices := endpointSliceList{}
+	if err := json.NewDecoder(response.Body).Decode(&endpointSlices); err != nil {
+		return "", errors.Wrap(err, "Failed to decode endpoint slices")
+	}
+
+	sliceEndpoints := map[string][]string{}
+	for _, endpointSlice := range endpointSlices.Items {
+		sliceEndpoints[endpointSlice.Metadata.Name] = d.readyEndpoints(&endpointSlice)
+	}
+
+	d.lock.Lock()
+	d.sliceEndpoints = sliceEndpoints
+	d.lock.Unlock()
+
+	d.updateEndpoints(ctx)
+	return endpointSlices.Metadata.ResourceVersion, nil
+}
+
+// watch keeps watching the endpoint slices, re-listing them once the watch cannot be resumed
+func (d *Discovery) watch(ctx context.Context, resourceVersion string) {
+	for {
+		err := d.watchEvents(ctx, &resourceVersion)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+
+			// the API server closes watches periodically
+			continue
+		}
+
+		d.logger.WarnWithCtx(ctx, "Failed to watch endpoint slices, retrying",
+			"service", d.config.ServiceName,
+			"err", err.Error())
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.config.RetryInterval):
+			}
+
+			if resourceVersion, err = d.list(ctx); err == nil {
+				break
+			}
+			d.logger.WarnWithCtx(ctx, "Failed to list endpoint slices, retrying",
+				"service", d.config.ServiceName,
+				"err", err.Error())
+		}
+	}
+}
+
+func (d *Discovery) watchEvents(ctx context.Context, resourceVersion *string) error {
+	response, err := d.sendRequest(ctx, url.Values{
+		"watch":               []string{"true"},
+		"resourceVersion":     []string{*resourceVersion},
+		"allowWatchBookmarks": []string{"true"},
+	})
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close() // nolint: errcheck
+
+	decoder := json.NewDecoder(response.Body)
+	for {
+		event := watchEvent{}
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() != nil || errors.Is(err, io.EOF) {
+				return nil
+			}
+			return errors.Wrap(err, "Failed to decode watch event")
+		}
+
+		// e.g.: the resource version is too old to resume watching from
+		if event.Type == watchEventTypeError {
+			return errors.Errorf("Received watch error: %s", string(event.Object))
+		}
+
+		endpointSlice := endpointSlice{}
+		if err := json.Unmarshal(event.Object, &endpointSlice); err != nil {
+			return errors.Wrap(err, "Failed to decode endpoint slice")
+		}
+		*resourceVersion = endpointSlice.Metadata.ResourceVersion
+
+		switch event.Type {
+		case watchEventTypeAdded, watchEventTypeModified:
+			d.lock.Lock()
+			d.sliceEndpoints[endpointSlice.Metadata.Name] = d.readyEndpoints(&endpointSlice)
+			d.lock.Unlock()
+		case watchEventTypeDeleted:
+			d.lock.Lock()
+			delete(d.sliceEndpoints, endpointSlice.Metadata.Name)
+			d.lock.Unlock()
+		default:
+			continue
+		}
+
+		d.updateEndpoints(ctx)
+	}
+}
+
+func (d *Discovery) sendRequest(ctx context.Context, query url.Values) (*http.Response, error) {
+	query.Set("labelSelector", serviceNameLabel+"="+d.config.ServiceName)
+	requestURL := fmt.Sprintf("%s/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?%s",
+		strings.TrimSuffix(d.config.APIServerAddress, "/"),
+		url.PathEscape(d.config.Namespace),
+		query.Encode())
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create request")
+	}
+	request.Header.Set("Accept", "application/json")
+	if d.config.TokenFile != "" {
+		token, err := os.ReadFile(d.config.TokenFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to read token file")
+		}
+		request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	response, err := d.config.HTTPClient.Do(request)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to send request to the API server")
+	}
+	if response.StatusCode != http.StatusOK {
+		response.Body.Close() // nolint: errcheck
+		return nil, errors.Errorf("Received unexpected status code from the API server: %d", response.StatusCode)
+	}
+	return response, nil
+}
+
+// readyEndpoints returns the addresses of the ready endpoints of the given slice
+func (d *Discovery) readyEndpoints(endpointSlice *endpointSlice) []string {
+	var port *int32
+	for _, endpointPort := range endpointSlice.Ports {
+		if d.config.PortName == "" || (endpointPort.Name != nil && *endpointPort.Name == d.config.PortName) {
+			port = endpointPort.Port
+			break
+		}
+	}
+	if port == nil {
+		return nil
+	}
+
+	var endpoints []string
+	for _, endpoint := range endpointSlice.Endpoints {
+
+		// unknown readiness is considered ready
+		if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+			continue
+		}
+		for _, address := range endpoint.Addresses {
+			endpoints = append(endpoints,
+				fmt.Sprintf("%s://%s", d.config.Scheme, net.JoinHostPort(address, strconv.Itoa(int(*port)))))
+		}
+	}
+	return endpoints
+}
+
+// updateEndpoints merges the endpoints of all slices (an endpoint may appear in several during updates)
+func (d *Discovery) updateEndpoints(ctx context.Context) {
+	d.lock.Lock()
+	var endpoints []string
+	for _, sliceEndpoints := range d.sliceEndpoints {
+		endpoints = append(endpoints, sliceEndpoints...)
+	}
+	slices.Sort(endpoints)
+	endpoints = slices.Compact(endpoints)
+
+	changed := !slices.Equal(endpoints, d.endpoints)
+	d.endpoints = endpoints
+	d.lock.Unlock()
+
+	if changed {
+		d.logger.InfoWithCtx(ctx, "Updated OPA endpoints",
+			"service", d.config.ServiceName,
+			"endpoints", endpoints)
+	}
+}
+
+// populateInClusterConfig fills in the namespace, API server address and credentials of the pod
+func populateInClusterConfig(config *Config) error {
+	if config.Namespace == "" {
+		namespace, err := os.ReadFile(filepath.Join(serviceAccountPath, "namespace"))
+		if err != nil {
+			return errors.Wrap(err, "Failed to read namespace")
+		}
+		config.Namespace = strings.TrimSpace(string(namespace))
+	}
+
+	if config.APIServerAddress == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return errors.New("Not running in a Kubernetes cluster, and no API server address is set")
+		}
+		config.APIServerAddress = "https://" + net.JoinHostPort(host, port)
+
+		if config.TokenFile == "" {
+			config.TokenFile = filepath.Join(serviceAccountPath, "token")
+		}
+	}
+
+	if config.HTTPClient == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if caCertificate, err := os.ReadFile(filepath.Join(serviceAccountPath, "ca.crt")); err == nil {
+			certificatePool := x509.NewCertPool()
+			if !certificatePool.AppendCertsFromPEM(caCertificate) {
+				return errors.New("Failed to parse service account CA")
+			}
+			transport.TLSClientConfig = &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				RootCAs:    certificatePool,
+			}
+		}
+
+		// watches are long-lived, so no request timeout
+		config.HTTPClient = &http.Client{Transport: transport}
+	}
+	return nil
+}
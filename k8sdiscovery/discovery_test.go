@@ -0,0 +1,125 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sdiscovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	nucliozap "github.com/nuclio/zap"
+	"github.com/stretchr/testify/suite"
+)
+
+type DiscoveryTestSuite struct {
+	suite.Suite
+	ctx           context.Context
+	cancel        context.CancelFunc
+	apiServer     *httptest.Server
+	watchRequests chan string
+	watchEvents   chan string
+	discovery     *Discovery
+}
+
+func (suite *DiscoveryTestSuite) SetupTest() {
+	loggerInstance, err := nucliozap.NewNuclioZapTest("k8s-discovery-test")
+	suite.Require().NoError(err)
+
+	suite.ctx, suite.cancel = context.WithCancel(context.Background())
+	suite.watchRequests = make(chan string, 10)
+	suite.watchEvents = make(chan string, 10)
+	suite.apiServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.Require().Equal("/apis/discovery.k8s.io/v1/namespaces/opa-ns/endpointslices", r.URL.Path)
+		suite.Require().Equal("kubernetes.io/service-name=opa", r.URL.Query().Get("labelSelector"))
+
+		if r.URL.Query().Get("watch") != "true" {
+			_, err := fmt.Fprintf(w, `{"metadata": {"resourceVersion": "1"}, "items": [%s]}`,
+				testEndpointSlice("opa-1", "2", "10.0.0.1", true))
+			suite.Require().NoError(err)
+			return
+		}
+
+		suite.watchRequests <- r.URL.Query().Get("resourceVersion")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event := <-suite.watchEvents:
+				_, err := fmt.Fprintln(w, event)
+				suite.Require().NoError(err)
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+
+	suite.discovery, err = NewDiscovery(loggerInstance, Config{
+		Namespace:        "opa-ns",
+		ServiceName:      "opa",
+		PortName:         "http",
+		APIServerAddress: suite.apiServer.URL,
+		HTTPClient:       suite.apiServer.Client(),
+	})
+	suite.Require().NoError(err)
+}
+
+func (suite *DiscoveryTestSuite) TearDownTest() {
+	suite.cancel()
+	suite.apiServer.Close()
+}
+
+func (suite *DiscoveryTestSuite) TestWatch() {
+	err := suite.discovery.Start(suite.ctx)
+	suite.Require().NoError(err)
+	suite.Require().Equal([]string{"http://10.0.0.1:8181"}, suite.discovery.Endpoints())
+	suite.Require().Equal("1", <-suite.watchRequests)
+
+	// scale up, with a not yet ready endpoint
+	suite.watchEvents <- fmt.Sprintf(`{"type": "ADDED", "object": %s}`,
+		testEndpointSlice("opa-2", "3", "10.0.0.2", true))
+	suite.watchEvents <- fmt.Sprintf(`{"type": "ADDED", "object": %s}`,
+		testEndpointSlice("opa-3", "4", "10.0.0.3", false))
+	suite.Require().Eventually(func() bool {
+		return len(suite.discovery.Endpoints()) == 2
+	}, time.Second, 10*time.Millisecond)
+	suite.Require().Equal([]string{"http://10.0.0.1:8181", "http://10.0.0.2:8181"}, suite.discovery.Endpoints())
+
+	// scale down
+	suite.watchEvents <- fmt.Sprintf(`{"type": "DELETED", "object": %s}`,
+		testEndpointSlice("opa-1", "5", "10.0.0.1", true))
+	suite.Require().Eventually(func() bool {
+		return len(suite.discovery.Endpoints()) == 1
+	}, time.Second, 10*time.Millisecond)
+	suite.Require().Equal([]string{"http://10.0.0.2:8181"}, suite.discovery.Endpoints())
+}
+
+func testEndpointSlice(name string, resourceVersion string, address string, ready bool) string {
+	return fmt.Sprintf(`{
+		"metadata": {"name": %q, "resourceVersion": %q},
+		"endpoints": [{"addresses": [%q], "conditions": {"ready": %t}}],
+		"ports": [{"name": "metrics", "port": 9090}, {"name": "http", "port": 8181}]
+	}`, name, resourceVersion, address, ready)
+}
+
+func TestDiscoveryTestSuite(t *testing.T) {
+	suite.Run(t, new(DiscoveryTestSuite))
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8sdiscovery
+
+import "encoding/json"
+
+// the subset of the discovery.k8s.io/v1 API used for discovery
+
+type watchEventType string
+
+const (
+	watchEventTypeAdded    watchEventType = "ADDED"
+	watchEventTypeModified watchEventType = "MODIFIED"
+	watchEventTypeDeleted  watchEventType = "DELETED"
+	watchEventTypeError    watchEventType = "ERROR"
+)
+
+type watchEvent struct {
+	Type   watchEventType  `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+type objectMeta struct {
+	Name            string `json:"name,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type endpointSliceList struct {
+	Metadata objectMeta      `json:"metadata"`
+	Items    []endpointSlice `json:"items"`
+}
+
+type endpointSlice struct {
+	Metadata  objectMeta     `json:"metadata"`
+	Endpoints []endpoint     `json:"endpoints"`
+	Ports     []endpointPort `json:"ports"`
+}
+
+type endpoint struct {
+	Addresses  []string           `json:"addresses"`
+	Conditions endpointConditions `json:"conditions"`
+}
+
+type endpointConditions struct {
+	Ready *bool `json:"ready,omitempty"`
+}
+
+type endpointPort struct {
+	Name *string `json:"name,omitempty"`
+	Port *int32  `json:"port,omitempty"`
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindowSize      = 100
+	latencyWindowMinSample = 20
+)
+
+// adaptiveTimeout derives the timeout of requests to an endpoint from its observed latency percentile,
+// so transient slowness fails fast rather than waiting for the full static timeout
+type adaptiveTimeout struct {
+	percentile float64
+	multiplier float64
+	minTimeout time.Duration
+
+	lock      sync.Mutex
+	latencies map[string]*latencyWindow
+}
+
+// latencyWindow is a rolling window of the latest latencies of an endpoint
+type latencyWindow struct {
+	samples  []time.Duration
+	nextIdx  int
+	complete bool
+}
+
+func newAdaptiveTimeout(percentile float64, multiplier float64, minTimeout time.Duration) *adaptiveTimeout {
+	return &adaptiveTimeout{
+		percentile: percentile,
+		multiplier: multiplier,
+		minTimeout: minTimeout,
+		latencies:  map[string]*latencyWindow{},
+	}
+}
+
+// observe records the latency of a successful request to the endpoint
+func (a *adaptiveTimeout) observe(endpoint string, latency time.Duration) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	window, found := a.latencies[endpoint]
+	if !found {
+		window = &latencyWindow{
+			samples: make([]time.Duration, 0, latencyWindowSize),
+		}
+		a.latencies[endpoint] = window
+	}
+
+	if !window.complete {
+		window.samples = append(window.samples, latency)
+		window.complete = len(window.samples) == latencyWindowSize
+		return
+	}
+	window.samples[window.nextIdx] = latency
+	window.nextIdx = (window.nextIdx + 1) % latencyWindowSize
+}
+
+// timeout returns the timeout of a request to the endpoint - its latency percentile times the multiplier
+// (and no less than the minimum). Returns false until enough latencies of the endpoint were observed
+func (a *adaptiveTimeout) timeout(endpoint string) (time.Duration, bool) {
+	a.lock.Lock()
+	window, found := a.latencies[endpoint]
+	if !found || len(window.samples) < latencyWindowMinSample {
+		a.lock.Unlock()
+		return 0, false
+	}
+	samples := slices.Clone(window.samples)
+	a.lock.Unlock()
+
+	slices.Sort(samples)
+	percentileIdx := int(math.Ceil(a.percentile*float64(len(samples)))) - 1
+	percentileLatency := samples[min(max(percentileIdx, 0), len(samples)-1)]
+	return max(time.Duration(float64(percentileLatency)*a.multiplier), a.minTimeout), true
+}
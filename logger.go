@@ -0,0 +1,88 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+
+	"github.com/nuclio/logger"
+)
+
+// NopLogger discards all logs. Constructors given a nil parent logger fall back to it
+type NopLogger struct{}
+
+func (NopLogger) Error(format interface{}, vars ...interface{}) {}
+
+func (NopLogger) Warn(format interface{}, vars ...interface{}) {}
+
+func (NopLogger) Info(format interface{}, vars ...interface{}) {}
+
+func (NopLogger) Debug(format interface{}, vars ...interface{}) {}
+
+func (NopLogger) ErrorCtx(ctx context.Context, format interface{}, vars ...interface{}) {}
+
+func (NopLogger) WarnCtx(ctx context.Context, format interface{}, vars ...interface{}) {}
+
+func (NopLogger) InfoCtx(ctx context.Context, format interface{}, vars ...interface{}) {}
+
+func (NopLogger) DebugCtx(ctx context.Context, format interface{}, vars ...interface{}) {}
+
+func (NopLogger) ErrorWith(format interface{}, vars ...interface{}) {}
+
+func (NopLogger) WarnWith(format interface{}, vars ...interface{}) {}
+
+func (NopLogger) InfoWith(format interface{}, vars ...interface{}) {}
+
+func (NopLogger) DebugWith(format interface{}, vars ...interface{}) {}
+
+func (NopLogger) ErrorWithCtx(ctx context.Context, format interface{}, vars ...interface{}) {}
+
+func (NopLogger) WarnWithCtx(ctx context.Context, format interface{}, vars ...interface{}) {}
+
+func (NopLogger) InfoWithCtx(ctx context.Context, format interface{}, vars ...interface{}) {}
+
+func (NopLogger) DebugWithCtx(ctx context.Context, format interface{}, vars ...interface{}) {}
+
+func (NopLogger) Flush() {}
+
+func (l NopLogger) GetChild(name string) logger.Logger {
+	return l
+}
+
+// childLogger returns the named child of the parent logger, or a no-op logger if the parent logger is nil
+func childLogger(parentLogger logger.Logger, name string) logger.Logger {
+	if parentLogger == nil {
+		return NopLogger{}
+	}
+	return parentLogger.GetChild(name)
+}
+
+type verboseContextKey struct{}
+
+// withVerbose returns a context whose queries are logged verbosely (or not), regardless of the client verbosity
+func withVerbose(ctx context.Context, verbose bool) context.Context {
+	return context.WithValue(ctx, verboseContextKey{}, verbose)
+}
+
+// isVerbose returns whether to log the queries of the given context verbosely - as set by their permission options
+// (see PermissionOptions.Verbose), or by the client
+func (c *HTTPClient) isVerbose(ctx context.Context) bool {
+	if verbose, ok := ctx.Value(verboseContextKey{}).(bool); ok {
+		return verbose
+	}
+	return c.verbose
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import "time"
+
+// Metric names reported by the client
+const (
+	MetricCacheHits             = "opa_client_cache_hits_total"
+	MetricCacheMisses           = "opa_client_cache_misses_total"
+	MetricCacheEvictions        = "opa_client_cache_evictions_total"
+	MetricCacheSize             = "opa_client_cache_size"
+	MetricCacheRefreshFailures  = "opa_client_cache_refresh_failures_total"
+	MetricShadowDivergences     = "opa_client_shadow_divergences_total"
+	MetricShadowFailures        = "opa_client_shadow_failures_total"
+	MetricStaleDecisions        = "opa_client_stale_decisions_total"
+	MetricFallbackDecisions     = "opa_client_fallback_decisions_total"
+	MetricMonitoredDenies       = "opa_client_monitored_denies_total"
+	MetricMonitoredFailures     = "opa_client_monitored_failures_total"
+	MetricRequestWait           = "opa_client_request_wait_seconds"
+	MetricQueries               = "opa_client_queries_total"
+	MetricQueryDuration         = "opa_client_query_duration_seconds"
+	MetricRetries               = "opa_client_retries_total"
+	MetricTimeouts              = "opa_client_timeouts_total"
+	MetricThrottledRequests     = "opa_client_throttled_requests_total"
+	MetricRetryBudgetExhausted  = "opa_client_retry_budget_exhausted_total"
+	MetricOverloadedRequests    = "opa_client_overloaded_requests_total"
+	MetricDecisions             = "opa_client_decisions_total"
+	MetricOverrides             = "opa_client_overrides_total"
+	MetricCanaryComparisons     = "opa_client_canary_comparisons_total"
+	MetricCanaryFailures        = "opa_client_canary_failures_total"
+	MetricPolicyEvalDuration    = "opa_client_policy_eval_duration_seconds"
+	MetricPolicyRevisionChanges = "opa_client_policy_revision_changes_total"
+)
+
+// MetricsSink receives the client metrics, to be exported by the application's metrics system
+type MetricsSink interface {
+
+	// IncrementCounter increments a counter by the given value
+	IncrementCounter(name string, value int64, labels map[string]string)
+
+	// SetGauge sets a gauge to the given value
+	SetGauge(name string, value float64, labels map[string]string)
+
+	// ObserveDuration records a duration (e.g.: into a histogram)
+	ObserveDuration(name string, duration time.Duration, labels map[string]string)
+}
+
+// NopMetricsSink discards all metrics
+type NopMetricsSink struct{}
+
+func (s NopMetricsSink) IncrementCounter(name string, value int64, labels map[string]string) {}
+
+func (s NopMetricsSink) SetGauge(name string, value float64, labels map[string]string) {}
+
+func (s NopMetricsSink) ObserveDuration(name string, duration time.Duration, labels map[string]string) {
+}
@@ -42,3 +42,16 @@ func (mc *MockClient) QueryPermissionsMultiResources(ctx context.Context,
 	args := mc.Called(ctx, resources, action, permissionOptions)
 	return args.Get(0).([]bool), args.Error(1)
 }
+
+func (mc *MockClient) Close(ctx context.Context) error {
+	args := mc.Called(ctx)
+	return args.Error(0)
+}
+
+func (mc *MockClient) QueryDecision(ctx context.Context,
+	resource string,
+	action Action,
+	permissionOptions *PermissionOptions) (*Decision, error) {
+	args := mc.Called(ctx, resource, action, permissionOptions)
+	return args.Get(0).(*Decision), args.Error(1)
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nuclio/errors"
+)
+
+// MultiResourceResult is the result of a multi-resource query which may have partially failed - e.g.: when some
+// of the filter requests of a chunked query (see WithFilterChunking) fail while others succeed
+type MultiResourceResult struct {
+
+	// Results hold whether the action is allowed against each resource (at the same index).
+	// Resources which were not evaluated are denied (or allowed, in monitor enforcement mode)
+	Results []bool
+
+	// Evaluated hold whether each resource (at the same index) was decided - by OPA, the decision cache,
+	// the override or the fallback policy
+	Evaluated []bool
+
+	// ChunkErrors are the errors of the chunks which failed to be evaluated
+	ChunkErrors []ChunkError
+}
+
+// ChunkError is the error of a chunk of resources which failed to be evaluated
+type ChunkError struct {
+
+	// Resources are the resources of the chunk, as queried (i.e.: scoped and normalized, and deduplicated)
+	Resources []string
+	Err       error
+}
+
+// Complete returns true if all of the resources were evaluated
+func (r *MultiResourceResult) Complete() bool {
+	return len(r.ChunkErrors) == 0
+}
+
+// Err returns the error of the first failed chunk (wrapped), or nil if all of the resources were evaluated
+func (r *MultiResourceResult) Err() error {
+	if r.Complete() {
+		return nil
+	}
+
+	failedResources := 0
+	for _, chunkError := range r.ChunkErrors {
+		failedResources += len(chunkError.Resources)
+	}
+	return errors.Wrapf(r.ChunkErrors[0].Err,
+		"Failed to evaluate %d resources in %d chunks",
+		failedResources,
+		len(r.ChunkErrors))
+}
+
+// QueryPermissionsMultiResourcesDetailed queries permissions for multiple resources at once, like
+// QueryPermissionsMultiResources, but rather than failing the whole batch once any of its chunks fails, returns
+// the results of the resources which were evaluated, along with the errors of the chunks which were not
+func (c *HTTPClient) QueryPermissionsMultiResourcesDetailed(ctx context.Context,
+	resources []string,
+	action Action,
+	permissionOptions *PermissionOptions) (*MultiResourceResult, error) {
+
+	if err := validateResources(resources); err != nil {
+		return nil, err
+	}
+	scopedResources, err := c.scopeResources(resources)
+	if err != nil {
+		return nil, err
+	}
+	ctx, permissionOptions, err = c.resolvePermissionOptions(ctx, permissionOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	uniqueResources, uniqueResourceIdxs := deduplicateResources(scopedResources)
+	uniqueResult, _ := c.queryUniqueResources(ctx, uniqueResources, action, permissionOptions)
+
+	multiResourceResult := &MultiResourceResult{
+		Results:     make([]bool, len(resources)),
+		Evaluated:   make([]bool, len(resources)),
+		ChunkErrors: uniqueResult.ChunkErrors,
+	}
+	for resourceIdx, uniqueResourceIdx := range uniqueResourceIdxs {
+		multiResourceResult.Results[resourceIdx] = uniqueResult.Results[uniqueResourceIdx]
+		multiResourceResult.Evaluated[resourceIdx] = uniqueResult.Evaluated[uniqueResourceIdx]
+	}
+	return multiResourceResult, nil
+}
+
+// queryChunks decides the given (uncached) resources by querying OPA in chunks (see WithFilterChunking), deciding
+// the resources of failed chunks by their stale decisions or the fallback policy, if possible. Returns the decisions
+// (nil for resources which were not decided), the errors deciding each resource, and the errors of the failed chunks
+func (c *HTTPClient) queryChunks(ctx context.Context,
+	resources []string,
+	action Action,
+	permissionOptions *PermissionOptions) ([]*Decision, []error, []ChunkError) {
+
+	chunkSize := len(resources)
+	if c.filterChunkSize > 0 && c.filterChunkSize < chunkSize {
+		chunkSize = c.filterChunkSize
+	}
+	chunkCount := (len(resources) + chunkSize - 1) / chunkSize
+
+	decisions := make([]*Decision, len(resources))
+	decisionErrs := make([]error, len(resources))
+	chunkErrs := make([]error, chunkCount)
+	queryChunk := func(chunkIdx int) {
+		chunkStart := chunkIdx * chunkSize
+		chunkResources := resources[chunkStart:min(chunkStart+chunkSize, len(resources))]
+
+		results, provenance, err := c.queryPermissionsMultiResources(ctx, chunkResources, action, permissionOptions)
+		if err == nil {
+			c.shadowQueryPermissionsMultiResources(ctx, chunkResources, action, permissionOptions, results)
+			c.canaryQueryPermissionsMultiResources(ctx, chunkResources, action, permissionOptions, results)
+			for chunkResourceIdx, allowed := range results {
+				decision := &Decision{
+					Resource:   chunkResources[chunkResourceIdx],
+					Action:     action,
+					Allowed:    allowed,
+					Provenance: provenance,
+					DecisionID: DecisionIDFromContext(ctx),
+				}
+				decisions[chunkStart+chunkResourceIdx] = decision
+				c.cacheDecision(ctx, decision, permissionOptions)
+			}
+			return
+		}
+
+		if failedQueryDecisions, decided := c.decideFailedQuery(ctx,
+			chunkResources,
+			action,
+			permissionOptions,
+			err); decided {
+			copy(decisions[chunkStart:], failedQueryDecisions)
+			return
+		}
+
+		chunkErrs[chunkIdx] = err
+		for chunkResourceIdx := range chunkResources {
+			decisionErrs[chunkStart+chunkResourceIdx] = err
+		}
+	}
+
+	if chunkCount == 1 || c.filterChunkConcurrency <= 1 {
+		for chunkIdx := 0; chunkIdx < chunkCount; chunkIdx++ {
+			queryChunk(chunkIdx)
+		}
+	} else {
+		chunkSlots := make(chan struct{}, c.filterChunkConcurrency)
+		waitGroup := sync.WaitGroup{}
+		for chunkIdx := 0; chunkIdx < chunkCount; chunkIdx++ {
+			chunkSlots <- struct{}{}
+			waitGroup.Add(1)
+			go func() {
+				defer func() {
+					<-chunkSlots
+					waitGroup.Done()
+				}()
+				queryChunk(chunkIdx)
+			}()
+		}
+		waitGroup.Wait()
+	}
+
+	var chunkErrors []ChunkError
+	for chunkIdx, chunkErr := range chunkErrs {
+		if chunkErr != nil {
+			chunkStart := chunkIdx * chunkSize
+			chunkErrors = append(chunkErrors, ChunkError{
+				Resources: resources[chunkStart:min(chunkStart+chunkSize, len(resources))],
+				Err:       chunkErr,
+			})
+		}
+	}
+	return decisions, decisionErrs, chunkErrors
+}
@@ -0,0 +1,267 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/nuclio/errors"
+)
+
+// DefaultMultiSubjectsConcurrency is the max number of concurrent per-subject queries of multi-subject queries,
+// while the multi-subjects path is not set
+const DefaultMultiSubjectsConcurrency = 8
+
+type PermissionMultiSubjectsRequest struct {
+	Input PermissionMultiSubjectsRequestInput `json:"input,omitempty"`
+}
+
+type PermissionMultiSubjectsRequestInput struct {
+	Resource   string         `json:"resource,omitempty"`
+	Action     string         `json:"action,omitempty"`
+	Subjects   [][]string     `json:"subjects,omitempty"`
+	Ancestors  []string       `json:"ancestors,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Prefix     string         `json:"prefix,omitempty"`
+
+	// Extra fields are merged into the input
+	Extra map[string]any `json:"-"`
+}
+
+func (i PermissionMultiSubjectsRequestInput) MarshalJSON() ([]byte, error) {
+	type permissionMultiSubjectsRequestInput PermissionMultiSubjectsRequestInput
+	return marshalInputWithExtra(permissionMultiSubjectsRequestInput(i), i.Extra)
+}
+
+// PermissionMultiSubjectsResponse lists the allowed subjects (by their member ids)
+type PermissionMultiSubjectsResponse struct {
+	Result     [][]string  `json:"result,omitempty"`
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// QueryPermissionsMultiSubjects queries permission of the action against a single resource for multiple subjects
+// (each given by its member ids) at once, e.g.: to display who can access the resource.
+// It is guaranteed that len(subjects) and len(results) are equal, and that subjects[i] query permission is at
+// results[i]. Empty subjects are rejected. The member ids, subject and override of the permission options are ignored.
+// The subjects are evaluated in a single request to the multi-subjects path (see WithMultiSubjectsPath), or in
+// concurrent requests per subject while it is not set (see DefaultMultiSubjectsConcurrency). As the decisions are not enforced, they are the policy
+// decisions in monitor enforcement mode as well
+func (c *HTTPClient) QueryPermissionsMultiSubjects(ctx context.Context,
+	resource string,
+	action Action,
+	subjects [][]string,
+	permissionOptions *PermissionOptions) ([]bool, error) {
+
+	for subjectIdx, subject := range subjects {
+		if len(subject) == 0 {
+			return nil, errors.Errorf("Subject at index %d is empty", subjectIdx)
+		}
+	}
+	if err := validateResources([]string{resource}); err != nil {
+		return nil, err
+	}
+	resource, err := c.scopeResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	ctx, permissionOptions, err = c.resolvePermissionOptions(ctx, permissionOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// the queried subjects are not the caller, so the caller's identity and override do not apply to them
+	subjectsPermissionOptions := make([]*PermissionOptions, len(subjects))
+	for subjectIdx, subject := range subjects {
+		subjectPermissionOptions := *permissionOptions
+		subjectPermissionOptions.MemberIds = subject
+		subjectPermissionOptions.Subject = nil
+		subjectPermissionOptions.OverrideHeaderValue = ""
+		subjectPermissionOptions.RequestHeaders = nil
+		subjectPermissionOptions.RaiseForbidden = false
+		subjectsPermissionOptions[subjectIdx] = &subjectPermissionOptions
+	}
+
+	if c.permissionMultiSubjectsPath != "" {
+		return c.queryMultiSubjects(ctx, resource, action, subjects, subjectsPermissionOptions)
+	}
+	return c.queryMultiSubjectsBySubject(ctx, resource, action, subjectsPermissionOptions)
+}
+
+// queryMultiSubjectsBySubject decides the resource for every subject concurrently (up to
+// DefaultMultiSubjectsConcurrency queries at a time), as single resource queries
+func (c *HTTPClient) queryMultiSubjectsBySubject(ctx context.Context,
+	resource string,
+	action Action,
+	subjectsPermissionOptions []*PermissionOptions) ([]bool, error) {
+	results := make([]bool, len(subjectsPermissionOptions))
+	errs := make([]error, len(subjectsPermissionOptions))
+
+	subjectSlots := make(chan struct{}, DefaultMultiSubjectsConcurrency)
+	var waitGroup sync.WaitGroup
+	for subjectIdx, subjectPermissionOptions := range subjectsPermissionOptions {
+		subjectSlots <- struct{}{}
+		waitGroup.Add(1)
+		go func() {
+			defer func() {
+				<-subjectSlots
+				waitGroup.Done()
+			}()
+
+			decision, err := c.queryDecision(ctx, resource, action, subjectPermissionOptions)
+			if err != nil {
+				errs[subjectIdx] = errors.Wrapf(err, "Failed to query permission of subject at index %d", subjectIdx)
+				return
+			}
+			results[subjectIdx] = decision.Allowed
+		}()
+	}
+	waitGroup.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// queryMultiSubjects decides the resource for every subject - by the cached decisions and querying OPA for the
+// rest in a single request (per hierarchy resource, in client hierarchy mode)
+func (c *HTTPClient) queryMultiSubjects(ctx context.Context,
+	resource string,
+	action Action,
+	subjects [][]string,
+	subjectsPermissionOptions []*PermissionOptions) ([]bool, error) {
+	results := make([]bool, len(subjects))
+
+	var uncachedSubjectIdxs []int
+	for subjectIdx, subjectPermissionOptions := range subjectsPermissionOptions {
+		if cachedDecision := c.getCachedDecisions(ctx,
+			[]string{resource},
+			action,
+			subjectPermissionOptions)[0]; cachedDecision != nil {
+			results[subjectIdx] = cachedDecision.Allowed
+			continue
+		}
+		uncachedSubjectIdxs = append(uncachedSubjectIdxs, subjectIdx)
+	}
+	if len(uncachedSubjectIdxs) == 0 {
+		return results, nil
+	}
+
+	// the permission options differ by the member ids only
+	permissionOptions := subjectsPermissionOptions[uncachedSubjectIdxs[0]]
+
+	// in client hierarchy mode, a subject is allowed if allowed against the resource or any of its ancestors
+	hierarchyResources := []string{resource}
+	if permissionOptions.HierarchyMode == HierarchyModeClient {
+		hierarchyResources = append(hierarchyResources, resourceAncestors(resource)...)
+	}
+
+	// subjects are matched by their member ids, regardless of their order
+	allowedSubjects := map[string]bool{}
+	var provenance *Provenance
+	queriedSubjectIdxs := uncachedSubjectIdxs
+	for _, hierarchyResource := range hierarchyResources {
+		queriedSubjects := make([][]string, 0, len(queriedSubjectIdxs))
+		for _, subjectIdx := range queriedSubjectIdxs {
+			queriedSubjects = append(queriedSubjects, subjects[subjectIdx])
+		}
+		permissionMultiSubjectsResponse, err := c.queryMultiSubjectsResource(ctx,
+			hierarchyResource,
+			action,
+			queriedSubjects,
+			permissionOptions)
+		if err != nil {
+			return nil, err
+		}
+		if provenance == nil {
+			provenance = permissionMultiSubjectsResponse.Provenance
+		}
+		for _, allowedSubject := range permissionMultiSubjectsResponse.Result {
+			allowedSubjects[subjectKey(allowedSubject)] = true
+		}
+
+		// query the ancestors for the subjects which are not allowed yet
+		queriedSubjectIdxs = slices.DeleteFunc(slices.Clone(queriedSubjectIdxs), func(subjectIdx int) bool {
+			return allowedSubjects[subjectKey(subjects[subjectIdx])]
+		})
+		if len(queriedSubjectIdxs) == 0 {
+			break
+		}
+	}
+
+	var decisionRecords []DecisionRecord
+	for _, subjectIdx := range uncachedSubjectIdxs {
+		decision := &Decision{
+			Resource:   resource,
+			Action:     action,
+			Allowed:    allowedSubjects[subjectKey(subjects[subjectIdx])],
+			Provenance: provenance,
+		}
+		results[subjectIdx] = decision.Allowed
+		c.cacheDecision(ctx, decision, subjectsPermissionOptions[subjectIdx])
+		if c.recordsDecisions() {
+			decisionRecords = append(decisionRecords,
+				newDecisionRecord(c.clock, decision, subjectsPermissionOptions[subjectIdx], nil))
+		}
+	}
+	if len(decisionRecords) > 0 {
+		c.logDecisions(ctx, decisionRecords)
+	}
+	return results, nil
+}
+
+// queryMultiSubjectsResource queries the multi-subjects path for the subjects allowed the action against the resource
+func (c *HTTPClient) queryMultiSubjectsResource(ctx context.Context,
+	resource string,
+	action Action,
+	subjects [][]string,
+	permissionOptions *PermissionOptions) (*PermissionMultiSubjectsResponse, error) {
+	requestInput := PermissionMultiSubjectsRequestInput{
+		Resource:   resource,
+		Action:     string(action),
+		Subjects:   subjects,
+		Attributes: permissionOptions.ResourceAttributes[resource],
+		Extra:      queryExtraInput(ctx, permissionOptions),
+	}
+	if permissionOptions.HierarchyMode == HierarchyModeInput {
+		requestInput.Ancestors = resourceAncestors(resource)
+	}
+	if IsWildcardResource(resource) {
+		requestInput.Prefix = resourcePrefix(resource)
+	}
+
+	permissionMultiSubjectsResponse := PermissionMultiSubjectsResponse{}
+	if err := c.sendQuery(ctx,
+		c.permissionMultiSubjectsPath,
+		&PermissionMultiSubjectsRequest{Input: requestInput},
+		&permissionMultiSubjectsResponse); err != nil {
+		return nil, err
+	}
+	return &permissionMultiSubjectsResponse, nil
+}
+
+// subjectKey returns the key of a subject by its member ids, regardless of their order
+func subjectKey(memberIds []string) string {
+	sortedMemberIds := slices.Clone(memberIds)
+	slices.Sort(sortedMemberIds)
+	return strings.Join(slices.Compact(sortedMemberIds), "\x00")
+}
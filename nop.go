@@ -29,7 +29,7 @@ type NopClient struct {
 
 func NewNopClient(parentLogger logger.Logger, verbose bool) *NopClient {
 	newClient := NopClient{
-		logger:  parentLogger.GetChild("opa"),
+		logger:  childLogger(parentLogger, "opa"),
 		verbose: verbose,
 	}
 	return &newClient
@@ -60,3 +60,24 @@ func (c *NopClient) QueryPermissions(ctx context.Context, resource string, actio
 	}
 	return true, nil
 }
+
+func (c *NopClient) Close(ctx context.Context) error {
+	return nil
+}
+
+func (c *NopClient) QueryDecision(ctx context.Context,
+	resource string,
+	action Action,
+	permissionOptions *PermissionOptions) (*Decision, error) {
+	if c.verbose {
+		c.logger.InfoWithCtx(ctx, "Skipping decision query",
+			"resource", resource,
+			"action", action,
+			"permissionOptions", permissionOptions)
+	}
+	return &Decision{
+		Resource: resource,
+		Action:   action,
+		Allowed:  true,
+	}, nil
+}
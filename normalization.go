@@ -0,0 +1,96 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"strings"
+
+	"github.com/nuclio/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	ResourceNormalizationTrim            = "trim"
+	ResourceNormalizationLowercase       = "lowercase"
+	ResourceNormalizationNFC             = "nfc"
+	ResourceNormalizationCollapseSlashes = "collapse_slashes"
+)
+
+// ResourceNormalizer returns the normalized form of a resource, so that equivalent resources (e.g.: /Projects/p1
+// and /projects//p1) are queried and cached alike
+type ResourceNormalizer func(resource string) string
+
+// NewResourceNormalizer returns a normalizer applying the given normalizations by name (trim, lowercase, nfc,
+// collapse_slashes), in order
+func NewResourceNormalizer(normalizations ...string) (ResourceNormalizer, error) {
+	resourceNormalizers := make([]ResourceNormalizer, 0, len(normalizations))
+	for _, normalization := range normalizations {
+		switch strings.ToLower(normalization) {
+		case ResourceNormalizationTrim:
+			resourceNormalizers = append(resourceNormalizers, strings.TrimSpace)
+		case ResourceNormalizationLowercase:
+			resourceNormalizers = append(resourceNormalizers, strings.ToLower)
+		case ResourceNormalizationNFC:
+			resourceNormalizers = append(resourceNormalizers, norm.NFC.String)
+		case ResourceNormalizationCollapseSlashes:
+			resourceNormalizers = append(resourceNormalizers, CollapseSlashes)
+		default:
+			return nil, errors.Errorf("Unknown resource normalization %s", normalization)
+		}
+	}
+	return ChainResourceNormalizers(resourceNormalizers...), nil
+}
+
+// ChainResourceNormalizers returns a normalizer applying the given normalizers in order
+func ChainResourceNormalizers(resourceNormalizers ...ResourceNormalizer) ResourceNormalizer {
+	return func(resource string) string {
+		for _, resourceNormalizer := range resourceNormalizers {
+			resource = resourceNormalizer(resource)
+		}
+		return resource
+	}
+}
+
+// CollapseSlashes replaces every run of slashes in the resource by a single one (e.g.: /projects//p1 -> /projects/p1)
+func CollapseSlashes(resource string) string {
+	if !strings.Contains(resource, "//") {
+		return resource
+	}
+
+	var collapsedResource strings.Builder
+	collapsedResource.Grow(len(resource))
+	for charIdx := 0; charIdx < len(resource); charIdx++ {
+		if resource[charIdx] == '/' && charIdx > 0 && resource[charIdx-1] == '/' {
+			continue
+		}
+		collapsedResource.WriteByte(resource[charIdx])
+	}
+	return collapsedResource.String()
+}
+
+// normalizeResource returns the normalized resource, failing if nothing is left of it
+func (c *HTTPClient) normalizeResource(resource string) (string, error) {
+	if c.resourceNormalizer == nil {
+		return resource, nil
+	}
+
+	normalizedResource := c.resourceNormalizer(resource)
+	if normalizedResource == "" {
+		return "", errors.Errorf("Resource %q is empty once normalized", resource)
+	}
+	return normalizedResource, nil
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+)
+
+// tokenExpiryMargin refreshes tokens a little before they expire, so they don't expire in flight
+const tokenExpiryMargin = 10 * time.Second
+
+// TokenSource provides the access token requests to OPA are authenticated with (as a bearer token)
+type TokenSource interface {
+
+	// Token returns a valid access token
+	Token(ctx context.Context) (string, error)
+}
+
+// ClientCredentialsTokenSource fetches access tokens using the OAuth2 client credentials grant,
+// reusing each token until shortly before it expires
+type ClientCredentialsTokenSource struct {
+	httpClient   *http.Client
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scopes       []string
+
+	// clientSecretSource (if set) provides the client secret instead, as it rotates (see WithSecretReferences)
+	clientSecretSource func(ctx context.Context) (string, error)
+
+	lock      sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+type clientCredentialsTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type,omitempty"`
+	ExpiresIn   int    `json:"expires_in,omitempty"`
+}
+
+func NewClientCredentialsTokenSource(httpClient *http.Client,
+	tokenURL string,
+	clientID string,
+	clientSecret string,
+	scopes []string) *ClientCredentialsTokenSource {
+	if httpClient == nil {
+		httpClient = &http.Client{
+			Timeout: DefaultRequestTimeOut,
+		}
+	}
+	return &ClientCredentialsTokenSource{
+		httpClient:   httpClient,
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		scopes:       scopes,
+	}
+}
+
+func (s *ClientCredentialsTokenSource) Token(ctx context.Context) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.token != "" && time.Now().Before(s.expiresAt) {
+		return s.token, nil
+	}
+
+	clientSecret := s.clientSecret
+	if s.clientSecretSource != nil {
+		var err error
+		if clientSecret, err = s.clientSecretSource(ctx); err != nil {
+			return "", errors.Wrap(err, "Failed to get client secret")
+		}
+	}
+
+	form := url.Values{
+		"grant_type": {"client_credentials"},
+	}
+	if len(s.scopes) > 0 {
+		form.Set("scope", strings.Join(s.scopes, " "))
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to create token request")
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("User-Agent", UserAgent)
+	request.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(clientSecret))
+
+	response, err := s.httpClient.Do(request)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to send token request")
+	}
+	defer response.Body.Close() // nolint: errcheck
+
+	if response.StatusCode != http.StatusOK {
+		return "", errors.Errorf("Got unexpected token response status code: %d", response.StatusCode)
+	}
+
+	tokenResponse := clientCredentialsTokenResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		return "", errors.Wrap(err, "Failed to decode token response")
+	}
+	if tokenResponse.AccessToken == "" {
+		return "", errors.New("Token response has no access token")
+	}
+
+	s.token = tokenResponse.AccessToken
+
+	// tokens without an expiry are reused until the next refresh window
+	expiresIn := time.Duration(tokenResponse.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+	s.expiresAt = time.Now().Add(expiresIn - min(tokenExpiryMargin, expiresIn/2))
+	return s.token, nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"slices"
+)
+
+type ObligationType string
+
+const (
+
+	// ObligationTypeMask obliges the application to mask the obligation fields (e.g.: of the returned records)
+	ObligationTypeMask ObligationType = "mask"
+
+	// ObligationTypeRowLimit obliges the application to return no more rows than the obligation limit
+	ObligationTypeRowLimit ObligationType = "row_limit"
+)
+
+// Obligation is a condition the policy attaches to its decision, which the application must enforce
+// (e.g.: allow, but mask field X). Policies return obligations in a rich result ({allow, obligations})
+type Obligation struct {
+	Type ObligationType `json:"type"`
+
+	// Fields the obligation applies to (e.g.: the fields to mask)
+	Fields []string `json:"fields,omitempty"`
+
+	// Limit the obligation sets (e.g.: the maximum number of rows)
+	Limit *int `json:"limit,omitempty"`
+
+	// Parameters of custom obligations
+	Parameters map[string]any `json:"parameters,omitempty"`
+}
+
+// Obligations are the obligations attached to a decision
+type Obligations []Obligation
+
+// OfType returns the obligations of the given type
+func (o Obligations) OfType(obligationType ObligationType) Obligations {
+	var obligations Obligations
+	for _, obligation := range o {
+		if obligation.Type == obligationType {
+			obligations = append(obligations, obligation)
+		}
+	}
+	return obligations
+}
+
+// MaskedFields returns the fields of all mask obligations
+func (o Obligations) MaskedFields() []string {
+	var maskedFields []string
+	for _, obligation := range o.OfType(ObligationTypeMask) {
+		for _, field := range obligation.Fields {
+			if !slices.Contains(maskedFields, field) {
+				maskedFields = append(maskedFields, field)
+			}
+		}
+	}
+	return maskedFields
+}
+
+// RowLimit returns the strictest limit of the row limit obligations, if any
+func (o Obligations) RowLimit() (int, bool) {
+	rowLimit, found := 0, false
+	for _, obligation := range o.OfType(ObligationTypeRowLimit) {
+		if obligation.Limit != nil && (!found || *obligation.Limit < rowLimit) {
+			rowLimit, found = *obligation.Limit, true
+		}
+	}
+	return rowLimit, found
+}
+
+// QueryPermissionsWithObligations queries permission for a single resource, returning the obligations the
+// application must enforce along with it (see QueryDecision)
+func (c *HTTPClient) QueryPermissionsWithObligations(ctx context.Context,
+	resource string,
+	action Action,
+	permissionOptions *PermissionOptions) (bool, Obligations, error) {
+
+	decision, err := c.QueryDecision(ctx, resource, action, permissionOptions)
+	if err != nil {
+		return false, nil, err
+	}
+	return decision.Allowed, decision.Obligations, nil
+}
@@ -49,3 +49,38 @@ type Client interface {
 	// Returns a slice of booleans where each index corresponds to the resource at the same index.
 	QueryPermissionsMultiResources(context.Context, []string, Action, *PermissionOptions) ([]bool, error)
 }
+
+// The features beyond querying permissions (e.g.: decisions, stats, health, derived clients) are methods of the
+// HTTPClient. Clients may implement the optional interfaces below as well, which callers holding a Client type-assert
+
+// DecisionQuerier queries permission for a single resource, returning the decision along with its metadata
+type DecisionQuerier interface {
+	QueryDecision(context.Context, string, Action, *PermissionOptions) (*Decision, error)
+}
+
+// Closer releases the client resources, draining its background work until the context is done
+type Closer interface {
+	Close(context.Context) error
+}
+
+// QueryDecision queries the decision of a single resource by the client - along with its metadata if the client is a
+// DecisionQuerier, or by its permission alone otherwise
+func QueryDecision(ctx context.Context,
+	client Client,
+	resource string,
+	action Action,
+	permissionOptions *PermissionOptions) (*Decision, error) {
+	if decisionQuerier, ok := client.(DecisionQuerier); ok {
+		return decisionQuerier.QueryDecision(ctx, resource, action, permissionOptions)
+	}
+
+	allowed, err := client.QueryPermissions(ctx, resource, action, permissionOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &Decision{
+		Resource: resource,
+		Action:   action,
+		Allowed:  allowed,
+	}, nil
+}
@@ -0,0 +1,654 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Option configures optional behavior of the HTTP client
+type Option func(*HTTPClient)
+
+// WithHTTPClient sends requests to OPA using the given HTTP client (e.g.: layered with instrumentation, or
+// a service-mesh transport), instead of the internally built one.
+// Transport options (e.g.: WithTransportTimeouts, WithCertificateReloader) apply to the internally built transport only
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *HTTPClient) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRoundTripper sends requests to OPA through the given round tripper, instead of the internally built
+// transport (which may be wrapped, e.g.: for instrumentation - see DefaultTransport).
+// The request timeout still applies
+func WithRoundTripper(roundTripper http.RoundTripper) Option {
+	return func(c *HTTPClient) {
+		c.httpClient = &http.Client{
+			Timeout:   c.httpClient.Timeout,
+			Transport: roundTripper,
+		}
+	}
+}
+
+// WithPermissionPaths queries the given single and multiple resources paths (e.g.: of a different policy package).
+// Empty paths are left unchanged
+func WithPermissionPaths(permissionQueryPath string, permissionFilterPath string) Option {
+	return func(c *HTTPClient) {
+		if permissionQueryPath != "" {
+			c.permissionQueryPath = permissionQueryPath
+		}
+		if permissionFilterPath != "" {
+			c.permissionFilterPath = permissionFilterPath
+		}
+	}
+}
+
+// WithRequestTimeout sets the timeout of querying OPA, keeping the HTTP client otherwise
+func WithRequestTimeout(requestTimeout time.Duration) Option {
+	return func(c *HTTPClient) {
+		httpClient := *c.httpClient
+		httpClient.Timeout = requestTimeout
+		c.httpClient = &httpClient
+		c.requestTimeout = requestTimeout
+	}
+}
+
+// WithDefaultPermissionOptions completes the permission options of every query with the given ones
+// (e.g.: a default hierarchy mode or extra input), for the fields the query leaves unset
+func WithDefaultPermissionOptions(defaultPermissionOptions *PermissionOptions) Option {
+	return func(c *HTTPClient) {
+		c.defaultPermissionOptions = defaultPermissionOptions
+	}
+}
+
+// WithMaxConcurrentRequests limits the number of requests sent to OPA concurrently, protecting both OPA and the local
+// file descriptors budget on bursts. Requests beyond the limit wait for a slot (reported as MetricRequestWait).
+// Waiting high priority requests are granted slots before low priority ones (see PermissionOptions.Priority).
+// Derived clients (see HTTPClient.With) share the limit
+func WithMaxConcurrentRequests(maxConcurrentRequests int) Option {
+	return func(c *HTTPClient) {
+		c.requestSlots = newPrioritySemaphore(maxConcurrentRequests, 0)
+	}
+}
+
+// WithRequestQueue limits the number of requests sent to OPA concurrently (see WithMaxConcurrentRequests), queueing
+// up to the given number of requests beyond the limit to absorb bursts. Requests beyond the queue size fail right
+// away with an OverloadedError (matching ErrOverloaded) rather than time out, unless of high priority - which displace
+// the latest queued low priority request (see PermissionOptions.Priority).
+// Derived clients (see HTTPClient.With) share the limit and queue
+func WithRequestQueue(maxConcurrentRequests int, queueSize int) Option {
+	return func(c *HTTPClient) {
+		c.requestSlots = newPrioritySemaphore(maxConcurrentRequests, queueSize)
+	}
+}
+
+// WithWarmup pre-establishes the given number of connections to every endpoint during the client construction, by
+// health queries, so the first queries don't pay for resolving OPA's host and completing TLS handshakes. The
+// internally built transport keeps at least as many idle connections per host
+func WithWarmup(connections int) Option {
+	return func(c *HTTPClient) {
+		c.warmupConnections = connections
+		c.transport.MaxIdleConnsPerHost = max(c.transport.MaxIdleConnsPerHost, connections)
+	}
+}
+
+// WithAdaptiveTimeout times out requests to each endpoint at its observed latency percentile (e.g.: 0.99) times the
+// multiplier (e.g.: 2), and no less than the minimum timeout, so transient slowness is retried rather than waited for
+// up to the request timeout. The request timeout applies until enough latencies of the endpoint were observed
+func WithAdaptiveTimeout(percentile float64, multiplier float64, minTimeout time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.adaptiveTimeout = newAdaptiveTimeout(percentile, multiplier, minTimeout)
+	}
+}
+
+// WithAdaptiveThrottling rejects requests to OPA locally (with ErrUnreachable) in proportion to its failure rate over
+// the given window, once it fails more than 1/multiplier of the requests (e.g.: 2, rejecting once more than half fail),
+// so a persistently failing OPA isn't loaded by every query retrying on its own. The throttling is shared by derived
+// clients. A zero window or multiplier defaults to DefaultThrottlingWindow or DefaultThrottlingMultiplier
+func WithAdaptiveThrottling(window time.Duration, multiplier float64) Option {
+	return func(c *HTTPClient) {
+		if window <= 0 {
+			window = DefaultThrottlingWindow
+		}
+		if multiplier <= 0 {
+			multiplier = DefaultThrottlingMultiplier
+		}
+		c.adaptiveThrottling = newAdaptiveThrottling(window, multiplier)
+	}
+}
+
+// WithTransportTimeouts sets the timeouts of establishing a connection, completing the TLS handshake,
+// and receiving the response headers, allowing to fail fast on connection errors while allowing slower policy
+// evaluation. The request timeout bounds them all. A zero timeout leaves it unbounded
+func WithTransportTimeouts(dialTimeout time.Duration,
+	tlsHandshakeTimeout time.Duration,
+	responseHeaderTimeout time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.dialer.Timeout = dialTimeout
+		c.transport.TLSHandshakeTimeout = tlsHandshakeTimeout
+		c.transport.ResponseHeaderTimeout = responseHeaderTimeout
+	}
+}
+
+// WithCachingResolver resolves the OPA host names using the given caching resolver,
+// re-resolving them once connecting fails
+func WithCachingResolver(cachingResolver *CachingResolver) Option {
+	return func(c *HTTPClient) {
+		c.transport.DialContext = cachingResolver.DialContext(c.dialer)
+	}
+}
+
+// WithCertificateReloader authenticates with the client certificate, and verifies the OPA server by the CA,
+// served (and reloaded once changed) by the given certificate reloader
+func WithCertificateReloader(certificateReloader *CertificateReloader) Option {
+	return func(c *HTTPClient) {
+		transport := c.transport
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{
+				MinVersion: tls.VersionTLS12,
+			}
+		}
+		certificateReloader.ConfigureTLS(transport.TLSClientConfig)
+	}
+}
+
+// WithEndpointTLS connects to the given OPA server address (e.g.: https://opa-remote:8443) by the given TLS
+// configuration, rather than the client-wide one (e.g.: mTLS to remote servers, along with plaintext sidecars).
+// The client certificate and CA of a certificate reloader can be set on it with CertificateReloader.ConfigureTLS
+func WithEndpointTLS(address string, tlsConfig *tls.Config) Option {
+	return func(c *HTTPClient) {
+		hostPort, err := endpointHostPort(address)
+		if err != nil {
+			c.logger.WarnWith("Failed to configure endpoint TLS, using the client-wide TLS configuration",
+				"address", address,
+				"err", err.Error())
+			return
+		}
+		c.ensureEndpointTLSDialer().tlsConfigs[hostPort] = tlsConfig
+	}
+}
+
+// WithTokenSource authenticates requests to OPA with the access tokens of the given token source
+// (e.g.: ClientCredentialsTokenSource), as bearer tokens
+func WithTokenSource(tokenSource TokenSource) Option {
+	return func(c *HTTPClient) {
+		c.tokenSource = tokenSource
+	}
+}
+
+// WithOverride reads the override value of queries from the given request header (see
+// PermissionOptions.RequestHeaders), unless set explicitly, and accepts the given override values along with the
+// configured one (e.g.: one per internal service, or the next value while rotating it).
+// An empty header name leaves it unchanged
+func WithOverride(overrideHeaderName string, overrideHeaderValues ...string) Option {
+	return func(c *HTTPClient) {
+		if overrideHeaderName != "" {
+			c.overrideHeaderName = overrideHeaderName
+		}
+		for _, overrideHeaderValue := range overrideHeaderValues {
+			if overrideHeaderValue != "" {
+				c.overrideHeaderValues = append(c.overrideHeaderValues, overrideHeaderValue)
+			}
+		}
+	}
+}
+
+// WithOverrideTokens accepts override tokens (see SignOverrideToken) signed by any of the given keys (e.g.: the current
+// and the next one while rotating), and unexpired, as override values. When issuers are given, only tokens of these
+// issuers are accepted
+func WithOverrideTokens(keys [][]byte, issuers ...string) Option {
+	return func(c *HTTPClient) {
+		c.overrideTokenKeys = keys
+		c.overrideTokenIssuers = issuers
+	}
+}
+
+// WithSPNEGO negotiates SPNEGO (Kerberos) authentication with the proxies in front of OPA, by tokens of the given
+// provider (see SPNEGOTransport). Must follow WithHTTPClient and WithRoundTripper to wrap their transport
+func WithSPNEGO(provider SPNEGOProvider, preemptive bool) Option {
+	return func(c *HTTPClient) {
+		c.httpClient = &http.Client{
+			Timeout: c.httpClient.Timeout,
+			Transport: &SPNEGOTransport{
+				Base:       c.httpClient.Transport,
+				Provider:   provider,
+				Preemptive: preemptive,
+			},
+		}
+	}
+}
+
+// WithInputValidators validates the input of every query by the given validators (e.g.: StandardInputValidator)
+// before it is sent, failing invalid queries with an InputValidationError rather than having OPA silently deny them
+func WithInputValidators(inputValidators ...InputValidator) Option {
+	return func(c *HTTPClient) {
+		c.inputValidators = inputValidators
+	}
+}
+
+// WithFilterChunking splits the filter requests of multi-resource queries into chunks of up to the given number of
+// resources, queried concurrently by up to the given concurrency (sequentially, unless greater than 1).
+// Failed chunks fail QueryPermissionsMultiResources as a whole, while QueryPermissionsMultiResourcesDetailed returns
+// the results of the succeeding ones
+func WithFilterChunking(chunkSize int, concurrency int) Option {
+	return func(c *HTTPClient) {
+		c.filterChunkSize = chunkSize
+		c.filterChunkConcurrency = concurrency
+	}
+}
+
+// WithResourceNormalizer normalizes every queried resource by the given normalizer (e.g.: NewResourceNormalizer)
+// before it is scoped, queried or cached. The resource scope, if any, is expected in normalized form
+func WithResourceNormalizer(resourceNormalizer ResourceNormalizer) Option {
+	return func(c *HTTPClient) {
+		c.resourceNormalizer = resourceNormalizer
+	}
+}
+
+// WithRequestSigning signs every query request with HMAC-SHA256 by the given key (see SignRequest), so gateways in
+// front of OPA can verify the integrity and freshness of the queries (see VerifyRequestSignature)
+func WithRequestSigning(key []byte) Option {
+	return func(c *HTTPClient) {
+		c.requestSigningKey = key
+	}
+}
+
+// WithIdentityForwarding forwards the identity carried by the request context (see ContextWithIdentity)
+// in the query input, as input.identity
+func WithIdentityForwarding() Option {
+	return func(c *HTTPClient) {
+		c.forwardIdentity = true
+	}
+}
+
+// WithSubjectResolver resolves the subject of queries whose permission options set neither member ids
+// nor a subject, using the given resolver (see CachingSubjectResolver)
+func WithSubjectResolver(subjectResolver SubjectResolver) Option {
+	return func(c *HTTPClient) {
+		c.subjectResolver = subjectResolver
+	}
+}
+
+// WithInterceptors hooks the given interceptors into every query sent to OPA, in order
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(c *HTTPClient) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// WithClock tells the time of retries and cached decisions expiry by the given clock (e.g.: a fake clock in tests).
+// The clock of a MemoryDecisionCache is set separately (see MemoryDecisionCache.SetClock)
+func WithClock(clock Clock) Option {
+	return func(c *HTTPClient) {
+		c.clock = clock
+	}
+}
+
+// WithDecisionCache caches permission decisions for the given TTL
+func WithDecisionCache(decisionCache DecisionCache, ttl time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.decisionCache = decisionCache
+		c.cacheTTL = ttl
+	}
+}
+
+// WithCacheDenyTTL caches deny decisions for the given TTL instead of the decision cache TTL.
+// A zero TTL disables caching of deny decisions
+func WithCacheDenyTTL(ttl time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.cacheDenyTTL = &ttl
+	}
+}
+
+// WithCacheActionTTLs caches the decisions of the given actions for their TTLs, instead of the decision cache TTL
+// (and the deny TTL), e.g.: caching read decisions for long, but delete decisions briefly. A zero TTL disables
+// caching of the action's decisions
+func WithCacheActionTTLs(actionTTLs map[Action]time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.cacheActionTTLs = actionTTLs
+	}
+}
+
+// WithCacheRefreshWindow refreshes cached decisions in the background when they are served within the given
+// window before their expiry, so frequently queried decisions are always served from the cache
+func WithCacheRefreshWindow(refreshWindow time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.cacheRefreshWindow = refreshWindow
+	}
+}
+
+// WithStrictBuiltinErrors queries OPA with strict builtin errors, so builtins failing to evaluate (e.g.: parsing a
+// malformed token) fail the query with a PolicyError, rather than silently leaving the result undefined (a deny)
+func WithStrictBuiltinErrors() Option {
+	return func(c *HTTPClient) {
+		c.strictBuiltinErrors = true
+	}
+}
+
+// WithInstrumentation queries OPA with instrumentation, attaching its performance metrics to the decisions
+// (see Decision.Metrics), and reporting the policy evaluation duration
+func WithInstrumentation() Option {
+	return func(c *HTTPClient) {
+		c.instrument = true
+	}
+}
+
+// WithProvenance requests OPA's provenance along with every decision, and attaches it to the decision
+// (and its decision record), so it can tell which policy revision produced the decision
+func WithProvenance() Option {
+	return func(c *HTTPClient) {
+		c.provenance = true
+	}
+}
+
+// WithHealthProbing probes the health of the OPA endpoints every interval in the background, notifying the given
+// listeners once the health state changes. Queries are balanced between the healthy endpoints only (while any)
+func WithHealthProbing(interval time.Duration, listeners ...HealthListener) Option {
+	return func(c *HTTPClient) {
+		c.healthProber = newHealthProber(interval, listeners)
+	}
+}
+
+// WithRequestEncoder encodes the query requests (and decodes their responses) by the given encoder, for gateways in
+// front of OPA accepting encodings other than JSON. Status and configuration queries are always JSON, as served by OPA
+func WithRequestEncoder(requestEncoder RequestEncoder) Option {
+	return func(c *HTTPClient) {
+		c.requestEncoder = requestEncoder
+	}
+}
+
+// WithMaxResponseSize fails OPA responses larger than the given size in bytes (DefaultMaxResponseSize unless set),
+// guarding against misconfigured servers or gateways responding with huge bodies
+func WithMaxResponseSize(maxResponseSize int64) Option {
+	return func(c *HTTPClient) {
+		c.maxResponseSize = maxResponseSize
+	}
+}
+
+// WithRevisionPolling polls OPA's status every interval, flushing the decision cache once the revision of the
+// active bundles changes. Combined with WithProvenance, cached decisions are keyed by the revision as well
+func WithRevisionPolling(interval time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.revisionPollInterval = interval
+	}
+}
+
+// WithStaleDecisions serves cached decisions expired no longer than maxStaleness ago, when OPA is unavailable
+// (after retries), before resorting to the fallback policy.
+// Must follow WithDecisionCache, whose cache must implement StaleDecisionCache
+func WithStaleDecisions(maxStaleness time.Duration) Option {
+	return func(c *HTTPClient) {
+		c.maxStaleness = maxStaleness
+		if staleDecisionCache, ok := c.decisionCache.(StaleDecisionCache); ok {
+			staleDecisionCache.RetainStale(maxStaleness)
+		}
+	}
+}
+
+// WithFallbackPolicy decides by the given local rule set when OPA is unavailable (after retries) - on transport
+// errors, timeouts, 5xx responses or local load shedding. Queries failed otherwise, or not matched by any rule,
+// fail as usual
+func WithFallbackPolicy(fallbackPolicy *FallbackPolicy) Option {
+	return func(c *HTTPClient) {
+		c.fallbackPolicy = fallbackPolicy
+	}
+}
+
+// WithEnforcementMode sets the enforcement mode. In monitor mode, every query is allowed (even if it failed),
+// and the policy decisions are only recorded
+func WithEnforcementMode(enforcementMode EnforcementMode) Option {
+	return func(c *HTTPClient) {
+		c.enforcementMode = enforcementMode
+	}
+}
+
+// WithResourceActionsPath queries multiple resources, each with its own action (see
+// QueryPermissionsResourceActions), in a single request to the given path - whose policy returns the allowed
+// resource actions of input.resourceActions
+func WithResourceActionsPath(permissionResourceActionsPath string) Option {
+	return func(c *HTTPClient) {
+		c.permissionResourceActionsPath = permissionResourceActionsPath
+	}
+}
+
+// WithAllowedActionsPath queries the allowed actions of a resource (see AllowedActions) from the given path - whose
+// policy returns the allowed actions of input.resource
+func WithAllowedActionsPath(permissionAllowedActionsPath string) Option {
+	return func(c *HTTPClient) {
+		c.permissionAllowedActionsPath = permissionAllowedActionsPath
+	}
+}
+
+// WithMultiSubjectsPath queries a resource for multiple subjects (see QueryPermissionsMultiSubjects) in a single
+// request to the given path - whose policy returns the allowed subjects of input.subjects
+func WithMultiSubjectsPath(permissionMultiSubjectsPath string) Option {
+	return func(c *HTTPClient) {
+		c.permissionMultiSubjectsPath = permissionMultiSubjectsPath
+	}
+}
+
+// WithPaginatedFilterPath lists the allowed resources (see ListAllowedResources) from the paginated filter policy
+// at the given path, a page of the given size (DefaultFilterPageSize unless positive) at a time
+func WithPaginatedFilterPath(permissionPaginatedFilterPath string, pageSize int) Option {
+	return func(c *HTTPClient) {
+		if pageSize <= 0 {
+			pageSize = DefaultFilterPageSize
+		}
+		c.permissionPaginatedFilterPath = permissionPaginatedFilterPath
+		c.filterPageSize = pageSize
+	}
+}
+
+// WithShadow sends every (uncached) query to the given shadow address and paths as well, in the background.
+// The primary decision is enforced, and divergences of the shadow decision are logged and reported. The shadow
+// queries have request slots, throttling and a retry budget of their own, so a failing shadow never holds back the
+// primary queries. Empty address or paths default to the primary ones
+func WithShadow(address string, permissionQueryPath string, permissionFilterPath string) Option {
+	return func(c *HTTPClient) {
+		if address == "" {
+			address = c.address
+		}
+		if permissionQueryPath == "" {
+			permissionQueryPath = c.permissionQueryPath
+		}
+		if permissionFilterPath == "" {
+			permissionFilterPath = c.permissionFilterPath
+		}
+		c.shadowClient = c.backgroundQueryClient("shadow", address, permissionQueryPath, permissionFilterPath)
+	}
+}
+
+// WithCanary evaluates the given percentage (0-100) of the (uncached) queries against the given canary policy paths
+// as well, in the background, e.g.: to validate a new policy package on live traffic before cutting over to it.
+// The primary decision is enforced, and the agreement of the canary decision is reported. Like shadow queries, the
+// canary queries have request slots, throttling and a retry budget of their own. Empty paths default to the primary
+// ones
+func WithCanary(permissionQueryPath string, permissionFilterPath string, percentage float64) Option {
+	return func(c *HTTPClient) {
+		if permissionQueryPath == "" {
+			permissionQueryPath = c.permissionQueryPath
+		}
+		if permissionFilterPath == "" {
+			permissionFilterPath = c.permissionFilterPath
+		}
+		c.canary = &canary{
+			client:     c.backgroundQueryClient("canary", c.address, permissionQueryPath, permissionFilterPath),
+			percentage: min(max(percentage, 0), 100),
+		}
+	}
+}
+
+// WithEndpointProvider balances queries between the OPA servers provided by the given endpoint provider
+// (e.g.: discovered by k8sdiscovery.Discovery), falling back to the configured address while none are provided
+func WithEndpointProvider(endpointProvider EndpointProvider) Option {
+	return func(c *HTTPClient) {
+		c.endpointProvider = endpointProvider
+		c.nextEndpoint = &atomic.Uint64{}
+	}
+}
+
+// WithRetryHook invokes the given hook with every failed attempt to query OPA (numbered from 1) which is about to be
+// retried, along with its error and the delay until the retry (e.g.: to alert on elevated retry rates)
+func WithRetryHook(onRetry func(attempt int, err error, nextDelay time.Duration)) Option {
+	return func(c *HTTPClient) {
+		c.onRetry = onRetry
+	}
+}
+
+// WithRetryBudget bounds the retries of queries over the given window to the given ratio (e.g.: 0.2) of the queries
+// over it, plus the given minimum number of retries, so a partial OPA brownout doesn't multiply the requests sent to
+// it. Failed queries beyond the budget fail without retrying. The budget is shared by derived clients.
+// A zero window or negative minimum defaults to DefaultRetryBudgetWindow or DefaultRetryBudgetMinRetries
+func WithRetryBudget(ratio float64, window time.Duration, minRetries int) Option {
+	return func(c *HTTPClient) {
+		if window <= 0 {
+			window = DefaultRetryBudgetWindow
+		}
+		if minRetries < 0 {
+			minRetries = DefaultRetryBudgetMinRetries
+		}
+		c.retryBudget = newRetryBudget(ratio, window, minRetries)
+	}
+}
+
+// WithStatsWindow gathers the statistics returned by Stats over the given window (a minute, by default).
+// The statistics are shared by derived clients
+func WithStatsWindow(window time.Duration) Option {
+	return func(c *HTTPClient) {
+		if window <= 0 {
+			window = DefaultStatsWindow
+		}
+		c.queryStats = newQueryStats(window)
+	}
+}
+
+// WithRequestDump writes the fully rendered requests sent to OPA, along with their responses, to the given writer
+// in pretty JSON - for the queries of contexts asking for it (see ContextWithRequestDump) only, e.g.: to reproduce
+// a specific denial. Secret headers are redacted
+func WithRequestDump(writer io.Writer) Option {
+	return func(c *HTTPClient) {
+		c.requestDumper = &requestDumper{writer: writer}
+	}
+}
+
+// WithDecisionIDs sends every query to OPA along with a generated decision id (unless the context carries one, see
+// ContextWithDecisionID), in the X-Decision-ID header and the decision_id input field, for policies to echo into
+// their decision logs. The decision id is returned in the Decision (and DecisionRecord) of the query
+func WithDecisionIDs() Option {
+	return func(c *HTTPClient) {
+		c.decisionIDs = true
+	}
+}
+
+// WithGETQueries sends single-resource queries whose url-encoded input is up to the given size (a zero size defaults
+// to DefaultGETQueryMaxInputSize) as GET requests, with the input in the query string, for intermediaries (e.g.: OPA
+// gateways) to cache. Larger queries, and queries of a non-JSON request encoder, are sent as POST requests
+func WithGETQueries(maxInputSize int) Option {
+	return func(c *HTTPClient) {
+		if maxInputSize <= 0 {
+			maxInputSize = DefaultGETQueryMaxInputSize
+		}
+		c.getQueryMaxInputSize = maxInputSize
+	}
+}
+
+// WithRoutes routes the permission queries of the resources and actions matching the given routes (the first
+// matching one) to their OPA servers and policies, querying the rest by the client. Multi-resource queries are
+// split into a filter request per route. The routed clients share the transport, decision cache, sinks and
+// background work of the client. Other queries (e.g.: allowed actions) are not routed
+func WithRoutes(routes ...Route) Option {
+	return func(c *HTTPClient) {
+		c.routes = append(c.routes, routes...)
+	}
+}
+
+// WithSidecarDetection probes the given sidecar addresses (or DefaultSidecarAddresses if none are given) at startup,
+// in order, and queries the first healthy one rather than the configured address, falling back to the configured
+// address if none is healthy. Addresses prefixed by unix:// are unix domain socket paths
+func WithSidecarDetection(sidecarAddresses ...string) Option {
+	return func(c *HTTPClient) {
+		if len(sidecarAddresses) == 0 {
+			sidecarAddresses = DefaultSidecarAddresses
+		}
+		c.sidecarAddresses = sidecarAddresses
+	}
+}
+
+// WithPolicyPathValidation validates the policy paths at startup (see HTTPClient.ValidatePolicyPaths), logging the
+// paths OPA responds are not found. To fail startup instead, call ValidatePolicyPaths
+func WithPolicyPathValidation() Option {
+	return func(c *HTTPClient) {
+		c.validatePolicyPaths = true
+	}
+}
+
+// WithSecretReferences resolves the given secrets by their references (e.g.: file:///var/run/secrets/opa/token, see
+// DefaultSecretResolvers), and re-resolves them every refresh interval (unless 0) so rotated secrets take effect
+// without restarting, keeping the previous secrets while they fail to resolve. The resolved override values and keys
+// are accepted along with the configured ones, and the resolved bearer token and signing key take precedence.
+// The resolved OAuth2 client secret is used by the ClientCredentialsTokenSource of the client (see WithTokenSource)
+func WithSecretReferences(references SecretReferences, resolvers SecretResolvers, refreshInterval time.Duration) Option {
+	return func(c *HTTPClient) {
+		if resolvers == nil {
+			resolvers = DefaultSecretResolvers()
+		}
+		c.secretRotation = &secretRotation{
+			references:      references,
+			resolvers:       resolvers,
+			refreshInterval: refreshInterval,
+		}
+		_, resolveErrs := c.secretRotation.resolve(context.Background())
+		for secretName, err := range resolveErrs {
+			c.logger.WarnWith("Failed to resolve secret reference",
+				"secret", secretName,
+				"err", err.Error())
+		}
+		if references.BearerToken != "" {
+			c.tokenSource = c.secretRotation
+		}
+	}
+}
+
+// WithDecisionHooks invokes the given hooks with the record of every permission decision
+func WithDecisionHooks(decisionHooks ...DecisionHooks) Option {
+	return func(c *HTTPClient) {
+		c.decisionHooks = append(c.decisionHooks, decisionHooks...)
+	}
+}
+
+// WithMetricsSink reports the client metrics to the given sink
+func WithMetricsSink(metricsSink MetricsSink) Option {
+	return func(c *HTTPClient) {
+		c.metricsSink = metricsSink
+	}
+}
+
+// WithDecisionLogSink writes a record of every permission decision to the given sink.
+// Unless already buffered, the sink is wrapped with a BufferedDecisionLogSink (with default settings)
+func WithDecisionLogSink(decisionLogSink DecisionLogSink) Option {
+	return func(c *HTTPClient) {
+		if _, buffered := decisionLogSink.(*BufferedDecisionLogSink); !buffered {
+			decisionLogSink = NewBufferedDecisionLogSink(c.logger, decisionLogSink, 0, 0, 0)
+		}
+		c.decisionLogSink = decisionLogSink
+	}
+}
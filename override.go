@@ -0,0 +1,168 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nuclio/errors"
+)
+
+// OverrideTokenClaims are the claims signed into an override token
+type OverrideTokenClaims struct {
+
+	// Issuer identifies the service the token was issued to (or by)
+	Issuer string `json:"iss"`
+
+	// ExpiresAt is the expiry of the token, in seconds since the epoch
+	ExpiresAt int64 `json:"exp"`
+}
+
+// SignOverrideToken returns an override token carrying the given claims, signed with HMAC-SHA256 by the given key.
+// Unlike static override values, a leaked token cannot be replayed once it expires
+func SignOverrideToken(key []byte, claims OverrideTokenClaims) (string, error) {
+	encodedClaims, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to encode override token claims")
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(encodedClaims)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(overrideTokenSignature(key, payload)), nil
+}
+
+// VerifyOverrideToken verifies the signature of an override token by any of the given keys, and its expiry
+// by the given time, returning its claims
+func VerifyOverrideToken(keys [][]byte, token string, now time.Time) (*OverrideTokenClaims, error) {
+	payload, encodedSignature, found := strings.Cut(token, ".")
+	if !found {
+		return nil, errors.New("Malformed override token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode override token signature")
+	}
+
+	verified := false
+	for _, key := range keys {
+		verified = hmac.Equal(signature, overrideTokenSignature(key, payload)) || verified
+	}
+	if !verified {
+		return nil, errors.New("Invalid override token signature")
+	}
+
+	encodedClaims, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to decode override token claims")
+	}
+	claims := &OverrideTokenClaims{}
+	if err := json.Unmarshal(encodedClaims, claims); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal override token claims")
+	}
+	if !now.Before(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, errors.Errorf("Override token of issuer %s expired", claims.Issuer)
+	}
+	return claims, nil
+}
+
+func overrideTokenSignature(key []byte, payload string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(payload)) // nolint: errcheck
+	return mac.Sum(nil)
+}
+
+// overrideValue returns the override value of the query - set explicitly, or read from the request headers
+func (c *HTTPClient) overrideValue(permissionOptions *PermissionOptions) string {
+	if permissionOptions.OverrideHeaderValue != "" {
+		return permissionOptions.OverrideHeaderValue
+	}
+	if c.overrideHeaderName != "" && permissionOptions.RequestHeaders != nil {
+		return permissionOptions.RequestHeaders.Get(c.overrideHeaderName)
+	}
+	return ""
+}
+
+// overridden returns whether the query carries any of the accepted override values, or a valid override token
+// (along with its issuer), in which case it is allowed without checking. Values are compared in constant time,
+// and against all accepted values, so the comparison does not leak them
+func (c *HTTPClient) overridden(permissionOptions *PermissionOptions) (string, bool) {
+	overrideValue := c.overrideValue(permissionOptions)
+	if overrideValue == "" {
+		return "", false
+	}
+
+	acceptedOverrideValues, overrideTokenKeys := c.acceptedOverrides()
+	matched := 0
+	for _, acceptedOverrideValue := range acceptedOverrideValues {
+		matched |= subtle.ConstantTimeCompare([]byte(overrideValue), []byte(acceptedOverrideValue))
+	}
+	if matched == 1 {
+		return "", true
+	}
+
+	if len(overrideTokenKeys) == 0 {
+		return "", false
+	}
+	claims, err := VerifyOverrideToken(overrideTokenKeys, overrideValue, c.clock.Now())
+	if err != nil {
+		c.logger.DebugWith("Rejected override token", "err", err.Error())
+		return "", false
+	}
+	if len(c.overrideTokenIssuers) > 0 && !slices.Contains(c.overrideTokenIssuers, claims.Issuer) {
+		c.logger.DebugWith("Rejected override token of unaccepted issuer", "issuer", claims.Issuer)
+		return "", false
+	}
+	return claims.Issuer, true
+}
+
+// auditOverride records the decisions allowed by the override. Unlike other decisions, these are always recorded
+// (regardless of verbosity), since bypassed authorization must be auditable - and the decision log logs those it
+// drops rather than dropping them silently
+func (c *HTTPClient) auditOverride(ctx context.Context,
+	decisions []*Decision,
+	permissionOptions *PermissionOptions,
+	overrideIssuer string) {
+	if len(decisions) == 0 {
+		return
+	}
+
+	decisionRecords := make([]DecisionRecord, len(decisions))
+	resources := make([]string, len(decisions))
+	for decisionIdx, decision := range decisions {
+		decisionRecords[decisionIdx] = newDecisionRecord(c.clock, decision, permissionOptions, nil)
+		decisionRecords[decisionIdx].OverrideIssuer = overrideIssuer
+		resources[decisionIdx] = decision.Resource
+	}
+	c.metricsSink.IncrementCounter(MetricOverrides, int64(len(decisions)), nil)
+	c.logDecisions(ctx, decisionRecords)
+
+	// without a decision log, the client log is the audit trail
+	if c.decisionLogSink == nil {
+		c.logger.InfoWithCtx(ctx, "Allowed permission query by override",
+			"resources", resources,
+			"action", decisions[0].Action,
+			"memberIds", permissionOptions.memberIds(),
+			"overrideIssuer", overrideIssuer)
+	}
+}
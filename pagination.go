@@ -0,0 +1,130 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+
+	"github.com/nuclio/errors"
+)
+
+// DefaultFilterPageSize is the number of allowed resources requested per page, unless configured
+const DefaultFilterPageSize = 1000
+
+// ResourcePageFunc is invoked with every page of allowed resources. Returning an error stops listing
+type ResourcePageFunc func(resources []string) error
+
+type PermissionPageRequest struct {
+	Input PermissionPageRequestInput `json:"input,omitempty"`
+}
+
+type PermissionPageRequestInput struct {
+	Action  string   `json:"action,omitempty"`
+	Ids     []string `json:"ids,omitempty"`
+	Subject *Subject `json:"subject,omitempty"`
+	Offset  int      `json:"offset"`
+	Limit   int      `json:"limit"`
+
+	// Extra fields are merged into the input
+	Extra map[string]any `json:"-"`
+}
+
+func (i PermissionPageRequestInput) MarshalJSON() ([]byte, error) {
+	type permissionPageRequestInput PermissionPageRequestInput
+	return marshalInputWithExtra(permissionPageRequestInput(i), i.Extra)
+}
+
+// PermissionPageResponse is a page of the allowed resources, along with the offset of the next page
+// (unset on the last page)
+type PermissionPageResponse struct {
+	Result     PermissionPageResult `json:"result"`
+	Provenance *Provenance          `json:"provenance,omitempty"`
+}
+
+type PermissionPageResult struct {
+	Resources  []string `json:"resources,omitempty"`
+	NextOffset *int     `json:"next_offset,omitempty"`
+}
+
+// ListAllowedResources lists the resources the action is allowed for, page by page, from a paginated filter policy
+// (see WithPaginatedFilterPath) - which enumerates the resources by itself (e.g.: from its data), and returns the
+// page at input.offset of at most input.limit resources, along with the offset of the next page (unset on the last
+// page). Neither the client nor OPA hold more than a page at a time, so huge resource sets can be listed.
+// A scoped client lists only the resources within its scope
+func (c *HTTPClient) ListAllowedResources(ctx context.Context,
+	action Action,
+	permissionOptions *PermissionOptions,
+	pageFunc ResourcePageFunc) error {
+	if c.permissionPaginatedFilterPath == "" {
+		return errors.New("Paginated filter path is not configured")
+	}
+
+	ctx, permissionOptions, err := c.resolvePermissionOptions(ctx, permissionOptions)
+	if err != nil {
+		return err
+	}
+
+	requestInput := PermissionPageRequestInput{
+		Action:  string(action),
+		Ids:     permissionOptions.memberIds(),
+		Subject: permissionOptions.Subject,
+		Limit:   c.filterPageSize,
+		Extra:   queryExtraInput(ctx, permissionOptions),
+	}
+	for {
+		permissionPageResponse := PermissionPageResponse{}
+		if err := c.sendQuery(ctx,
+			c.permissionPaginatedFilterPath,
+			&PermissionPageRequest{Input: requestInput},
+			&permissionPageResponse); err != nil {
+			return errors.Wrapf(err, "Failed to query allowed resources page at offset %d", requestInput.Offset)
+		}
+
+		resources := c.inScopeResources(permissionPageResponse.Result.Resources)
+		if len(resources) > 0 {
+			if err := pageFunc(resources); err != nil {
+				return err
+			}
+		}
+
+		nextOffset := permissionPageResponse.Result.NextOffset
+		if nextOffset == nil {
+			return nil
+		}
+
+		// a policy not advancing would be listed forever
+		if *nextOffset <= requestInput.Offset {
+			return errors.Errorf("Next page offset %d does not follow offset %d", *nextOffset, requestInput.Offset)
+		}
+		requestInput.Offset = *nextOffset
+	}
+}
+
+// inScopeResources returns the given resources within the client scope
+func (c *HTTPClient) inScopeResources(resources []string) []string {
+	if c.resourceScope == "" {
+		return resources
+	}
+
+	inScopeResources := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		if scopedResource, err := c.scopeResource(resource); err == nil && scopedResource == resource {
+			inScopeResources = append(inScopeResources, resource)
+		}
+	}
+	return inScopeResources
+}
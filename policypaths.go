@@ -0,0 +1,98 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/nuclio/errors"
+)
+
+// ValidatePolicyPaths queries the configured policy paths (and those of the routes) without input, failing with a
+// PolicyPathNotFoundError once OPA responds a path is not found (e.g.: a typo in a path), rather than failing every
+// query later on. Paths whose document is undefined without input are logged, as they may not exist either.
+// Tenant policy paths (see TenantPathPlaceholder) are skipped
+func (c *HTTPClient) ValidatePolicyPaths(ctx context.Context) error {
+	clients := []*HTTPClient{c}
+	for _, routedClient := range c.routedClients {
+		clients = append(clients, routedClient.client)
+	}
+
+	validatedURLs := map[string]bool{}
+	for _, client := range clients {
+		endpoint := client.endpointAddress()
+		for _, path := range []string{client.permissionQueryPath, client.permissionFilterPath} {
+			if path == "" || validatedURLs[endpoint+path] {
+				continue
+			}
+
+			// tenant path templates are expanded per query
+			if isTenantPathTemplate(path) {
+				client.logger.DebugWithCtx(ctx, "Skipping validation of tenant policy path", "path", path)
+				continue
+			}
+			validatedURLs[endpoint+path] = true
+
+			if err := client.validatePolicyPath(ctx, endpoint, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validatePolicyPath queries the policy path of the endpoint without input
+func (c *HTTPClient) validatePolicyPath(ctx context.Context, endpoint string, path string) error {
+	validationCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	headers, err := c.requestHeaders(validationCtx)
+	if err != nil {
+		return err
+	}
+
+	responseBody, _, err := sendHTTPRequest(validationCtx,
+		c.httpClient,
+		http.MethodGet,
+		endpoint+path,
+		nil,
+		headers,
+		[]*http.Cookie{},
+		http.StatusOK,
+		c.maxResponseSize)
+	if err != nil {
+		if pathNotFoundError := newPolicyPathNotFoundError(responseBody, err, path, endpoint); pathNotFoundError != nil {
+			return errors.Wrap(pathNotFoundError, "Failed to validate policy path")
+		}
+		return errors.Wrapf(opaResponseError(responseBody, err), "Failed to validate policy path %s", path)
+	}
+
+	dataResponse := struct {
+		Result *json.RawMessage `json:"result"`
+	}{}
+	if err := json.Unmarshal(responseBody, &dataResponse); err != nil {
+		return errors.Wrapf(err, "Failed to unmarshal response body of policy path %s", path)
+	}
+	if dataResponse.Result == nil {
+		c.logger.WarnWithCtx(ctx, "Policy path is undefined without input, it may not exist",
+			"path", path,
+			"endpoint", endpoint)
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policytest runs declarative expectation suites - YAML fixtures of subjects, resources, actions and their
+// expected decisions - against a client, so policy changes can be gated by them.
+//
+// A fixture file looks like:
+//
+//	name: project permissions
+//	defaults:
+//	  action: read
+//	cases:
+//	  - name: admins can update projects
+//	    subject: {userId: alice, groupIds: [admins]}
+//	    resource: projects/p1
+//	    action: update
+//	    expect: allow
+//	  - subject: {userId: bob}
+//	    resource: projects/p1
+//	    expect: deny
+//	    reason: not a project member
+package policytest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/nuclio/errors"
+	opaclient "github.com/nuclio/opa-client"
+	"gopkg.in/yaml.v3"
+)
+
+type Expectation string
+
+const (
+	ExpectAllow Expectation = "allow"
+	ExpectDeny  Expectation = "deny"
+)
+
+// Suite is a set of expectation cases, loaded from a fixture file
+type Suite struct {
+	Name string `yaml:"name"`
+
+	// Defaults complete the cases, for the fields they leave unset
+	Defaults Case   `yaml:"defaults"`
+	Cases    []Case `yaml:"cases"`
+}
+
+// Case is a query along with its expected decision
+type Case struct {
+	Name          string                  `yaml:"name"`
+	Subject       *Subject                `yaml:"subject"`
+	MemberIds     []string                `yaml:"memberIds"`
+	Resource      string                  `yaml:"resource"`
+	Action        opaclient.Action        `yaml:"action"`
+	HierarchyMode opaclient.HierarchyMode `yaml:"hierarchy"`
+	Input         map[string]any          `yaml:"input"`
+	Expect        Expectation             `yaml:"expect"`
+
+	// Reason is the expected deny reason, checked when set
+	Reason string `yaml:"reason"`
+}
+
+type Subject struct {
+	UserID   string   `yaml:"userId"`
+	GroupIDs []string `yaml:"groupIds"`
+	Roles    []string `yaml:"roles"`
+	Tenant   string   `yaml:"tenant"`
+}
+
+// Result is the outcome of running a case
+type Result struct {
+	Case     *Case
+	Decision *opaclient.Decision
+	Err      error
+}
+
+// LoadSuite reads a suite from the given fixture file
+func LoadSuite(path string) (*Suite, error) {
+	fixture, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to read fixture file")
+	}
+
+	suite, err := ParseSuite(fixture)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to parse fixture file %s", path)
+	}
+	if suite.Name == "" {
+		suite.Name = path
+	}
+	return suite, nil
+}
+
+// ParseSuite parses a YAML fixture, completing its cases by the defaults
+func ParseSuite(fixture []byte) (*Suite, error) {
+	suite := &Suite{}
+	decoder := yaml.NewDecoder(bytes.NewReader(fixture))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(suite); err != nil {
+		return nil, errors.Wrap(err, "Failed to decode fixture")
+	}
+
+	for caseIndex := range suite.Cases {
+		testCase := &suite.Cases[caseIndex]
+		testCase.applyDefaults(&suite.Defaults)
+		if testCase.Resource == "" {
+			return nil, errors.Errorf("Case %d has no resource", caseIndex)
+		}
+		if testCase.Action == "" {
+			return nil, errors.Errorf("Case %d has no action", caseIndex)
+		}
+		if testCase.Expect != ExpectAllow && testCase.Expect != ExpectDeny {
+			return nil, errors.Errorf("Case %d expects neither %s nor %s", caseIndex, ExpectAllow, ExpectDeny)
+		}
+		if testCase.Name == "" {
+			testCase.Name = fmt.Sprintf("%s %s", testCase.Action, testCase.Resource)
+		}
+	}
+	return suite, nil
+}
+
+// Run runs the cases of the suite against the given client, in order
+func Run(ctx context.Context, client opaclient.Client, suite *Suite) []*Result {
+	results := make([]*Result, 0, len(suite.Cases))
+	for caseIndex := range suite.Cases {
+		testCase := &suite.Cases[caseIndex]
+		decision, err := opaclient.QueryDecision(ctx,
+			client,
+			testCase.Resource,
+			testCase.Action,
+			testCase.permissionOptions())
+		results = append(results, &Result{
+			Case:     testCase,
+			Decision: decision,
+			Err:      err,
+		})
+	}
+	return results
+}
+
+// RunTests runs the cases of the given fixture files against the client as sub-tests,
+// failing those whose decision is not the expected one
+func RunTests(t *testing.T, client opaclient.Client, fixturePaths ...string) {
+	t.Helper()
+	for _, fixturePath := range fixturePaths {
+		suite, err := LoadSuite(fixturePath)
+		if err != nil {
+			t.Fatalf("Failed to load suite: %s", err.Error())
+		}
+
+		t.Run(suite.Name, func(t *testing.T) {
+			for _, result := range Run(context.Background(), client, suite) {
+				t.Run(result.Case.Name, func(t *testing.T) {
+					if failure := result.Failure(); failure != "" {
+						t.Error(failure)
+					}
+				})
+			}
+		})
+	}
+}
+
+// Passed returns whether the decision is the expected one
+func (r *Result) Passed() bool {
+	return r.Failure() == ""
+}
+
+// Failure describes how the decision differs from the expected one, or returns an empty string if it does not
+func (r *Result) Failure() string {
+	if r.Err != nil {
+		return fmt.Sprintf("Query failed: %s", r.Err.Error())
+	}
+
+	decision := ExpectDeny
+	if r.Decision.Allowed {
+		decision = ExpectAllow
+	}
+	if decision != r.Case.Expect {
+		return fmt.Sprintf("Expected %s, got %s", r.Case.Expect, decision)
+	}
+	if r.Case.Reason != "" && r.Decision.Reason != r.Case.Reason {
+		return fmt.Sprintf("Expected reason %q, got %q", r.Case.Reason, r.Decision.Reason)
+	}
+	return ""
+}
+
+func (c *Case) applyDefaults(defaults *Case) {
+	if c.Subject == nil && len(c.MemberIds) == 0 {
+		c.Subject = defaults.Subject
+		c.MemberIds = defaults.MemberIds
+	}
+	if c.Resource == "" {
+		c.Resource = defaults.Resource
+	}
+	if c.Action == "" {
+		c.Action = defaults.Action
+	}
+	if c.HierarchyMode == "" {
+		c.HierarchyMode = defaults.HierarchyMode
+	}
+	if len(defaults.Input) > 0 {
+		input := make(map[string]any, len(defaults.Input)+len(c.Input))
+		for fieldName, fieldValue := range defaults.Input {
+			input[fieldName] = fieldValue
+		}
+		for fieldName, fieldValue := range c.Input {
+			input[fieldName] = fieldValue
+		}
+		c.Input = input
+	}
+	if c.Expect == "" {
+		c.Expect = defaults.Expect
+	}
+}
+
+func (c *Case) permissionOptions() *opaclient.PermissionOptions {
+	permissionOptions := &opaclient.PermissionOptions{
+		MemberIds:     c.MemberIds,
+		HierarchyMode: c.HierarchyMode,
+		ExtraInput:    c.Input,
+	}
+	if c.Subject != nil {
+		permissionOptions.Subject = &opaclient.Subject{
+			UserID:   c.Subject.UserID,
+			GroupIDs: c.Subject.GroupIDs,
+			Roles:    c.Subject.Roles,
+			Tenant:   c.Subject.Tenant,
+		}
+	}
+	return permissionOptions
+}
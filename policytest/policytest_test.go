@@ -0,0 +1,114 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policytest
+
+import (
+	"context"
+	"testing"
+
+	opaclient "github.com/nuclio/opa-client"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/suite"
+)
+
+type PolicyTestTestSuite struct {
+	suite.Suite
+	ctx    context.Context
+	client *opaclient.MockClient
+}
+
+func (suite *PolicyTestTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.client = &opaclient.MockClient{}
+}
+
+func (suite *PolicyTestTestSuite) TestParseSuite() {
+	testSuite, err := ParseSuite([]byte(`
+name: projects
+defaults:
+  action: read
+  subject: {userId: alice, groupIds: [admins]}
+  input: {ip: 10.0.0.1}
+cases:
+  - resource: projects/p1
+    expect: allow
+  - name: members cannot delete
+    memberIds: [bob]
+    resource: projects/p1
+    action: delete
+    input: {mfa: true}
+    expect: deny
+`))
+	suite.Require().NoError(err)
+	suite.Require().Equal("projects", testSuite.Name)
+	suite.Require().Len(testSuite.Cases, 2)
+
+	// defaults complete the unset fields
+	suite.Require().Equal("read projects/p1", testSuite.Cases[0].Name)
+	suite.Require().Equal(opaclient.ActionRead, testSuite.Cases[0].Action)
+	suite.Require().Equal("alice", testSuite.Cases[0].Subject.UserID)
+	suite.Require().Equal(opaclient.ActionDelete, testSuite.Cases[1].Action)
+	suite.Require().Nil(testSuite.Cases[1].Subject)
+	suite.Require().Equal(map[string]any{"ip": "10.0.0.1", "mfa": true}, testSuite.Cases[1].Input)
+
+	for _, invalidFixture := range []string{
+		`cases: [{action: read, expect: allow}]`,
+		`cases: [{resource: projects/p1, action: read, expect: maybe}]`,
+		`cases: [{resource: projects/p1, action: read, expect: allow, unknown: field}]`,
+	} {
+		_, err := ParseSuite([]byte(invalidFixture))
+		suite.Require().Error(err, invalidFixture)
+	}
+}
+
+func (suite *PolicyTestTestSuite) TestRun() {
+	testSuite, err := ParseSuite([]byte(`
+defaults:
+  action: read
+  subject: {userId: alice}
+cases:
+  - {resource: projects/allowed, expect: allow}
+  - {resource: projects/denied, expect: allow}
+  - {resource: projects/locked, expect: deny, reason: locked}
+  - {resource: projects/locked, expect: deny, reason: not a member}
+`))
+	suite.Require().NoError(err)
+
+	suite.client.On("QueryDecision", suite.ctx, "projects/allowed", opaclient.ActionRead, mock.Anything).
+		Return(&opaclient.Decision{Allowed: true}, nil)
+	suite.client.On("QueryDecision", suite.ctx, "projects/denied", opaclient.ActionRead, mock.Anything).
+		Return(&opaclient.Decision{Allowed: false}, nil)
+	suite.client.On("QueryDecision", suite.ctx, "projects/locked", opaclient.ActionRead, mock.Anything).
+		Return(&opaclient.Decision{Allowed: false, Reason: "locked"}, nil)
+
+	results := Run(suite.ctx, suite.client, testSuite)
+	suite.Require().Len(results, 4)
+	suite.Require().True(results[0].Passed())
+	suite.Require().Equal("Expected allow, got deny", results[1].Failure())
+	suite.Require().True(results[2].Passed())
+	suite.Require().Equal(`Expected reason "not a member", got "locked"`, results[3].Failure())
+
+	// the case subject is queried with
+	permissionOptions := suite.client.Calls[0].Arguments.Get(3).(*opaclient.PermissionOptions)
+	suite.Require().Equal("alice", permissionOptions.Subject.UserID)
+}
+
+func TestPolicyTestTestSuite(t *testing.T) {
+	suite.Run(t, new(PolicyTestTestSuite))
+}
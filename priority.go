@@ -0,0 +1,166 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/nuclio/errors"
+)
+
+type Priority string
+
+const (
+
+	// PriorityHigh is the priority of interactive queries (e.g.: authorizing user requests), which is the default
+	PriorityHigh Priority = "high"
+
+	// PriorityLow is the priority of background queries (e.g.: reconciliation), which yield to high priority ones
+	// under the concurrency limit and adaptive throttling
+	PriorityLow Priority = "low"
+)
+
+type priorityContextKey struct{}
+
+// withPriority returns a context carrying the priority of the queries sent by it
+func withPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityContextKey{}, priority)
+}
+
+// priorityFromContext returns the priority of the queries sent by the context (high, unless set)
+func priorityFromContext(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityContextKey{}).(Priority); ok && priority == PriorityLow {
+		return PriorityLow
+	}
+	return PriorityHigh
+}
+
+// prioritySemaphore bounds the number of concurrent holders, granting freed slots to the waiting high priority
+// holders first (in order of arrival), and only then to the low priority ones. Once the given number of holders
+// wait (unless unbounded), further ones are rejected with an OverloadedError - unless of high priority, displacing
+// the latest low priority waiter
+type prioritySemaphore struct {
+	capacity   int
+	maxWaiters int
+
+	lock                sync.Mutex
+	held                int
+	highPriorityWaiters list.List
+	lowPriorityWaiters  list.List
+}
+
+type semaphoreWaiter struct {
+
+	// done is closed once the waiter is granted a slot, or rejected by err
+	done chan struct{}
+	err  error
+}
+
+// newPrioritySemaphore returns a semaphore of the given capacity, with up to the given number of waiters
+// (unbounded, unless positive)
+func newPrioritySemaphore(capacity int, maxWaiters int) *prioritySemaphore {
+	return &prioritySemaphore{
+		capacity:   capacity,
+		maxWaiters: maxWaiters,
+	}
+}
+
+// empty returns a new semaphore of the same capacity and number of waiters, none of its slots held
+func (s *prioritySemaphore) empty() *prioritySemaphore {
+	return newPrioritySemaphore(s.capacity, s.maxWaiters)
+}
+
+// acquire waits for a slot until the context is done, failing with an OverloadedError if too many wait already
+func (s *prioritySemaphore) acquire(ctx context.Context, priority Priority) error {
+	s.lock.Lock()
+	waiters := &s.highPriorityWaiters
+	if priority == PriorityLow {
+		waiters = &s.lowPriorityWaiters
+	}
+
+	// low priority holders wait behind all waiters, and high priority ones behind the high priority waiters
+	if s.held < s.capacity && s.highPriorityWaiters.Len() == 0 && (priority != PriorityLow || waiters.Len() == 0) {
+		s.held++
+		s.lock.Unlock()
+		return nil
+	}
+
+	if s.maxWaiters > 0 && s.highPriorityWaiters.Len()+s.lowPriorityWaiters.Len() >= s.maxWaiters {
+		displacedWaiter := s.lowPriorityWaiters.Back()
+		if priority == PriorityLow || displacedWaiter == nil {
+			s.lock.Unlock()
+			return &OverloadedError{Priority: priority, QueueSize: s.maxWaiters}
+		}
+		s.lowPriorityWaiters.Remove(displacedWaiter)
+		s.reject(displacedWaiter.Value.(*semaphoreWaiter), PriorityLow)
+	}
+
+	waiter := &semaphoreWaiter{done: make(chan struct{})}
+	waiterElement := waiters.PushBack(waiter)
+	s.lock.Unlock()
+
+	select {
+	case <-waiter.done:
+		return waiter.err
+	case <-ctx.Done():
+		s.lock.Lock()
+		select {
+		case <-waiter.done:
+			s.lock.Unlock()
+
+			// granted meanwhile - pass the slot on
+			if waiter.err == nil {
+				s.release()
+			}
+		default:
+			waiters.Remove(waiterElement)
+			s.lock.Unlock()
+		}
+		return errors.Wrap(ctx.Err(), "Timed out waiting for a request slot")
+	}
+}
+
+// release frees a slot, handing it over to the next waiter (if any)
+func (s *prioritySemaphore) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, waiters := range []*list.List{&s.highPriorityWaiters, &s.lowPriorityWaiters} {
+		if waiterElement := waiters.Front(); waiterElement != nil {
+			waiters.Remove(waiterElement)
+			close(waiterElement.Value.(*semaphoreWaiter).done)
+			return
+		}
+	}
+	s.held--
+}
+
+// reject fails a (removed) waiter with an OverloadedError
+func (s *prioritySemaphore) reject(waiter *semaphoreWaiter, priority Priority) {
+	waiter.err = &OverloadedError{Priority: priority, QueueSize: s.maxWaiters}
+	close(waiter.done)
+}
+
+// inUse returns the number of held slots
+func (s *prioritySemaphore) inUse() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.held
+}
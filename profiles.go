@@ -0,0 +1,127 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/nuclio/errors"
+)
+
+// profileExtendsField is the field of a profile naming the profile it extends
+const profileExtendsField = "extends"
+
+// ConfigProfiles are named client configurations (e.g.: dev, staging and prod), so a single binary can carry the
+// configuration of all environments. A profile may extend another, overriding the fields it sets, e.g.:
+//
+//	{
+//		"profiles": {
+//			"base": {"clientKind": "http", "permissionQueryPath": "/v1/data/authz/allow"},
+//			"dev": {"extends": "base", "address": "http://localhost:8181"},
+//			"prod": {"extends": "base", "address": "https://opa.prod:8443", "cacheTTL": 60}
+//		}
+//	}
+type ConfigProfiles struct {
+	profiles map[string]map[string]json.RawMessage
+}
+
+// ParseConfigProfiles parses the profiles of a JSON configuration file (e.g.: embedded in the binary)
+func ParseConfigProfiles(contents []byte) (*ConfigProfiles, error) {
+	profilesFile := struct {
+		Profiles map[string]map[string]json.RawMessage `json:"profiles"`
+	}{}
+	if err := json.Unmarshal(contents, &profilesFile); err != nil {
+		return nil, errors.Wrap(err, "Failed to unmarshal configuration profiles")
+	}
+	if len(profilesFile.Profiles) == 0 {
+		return nil, errors.New("No configuration profiles are defined")
+	}
+	return &ConfigProfiles{
+		profiles: profilesFile.Profiles,
+	}, nil
+}
+
+// LoadConfigProfiles reads the profiles of the given YAML or JSON configuration file (by its extension)
+func LoadConfigProfiles(path string) (*ConfigProfiles, error) {
+	contents, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfigProfiles(contents)
+}
+
+// Names returns the names of the profiles, sorted
+func (p *ConfigProfiles) Names() []string {
+	names := make([]string, 0, len(p.profiles))
+	for name := range p.profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// LoadProfile returns the configuration of the given profile, merged over those of the profiles it extends
+func (p *ConfigProfiles) LoadProfile(name string) (*Config, error) {
+	profileFields, err := p.resolveProfile(name, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	encodedProfile, err := json.Marshal(profileFields)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to encode profile %s", name)
+	}
+	config := &Config{}
+	if err := json.Unmarshal(encodedProfile, config); err != nil {
+		return nil, errors.Wrapf(err, "Failed to unmarshal profile %s", name)
+	}
+	return config, nil
+}
+
+// resolveProfile returns the fields of the given profile, merged over those of the profiles it extends.
+// The extending profiles (which must not be extended again) are given
+func (p *ConfigProfiles) resolveProfile(name string, extendingProfiles []string) (map[string]json.RawMessage, error) {
+	if slices.Contains(extendingProfiles, name) {
+		return nil, errors.Errorf("Profiles extend each other: %s",
+			strings.Join(append(extendingProfiles, name), " -> "))
+	}
+	profile, found := p.profiles[name]
+	if !found {
+		return nil, errors.Errorf("Profile %s not found (profiles: %s)", name, strings.Join(p.Names(), ", "))
+	}
+
+	profileFields := map[string]json.RawMessage{}
+	if encodedExtendedName, found := profile[profileExtendsField]; found {
+		var extendedName string
+		if err := json.Unmarshal(encodedExtendedName, &extendedName); err != nil {
+			return nil, errors.Wrapf(err, "Failed to unmarshal the profile extended by profile %s", name)
+		}
+		var err error
+		if profileFields, err = p.resolveProfile(extendedName, append(extendingProfiles, name)); err != nil {
+			return nil, err
+		}
+	}
+
+	for fieldName, fieldValue := range profile {
+		if fieldName != profileExtendsField {
+			profileFields[fieldName] = fieldValue
+		}
+	}
+	return profileFields, nil
+}
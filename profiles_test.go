@@ -0,0 +1,100 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ConfigProfilesTestSuite struct {
+	suite.Suite
+	profiles *ConfigProfiles
+}
+
+func (suite *ConfigProfilesTestSuite) SetupTest() {
+	profilesPath := filepath.Join(suite.T().TempDir(), "opa.json")
+	err := os.WriteFile(profilesPath, []byte(`{
+		"profiles": {
+			"base": {
+				"clientKind": "http",
+				"permissionQueryPath": "/v1/data/authz/allow",
+				"requestTimeout": 10,
+				"cacheTTL": 30
+			},
+			"dev": {"extends": "base", "address": "http://localhost:8181", "verbose": true},
+			"prod": {"extends": "base", "address": "https://opa.prod:8443", "cacheTTL": 60},
+			"prod-eu": {"extends": "prod", "address": "https://opa.prod-eu:8443"},
+			"cycle-a": {"extends": "cycle-b"},
+			"cycle-b": {"extends": "cycle-a"},
+			"orphan": {"extends": "missing"}
+		}
+	}`), 0600)
+	suite.Require().NoError(err)
+
+	suite.profiles, err = LoadConfigProfiles(profilesPath)
+	suite.Require().NoError(err)
+}
+
+func (suite *ConfigProfilesTestSuite) TestLoadProfile() {
+	config, err := suite.profiles.LoadProfile("dev")
+	suite.Require().NoError(err)
+	suite.Require().Equal(&Config{
+		ClientKind:          ClientKindHTTP,
+		Address:             "http://localhost:8181",
+		PermissionQueryPath: "/v1/data/authz/allow",
+		RequestTimeout:      10,
+		Verbose:             true,
+		CacheTTL:            30,
+	}, config)
+
+	// inherited through several profiles, overriding the fields set along the way
+	config, err = suite.profiles.LoadProfile("prod-eu")
+	suite.Require().NoError(err)
+	suite.Require().Equal("https://opa.prod-eu:8443", config.Address)
+	suite.Require().Equal("/v1/data/authz/allow", config.PermissionQueryPath)
+	suite.Require().Equal(60, config.CacheTTL)
+	suite.Require().False(config.Verbose)
+}
+
+func (suite *ConfigProfilesTestSuite) TestInvalidProfiles() {
+	_, err := suite.profiles.LoadProfile("staging")
+	suite.Require().ErrorContains(err, "Profile staging not found")
+
+	_, err = suite.profiles.LoadProfile("orphan")
+	suite.Require().ErrorContains(err, "Profile missing not found")
+
+	_, err = suite.profiles.LoadProfile("cycle-a")
+	suite.Require().ErrorContains(err, "Profiles extend each other: cycle-a -> cycle-b -> cycle-a")
+
+	_, err = ParseConfigProfiles([]byte(`{"address": "http://localhost:8181"}`))
+	suite.Require().ErrorContains(err, "No configuration profiles are defined")
+}
+
+func (suite *ConfigProfilesTestSuite) TestNames() {
+	suite.Require().Equal([]string{"base", "cycle-a", "cycle-b", "dev", "orphan", "prod", "prod-eu"},
+		suite.profiles.Names())
+}
+
+func TestConfigProfilesTestSuite(t *testing.T) {
+	suite.Run(t, new(ConfigProfilesTestSuite))
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rediscache provides a Redis-backed decision cache, letting a fleet of replicas share permission decisions.
+package rediscache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+	opaclient "github.com/nuclio/opa-client"
+	"github.com/redis/go-redis/v9"
+)
+
+// DefaultNamespace prefixes the decision keys, unless configured otherwise
+const DefaultNamespace = "opa-decisions"
+
+// Cache is a Redis-backed decision cache.
+// Decisions are stored as JSON under namespaced, hashed keys, and expire along with the decision
+type Cache struct {
+	logger       logger.Logger
+	client       redis.UniversalClient
+	namespace    string
+	maxStaleness time.Duration
+}
+
+func NewCache(parentLogger logger.Logger, client redis.UniversalClient, namespace string) *Cache {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	if parentLogger == nil {
+		parentLogger = opaclient.NopLogger{}
+	}
+	return &Cache{
+		logger:    parentLogger.GetChild("opa-redis-cache"),
+		client:    client,
+		namespace: namespace,
+	}
+}
+
+func (c *Cache) Get(ctx context.Context, key string) (*opaclient.CachedDecision, bool) {
+	encodedDecision, err := c.client.Get(ctx, c.redisKey(key)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			c.logger.WarnWithCtx(ctx, "Failed to get cached decision", "err", err.Error())
+		}
+		return nil, false
+	}
+
+	return c.decodeDecision(ctx, encodedDecision, 0)
+}
+
+// RetainStale keeps decisions in redis for the given period past their expiry
+func (c *Cache) RetainStale(maxStaleness time.Duration) {
+	c.maxStaleness = maxStaleness
+}
+
+func (c *Cache) GetStale(ctx context.Context,
+	key string,
+	maxStaleness time.Duration) (*opaclient.CachedDecision, bool) {
+	encodedDecision, err := c.client.Get(ctx, c.redisKey(key)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			c.logger.WarnWithCtx(ctx, "Failed to get stale cached decision", "err", err.Error())
+		}
+		return nil, false
+	}
+
+	return c.decodeDecision(ctx, encodedDecision, maxStaleness)
+}
+
+// GetMulti gets all decisions in a single pipeline
+func (c *Cache) GetMulti(ctx context.Context, keys []string) map[string]*opaclient.CachedDecision {
+	commands := make([]*redis.StringCmd, len(keys))
+	if _, err := c.client.Pipelined(ctx, func(pipeliner redis.Pipeliner) error {
+		for keyIdx, key := range keys {
+			commands[keyIdx] = pipeliner.Get(ctx, c.redisKey(key))
+		}
+		return nil
+	}); err != nil && !errors.Is(err, redis.Nil) {
+		c.logger.WarnWithCtx(ctx, "Failed to get cached decisions", "err", err.Error())
+	}
+
+	decisions := map[string]*opaclient.CachedDecision{}
+	for keyIdx, command := range commands {
+		encodedDecision, err := command.Bytes()
+		if err != nil {
+			continue
+		}
+		if decision, found := c.decodeDecision(ctx, encodedDecision, 0); found {
+			decisions[keys[keyIdx]] = decision
+		}
+	}
+	return decisions
+}
+
+func (c *Cache) Set(ctx context.Context, key string, decision *opaclient.CachedDecision) {
+	ttl := time.Until(decision.ExpiresAt.Add(c.maxStaleness))
+	if ttl <= 0 {
+		return
+	}
+
+	encodedDecision, err := json.Marshal(decision)
+	if err != nil {
+		c.logger.WarnWithCtx(ctx, "Failed to encode decision", "err", err.Error())
+		return
+	}
+
+	if err := c.client.Set(ctx, c.redisKey(key), encodedDecision, ttl).Err(); err != nil {
+		c.logger.WarnWithCtx(ctx, "Failed to set cached decision", "err", err.Error())
+	}
+}
+
+// decodeDecision decodes a cached decision, unless it has expired more than maxStaleness ago
+func (c *Cache) decodeDecision(ctx context.Context,
+	encodedDecision []byte,
+	maxStaleness time.Duration) (*opaclient.CachedDecision, bool) {
+	decision := opaclient.CachedDecision{}
+	if err := json.Unmarshal(encodedDecision, &decision); err != nil {
+		c.logger.WarnWithCtx(ctx, "Failed to decode cached decision", "err", err.Error())
+		return nil, false
+	}
+
+	// stale decisions are retained, and redis expiry granularity may leave an expired decision around for a little while
+	if time.Now().After(decision.ExpiresAt.Add(maxStaleness)) {
+		return nil, false
+	}
+	return &decision, true
+}
+
+// redisKey namespaces the key, and hashes it to keep member ids out of redis and the key length bounded
+func (c *Cache) redisKey(key string) string {
+	keyHash := sha256.Sum256([]byte(key))
+	return c.namespace + ":" + hex.EncodeToString(keyHash[:])
+}
@@ -0,0 +1,85 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rediscache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	opaclient "github.com/nuclio/opa-client"
+	nucliozap "github.com/nuclio/zap"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/suite"
+)
+
+type CacheTestSuite struct {
+	suite.Suite
+	ctx         context.Context
+	redisServer *miniredis.Miniredis
+	cache       *Cache
+}
+
+func (suite *CacheTestSuite) SetupTest() {
+	loggerInstance, err := nucliozap.NewNuclioZapTest("redis-cache-test")
+	suite.Require().NoError(err)
+
+	suite.ctx = context.Background()
+	suite.redisServer = miniredis.RunT(suite.T())
+	suite.cache = NewCache(loggerInstance,
+		redis.NewClient(&redis.Options{Addr: suite.redisServer.Addr()}),
+		"test")
+}
+
+func (suite *CacheTestSuite) TestSetGet() {
+	suite.cache.Set(suite.ctx, "read|/projects/p1|user1|", &opaclient.CachedDecision{
+		Allowed:   true,
+		ExpiresAt: time.Now().Add(time.Minute),
+	})
+
+	decision, found := suite.cache.Get(suite.ctx, "read|/projects/p1|user1|")
+	suite.Require().True(found)
+	suite.Require().True(decision.Allowed)
+
+	// keys are namespaced and expire along with the decision
+	keys := suite.redisServer.Keys()
+	suite.Require().Len(keys, 1)
+	suite.Require().Regexp("^test:[0-9a-f]{64}$", keys[0])
+	suite.Require().InDelta(time.Minute, suite.redisServer.TTL(keys[0]), float64(time.Second))
+
+	suite.redisServer.FastForward(time.Minute)
+	_, found = suite.cache.Get(suite.ctx, "read|/projects/p1|user1|")
+	suite.Require().False(found)
+}
+
+func (suite *CacheTestSuite) TestGetMulti() {
+	expiresAt := time.Now().Add(time.Minute)
+	suite.cache.Set(suite.ctx, "a", &opaclient.CachedDecision{Allowed: true, ExpiresAt: expiresAt})
+	suite.cache.Set(suite.ctx, "b", &opaclient.CachedDecision{Allowed: false, ExpiresAt: expiresAt})
+
+	decisions := suite.cache.GetMulti(suite.ctx, []string{"a", "b", "c"})
+	suite.Require().Len(decisions, 2)
+	suite.Require().True(decisions["a"].Allowed)
+	suite.Require().False(decisions["b"].Allowed)
+}
+
+func TestCacheTestSuite(t *testing.T) {
+	suite.Run(t, new(CacheTestSuite))
+}
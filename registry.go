@@ -0,0 +1,222 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+// DefaultRegistryMaxClients is the number of tenant clients a registry keeps, unless configured
+const DefaultRegistryMaxClients = 100
+
+// TenantConfigFunc returns the client configuration of a tenant (e.g.: its OPA address or policy paths)
+type TenantConfigFunc func(ctx context.Context, tenant string) (*Config, error)
+
+// ClientRegistry manages a client per tenant, for control planes federating many OPA instances.
+// Clients are created once first requested, by the tenant configuration, and share a single transport
+// (unless the tenant configures its own transport or TLS). Beyond the max clients, the least recently
+// requested tenant client is evicted and closed
+type ClientRegistry struct {
+	logger     logger.Logger
+	configFunc TenantConfigFunc
+	maxClients int
+	transport  *http.Transport
+
+	lock           sync.Mutex
+	closed         bool
+	clients        map[string]*list.Element
+	lru            *list.List
+	closingClients sync.WaitGroup
+}
+
+type registeredClient struct {
+	tenant string
+	client Client
+}
+
+func NewClientRegistry(parentLogger logger.Logger, configFunc TenantConfigFunc, maxClients int) *ClientRegistry {
+	if maxClients <= 0 {
+		maxClients = DefaultRegistryMaxClients
+	}
+	return &ClientRegistry{
+		logger:     childLogger(parentLogger, "opa-registry"),
+		configFunc: configFunc,
+		maxClients: maxClients,
+		transport:  http.DefaultTransport.(*http.Transport).Clone(),
+		clients:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+// Client returns the client of the tenant, creating it if it does not exist
+func (r *ClientRegistry) Client(ctx context.Context, tenant string) (Client, error) {
+	if client, found := r.get(tenant); found {
+		return client, nil
+	}
+
+	// the configuration may take a while to get (e.g.: from a database), so it's done without holding the lock
+	tenantConfig, err := r.configFunc(ctx, tenant)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get configuration of tenant %s", tenant)
+	}
+	tenantConfig = r.shareTransport(tenantConfig)
+	newClient := CreateOpaClient(r.logger, tenantConfig)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.closed {
+		r.closeClient(newClient)
+		return nil, errors.New("Client registry is closed")
+	}
+
+	// created concurrently
+	if element, found := r.clients[tenant]; found {
+		r.lru.MoveToFront(element)
+		r.closeClient(newClient)
+		return element.Value.(*registeredClient).client, nil
+	}
+
+	r.clients[tenant] = r.lru.PushFront(&registeredClient{
+		tenant: tenant,
+		client: newClient,
+	})
+	r.logger.DebugWithCtx(ctx, "Created tenant client", "tenant", tenant)
+
+	// evict the least recently requested tenant
+	if r.lru.Len() > r.maxClients {
+		oldestElement := r.lru.Back()
+		r.removeElement(oldestElement)
+		r.logger.DebugWithCtx(ctx, "Evicted tenant client",
+			"tenant", oldestElement.Value.(*registeredClient).tenant)
+	}
+	return newClient, nil
+}
+
+// Evict removes and closes the client of the tenant (e.g.: once its configuration changed), if it exists
+func (r *ClientRegistry) Evict(tenant string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if element, found := r.clients[tenant]; found {
+		r.removeElement(element)
+	}
+}
+
+// Len returns the number of tenant clients
+func (r *ClientRegistry) Len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.lru.Len()
+}
+
+// Close closes all tenant clients (including evicted ones still closing), draining their background work until
+// the context is done
+func (r *ClientRegistry) Close(ctx context.Context) error {
+	r.lock.Lock()
+	r.closed = true
+	var clients []Client
+	for element := r.lru.Front(); element != nil; element = element.Next() {
+		clients = append(clients, element.Value.(*registeredClient).client)
+	}
+	r.clients = map[string]*list.Element{}
+	r.lru.Init()
+	r.lock.Unlock()
+
+	var closeErr error
+	for _, client := range clients {
+		closer, ok := client.(Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(ctx); err != nil && closeErr == nil {
+			closeErr = errors.Wrap(err, "Failed to close tenant client")
+		}
+	}
+	r.closingClients.Wait()
+	r.transport.CloseIdleConnections()
+	return closeErr
+}
+
+func (r *ClientRegistry) get(tenant string) (Client, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	element, found := r.clients[tenant]
+	if !found {
+		return nil, false
+	}
+	r.lru.MoveToFront(element)
+	return element.Value.(*registeredClient).client, true
+}
+
+// shareTransport returns a copy of the tenant configuration using the shared transport, unless it configures
+// its own transport or TLS
+func (r *ClientRegistry) shareTransport(tenantConfig *Config) *Config {
+	sharedTransportConfig := *tenantConfig
+	if tenantConfig.HTTPClient != nil ||
+		tenantConfig.RoundTripper != nil ||
+		tenantConfig.SkipTLSVerify ||
+		tenantConfig.TLSCertFile != "" ||
+		tenantConfig.TLSCAFile != "" ||
+		len(tenantConfig.EndpointTLS) > 0 {
+		return &sharedTransportConfig
+	}
+
+	sharedTransportConfig.RoundTripper = sharedRoundTripper{r.transport}
+	return &sharedTransportConfig
+}
+
+// sharedRoundTripper hides the idle connections closing of the shared transport from the tenant clients,
+// so closing an evicted client does not close the connections of the others
+type sharedRoundTripper struct {
+	http.RoundTripper
+}
+
+// removeElement removes the tenant client, and closes it in the background (as it may still be in use).
+// Must be called while holding the lock
+func (r *ClientRegistry) removeElement(element *list.Element) {
+	removedClient := element.Value.(*registeredClient)
+	r.lru.Remove(element)
+	delete(r.clients, removedClient.tenant)
+	r.closeClient(removedClient.client)
+}
+
+// closeClient closes the client in the background, within the request timeout
+func (r *ClientRegistry) closeClient(client Client) {
+	closer, ok := client.(Closer)
+	if !ok {
+		return
+	}
+	r.closingClients.Add(1)
+	go func() {
+		defer r.closingClients.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeOut)
+		defer cancel()
+		if err := closer.Close(ctx); err != nil {
+			r.logger.WarnWith("Failed to close tenant client", "err", err.Error())
+		}
+	}()
+}
@@ -0,0 +1,121 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/nuclio/errors"
+	"github.com/stretchr/testify/suite"
+)
+
+type ClientRegistryTestSuite struct {
+	suite.Suite
+	ctx            context.Context
+	testHTTPServer *httptest.Server
+
+	lock            sync.Mutex
+	queriedPaths    []string
+	configuredCount map[string]int
+}
+
+func (suite *ClientRegistryTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.queriedPaths = nil
+	suite.configuredCount = map[string]int{}
+	suite.testHTTPServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		suite.lock.Lock()
+		suite.queriedPaths = append(suite.queriedPaths, r.URL.Path)
+		suite.lock.Unlock()
+
+		_, err := w.Write([]byte(`{"result": true}`))
+		suite.Require().NoError(err)
+	}))
+}
+
+func (suite *ClientRegistryTestSuite) TearDownTest() {
+	suite.testHTTPServer.Close()
+}
+
+// tenantConfig configures each tenant to query its own policy package
+func (suite *ClientRegistryTestSuite) tenantConfig(ctx context.Context, tenant string) (*Config, error) {
+	if tenant == "unknown" {
+		return nil, errors.New("Unknown tenant")
+	}
+
+	suite.lock.Lock()
+	suite.configuredCount[tenant]++
+	suite.lock.Unlock()
+	return &Config{
+		ClientKind:          ClientKindHTTP,
+		Address:             suite.testHTTPServer.URL,
+		PermissionQueryPath: "/v1/data/" + tenant + "/allow",
+	}, nil
+}
+
+func (suite *ClientRegistryTestSuite) TestClient() {
+	registry := NewClientRegistry(nil, suite.tenantConfig, 2)
+	permissionOptions := &PermissionOptions{
+		MemberIds: []string{"user1"},
+	}
+
+	for _, tenant := range []string{"t1", "t2", "t1"} {
+		client, err := registry.Client(suite.ctx, tenant)
+		suite.Require().NoError(err)
+		allowed, err := client.QueryPermissions(suite.ctx, "resource", ActionRead, permissionOptions)
+		suite.Require().NoError(err)
+		suite.Require().True(allowed)
+	}
+	suite.Require().Equal([]string{"/v1/data/t1/allow", "/v1/data/t2/allow", "/v1/data/t1/allow"},
+		suite.queriedPaths)
+
+	// created once, sharing the transport
+	suite.Require().Equal(1, suite.configuredCount["t1"])
+	client, err := registry.Client(suite.ctx, "t1")
+	suite.Require().NoError(err)
+	_, sharesTransport := client.(*HTTPClient).httpClient.Transport.(sharedRoundTripper)
+	suite.Require().True(sharesTransport)
+
+	// the least recently requested tenant is evicted
+	_, err = registry.Client(suite.ctx, "t3")
+	suite.Require().NoError(err)
+	suite.Require().Equal(2, registry.Len())
+	_, err = registry.Client(suite.ctx, "t2")
+	suite.Require().NoError(err)
+	suite.Require().Equal(2, suite.configuredCount["t2"])
+
+	registry.Evict("t2")
+	suite.Require().Equal(1, registry.Len())
+
+	_, err = registry.Client(suite.ctx, "unknown")
+	suite.Require().Error(err)
+
+	suite.Require().NoError(registry.Close(suite.ctx))
+	suite.Require().Zero(registry.Len())
+	_, err = registry.Client(suite.ctx, "t1")
+	suite.Require().Error(err)
+}
+
+func TestClientRegistryTestSuite(t *testing.T) {
+	suite.Run(t, new(ClientRegistryTestSuite))
+}
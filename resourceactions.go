@@ -0,0 +1,380 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"slices"
+
+	"github.com/nuclio/errors"
+)
+
+// ResourceAction is a resource along with the action to query permission for
+type ResourceAction struct {
+	Resource string `json:"resource"`
+	Action   Action `json:"action"`
+}
+
+type PermissionResourceActionsRequest struct {
+	Input PermissionResourceActionsRequestInput `json:"input,omitempty"`
+}
+
+type PermissionResourceActionsRequestInput struct {
+	ResourceActions []ResourceAction    `json:"resourceActions,omitempty"`
+	Ids             []string            `json:"ids,omitempty"`
+	Subject         *Subject            `json:"subject,omitempty"`
+	Ancestors       map[string][]string `json:"ancestors,omitempty"`
+
+	// Attributes maps the resources to their attributes (see PermissionOptions.ResourceAttributes)
+	Attributes map[string]map[string]any `json:"attributes,omitempty"`
+
+	// Prefixes maps the wildcard resources to their prefixes
+	Prefixes map[string]string `json:"prefixes,omitempty"`
+
+	// Extra fields are merged into the input
+	Extra map[string]any `json:"-"`
+}
+
+func (i PermissionResourceActionsRequestInput) MarshalJSON() ([]byte, error) {
+	type permissionResourceActionsRequestInput PermissionResourceActionsRequestInput
+	return marshalInputWithExtra(permissionResourceActionsRequestInput(i), i.Extra)
+}
+
+// PermissionResourceActionsResponse lists the allowed resource actions
+type PermissionResourceActionsResponse struct {
+	Result     []ResourceAction `json:"result,omitempty"`
+	Provenance *Provenance      `json:"provenance,omitempty"`
+}
+
+// QueryPermissionsResourceActions queries permissions for multiple resources, each with its own action, at once.
+// It is guaranteed that len(resourceActions) and len(results) are equal, and that resourceActions[i] query permission
+// is at results[i]. Duplicate resource actions are queried once, and empty resources or actions are rejected.
+// The resource actions are evaluated in a single request to the resource actions path (see WithResourceActionsPath),
+// or in a request per action while it is not set
+func (c *HTTPClient) QueryPermissionsResourceActions(ctx context.Context,
+	resourceActions []ResourceAction,
+	permissionOptions *PermissionOptions) ([]bool, error) {
+
+	resources := make([]string, len(resourceActions))
+	for resourceActionIdx, resourceAction := range resourceActions {
+		if resourceAction.Action == "" {
+			return nil, errors.Errorf("Action at index %d is empty", resourceActionIdx)
+		}
+		resources[resourceActionIdx] = resourceAction.Resource
+	}
+	if err := validateResources(resources); err != nil {
+		return nil, err
+	}
+	scopedResources, err := c.scopeResources(resources)
+	if err != nil {
+		return nil, err
+	}
+	ctx, permissionOptions, err = c.resolvePermissionOptions(ctx, permissionOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	scopedResourceActions := make([]ResourceAction, len(resourceActions))
+	for resourceActionIdx, resourceAction := range resourceActions {
+		scopedResourceActions[resourceActionIdx] = ResourceAction{
+			Resource: scopedResources[resourceActionIdx],
+			Action:   resourceAction.Action,
+		}
+	}
+	uniqueResourceActions, uniqueResourceActionIdxs := deduplicateResourceActions(scopedResourceActions)
+
+	var uniqueResults []bool
+	if c.permissionResourceActionsPath != "" {
+		uniqueResults, err = c.queryUniqueResourceActions(ctx, uniqueResourceActions, permissionOptions)
+	} else {
+		uniqueResults, err = c.queryUniqueResourceActionsByAction(ctx, uniqueResourceActions, permissionOptions)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]bool, len(resourceActions))
+	for resourceActionIdx, uniqueResourceActionIdx := range uniqueResourceActionIdxs {
+		results[resourceActionIdx] = uniqueResults[uniqueResourceActionIdx]
+	}
+	return results, nil
+}
+
+// queryUniqueResourceActionsByAction decides the given (unique) resource actions by querying the resources of each
+// action together
+func (c *HTTPClient) queryUniqueResourceActionsByAction(ctx context.Context,
+	resourceActions []ResourceAction,
+	permissionOptions *PermissionOptions) ([]bool, error) {
+	results := make([]bool, len(resourceActions))
+	for action, resourceActionIdxs := range groupResourceActions(resourceActions) {
+		resources := make([]string, len(resourceActionIdxs))
+		for idx, resourceActionIdx := range resourceActionIdxs {
+			resources[idx] = resourceActions[resourceActionIdx].Resource
+		}
+
+		actionResult, err := c.queryUniqueResources(ctx, resources, action, permissionOptions)
+		if err != nil {
+			return nil, err
+		}
+		for idx, resourceActionIdx := range resourceActionIdxs {
+			results[resourceActionIdx] = actionResult.Results[idx]
+		}
+	}
+	return results, nil
+}
+
+// queryUniqueResourceActions decides the given (unique) resource actions - by the override, the cached decisions and
+// querying OPA in a single request
+func (c *HTTPClient) queryUniqueResourceActions(ctx context.Context,
+	resourceActions []ResourceAction,
+	permissionOptions *PermissionOptions) ([]bool, error) {
+	var err error
+	results := make([]bool, len(resourceActions))
+	decisions := make([]*Decision, len(resourceActions))
+
+	// If the override header value matches any accepted override header value, allow without checking
+	if overrideIssuer, overridden := c.overridden(permissionOptions); overridden {
+		for resourceActionIdx, resourceAction := range resourceActions {
+			results[resourceActionIdx] = true
+			decisions[resourceActionIdx] = &Decision{
+				Resource:   resourceAction.Resource,
+				Action:     resourceAction.Action,
+				Allowed:    true,
+				Overridden: true,
+			}
+		}
+		c.auditOverride(ctx, decisions, permissionOptions, overrideIssuer)
+		return results, nil
+	}
+
+	// serve cached decisions, and query only the rest
+	var uncachedResourceActions []ResourceAction
+	var uncachedResourceActionIdxs []int
+	for resourceActionIdx, resourceAction := range resourceActions {
+		if cachedDecision := c.getCachedDecisions(ctx,
+			[]string{resourceAction.Resource},
+			resourceAction.Action,
+			permissionOptions)[0]; cachedDecision != nil {
+			decisions[resourceActionIdx] = cachedDecision.toDecision(resourceAction.Resource, resourceAction.Action)
+			continue
+		}
+		uncachedResourceActions = append(uncachedResourceActions, resourceAction)
+		uncachedResourceActionIdxs = append(uncachedResourceActionIdxs, resourceActionIdx)
+	}
+
+	if len(uncachedResourceActions) > 0 {
+		var uncachedResults []bool
+		var provenance *Provenance
+		uncachedResults, provenance, err = c.queryResourceActions(ctx, uncachedResourceActions, permissionOptions)
+		if err == nil {
+			for uncachedIdx, allowed := range uncachedResults {
+				decision := &Decision{
+					Resource:   uncachedResourceActions[uncachedIdx].Resource,
+					Action:     uncachedResourceActions[uncachedIdx].Action,
+					Allowed:    allowed,
+					Provenance: provenance,
+				}
+				decisions[uncachedResourceActionIdxs[uncachedIdx]] = decision
+				c.cacheDecision(ctx, decision, permissionOptions)
+			}
+		} else if failedQueryDecisions, decided := c.decideFailedResourceActionsQuery(ctx,
+			uncachedResourceActions,
+			permissionOptions,
+			err); decided {
+			for uncachedIdx, decision := range failedQueryDecisions {
+				decisions[uncachedResourceActionIdxs[uncachedIdx]] = decision
+			}
+			err = nil
+		}
+	}
+
+	for resourceActionIdx, decision := range decisions {
+		if decision != nil {
+			results[resourceActionIdx] = decision.Allowed
+		}
+	}
+
+	if c.recordsDecisions() {
+		decisionRecords := make([]DecisionRecord, len(resourceActions))
+		for resourceActionIdx, resourceAction := range resourceActions {
+			decision := decisions[resourceActionIdx]
+			var decisionErr error
+			if decision == nil {
+				decision = &Decision{
+					Resource: resourceAction.Resource,
+					Action:   resourceAction.Action,
+				}
+				decisionErr = err
+			}
+			decisionRecords[resourceActionIdx] = newDecisionRecord(c.clock, decision, permissionOptions, decisionErr)
+		}
+		c.logDecisions(ctx, decisionRecords)
+	}
+
+	if c.enforcementMode == EnforcementModeMonitor {
+		for action, resourceActionIdxs := range groupResourceActions(resourceActions) {
+			actionResources := make([]string, len(resourceActionIdxs))
+			actionResults := make([]bool, len(resourceActionIdxs))
+			for idx, resourceActionIdx := range resourceActionIdxs {
+				actionResources[idx] = resourceActions[resourceActionIdx].Resource
+				actionResults[idx] = results[resourceActionIdx]
+			}
+			c.monitorDecisions(ctx, actionResources, action, actionResults, err)
+		}
+		for resourceActionIdx := range results {
+			results[resourceActionIdx] = true
+		}
+		return results, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// decideFailedResourceActionsQuery decides the resource actions of a failed query by the stale decisions and the
+// fallback policy, if all of them can be decided
+func (c *HTTPClient) decideFailedResourceActionsQuery(ctx context.Context,
+	resourceActions []ResourceAction,
+	permissionOptions *PermissionOptions,
+	queryErr error) ([]*Decision, bool) {
+	decisions := make([]*Decision, len(resourceActions))
+	for action, resourceActionIdxs := range groupResourceActions(resourceActions) {
+		resources := make([]string, len(resourceActionIdxs))
+		for idx, resourceActionIdx := range resourceActionIdxs {
+			resources[idx] = resourceActions[resourceActionIdx].Resource
+		}
+
+		actionDecisions, decided := c.decideFailedQuery(ctx, resources, action, permissionOptions, queryErr)
+		if !decided {
+			return nil, false
+		}
+		for idx, resourceActionIdx := range resourceActionIdxs {
+			decisions[resourceActionIdx] = actionDecisions[idx]
+		}
+	}
+	return decisions, true
+}
+
+// queryResourceActions queries OPA for the given resource actions in a single request
+func (c *HTTPClient) queryResourceActions(ctx context.Context,
+	resourceActions []ResourceAction,
+	permissionOptions *PermissionOptions) ([]bool, *Provenance, error) {
+
+	requestInput := PermissionResourceActionsRequestInput{
+		ResourceActions: resourceActions,
+		Ids:             permissionOptions.memberIds(),
+		Subject:         permissionOptions.Subject,
+		Extra:           queryExtraInput(ctx, permissionOptions),
+	}
+
+	for _, resourceAction := range resourceActions {
+		if IsWildcardResource(resourceAction.Resource) {
+			if requestInput.Prefixes == nil {
+				requestInput.Prefixes = map[string]string{}
+			}
+			requestInput.Prefixes[resourceAction.Resource] = resourcePrefix(resourceAction.Resource)
+		}
+	}
+
+	switch permissionOptions.HierarchyMode {
+	case HierarchyModeInput:
+		requestInput.Ancestors = map[string][]string{}
+		for _, resourceAction := range resourceActions {
+			requestInput.Ancestors[resourceAction.Resource] = resourceAncestors(resourceAction.Resource)
+		}
+
+	case HierarchyModeClient:
+
+		// query the resource actions along with the same actions of all of their ancestors in a single request
+		var hierarchyResourceActions []ResourceAction
+		for _, resourceAction := range resourceActions {
+			for _, hierarchyResource := range append([]string{resourceAction.Resource},
+				resourceAncestors(resourceAction.Resource)...) {
+				hierarchyResourceAction := ResourceAction{Resource: hierarchyResource, Action: resourceAction.Action}
+				if !slices.Contains(hierarchyResourceActions, hierarchyResourceAction) {
+					hierarchyResourceActions = append(hierarchyResourceActions, hierarchyResourceAction)
+				}
+			}
+		}
+		requestInput.ResourceActions = hierarchyResourceActions
+	}
+
+	queriedResources := make([]string, len(requestInput.ResourceActions))
+	for resourceActionIdx, resourceAction := range requestInput.ResourceActions {
+		queriedResources[resourceActionIdx] = resourceAction.Resource
+	}
+	requestInput.Attributes = permissionOptions.resourceAttributes(queriedResources)
+
+	permissionResourceActionsResponse := PermissionResourceActionsResponse{}
+	if err := c.sendQuery(ctx,
+		c.permissionResourceActionsPath,
+		&PermissionResourceActionsRequest{Input: requestInput},
+		&permissionResourceActionsResponse); err != nil {
+		return nil, nil, err
+	}
+	allowedResourceActions := permissionResourceActionsResponse.Result
+
+	results := make([]bool, len(resourceActions))
+	for resourceActionIdx, resourceAction := range resourceActions {
+		if slices.Contains(allowedResourceActions, resourceAction) {
+			results[resourceActionIdx] = true
+			continue
+		}
+
+		// a resource action is allowed if the same action of any of its ancestors is allowed
+		if permissionOptions.HierarchyMode == HierarchyModeClient {
+			for _, ancestor := range resourceAncestors(resourceAction.Resource) {
+				if slices.Contains(allowedResourceActions, ResourceAction{Resource: ancestor, Action: resourceAction.Action}) {
+					results[resourceActionIdx] = true
+					break
+				}
+			}
+		}
+	}
+	return results, permissionResourceActionsResponse.Provenance, nil
+}
+
+// deduplicateResourceActions returns the unique resource actions (in order of first appearance),
+// and the index of each of the given resource actions within them
+func deduplicateResourceActions(resourceActions []ResourceAction) ([]ResourceAction, []int) {
+	uniqueResourceActions := make([]ResourceAction, 0, len(resourceActions))
+	uniqueResourceActionIdxs := make([]int, len(resourceActions))
+	uniqueResourceActionIdxsByResourceAction := make(map[ResourceAction]int, len(resourceActions))
+	for resourceActionIdx, resourceAction := range resourceActions {
+		uniqueResourceActionIdx, found := uniqueResourceActionIdxsByResourceAction[resourceAction]
+		if !found {
+			uniqueResourceActionIdx = len(uniqueResourceActions)
+			uniqueResourceActionIdxsByResourceAction[resourceAction] = uniqueResourceActionIdx
+			uniqueResourceActions = append(uniqueResourceActions, resourceAction)
+		}
+		uniqueResourceActionIdxs[resourceActionIdx] = uniqueResourceActionIdx
+	}
+	return uniqueResourceActions, uniqueResourceActionIdxs
+}
+
+// groupResourceActions returns the indexes of the given resource actions, by their action
+func groupResourceActions(resourceActions []ResourceAction) map[Action][]int {
+	resourceActionIdxsByAction := map[Action][]int{}
+	for resourceActionIdx, resourceAction := range resourceActions {
+		resourceActionIdxsByAction[resourceAction.Action] = append(
+			resourceActionIdxsByAction[resourceAction.Action],
+			resourceActionIdx)
+	}
+	return resourceActionIdxsByAction
+}
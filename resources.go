@@ -0,0 +1,111 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nuclio/errors"
+)
+
+// WildcardSuffix marks a resource as a wildcard matching anything under it (e.g.: /projects/p1/*)
+const WildcardSuffix = "/*"
+
+// ProjectResource returns the canonical resource string of a project
+func ProjectResource(projectName string) (string, error) {
+	return joinResource("", "projects", projectName)
+}
+
+// FunctionResource returns the canonical resource string of a function within a project
+func FunctionResource(projectName string, functionName string) (string, error) {
+	projectResource, err := ProjectResource(projectName)
+	if err != nil {
+		return "", err
+	}
+	return joinResource(projectResource, "functions", functionName)
+}
+
+// FunctionEventResource returns the canonical resource string of a function event within a function
+func FunctionEventResource(projectName string, functionName string, functionEventName string) (string, error) {
+	functionResource, err := FunctionResource(projectName, functionName)
+	if err != nil {
+		return "", err
+	}
+	return joinResource(functionResource, "function-events", functionEventName)
+}
+
+// APIGatewayResource returns the canonical resource string of an API gateway within a project
+func APIGatewayResource(projectName string, apiGatewayName string) (string, error) {
+	projectResource, err := ProjectResource(projectName)
+	if err != nil {
+		return "", err
+	}
+	return joinResource(projectResource, "api-gateways", apiGatewayName)
+}
+
+// joinResource appends the kind and name segments to the parent resource, failing (with ErrInvalidInput)
+// on names that are not a single path segment, as they would build the resource string of another resource
+func joinResource(parentResource string, kind string, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return "", errors.Wrapf(ErrInvalidInput, "Name %q of %s is not a valid resource path segment", name, kind)
+	}
+	return fmt.Sprintf("%s/%s/%s", parentResource, kind, name), nil
+}
+
+// WildcardResource returns a wildcard resource matching anything under the given resource
+func WildcardResource(resource string) string {
+	return strings.TrimSuffix(resource, "/") + WildcardSuffix
+}
+
+// IsWildcardResource returns true if the given resource is a wildcard resource
+func IsWildcardResource(resource string) bool {
+	return strings.HasSuffix(resource, WildcardSuffix)
+}
+
+// resourcePrefix returns the prefix a wildcard resource matches (e.g.: /projects/p1/* -> /projects/p1/)
+func resourcePrefix(resource string) string {
+	return strings.TrimSuffix(resource, "*")
+}
+
+// validateResources fails if any of the given resources is empty
+func validateResources(resources []string) error {
+	for resourceIdx, resource := range resources {
+		if resource == "" {
+			return errors.Errorf("Resource at index %d is empty", resourceIdx)
+		}
+	}
+	return nil
+}
+
+// deduplicateResources returns the unique resources (in order of first appearance),
+// and the index of each of the given resources within them
+func deduplicateResources(resources []string) ([]string, []int) {
+	uniqueResources := make([]string, 0, len(resources))
+	uniqueResourceIdxs := make([]int, len(resources))
+	uniqueResourceIdxsByResource := make(map[string]int, len(resources))
+	for resourceIdx, resource := range resources {
+		uniqueResourceIdx, found := uniqueResourceIdxsByResource[resource]
+		if !found {
+			uniqueResourceIdx = len(uniqueResources)
+			uniqueResourceIdxsByResource[resource] = uniqueResourceIdx
+			uniqueResources = append(uniqueResources, resource)
+		}
+		uniqueResourceIdxs[resourceIdx] = uniqueResourceIdx
+	}
+	return uniqueResources, uniqueResourceIdxs
+}
@@ -0,0 +1,117 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ResourcesTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ResourcesTestSuite) TestResources() {
+	for _, testCase := range []struct {
+		name             string
+		buildResource    func() (string, error)
+		expectedResource string
+		expectedErr      bool
+	}{
+		{
+			name:             "project",
+			buildResource:    func() (string, error) { return ProjectResource("p1") },
+			expectedResource: "/projects/p1",
+		},
+		{
+			name:             "function",
+			buildResource:    func() (string, error) { return FunctionResource("p1", "f1") },
+			expectedResource: "/projects/p1/functions/f1",
+		},
+		{
+			name:             "functionEvent",
+			buildResource:    func() (string, error) { return FunctionEventResource("p1", "f1", "e1") },
+			expectedResource: "/projects/p1/functions/f1/function-events/e1",
+		},
+		{
+			name:             "apiGateway",
+			buildResource:    func() (string, error) { return APIGatewayResource("p1", "gw1") },
+			expectedResource: "/projects/p1/api-gateways/gw1",
+		},
+		{
+			name:          "emptyProject",
+			buildResource: func() (string, error) { return ProjectResource("") },
+			expectedErr:   true,
+		},
+		{
+			name:          "emptyFunction",
+			buildResource: func() (string, error) { return FunctionResource("p1", "") },
+			expectedErr:   true,
+		},
+		{
+			name:          "emptyProjectOfFunction",
+			buildResource: func() (string, error) { return FunctionResource("", "f1") },
+			expectedErr:   true,
+		},
+		{
+			name:          "slashedFunction",
+			buildResource: func() (string, error) { return FunctionResource("p", "a/b") },
+			expectedErr:   true,
+		},
+		{
+			name:          "slashedProjectOfAPIGateway",
+			buildResource: func() (string, error) { return APIGatewayResource("p1/functions/f1", "gw1") },
+			expectedErr:   true,
+		},
+		{
+			name:          "dotFunctionEvent",
+			buildResource: func() (string, error) { return FunctionEventResource("p1", "f1", ".") },
+			expectedErr:   true,
+		},
+		{
+			name:          "dotDotFunction",
+			buildResource: func() (string, error) { return FunctionEventResource("p1", "..", "e1") },
+			expectedErr:   true,
+		},
+	} {
+		suite.Run(testCase.name, func() {
+			resource, err := testCase.buildResource()
+			if testCase.expectedErr {
+				suite.Require().ErrorIs(err, ErrInvalidInput)
+				suite.Require().Empty(resource)
+				return
+			}
+			suite.Require().NoError(err)
+			suite.Require().Equal(testCase.expectedResource, resource)
+		})
+	}
+}
+
+// mustResource returns the given resource, panicking on the error of building it
+func mustResource(resource string, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return resource
+}
+
+func TestResourcesTestSuite(t *testing.T) {
+	suite.Run(t, new(ResourcesTestSuite))
+}
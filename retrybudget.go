@@ -0,0 +1,75 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRetryBudgetWindow     = 10 * time.Second
+	DefaultRetryBudgetMinRetries = 10
+)
+
+// retryBudget bounds the retries over a rolling window to a ratio of the queries over it (plus a minimum number of
+// retries, so seldom queried clients may retry as well), so a partial OPA brownout doesn't multiply the load on it
+type retryBudget struct {
+	ratio      float64
+	minRetries int64
+
+	lock   sync.Mutex
+	counts *rollingCounts
+}
+
+func newRetryBudget(ratio float64, window time.Duration, minRetries int) *retryBudget {
+	return &retryBudget{
+		ratio:      ratio,
+		minRetries: int64(minRetries),
+		counts:     newRollingCounts(window),
+	}
+}
+
+// empty returns a new budget of the same ratio, window and minimum, having counted no queries nor retries yet
+func (b *retryBudget) empty() *retryBudget {
+	return &retryBudget{
+		ratio:      b.ratio,
+		minRetries: b.minRetries,
+		counts:     b.counts.empty(),
+	}
+}
+
+// deposit counts a query, adding to the budget
+func (b *retryBudget) deposit(now time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.counts.add(now, 1, 0)
+}
+
+// withdraw counts a retry, returning false (without counting it) if the budget is exhausted
+func (b *retryBudget) withdraw(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	queries, retries := b.counts.sum(now)
+	if float64(retries) >= float64(b.minRetries)+b.ratio*float64(queries) {
+		return false
+	}
+	b.counts.add(now, 0, 1)
+	return true
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"sync"
+)
+
+// policyRevision is the revision of the policy bundles OPA was last observed running (by the provenance of its
+// decisions, or by polling its status), shared by clients derived from each other
+type policyRevision struct {
+	lock     sync.Mutex
+	revision string
+}
+
+func (r *policyRevision) get() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.revision
+}
+
+// observe stores the given revision, returning true if it replaced a different, previously observed one
+func (r *policyRevision) observe(revision string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	changed := r.revision != "" && r.revision != revision
+	r.revision = revision
+	return changed
+}
+
+// provenanceRevision returns the revisions of all bundles listed by the provenance (or its legacy revision),
+// sorted and joined. Bundle names are omitted, as the legacy revision is reported by the status under a bundle name
+func provenanceRevision(provenance *Provenance) string {
+	if provenance == nil {
+		return ""
+	}
+	if len(provenance.Bundles) == 0 {
+		return provenance.Revision
+	}
+
+	revisions := make([]string, 0, len(provenance.Bundles))
+	for _, bundle := range provenance.Bundles {
+		revisions = append(revisions, bundle.Revision)
+	}
+	return sortedJoin(revisions)
+}
+
+// statusRevision returns the active revisions of all bundles reported by the status, encoded as provenanceRevision
+func statusRevision(status *ServerStatus) string {
+	revisions := make([]string, 0, len(status.Bundles))
+	for _, bundle := range status.Bundles {
+		revisions = append(revisions, bundle.ActiveRevision)
+	}
+	return sortedJoin(revisions)
+}
+
+// observePolicyRevision records the policy revision OPA is running. Once it changes, decisions cached under the
+// previous revision are flushed (if the cache supports it)
+func (c *HTTPClient) observePolicyRevision(ctx context.Context, revision string) {
+	if revision == "" || !c.policyRevision.observe(revision) {
+		return
+	}
+
+	c.metricsSink.IncrementCounter(MetricPolicyRevisionChanges, 1, nil)
+	flushableDecisionCache, ok := c.decisionCache.(FlushableDecisionCache)
+	if !ok {
+		c.logger.InfoWithCtx(ctx, "Policy revision changed", "revision", revision)
+		return
+	}
+
+	flushableDecisionCache.Flush(ctx)
+	c.logger.InfoWithCtx(ctx, "Policy revision changed, flushed decision cache", "revision", revision)
+}
+
+// refreshPolicyRevision queries OPA's status, and observes the revision of its active bundles
+func (c *HTTPClient) refreshPolicyRevision(ctx context.Context) error {
+	status, err := c.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.observePolicyRevision(ctx, statusRevision(status))
+	return nil
+}
+
+// pollPolicyRevision refreshes the policy revision, periodically (see WithRevisionPolling)
+func (c *HTTPClient) pollPolicyRevision(ctx context.Context) {
+	pollCtx, cancel := context.WithTimeout(ctx, c.requestTimeout)
+	defer cancel()
+
+	if err := c.refreshPolicyRevision(pollCtx); err != nil {
+		c.logger.WarnWithCtx(pollCtx, "Failed to poll policy revision", "err", err.Error())
+	}
+}
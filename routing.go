@@ -0,0 +1,150 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+// Route routes the permission queries of the resources under a prefix and/or of some actions to a different OPA
+// server and/or policy (e.g.: billing resources to the billing OPA), so a single client can serve a service spanning
+// multiple policy domains
+type Route struct {
+
+	// ResourcePrefix matches the resources under it (as queried, i.e.: scoped and normalized), or any resource if empty
+	ResourcePrefix string `json:"resourcePrefix,omitempty"`
+
+	// Actions match the queries of any of them, or of any action if empty
+	Actions []Action `json:"actions,omitempty"`
+
+	// Address of the OPA server to query, or the client's one if empty
+	Address string `json:"address,omitempty"`
+
+	// policy paths to query, or the client's ones if empty
+	PermissionQueryPath  string `json:"permissionQueryPath,omitempty"`
+	PermissionFilterPath string `json:"permissionFilterPath,omitempty"`
+}
+
+// matches returns true if the route matches the given resource and action
+func (r *Route) matches(resource string, action Action) bool {
+	return r.matchesResource(resource) && (len(r.Actions) == 0 || slices.Contains(r.Actions, action))
+}
+
+// matchesResource returns true if the resource is the prefix, or under it (e.g.: /projects/p1/functions/f1 is under
+// /projects/p1, while /projects/p10 is not)
+func (r *Route) matchesResource(resource string) bool {
+	if r.ResourcePrefix == "" || resource == r.ResourcePrefix {
+		return true
+	}
+	if !strings.HasPrefix(resource, r.ResourcePrefix) {
+		return false
+	}
+	return strings.HasSuffix(r.ResourcePrefix, "/") || resource[len(r.ResourcePrefix)] == '/'
+}
+
+// routedClient is the client querying the OPA server and policy of a route
+type routedClient struct {
+	route  Route
+	client *HTTPClient
+}
+
+// buildRoutedClients derives the clients of the routes, sharing the transport, decision cache, sinks and background
+// work of the client
+func (c *HTTPClient) buildRoutedClients() {
+	c.routedClients = make([]*routedClient, 0, len(c.routes))
+	for _, route := range c.routes {
+		client := *c
+		client.routes = nil
+		client.routedClients = nil
+		if route.Address != "" {
+			client.address = route.Address
+			client.endpointProvider = nil
+		}
+		if route.PermissionQueryPath != "" {
+			client.permissionQueryPath = route.PermissionQueryPath
+		}
+		if route.PermissionFilterPath != "" {
+			client.permissionFilterPath = route.PermissionFilterPath
+		}
+		c.routedClients = append(c.routedClients, &routedClient{
+			route:  route,
+			client: &client,
+		})
+	}
+}
+
+// routeClient returns the client to query the given resource and action by - that of the first matching route,
+// or the client itself
+func (c *HTTPClient) routeClient(resource string, action Action) *HTTPClient {
+	for _, routedClient := range c.routedClients {
+		if routedClient.route.matches(resource, action) {
+			return routedClient.client
+		}
+	}
+	return c
+}
+
+// queryRoutedMultiResources queries the given resources by their routes - a filter request per route
+func (c *HTTPClient) queryRoutedMultiResources(ctx context.Context,
+	resources []string,
+	action Action,
+	permissionOptions *PermissionOptions) ([]bool, *Provenance, error) {
+
+	var routeClients []*HTTPClient
+	routeResourceIdxs := map[*HTTPClient][]int{}
+	for resourceIdx, resource := range resources {
+		routeClient := c.routeClient(resource, action)
+		if _, found := routeResourceIdxs[routeClient]; !found {
+			routeClients = append(routeClients, routeClient)
+		}
+		routeResourceIdxs[routeClient] = append(routeResourceIdxs[routeClient], resourceIdx)
+	}
+
+	results := make([]bool, len(resources))
+	var provenance *Provenance
+	for _, routeClient := range routeClients {
+		routeResources := make([]string, 0, len(routeResourceIdxs[routeClient]))
+		for _, resourceIdx := range routeResourceIdxs[routeClient] {
+			routeResources = append(routeResources, resources[resourceIdx])
+		}
+
+		// query the unrouted resources by the client itself, bypassing the routes
+		queryingClient := routeClient
+		if routeClient == c {
+			unroutedClient := *c
+			unroutedClient.routedClients = nil
+			queryingClient = &unroutedClient
+		}
+
+		routeResults, routeProvenance, err := queryingClient.queryPermissionsMultiResources(ctx,
+			routeResources,
+			action,
+			permissionOptions)
+		if err != nil {
+			return nil, nil, err
+		}
+		for routeResourceIdx, resourceIdx := range routeResourceIdxs[routeClient] {
+			results[resourceIdx] = routeResults[routeResourceIdx]
+		}
+		if provenance == nil {
+			provenance = routeProvenance
+		}
+	}
+	return results, provenance, nil
+}
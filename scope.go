@@ -0,0 +1,91 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"path"
+	"strings"
+
+	"github.com/nuclio/errors"
+)
+
+// ScopeInputField is the query input field the resource scope of a scoped client is sent in (input.scope)
+const ScopeInputField = "scope"
+
+// ErrOutOfScope is matched (using errors.Is) by the error returned when a scoped client is queried
+// for a resource outside of its scope
+var ErrOutOfScope = errors.New("Resource is out of scope")
+
+// Scoped returns a derived client bound to the given resource scope (e.g.: /projects/p1).
+// Relative resources (e.g.: functions/f1) are prefixed by the scope, and resources outside of it are rejected
+// with ErrOutOfScope. The scope is sent in the query input as well (input.scope)
+func (c *HTTPClient) Scoped(scope string) *HTTPClient {
+	return c.With(WithResourceScope(scope))
+}
+
+// WithResourceScope binds the client to the given resource scope (see Scoped).
+// A scoped client is further scoped relative to its scope
+func WithResourceScope(scope string) Option {
+	return func(c *HTTPClient) {
+		if c.resourceScope != "" && !strings.HasPrefix(scope, "/") {
+			scope = c.resourceScope + "/" + scope
+		}
+		c.resourceScope = path.Clean("/" + scope)
+	}
+}
+
+// scopeResource returns the (normalized) resource within the client scope, failing if it is outside of it
+func (c *HTTPClient) scopeResource(resource string) (string, error) {
+	resource, err := c.normalizeResource(resource)
+	if err != nil {
+		return "", err
+	}
+	if c.resourceScope == "" {
+		return resource, nil
+	}
+
+	// cleaning resolves any ../ escaping the scope
+	scopedResource := resource
+	if !strings.HasPrefix(resource, "/") {
+		scopedResource = c.resourceScope + "/" + resource
+	}
+	scopedResource = path.Clean(scopedResource)
+	if IsWildcardResource(resource) && !IsWildcardResource(scopedResource) {
+		scopedResource = WildcardResource(scopedResource)
+	}
+
+	if scopedResource != c.resourceScope && !strings.HasPrefix(scopedResource, c.resourceScope+"/") {
+		return "", errors.Wrapf(ErrOutOfScope, "Resource %s is out of scope %s", resource, c.resourceScope)
+	}
+	return scopedResource, nil
+}
+
+func (c *HTTPClient) scopeResources(resources []string) ([]string, error) {
+	if c.resourceScope == "" && c.resourceNormalizer == nil {
+		return resources, nil
+	}
+
+	scopedResources := make([]string, len(resources))
+	for resourceIdx, resource := range resources {
+		scopedResource, err := c.scopeResource(resource)
+		if err != nil {
+			return nil, err
+		}
+		scopedResources[resourceIdx] = scopedResource
+	}
+	return scopedResources, nil
+}
@@ -0,0 +1,376 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+const (
+	SecretSchemeFile  = "file"
+	SecretSchemeEnv   = "env"
+	SecretSchemeVault = "vault"
+
+	// DefaultSecretRefreshInterval is the interval to re-resolve secret references at, so rotated secrets take effect
+	DefaultSecretRefreshInterval = time.Minute
+)
+
+// SecretResolver resolves the secret references of a scheme, by their location (the reference without the scheme,
+// e.g.: /var/run/secrets/opa/token for file:///var/run/secrets/opa/token)
+type SecretResolver interface {
+	ResolveSecret(ctx context.Context, location string) (string, error)
+}
+
+// SecretResolverFunc resolves secret references by a function
+type SecretResolverFunc func(ctx context.Context, location string) (string, error)
+
+func (f SecretResolverFunc) ResolveSecret(ctx context.Context, location string) (string, error) {
+	return f(ctx, location)
+}
+
+// SecretResolvers resolve secret references (e.g.: env://OPA_SIGNING_KEY) by their scheme.
+// Values of other schemes (or none) are literal secrets
+type SecretResolvers map[string]SecretResolver
+
+// DefaultSecretResolvers resolve file://<path> references by the file contents (without trailing newlines),
+// env://<name> references by the environment variable, and vault://<mount>/<path>#<field> references by the field
+// of a Vault KV v2 secret (see VaultSecretResolver, addressed by VAULT_ADDR and authenticated by VAULT_TOKEN)
+func DefaultSecretResolvers() SecretResolvers {
+	return SecretResolvers{
+		SecretSchemeFile:  SecretResolverFunc(resolveFileSecret),
+		SecretSchemeEnv:   SecretResolverFunc(resolveEnvSecret),
+		SecretSchemeVault: NewVaultSecretResolver(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN")),
+	}
+}
+
+// IsReference returns true if the value is a reference of any of the schemes
+func (r SecretResolvers) IsReference(value string) bool {
+	scheme, _, found := strings.Cut(value, "://")
+	if !found {
+		return false
+	}
+	_, found = r[scheme]
+	return found
+}
+
+// Resolve returns the secret the value references, or the value itself if it isn't a reference
+func (r SecretResolvers) Resolve(ctx context.Context, value string) (string, error) {
+	scheme, location, found := strings.Cut(value, "://")
+	if !found {
+		return value, nil
+	}
+	resolver, found := r[scheme]
+	if !found {
+		return value, nil
+	}
+
+	secret, err := resolver.ResolveSecret(ctx, location)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to resolve %s secret reference", scheme)
+	}
+	return secret, nil
+}
+
+func resolveFileSecret(ctx context.Context, location string) (string, error) {
+	contents, err := os.ReadFile(location)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to read secret file")
+	}
+	return strings.TrimRight(string(contents), "\r\n"), nil
+}
+
+func resolveEnvSecret(ctx context.Context, location string) (string, error) {
+	secret, found := os.LookupEnv(location)
+	if !found {
+		return "", errors.Errorf("Environment variable %s is not set", location)
+	}
+	return secret, nil
+}
+
+// VaultSecretResolver resolves vault://<mount>/<path>#<field> references by the field of a Vault KV v2 secret
+// (e.g.: vault://secret/opa-client#signing_key)
+type VaultSecretResolver struct {
+	Address    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+func NewVaultSecretResolver(address string, token string) *VaultSecretResolver {
+	return &VaultSecretResolver{
+		Address: address,
+		Token:   token,
+		HTTPClient: &http.Client{
+			Timeout: DefaultRequestTimeOut,
+		},
+	}
+}
+
+func (r *VaultSecretResolver) ResolveSecret(ctx context.Context, location string) (string, error) {
+	if r.Address == "" {
+		return "", errors.New("Vault address is not set")
+	}
+	secretPath, field, found := strings.Cut(location, "#")
+	mount, path, pathFound := strings.Cut(secretPath, "/")
+	if !found || !pathFound || field == "" || path == "" {
+		return "", errors.Errorf("Reference %s is not of the form <mount>/<path>#<field>", location)
+	}
+
+	requestURL := strings.TrimSuffix(r.Address, "/") + "/v1/" + url.PathEscape(mount) + "/data/" + path
+	headers := map[string]string{}
+	if r.Token != "" {
+		headers["X-Vault-Token"] = r.Token
+	}
+	responseBody, _, err := sendHTTPRequest(ctx,
+		r.HTTPClient,
+		http.MethodGet,
+		requestURL,
+		nil,
+		headers,
+		[]*http.Cookie{},
+		http.StatusOK,
+		DefaultMaxResponseSize)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to read Vault secret %s", secretPath)
+	}
+
+	secretResponse := struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(responseBody, &secretResponse); err != nil {
+		return "", errors.Wrap(err, "Failed to unmarshal Vault secret")
+	}
+	secret, ok := secretResponse.Data.Data[field].(string)
+	if !ok {
+		return "", errors.Errorf("Vault secret %s has no %s field", secretPath, field)
+	}
+	return secret, nil
+}
+
+// SecretReferences are the secrets of the client, as secret references (or literal secrets)
+type SecretReferences struct {
+
+	// bearer token requests to OPA are authenticated with
+	BearerToken string
+
+	// accepted override values, and keys to verify override tokens by
+	OverrideHeaderValues []string
+	OverrideTokenKeys    []string
+
+	// key to sign the query requests by
+	RequestSigningKey string
+
+	// client secret the OAuth2 access tokens are fetched with (by a ClientCredentialsTokenSource, see WithTokenSource)
+	OAuth2ClientSecret string
+}
+
+// names of the secrets, by which their resolution errors are kept
+const (
+	secretNameBearerToken        = "bearer token"
+	secretNameRequestSigningKey  = "request signing key"
+	secretNameOAuth2ClientSecret = "OAuth2 client secret"
+)
+
+// resolvedSecrets are the secrets the references resolved to. Override values and keys are kept by the index of
+// their references, and are empty while unresolved
+type resolvedSecrets struct {
+	bearerToken          string
+	overrideHeaderValues []string
+	overrideTokenKeys    [][]byte
+	requestSigningKey    []byte
+	oauth2ClientSecret   string
+}
+
+// secretRotation holds the secrets resolved from their references, re-resolving them periodically so rotated
+// secrets take effect without restarting
+type secretRotation struct {
+	references      SecretReferences
+	resolvers       SecretResolvers
+	refreshInterval time.Duration
+
+	lock        sync.RWMutex
+	secrets     resolvedSecrets
+	resolveErrs map[string]error
+}
+
+// resolve resolves each of the references independently, keeping the previously resolved secret of any which
+// fails to resolve. Returns whether any secret changed, and the resolution errors by the secret names
+func (r *secretRotation) resolve(ctx context.Context) (bool, map[string]error) {
+	secrets, resolveErrs := r.resolveSecrets(ctx, r.get())
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.resolveErrs = resolveErrs
+	changed := secrets.bearerToken != r.secrets.bearerToken ||
+		!slices.Equal(secrets.overrideHeaderValues, r.secrets.overrideHeaderValues) ||
+		!slices.EqualFunc(secrets.overrideTokenKeys, r.secrets.overrideTokenKeys, slices.Equal) ||
+		!slices.Equal(secrets.requestSigningKey, r.secrets.requestSigningKey) ||
+		secrets.oauth2ClientSecret != r.secrets.oauth2ClientSecret
+	r.secrets = secrets
+	return changed, resolveErrs
+}
+
+// resolveSecrets resolves the references, falling back to the previous secrets of those failing to resolve
+func (r *secretRotation) resolveSecrets(ctx context.Context,
+	previousSecrets resolvedSecrets) (resolvedSecrets, map[string]error) {
+	resolveErrs := map[string]error{}
+	resolveSecret := func(name string, reference string, previousSecret string) string {
+		secret, err := r.resolvers.Resolve(ctx, reference)
+		if err != nil {
+			resolveErrs[name] = errors.Wrapf(err, "Failed to resolve %s", name)
+			return previousSecret
+		}
+		return secret
+	}
+
+	secrets := resolvedSecrets{
+		bearerToken: resolveSecret(secretNameBearerToken,
+			r.references.BearerToken,
+			previousSecrets.bearerToken),
+		overrideHeaderValues: make([]string, len(r.references.OverrideHeaderValues)),
+		overrideTokenKeys:    make([][]byte, len(r.references.OverrideTokenKeys)),
+		oauth2ClientSecret: resolveSecret(secretNameOAuth2ClientSecret,
+			r.references.OAuth2ClientSecret,
+			previousSecrets.oauth2ClientSecret),
+	}
+	for overrideHeaderValueIdx, overrideHeaderValue := range r.references.OverrideHeaderValues {
+		var previousValue string
+		if overrideHeaderValueIdx < len(previousSecrets.overrideHeaderValues) {
+			previousValue = previousSecrets.overrideHeaderValues[overrideHeaderValueIdx]
+		}
+		secrets.overrideHeaderValues[overrideHeaderValueIdx] = resolveSecret(
+			fmt.Sprintf("override header value %d", overrideHeaderValueIdx),
+			overrideHeaderValue,
+			previousValue)
+	}
+	for overrideTokenKeyIdx, overrideTokenKey := range r.references.OverrideTokenKeys {
+		var previousKey string
+		if overrideTokenKeyIdx < len(previousSecrets.overrideTokenKeys) {
+			previousKey = string(previousSecrets.overrideTokenKeys[overrideTokenKeyIdx])
+		}
+		if resolvedKey := resolveSecret(fmt.Sprintf("override token key %d", overrideTokenKeyIdx),
+			overrideTokenKey,
+			previousKey); resolvedKey != "" {
+			secrets.overrideTokenKeys[overrideTokenKeyIdx] = []byte(resolvedKey)
+		}
+	}
+	if requestSigningKey := resolveSecret(secretNameRequestSigningKey,
+		r.references.RequestSigningKey,
+		string(previousSecrets.requestSigningKey)); requestSigningKey != "" {
+		secrets.requestSigningKey = []byte(requestSigningKey)
+	}
+	return secrets, resolveErrs
+}
+
+// refresh re-resolves the references, logging the failures (the previous secrets are kept meanwhile)
+func (r *secretRotation) refresh(ctx context.Context, logger logger.Logger) {
+	changed, resolveErrs := r.resolve(ctx)
+	for secretName, err := range resolveErrs {
+		logger.WarnWithCtx(ctx, "Failed to re-resolve secret reference, keeping the previous secret",
+			"secret", secretName,
+			"err", err.Error())
+	}
+	if changed {
+		logger.InfoWithCtx(ctx, "Secrets rotated")
+	}
+}
+
+func (r *secretRotation) get() resolvedSecrets {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.secrets
+}
+
+// Token returns the resolved bearer token (see TokenSource) - the last one resolved, failing with the resolution
+// error while none was
+func (r *secretRotation) Token(ctx context.Context) (string, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.secrets.bearerToken != "" {
+		return r.secrets.bearerToken, nil
+	}
+	return "", r.unresolvedError(secretNameBearerToken)
+}
+
+// oauth2ClientSecret returns the resolved OAuth2 client secret - the last one resolved, failing with the resolution
+// error while none was
+func (r *secretRotation) oauth2ClientSecret(ctx context.Context) (string, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	if r.secrets.oauth2ClientSecret != "" {
+		return r.secrets.oauth2ClientSecret, nil
+	}
+	return "", r.unresolvedError(secretNameOAuth2ClientSecret)
+}
+
+// unresolvedError returns the error of the named secret which was not resolved. Must be called under the lock
+func (r *secretRotation) unresolvedError(secretName string) error {
+	if resolveErr := r.resolveErrs[secretName]; resolveErr != nil {
+		return errors.Wrapf(resolveErr, "No %s was resolved", secretName)
+	}
+	return errors.Errorf("Resolved %s is empty", secretName)
+}
+
+// acceptedOverrides returns the accepted override values and the keys to verify override tokens by - the configured
+// ones, along with the resolved ones
+func (c *HTTPClient) acceptedOverrides() ([]string, [][]byte) {
+	if c.secretRotation == nil {
+		return c.overrideHeaderValues, c.overrideTokenKeys
+	}
+	secrets := c.secretRotation.get()
+
+	// unresolved values and keys are empty, and must never be accepted
+	overrideHeaderValues := slices.Clone(c.overrideHeaderValues)
+	for _, overrideHeaderValue := range secrets.overrideHeaderValues {
+		if overrideHeaderValue != "" {
+			overrideHeaderValues = append(overrideHeaderValues, overrideHeaderValue)
+		}
+	}
+	overrideTokenKeys := slices.Clone(c.overrideTokenKeys)
+	for _, overrideTokenKey := range secrets.overrideTokenKeys {
+		if len(overrideTokenKey) > 0 {
+			overrideTokenKeys = append(overrideTokenKeys, overrideTokenKey)
+		}
+	}
+	return overrideHeaderValues, overrideTokenKeys
+}
+
+// signingKey returns the key to sign the query requests by - the resolved one, or the configured one
+func (c *HTTPClient) signingKey() []byte {
+	if c.secretRotation != nil {
+		if requestSigningKey := c.secretRotation.get().requestSigningKey; requestSigningKey != nil {
+			return requestSigningKey
+		}
+	}
+	return c.requestSigningKey
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nuclio/errors"
+)
+
+const (
+
+	// SelfCheckResource and SelfCheckMemberID are the resource and member the self check canary queries are sent for
+	// (in the SelfCheckTenant, of tenant policy paths)
+	SelfCheckResource = "opa-client/self-check"
+	SelfCheckMemberID = "opa-client-self-check"
+	SelfCheckTenant   = "opa-client-self-check"
+)
+
+// SelfCheck verifies the client configuration, to run at service boot so misconfiguration is caught at deploy time:
+// OPA is reachable, the client authenticates with it, both policy paths exist (see ValidatePolicyPaths), and canary
+// queries of both paths return well-formed results (a decision, and a list of resources).
+// It returns the error of the first failed check
+func (c *HTTPClient) SelfCheck(ctx context.Context) error {
+	endpoint := c.endpointAddress()
+	if err := c.probeEndpoint(ctx, endpoint); err != nil {
+		if isAuthenticationError(err) {
+			return errors.Wrapf(err, "Failed to authenticate with OPA at %s", endpoint)
+		}
+		return errors.Wrapf(err, "Failed to connect to OPA at %s", endpoint)
+	}
+
+	if err := c.ValidatePolicyPaths(ctx); err != nil {
+		if isAuthenticationError(err) {
+			return errors.Wrapf(err, "Failed to authenticate with OPA at %s", endpoint)
+		}
+		return errors.Wrap(err, "Failed to validate policy paths")
+	}
+
+	ctx = withTenant(ctx, SelfCheckTenant)
+	queryResponse := map[string]any{}
+	if err := c.sendQuery(ctx, c.permissionQueryPath, &PermissionQueryRequest{
+		Input: PermissionQueryRequestInput{
+			Resource: SelfCheckResource,
+			Action:   string(ActionRead),
+			Ids:      []string{SelfCheckMemberID},
+		},
+	}, &queryResponse); err != nil {
+		return errors.Wrapf(err, "Failed to send canary query to %s", c.permissionQueryPath)
+	}
+	if err := validateQueryResult(queryResponse["result"]); err != nil {
+		return errors.Errorf("Received malformed canary query result from %s: %s", c.permissionQueryPath, err.Error())
+	}
+
+	if c.permissionFilterPath == "" {
+		return nil
+	}
+	filterResponse := map[string]any{}
+	if err := c.sendQuery(ctx, c.permissionFilterPath, &PermissionFilterRequest{
+		Input: PermissionFilterRequestInput{
+			Resources: []string{SelfCheckResource},
+			Action:    string(ActionRead),
+			Ids:       []string{SelfCheckMemberID},
+		},
+	}, &filterResponse); err != nil {
+		return errors.Wrapf(err, "Failed to send canary query to %s", c.permissionFilterPath)
+	}
+	if err := validateFilterResult(filterResponse["result"]); err != nil {
+		return errors.Errorf("Received malformed canary query result from %s: %s", c.permissionFilterPath, err.Error())
+	}
+	return nil
+}
+
+// validateQueryResult returns an error unless the result is a decision - a boolean, or a rich result with a boolean
+// allow field
+func validateQueryResult(result any) error {
+	switch typedResult := result.(type) {
+	case nil:
+		return errors.New("Result is undefined (the policy may lack a default decision)")
+	case bool:
+		return nil
+	case map[string]any:
+		if _, ok := typedResult["allow"].(bool); !ok {
+			return errors.Errorf("Rich result has no boolean allow field: %v", typedResult)
+		}
+		return nil
+	default:
+		return errors.Errorf("Result is neither a boolean nor a rich result: %v", typedResult)
+	}
+}
+
+// validateFilterResult returns an error unless the result is a list of resources (an undefined result is an empty one)
+func validateFilterResult(result any) error {
+	if result == nil {
+		return nil
+	}
+	resources, ok := result.([]any)
+	if !ok {
+		return errors.Errorf("Result is not a list of resources: %v", result)
+	}
+	for _, resource := range resources {
+		if _, ok := resource.(string); !ok {
+			return errors.Errorf("Result has a non-string resource: %v", resource)
+		}
+	}
+	return nil
+}
+
+// isAuthenticationError returns true if OPA rejected the request as unauthenticated or unauthorized
+func isAuthenticationError(err error) bool {
+	for ; err != nil; err = unwrapError(err) {
+		if statusError, ok := err.(*UnexpectedStatusError); ok {
+			return statusError.StatusCode == http.StatusUnauthorized || statusError.StatusCode == http.StatusForbidden
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+
+	// DefaultSidecarProbeTimeout is the max duration of probing a sidecar address at startup
+	DefaultSidecarProbeTimeout = time.Second
+
+	// unixSocketScheme prefixes the addresses of OPA servers listening on a unix domain socket
+	unixSocketScheme = "unix://"
+
+	// sidecarSocketHost is the host requests to a sidecar listening on a unix domain socket are sent to
+	sidecarSocketHost = "opa-sidecar"
+)
+
+// DefaultSidecarAddresses are the well-known addresses an OPA sidecar listens on - OPA's default port on the
+// loopback interface, and a unix domain socket
+var DefaultSidecarAddresses = []string{
+	"http://localhost:8181",
+	"unix:///var/run/opa/opa.sock",
+}
+
+// detectSidecar probes the sidecar addresses in order, and queries the first healthy one rather than the configured
+// address (and endpoints). The configured address is kept if none is healthy
+func (c *HTTPClient) detectSidecar(ctx context.Context) {
+	for _, sidecarAddress := range c.sidecarAddresses {
+		var err error
+		if socketPath, isSocket := strings.CutPrefix(sidecarAddress, unixSocketScheme); isSocket {
+			err = c.probeSidecarSocket(ctx, socketPath)
+		} else {
+			err = c.probeSidecar(ctx, sidecarAddress)
+		}
+		if err != nil {
+			c.logger.DebugWithCtx(ctx, "OPA sidecar not detected",
+				"sidecarAddress", sidecarAddress,
+				"err", err.Error())
+			continue
+		}
+
+		c.logger.InfoWithCtx(ctx, "Detected OPA sidecar, querying it rather than the configured address",
+			"sidecarAddress", sidecarAddress,
+			"address", c.address)
+		if socketPath, isSocket := strings.CutPrefix(sidecarAddress, unixSocketScheme); isSocket {
+			c.transport.DialContext = unixSocketDialContext(socketPath, sidecarSocketHost, c.transport.DialContext)
+			sidecarAddress = "http://" + sidecarSocketHost
+		}
+		c.address = sidecarAddress
+		c.endpointProvider = nil
+		return
+	}
+
+	c.logger.InfoWithCtx(ctx, "No OPA sidecar detected, querying the configured address",
+		"address", c.address)
+}
+
+// probeSidecar queries OPA's health API of the sidecar address
+func (c *HTTPClient) probeSidecar(ctx context.Context, sidecarAddress string) error {
+	probeCtx, cancel := context.WithTimeout(ctx, DefaultSidecarProbeTimeout)
+	defer cancel()
+
+	return c.probeEndpoint(probeCtx, sidecarAddress)
+}
+
+// probeSidecarSocket queries OPA's health API of the sidecar listening on the unix domain socket
+func (c *HTTPClient) probeSidecarSocket(ctx context.Context, socketPath string) error {
+	probeCtx, cancel := context.WithTimeout(ctx, DefaultSidecarProbeTimeout)
+	defer cancel()
+
+	transport := &http.Transport{
+		DialContext: unixSocketDialContext(socketPath, sidecarSocketHost, nil),
+	}
+	defer transport.CloseIdleConnections()
+
+	probingClient := *c
+	probingClient.httpClient = &http.Client{
+		Transport: transport,
+	}
+	return probingClient.probeEndpoint(probeCtx, "http://"+sidecarSocketHost)
+}
+
+// unixSocketDialContext dials the unix domain socket for connections to the given host, and the rest by the
+// given dial function
+func unixSocketDialContext(socketPath string,
+	host string,
+	dialContext func(ctx context.Context, network string, address string) (net.Conn, error),
+) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		if addressHost, _, err := net.SplitHostPort(address); err == nil && addressHost == host {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+		if dialContext == nil {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return dialContext(ctx, network, address)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/nuclio/errors"
+)
+
+// DefaultSnapshotBatchSize is the number of resources queried per filter request of a snapshot, unless configured
+const DefaultSnapshotBatchSize = 500
+
+// ResourceLister lists the resources under the given prefix (e.g.: the functions of a project, from the application
+// database), as the resources of a permission snapshot
+type ResourceLister func(ctx context.Context, prefix string) ([]string, error)
+
+// SnapshotConfig configures a permission snapshot
+type SnapshotConfig struct {
+
+	// Prefixes are the resource prefixes (e.g.: /projects/p1) to snapshot the resources under
+	Prefixes []string
+
+	// Lister lists the resources under every prefix
+	Lister ResourceLister
+
+	// Actions to snapshot (the actions defined by the client, unless set)
+	Actions []Action
+
+	// BatchSize is the number of resources queried per filter request (DefaultSnapshotBatchSize, unless set)
+	BatchSize int
+}
+
+// PermissionSnapshot is the permissions of a subject at a point in time, for offline audit reports and access reviews
+type PermissionSnapshot struct {
+	TakenAt   time.Time `json:"takenAt"`
+	MemberIds []string  `json:"memberIds,omitempty"`
+	Subject   *Subject  `json:"subject,omitempty"`
+	Actions   []Action  `json:"actions"`
+
+	// Permissions maps every listed resource to its allowed actions (sorted, empty if none)
+	Permissions map[string][]Action `json:"permissions"`
+}
+
+// TakePermissionSnapshot snapshots the permissions of the subject (given by the permission options) over the resources
+// under the configured prefixes - querying every action against batches of the resources, by multi-resource queries.
+// Decisions are served from the decision cache of the client, if enabled
+func TakePermissionSnapshot(ctx context.Context,
+	client Client,
+	permissionOptions *PermissionOptions,
+	config SnapshotConfig) (*PermissionSnapshot, error) {
+	if config.Lister == nil {
+		return nil, errors.New("Resource lister must be given")
+	}
+	if len(config.Actions) == 0 {
+		config.Actions = standardActions()
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultSnapshotBatchSize
+	}
+	if permissionOptions == nil {
+		permissionOptions = &PermissionOptions{}
+	}
+
+	permissionSnapshot := &PermissionSnapshot{
+		TakenAt:     time.Now(),
+		MemberIds:   permissionOptions.MemberIds,
+		Subject:     permissionOptions.Subject,
+		Actions:     config.Actions,
+		Permissions: map[string][]Action{},
+	}
+
+	var resources []string
+	for _, prefix := range config.Prefixes {
+		prefixResources, err := config.Lister(ctx, prefix)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed to list resources under %s", prefix)
+		}
+		for _, resource := range prefixResources {
+			if _, found := permissionSnapshot.Permissions[resource]; !found {
+				permissionSnapshot.Permissions[resource] = []Action{}
+				resources = append(resources, resource)
+			}
+		}
+	}
+
+	for batch := range slices.Chunk(resources, config.BatchSize) {
+		for _, action := range config.Actions {
+			results, err := client.QueryPermissionsMultiResources(ctx, batch, action, permissionOptions)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Failed to query %s permissions", action)
+			}
+			for resourceIdx, allowed := range results {
+				if allowed {
+					resource := batch[resourceIdx]
+					permissionSnapshot.Permissions[resource] = append(permissionSnapshot.Permissions[resource], action)
+				}
+			}
+		}
+	}
+
+	for _, allowedActions := range permissionSnapshot.Permissions {
+		slices.Sort(allowedActions)
+	}
+	return permissionSnapshot, nil
+}
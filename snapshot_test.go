@@ -0,0 +1,104 @@
+//go:build test_unit
+
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nuclio/errors"
+	"github.com/stretchr/testify/suite"
+)
+
+type PermissionSnapshotTestSuite struct {
+	suite.Suite
+	ctx    context.Context
+	client *MockClient
+}
+
+func (suite *PermissionSnapshotTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.client = &MockClient{}
+
+}
+
+func (suite *PermissionSnapshotTestSuite) TestTakePermissionSnapshot() {
+	listedPrefixes := map[string]int{}
+	permissionOptions := &PermissionOptions{MemberIds: []string{"user1"}}
+	firstBatch := []string{"/projects/p1", "/projects/p1/functions/f1", "/projects/p1/functions/f2", "/projects/p2"}
+	secondBatch := []string{"/projects/p2/functions/f1", "/projects/p2/functions/f2"}
+
+	// reads are allowed within project p1, and updates of its functions only
+	for action, results := range map[Action][][]bool{
+		ActionRead:   {{true, true, true, false}, {false, false}},
+		ActionUpdate: {{false, true, true, false}, {false, false}},
+		ActionDelete: {{false, false, false, false}, {false, false}},
+	} {
+		suite.client.
+			On("QueryPermissionsMultiResources", suite.ctx, firstBatch, action, permissionOptions).
+			Return(results[0], nil).
+			Once()
+		suite.client.
+			On("QueryPermissionsMultiResources", suite.ctx, secondBatch, action, permissionOptions).
+			Return(results[1], nil).
+			Once()
+	}
+
+	permissionSnapshot, err := TakePermissionSnapshot(suite.ctx, suite.client, permissionOptions, SnapshotConfig{
+		Prefixes: []string{mustResource(ProjectResource("p1")), mustResource(ProjectResource("p2"))},
+		Lister: func(ctx context.Context, prefix string) ([]string, error) {
+			listedPrefixes[prefix]++
+			return []string{prefix, prefix + "/functions/f1", prefix + "/functions/f2", prefix}, nil
+		},
+		Actions:   []Action{ActionUpdate, ActionRead, ActionDelete},
+		BatchSize: 4,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal(map[string]int{"/projects/p1": 1, "/projects/p2": 1}, listedPrefixes)
+	suite.Require().Equal([]string{"user1"}, permissionSnapshot.MemberIds)
+	suite.Require().Equal(map[string][]Action{
+		"/projects/p1":              {ActionRead},
+		"/projects/p1/functions/f1": {ActionRead, ActionUpdate},
+		"/projects/p1/functions/f2": {ActionRead, ActionUpdate},
+		"/projects/p2":              {},
+		"/projects/p2/functions/f1": {},
+		"/projects/p2/functions/f2": {},
+	}, permissionSnapshot.Permissions)
+
+	// 6 unique resources in 2 batches, for each of the 3 actions
+	suite.client.AssertExpectations(suite.T())
+}
+
+func (suite *PermissionSnapshotTestSuite) TestListerFailure() {
+	_, err := TakePermissionSnapshot(suite.ctx, suite.client, nil, SnapshotConfig{
+		Prefixes: []string{mustResource(ProjectResource("p1"))},
+		Lister: func(ctx context.Context, prefix string) ([]string, error) {
+			return nil, errors.New("database is down")
+		},
+	})
+	suite.Require().Error(err)
+	suite.client.AssertNotCalled(suite.T(), "QueryPermissionsMultiResources")
+
+	_, err = TakePermissionSnapshot(suite.ctx, suite.client, nil, SnapshotConfig{})
+	suite.Require().Error(err)
+}
+
+func TestPermissionSnapshotTestSuite(t *testing.T) {
+	suite.Run(t, new(PermissionSnapshotTestSuite))
+}
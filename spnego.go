@@ -0,0 +1,108 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/nuclio/errors"
+)
+
+// negotiateScheme is the HTTP authentication scheme of SPNEGO (RFC 4559)
+const negotiateScheme = "Negotiate"
+
+// SPNEGOProvider provides the SPNEGO (Kerberos) tokens requests are negotiated with. It is implemented by adapting
+// the application's Kerberos client (e.g.: gokrb5's spnego package), so this package doesn't depend on a specific one
+type SPNEGOProvider interface {
+
+	// Token returns an initial SPNEGO token, authenticating to the HTTP service principal of the given host
+	// (i.e.: HTTP/host)
+	Token(ctx context.Context, host string) ([]byte, error)
+}
+
+// SPNEGOTransport negotiates SPNEGO authentication with the proxies in front of OPA. Requests challenged with
+// 401 Negotiate responses are retried once with a token, or, if preemptive, tokens are sent with every request
+// up front (saving the challenge round trip)
+type SPNEGOTransport struct {
+	Base       http.RoundTripper
+	Provider   SPNEGOProvider
+	Preemptive bool
+}
+
+func (t *SPNEGOTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if t.Preemptive {
+		authenticatedRequest, err := t.authenticate(request)
+		if err != nil {
+			return nil, err
+		}
+		return t.base().RoundTrip(authenticatedRequest)
+	}
+
+	response, err := t.base().RoundTrip(request)
+	if err != nil || !isNegotiateChallenge(response) || (request.Body != nil && request.GetBody == nil) {
+		return response, err
+	}
+
+	authenticatedRequest, err := t.authenticate(request)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, response.Body) // nolint: errcheck
+	response.Body.Close()              // nolint: errcheck
+	return t.base().RoundTrip(authenticatedRequest)
+}
+
+// authenticate returns a clone of the request (with its body renewed), carrying a SPNEGO token
+func (t *SPNEGOTransport) authenticate(request *http.Request) (*http.Request, error) {
+	token, err := t.Provider.Token(request.Context(), request.URL.Hostname())
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get SPNEGO token of host %s", request.URL.Hostname())
+	}
+
+	authenticatedRequest := request.Clone(request.Context())
+	if request.GetBody != nil {
+		if authenticatedRequest.Body, err = request.GetBody(); err != nil {
+			return nil, errors.Wrap(err, "Failed to renew request body")
+		}
+	}
+	authenticatedRequest.Header.Set("Authorization", negotiateScheme+" "+base64.StdEncoding.EncodeToString(token))
+	return authenticatedRequest, nil
+}
+
+func (t *SPNEGOTransport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// isNegotiateChallenge returns true if the response challenges the request to authenticate by SPNEGO
+func isNegotiateChallenge(response *http.Response) bool {
+	if response.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	for _, challenge := range response.Header.Values("WWW-Authenticate") {
+		if scheme, _, _ := strings.Cut(challenge, " "); strings.EqualFold(scheme, negotiateScheme) {
+			return true
+		}
+	}
+	return false
+}
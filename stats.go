@@ -0,0 +1,150 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultStatsWindow = time.Minute
+
+	// statsLatencySamples is the number of latest query latencies the percentiles are computed over
+	statsLatencySamples = 1000
+)
+
+// Stats are the statistics of the queries sent to OPA over the recent window, for services to adapt by
+// (e.g.: switching to serving cached decisions only once the error rate or latency rises)
+type Stats struct {
+
+	// Window is the duration the statistics were gathered over (shorter than the stats window, if the client
+	// was created more recently)
+	Window time.Duration `json:"window"`
+
+	Queries  int64 `json:"queries"`
+	Failures int64 `json:"failures"`
+
+	// QPS is the rate of queries per second
+	QPS float64 `json:"qps"`
+
+	// ErrorRate is the fraction (0-1) of the queries which failed
+	ErrorRate float64 `json:"errorRate"`
+
+	// latency percentiles of the queries (including retries), over the latest queries of the window
+	LatencyP50 time.Duration `json:"latencyP50"`
+	LatencyP90 time.Duration `json:"latencyP90"`
+	LatencyP99 time.Duration `json:"latencyP99"`
+	LatencyMax time.Duration `json:"latencyMax"`
+}
+
+// queryStats gathers the statistics of the queries sent to OPA over a rolling window
+type queryStats struct {
+	window time.Duration
+
+	lock      sync.Mutex
+	startTime time.Time
+	counts    *rollingCounts
+	latencies []latencySample
+	nextIdx   int
+}
+
+type latencySample struct {
+	time    time.Time
+	latency time.Duration
+}
+
+func newQueryStats(window time.Duration) *queryStats {
+	return &queryStats{
+		window:    window,
+		counts:    newRollingCounts(window),
+		latencies: make([]latencySample, 0, statsLatencySamples),
+	}
+}
+
+// observe records a query which completed at the given time, taking the given latency
+func (s *queryStats) observe(now time.Time, latency time.Duration, failed bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.startTime.IsZero() {
+		s.startTime = now
+	}
+
+	failures := int64(0)
+	if failed {
+		failures = 1
+	}
+	s.counts.add(now, 1, failures)
+
+	sample := latencySample{time: now, latency: latency}
+	if len(s.latencies) < statsLatencySamples {
+		s.latencies = append(s.latencies, sample)
+		return
+	}
+	s.latencies[s.nextIdx] = sample
+	s.nextIdx = (s.nextIdx + 1) % statsLatencySamples
+}
+
+// stats returns the statistics of the window ending at the given time
+func (s *queryStats) stats(now time.Time) Stats {
+	s.lock.Lock()
+	queries, failures := s.counts.sum(now)
+	window := s.window
+	if !s.startTime.IsZero() {
+		window = min(window, max(now.Sub(s.startTime), time.Second))
+	}
+	latencies := make([]time.Duration, 0, len(s.latencies))
+	for _, sample := range s.latencies {
+		if now.Sub(sample.time) < s.window {
+			latencies = append(latencies, sample.latency)
+		}
+	}
+	s.lock.Unlock()
+
+	stats := Stats{
+		Window:   window,
+		Queries:  queries,
+		Failures: failures,
+		QPS:      float64(queries) / window.Seconds(),
+	}
+	if queries > 0 {
+		stats.ErrorRate = float64(failures) / float64(queries)
+	}
+	if len(latencies) > 0 {
+		slices.Sort(latencies)
+		stats.LatencyP50 = latencyPercentile(latencies, 0.5)
+		stats.LatencyP90 = latencyPercentile(latencies, 0.9)
+		stats.LatencyP99 = latencyPercentile(latencies, 0.99)
+		stats.LatencyMax = latencies[len(latencies)-1]
+	}
+	return stats
+}
+
+// latencyPercentile returns the percentile of the given (sorted) latencies, by the nearest rank
+func latencyPercentile(sortedLatencies []time.Duration, percentile float64) time.Duration {
+	percentileIdx := int(math.Ceil(percentile*float64(len(sortedLatencies)))) - 1
+	return sortedLatencies[min(max(percentileIdx, 0), len(sortedLatencies)-1)]
+}
+
+// Stats returns the statistics of the queries sent to OPA over the recent window (see WithStatsWindow), shared by
+// derived clients
+func (c *HTTPClient) Stats() Stats {
+	return c.queryStats.stats(c.clock.Now())
+}
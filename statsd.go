@@ -0,0 +1,101 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nuclio/errors"
+	"github.com/nuclio/logger"
+)
+
+// StatsdMetricsSink sends the client metrics to a statsd server (e.g.: the Datadog agent) over UDP.
+// Labels are sent as Datadog-style tags, and durations as timings in milliseconds
+type StatsdMetricsSink struct {
+	logger     logger.Logger
+	connection net.Conn
+	prefix     string
+	tags       map[string]string
+}
+
+// NewStatsdMetricsSink creates a statsd metrics sink sending to the given address (e.g.: localhost:8125),
+// prefixing the metric names by the given prefix, and tagging all metrics with the given tags
+func NewStatsdMetricsSink(parentLogger logger.Logger,
+	address string,
+	prefix string,
+	tags map[string]string) (*StatsdMetricsSink, error) {
+	connection, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to connect to statsd at %s", address)
+	}
+
+	return &StatsdMetricsSink{
+		logger:     childLogger(parentLogger, "opa-statsd"),
+		connection: connection,
+		prefix:     prefix,
+		tags:       tags,
+	}, nil
+}
+
+func (s *StatsdMetricsSink) IncrementCounter(name string, value int64, labels map[string]string) {
+	s.send(name, strconv.FormatInt(value, 10), "c", labels)
+}
+
+func (s *StatsdMetricsSink) SetGauge(name string, value float64, labels map[string]string) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", labels)
+}
+
+func (s *StatsdMetricsSink) ObserveDuration(name string, duration time.Duration, labels map[string]string) {
+	s.send(name, strconv.FormatFloat(float64(duration)/float64(time.Millisecond), 'f', -1, 64), "ms", labels)
+}
+
+// Close closes the connection to the statsd server
+func (s *StatsdMetricsSink) Close() error {
+	return s.connection.Close()
+}
+
+// send sends a metric in the statsd format (e.g.: opa_client_queries_total:1|c|#status:success)
+func (s *StatsdMetricsSink) send(name string, value string, metricType string, labels map[string]string) {
+	tags := s.tags
+	if len(labels) > 0 {
+		tags = maps.Clone(s.tags)
+		if tags == nil {
+			tags = map[string]string{}
+		}
+		maps.Copy(tags, labels)
+	}
+
+	metric := fmt.Sprintf("%s%s:%s|%s", s.prefix, name, value, metricType)
+	if len(tags) > 0 {
+		encodedTags := make([]string, 0, len(tags))
+		for _, tagName := range slices.Sorted(maps.Keys(tags)) {
+			encodedTags = append(encodedTags, tagName+":"+tags[tagName])
+		}
+		metric += "|#" + strings.Join(encodedTags, ",")
+	}
+
+	// metrics are best effort, and statsd is usually local
+	if _, err := s.connection.Write([]byte(metric)); err != nil {
+		s.logger.DebugWith("Failed to send metric", "name", name, "err", err.Error())
+	}
+}
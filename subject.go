@@ -0,0 +1,113 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SubjectResolver resolves the subject of a query from its context (e.g.: from a session store or an IdP),
+// when the permission options set neither member ids nor a subject
+type SubjectResolver interface {
+	ResolveSubject(ctx context.Context) (*Subject, error)
+}
+
+// SubjectResolverFunc adapts a function to a SubjectResolver
+type SubjectResolverFunc func(ctx context.Context) (*Subject, error)
+
+func (f SubjectResolverFunc) ResolveSubject(ctx context.Context) (*Subject, error) {
+	return f(ctx)
+}
+
+// CachingSubjectResolver caches the subjects resolved by another resolver, keyed by the request context
+// (e.g.: by session id). Contexts without a key are resolved without caching
+type CachingSubjectResolver struct {
+	resolver SubjectResolver
+	keyFunc  func(ctx context.Context) string
+	ttl      time.Duration
+	maxSize  int
+
+	lock     sync.Mutex
+	subjects map[string]cachedSubject
+}
+
+type cachedSubject struct {
+	subject   *Subject
+	expiresAt time.Time
+}
+
+func NewCachingSubjectResolver(resolver SubjectResolver,
+	keyFunc func(ctx context.Context) string,
+	ttl time.Duration,
+	maxSize int) *CachingSubjectResolver {
+	if maxSize <= 0 {
+		maxSize = DefaultCacheSize
+	}
+	return &CachingSubjectResolver{
+		resolver: resolver,
+		keyFunc:  keyFunc,
+		ttl:      ttl,
+		maxSize:  maxSize,
+		subjects: map[string]cachedSubject{},
+	}
+}
+
+func (r *CachingSubjectResolver) ResolveSubject(ctx context.Context) (*Subject, error) {
+	key := r.keyFunc(ctx)
+	if key == "" {
+		return r.resolver.ResolveSubject(ctx)
+	}
+
+	r.lock.Lock()
+	cached, found := r.subjects[key]
+	r.lock.Unlock()
+	if found && time.Now().Before(cached.expiresAt) {
+		return cached.subject, nil
+	}
+
+	subject, err := r.resolver.ResolveSubject(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// make room by dropping the expired subjects, or else an arbitrary one
+	if len(r.subjects) >= r.maxSize {
+		now := time.Now()
+		for cachedKey, cached := range r.subjects {
+			if now.After(cached.expiresAt) {
+				delete(r.subjects, cachedKey)
+			}
+		}
+		for cachedKey := range r.subjects {
+			if len(r.subjects) < r.maxSize {
+				break
+			}
+			delete(r.subjects, cachedKey)
+		}
+	}
+
+	r.subjects[key] = cachedSubject{
+		subject:   subject,
+		expiresAt: time.Now().Add(r.ttl),
+	}
+	return subject, nil
+}
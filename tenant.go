@@ -0,0 +1,75 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/nuclio/errors"
+)
+
+const (
+
+	// TenantInputField is the query input field the tenant of a query is sent in (input.tenant)
+	TenantInputField = "tenant"
+
+	// TenantPathPlaceholder is replaced by the tenant of a query in the policy paths it is sent to
+	// (e.g.: /v1/data/tenants/{tenant}/authz/allow)
+	TenantPathPlaceholder = "{tenant}"
+)
+
+// ErrTenantRequired is matched (using errors.Is) by the error returned when a tenant policy path is queried
+// without a tenant
+var ErrTenantRequired = errors.New("Tenant is required")
+
+type tenantContextKey struct{}
+
+// withTenant returns a context carrying the tenant to expand the policy paths by
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+func tenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// isTenantPathTemplate returns true if the policy path is expanded by the query tenant
+func isTenantPathTemplate(path string) bool {
+	return strings.Contains(path, TenantPathPlaceholder)
+}
+
+// expandTenantPath replaces the tenant placeholders of the policy path by the (escaped) tenant the context carries,
+// failing if it carries none. Tenants which would escape their path segment (., .. or containing /) are invalid input
+func expandTenantPath(ctx context.Context, path string) (string, error) {
+	if !isTenantPathTemplate(path) {
+		return path, nil
+	}
+	tenant := tenantFromContext(ctx)
+	if tenant == "" {
+		return "", errors.Wrapf(ErrTenantRequired, "Policy path %s requires a tenant", path)
+	}
+	if tenant == "." || tenant == ".." || strings.Contains(tenant, "/") {
+		return "", &InputValidationError{
+			Path: path,
+			Err:  errors.Errorf("Tenant %q is not a valid path segment", tenant),
+		}
+	}
+	return strings.ReplaceAll(path, TenantPathPlaceholder, url.PathEscape(tenant)), nil
+}
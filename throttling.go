@@ -0,0 +1,97 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nuclio/errors"
+)
+
+const (
+	DefaultThrottlingWindow     = 2 * time.Minute
+	DefaultThrottlingMultiplier = 2.0
+)
+
+// ErrUnreachable is matched (using errors.Is) by the error returned when a request to OPA is rejected locally by the
+// adaptive throttling (see WithAdaptiveThrottling), OPA having failed most of the recent requests
+var ErrUnreachable = errors.New("OPA is unreachable")
+
+// adaptiveThrottling rejects requests locally in proportion to the recent failure rate of OPA (client-side
+// throttling, as described in Google's SRE book). Having counted the requests and the accepted requests (those OPA
+// answered) over the window, a request is rejected at the probability of
+// max(0, (requests - multiplier * accepts) / (requests + 1)).
+// Low priority requests are rejected by half the multiplier, so they are throttled before high priority ones
+type adaptiveThrottling struct {
+	multiplier float64
+	random     func() float64
+
+	lock   sync.Mutex
+	counts *rollingCounts
+}
+
+func newAdaptiveThrottling(window time.Duration, multiplier float64) *adaptiveThrottling {
+	return &adaptiveThrottling{
+		multiplier: multiplier,
+		random:     rand.Float64,
+		counts:     newRollingCounts(window),
+	}
+}
+
+// empty returns a new throttling of the same window and multiplier, having counted no requests yet
+func (t *adaptiveThrottling) empty() *adaptiveThrottling {
+	return &adaptiveThrottling{
+		multiplier: t.multiplier,
+		random:     t.random,
+		counts:     t.counts.empty(),
+	}
+}
+
+// allow returns whether a request may be sent, along with the rejection probability.
+// Rejected requests are counted as well, so the rejection probability keeps growing while OPA is unreachable
+func (t *adaptiveThrottling) allow(now time.Time, priority Priority) (bool, float64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	requests, accepts := t.counts.sum(now)
+	t.counts.add(now, 1, 0)
+
+	multiplier := t.multiplier
+	if priority == PriorityLow {
+		multiplier /= 2
+	}
+	rejectionProbability := max(0, (float64(requests)-multiplier*float64(accepts))/float64(requests+1))
+	return t.random() >= rejectionProbability, rejectionProbability
+}
+
+// accept counts a request OPA answered
+func (t *adaptiveThrottling) accept(now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.counts.add(now, 0, 1)
+}
+
+// isAnsweredRequestError returns true if the error of a request is an answer of OPA (e.g.: a policy error) rather
+// than a failure to reach it (e.g.: a connection error, a timeout or an unavailability status)
+func isAnsweredRequestError(err error) bool {
+	statusError, ok := err.(*UnexpectedStatusError)
+	return ok && statusError.StatusCode < http.StatusInternalServerError && statusError.StatusCode != http.StatusTooManyRequests
+}
@@ -16,7 +16,16 @@ limitations under the License.
 
 package opaclient
 
-import "time"
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nuclio/errors"
+)
 
 type ClientKind string
 
@@ -27,6 +36,26 @@ const (
 
 	DefaultClientKind     = ClientKindNop
 	DefaultRequestTimeOut = 10 * time.Second
+	DefaultCacheSize      = 10000
+
+	// DefaultDecisionLogMaxSize is the size in bytes a decision log file is rotated at
+	DefaultDecisionLogMaxSize = 100 * 1024 * 1024
+
+	// DefaultStatusPath is OPA's status API, reporting bundles and plugins state
+	DefaultStatusPath = "/v1/status"
+
+	// DefaultHealthPath is OPA's health API, responding successfully once the server is ready
+	DefaultHealthPath = "/health"
+
+	// DefaultMaxResponseSize is the size in bytes of the largest OPA response read, unless configured
+	DefaultMaxResponseSize = 64 * 1024 * 1024
+
+	// DefaultConfigPath is OPA's config API, reporting the server version (as a label) and active configuration
+	DefaultConfigPath = "/v1/config"
+
+	// DefaultAdaptiveTimeoutMultiplier and DefaultAdaptiveTimeoutMin apply to adaptive timeouts, unless configured
+	DefaultAdaptiveTimeoutMultiplier = 2
+	DefaultAdaptiveTimeoutMin        = 100 * time.Millisecond
 )
 
 type Config struct {
@@ -40,32 +69,446 @@ type Config struct {
 	// timeout period when querying opa server
 	RequestTimeout int `json:"requestTimeout,omitempty"`
 
+	// timeouts in seconds of establishing a connection, completing the TLS handshake, and receiving the response
+	// headers (after sending the request), each bounded by RequestTimeout as well (0 leaves them unbounded)
+	DialTimeout           int `json:"dialTimeout,omitempty"`
+	TLSHandshakeTimeout   int `json:"tlsHandshakeTimeout,omitempty"`
+	ResponseHeaderTimeout int `json:"responseHeaderTimeout,omitempty"`
+
+	// time out requests to each OPA endpoint at its observed latency percentile (e.g.: 0.99, 0 disables it) times
+	// the multiplier, and no less than the minimum in milliseconds, rather than at RequestTimeout
+	AdaptiveTimeoutPercentile float64 `json:"adaptiveTimeoutPercentile,omitempty"`
+	AdaptiveTimeoutMultiplier float64 `json:"adaptiveTimeoutMultiplier,omitempty"`
+	AdaptiveTimeoutMinMillis  int     `json:"adaptiveTimeoutMinMillis,omitempty"`
+
+	// reject requests to OPA locally in proportion to its failure rate over the window in seconds, once it fails more
+	// than 1/multiplier of the requests (see WithAdaptiveThrottling). Unset window and multiplier are defaulted
+	AdaptiveThrottling           bool    `json:"adaptiveThrottling,omitempty"`
+	AdaptiveThrottlingWindow     int     `json:"adaptiveThrottlingWindow,omitempty"`
+	AdaptiveThrottlingMultiplier float64 `json:"adaptiveThrottlingMultiplier,omitempty"`
+
+	// maximum number of requests sent to OPA concurrently, beyond which requests wait (0 leaves them unlimited)
+	MaxConcurrentRequests int `json:"maxConcurrentRequests,omitempty"`
+
+	// maximum number of requests waiting for a slot under MaxConcurrentRequests, beyond which requests fail with
+	// ErrOverloaded (0 leaves the queue unbounded)
+	RequestQueueSize int `json:"requestQueueSize,omitempty"`
+
+	// number of resources per filter request of multi-resource queries (0 queries them in a single request),
+	// and the number of such chunks queried concurrently (sequentially, unless greater than 1)
+	FilterChunkSize        int `json:"filterChunkSize,omitempty"`
+	FilterChunkConcurrency int `json:"filterChunkConcurrency,omitempty"`
+
+	// number of connections to pre-establish to every endpoint during the client construction (0 disables it)
+	WarmupConnections int `json:"warmupConnections,omitempty"`
+
+	// period in seconds to cache OPA host name resolutions for (0 disables caching).
+	// Hosts are re-resolved once connecting to them fails
+	DNSCacheTTL int `json:"dnsCacheTTL,omitempty"`
+
 	// the path used when querying single resource against opa server (e.g.: /v1/data/somewhere/authz/allow)
 	PermissionQueryPath string `json:"permissionQueryPath,omitempty"`
 
 	// the path used when querying multiple resources against opa server (e.g.: /v1/data/somewhere/authz/filter_allowed)
 	PermissionFilterPath string `json:"permissionFilterPath,omitempty"`
 
+	// PermissionResourceActionsPath is queried for multiple resources, each with its own action, in a single request
+	// (see QueryPermissionsResourceActions). While unset, the resources of each action are queried separately
+	PermissionResourceActionsPath string `json:"permissionResourceActionsPath,omitempty"`
+
+	// PermissionAllowedActionsPath is queried for the allowed actions of a resource (see AllowedActions)
+	PermissionAllowedActionsPath string `json:"permissionAllowedActionsPath,omitempty"`
+
+	// PermissionMultiSubjectsPath is queried for a resource for multiple subjects in a single request
+	// (see QueryPermissionsMultiSubjects). While unset, each subject is queried separately
+	PermissionMultiSubjectsPath string `json:"permissionMultiSubjectsPath,omitempty"`
+
+	// PermissionPaginatedFilterPath is queried for the allowed resources page by page (see ListAllowedResources)
+	PermissionPaginatedFilterPath string `json:"permissionPaginatedFilterPath,omitempty"`
+
+	// number of allowed resources to list per page (defaults to 1000)
+	FilterPageSize int `json:"filterPageSize,omitempty"`
+
 	// for extra verbosity
 	Verbose bool `json:"verbose,omitempty"`
 
 	// the header value for bypassing OPA if needed
 	OverrideHeaderValue string `json:"overrideHeaderValue,omitempty"`
 
+	// request header to read the override value from (see PermissionOptions.RequestHeaders),
+	// and override values accepted along with OverrideHeaderValue (e.g.: one per internal service)
+	OverrideHeaderName   string   `json:"overrideHeaderName,omitempty"`
+	OverrideHeaderValues []string `json:"overrideHeaderValues,omitempty"`
+
+	// keys to verify override tokens by (see SignOverrideToken), and the accepted token issuers (empty accepts all)
+	OverrideTokenKeys    []string `json:"overrideTokenKeys,omitempty"`
+	OverrideTokenIssuers []string `json:"overrideTokenIssuers,omitempty"`
+
+	// key to sign the query requests by, for gateways in front of OPA to verify (see WithRequestSigning)
+	RequestSigningKey string `json:"requestSigningKey,omitempty"`
+
+	// bearer token to authenticate against OPA with (ignored when authenticating by OAuth2)
+	BearerToken string `json:"bearerToken,omitempty"`
+
+	// the secrets above (bearer token, override header values, override token keys and request signing key) may be
+	// references (e.g.: file:///var/run/secrets/opa/token, env://OPA_TOKEN or vault://secret/opa#token), resolved by
+	// the given resolvers (defaulting to DefaultSecretResolvers) and re-resolved every interval in seconds
+	// (defaulting to 60) so rotated secrets take effect. The OAuth2 client secret may be a reference as well,
+	// resolved once (see WithSecretReferences)
+	SecretResolvers       SecretResolvers `json:"-"`
+	SecretRefreshInterval int             `json:"secretRefreshInterval,omitempty"`
+
 	// SkipTLSVerify indicates whether to skip TLS verification for the OPA server
 	SkipTLSVerify bool `json:"skipTLSVerify,omitempty"`
+
+	// query OPA with strict builtin errors, failing queries whose builtins fail rather than leaving them undefined,
+	// and with instrumentation, attaching its performance metrics to the decisions
+	StrictBuiltinErrors bool `json:"strictBuiltinErrors,omitempty"`
+	Instrument          bool `json:"instrument,omitempty"`
+
+	// paths of the client certificate and key, and of the CA to verify the OPA server by.
+	// The files are reloaded once changed (e.g.: rotated)
+	TLSCertFile string `json:"tlsCertFile,omitempty"`
+	TLSKeyFile  string `json:"tlsKeyFile,omitempty"`
+	TLSCAFile   string `json:"tlsCAFile,omitempty"`
+
+	// TLS configurations of specific OPA server addresses (e.g.: https://opa-remote:8443), overriding the above
+	// (e.g.: mTLS to remote servers, along with plaintext sidecars)
+	EndpointTLS map[string]*EndpointTLSConfig `json:"endpointTLS,omitempty"`
+
+	// OAuth2 client credentials to authenticate against OPA with (empty token URL disables it)
+	OAuth2TokenURL     string   `json:"oauth2TokenURL,omitempty"`
+	OAuth2ClientID     string   `json:"oauth2ClientID,omitempty"`
+	OAuth2ClientSecret string   `json:"oauth2ClientSecret,omitempty"`
+	OAuth2Scopes       []string `json:"oauth2Scopes,omitempty"`
+
+	// negotiate SPNEGO (Kerberos) authentication with the proxies in front of OPA, by tokens of the given provider -
+	// up front with every request if preemptive, or else once challenged
+	SPNEGOProvider   SPNEGOProvider `json:"-"`
+	SPNEGOPreemptive bool           `json:"spnegoPreemptive,omitempty"`
+
+	// forward the identity carried by the request context (raw JWT / claims) in the query input, as input.identity
+	ForwardIdentity bool `json:"forwardIdentity,omitempty"`
+
+	// send requests to OPA using the given HTTP client, or round tripper, instead of the internally built ones
+	HTTPClient   *http.Client      `json:"-"`
+	RoundTripper http.RoundTripper `json:"-"`
+
+	// balance queries between the OPA servers provided by the given endpoint provider, instead of Address
+	// (e.g.: k8sdiscovery.Discovery)
+	EndpointProvider EndpointProvider `json:"-"`
+
+	// validate the input of every query before it is sent, by the standard validator (see StandardInputValidator)
+	// and by the given validators
+	ValidateInput   bool             `json:"validateInput,omitempty"`
+	InputValidators []InputValidator `json:"-"`
+
+	// normalizations applied to every queried resource, in order (trim, lowercase, nfc, collapse_slashes),
+	// followed by the given normalizer
+	ResourceNormalization []string           `json:"resourceNormalization,omitempty"`
+	ResourceNormalizer    ResourceNormalizer `json:"-"`
+
+	// hooks invoked around every query sent to OPA (in order)
+	Interceptors []Interceptor `json:"-"`
+
+	// statsd server (e.g.: the Datadog agent) address to send the client metrics to (empty disables it),
+	// along with the metric names prefix and the tags of all metrics
+	StatsdAddress string            `json:"statsdAddress,omitempty"`
+	StatsdPrefix  string            `json:"statsdPrefix,omitempty"`
+	StatsdTags    map[string]string `json:"statsdTags,omitempty"`
+
+	// hooks invoked with the record of every permission decision
+	DecisionHooks []DecisionHooks `json:"-"`
+
+	// hook invoked with every failed attempt to query OPA which is about to be retried
+	OnRetry func(attempt int, err error, nextDelay time.Duration) `json:"-"`
+
+	// bound the retries over the window in seconds to the given ratio (e.g.: 0.2) of the queries over it, plus the
+	// given minimum number of retries (see WithRetryBudget). A zero ratio disables the budget
+	RetryBudgetRatio      float64 `json:"retryBudgetRatio,omitempty"`
+	RetryBudgetWindow     int     `json:"retryBudgetWindow,omitempty"`
+	RetryBudgetMinRetries int     `json:"retryBudgetMinRetries,omitempty"`
+
+	// window in seconds to gather the statistics returned by Stats over (0 defaults to a minute)
+	StatsWindow int `json:"statsWindow,omitempty"`
+
+	// send a generated decision id with every query, for policies to echo into their decision logs
+	// (see WithDecisionIDs)
+	DecisionIDs bool `json:"decisionIDs,omitempty"`
+
+	// send single-resource queries whose url-encoded input is up to the given size in bytes as GET requests, for
+	// intermediaries to cache (0 disables it, see WithGETQueries)
+	GETQueryMaxInputSize int `json:"getQueryMaxInputSize,omitempty"`
+
+	// route the permission queries of resource prefixes and/or actions to different OPA servers and policies
+	// (see WithRoutes)
+	Routes []Route `json:"routes,omitempty"`
+
+	// probe well-known sidecar addresses (or the given ones) at startup, and query the first healthy one rather than
+	// the address (see WithSidecarDetection)
+	SidecarDetection bool     `json:"sidecarDetection,omitempty"`
+	SidecarAddresses []string `json:"sidecarAddresses,omitempty"`
+
+	// validate the policy paths at startup, logging those not found (see WithPolicyPathValidation)
+	ValidatePolicyPaths bool `json:"validatePolicyPaths,omitempty"`
+
+	// writer to dump the requests of contexts asking for it to (see WithRequestDump)
+	RequestDumpWriter io.Writer `json:"-"`
+
+	// period in seconds to cache permission decisions for (0 disables caching)
+	CacheTTL int `json:"cacheTTL,omitempty"`
+
+	// period in seconds to cache deny decisions for, if different than CacheTTL (0 disables caching denies)
+	CacheDenyTTL *int `json:"cacheDenyTTL,omitempty"`
+
+	// periods in seconds to cache the decisions of specific actions for, instead of CacheTTL (and CacheDenyTTL).
+	// 0 disables caching the action's decisions
+	CacheActionTTLs map[Action]int `json:"cacheActionTTLs,omitempty"`
+
+	// maximum number of cached permission decisions
+	CacheSize int `json:"cacheSize,omitempty"`
+
+	// period in seconds before a cached decision expires, during which serving it triggers a background refresh
+	CacheRefreshWindow int `json:"cacheRefreshWindow,omitempty"`
+
+	// path of a local file to write decision records to, as JSON lines (empty disables decision logging)
+	DecisionLogPath string `json:"decisionLogPath,omitempty"`
+
+	// size in megabytes the decision log file is rotated at
+	DecisionLogMaxSizeMB int `json:"decisionLogMaxSizeMB,omitempty"`
+
+	// number of rotated decision log files to keep
+	DecisionLogMaxBackups int `json:"decisionLogMaxBackups,omitempty"`
+
+	// URL of an HTTP collector to post decision records to (empty disables it)
+	DecisionLogCollectorURL string `json:"decisionLogCollectorURL,omitempty"`
+
+	// maximum number of decision records queued for writing, beyond which records are dropped
+	DecisionLogQueueSize int `json:"decisionLogQueueSize,omitempty"`
+
+	// period in seconds to flush queued decision records at
+	DecisionLogFlushInterval int `json:"decisionLogFlushInterval,omitempty"`
+
+	// period in seconds to probe the health of the OPA endpoints at (0 disables probing)
+	HealthProbeInterval int `json:"healthProbeInterval,omitempty"`
+
+	// listeners notified once the health state of the OPA endpoints changes, when probed
+	HealthListeners []HealthListener `json:"-"`
+
+	// size in bytes of the largest OPA response read, failing larger ones (defaults to 64MiB)
+	MaxResponseSize int64 `json:"maxResponseSize,omitempty"`
+
+	// request OPA's provenance along with every decision (i.e.: the bundle revisions it was evaluated by)
+	Provenance bool `json:"provenance,omitempty"`
+
+	// period in seconds to poll OPA's status at, flushing the decision cache once the policy revision changes
+	RevisionPollInterval int `json:"revisionPollInterval,omitempty"`
+
+	// period in seconds past their expiry, during which cached decisions are served if OPA is unavailable
+	CacheMaxStaleness int `json:"cacheMaxStaleness,omitempty"`
+
+	// local rule set to decide by when OPA is unavailable (nil fails such queries)
+	FallbackPolicy *FallbackPolicy `json:"fallbackPolicy,omitempty"`
+
+	// enforcement mode (enforce / monitor)
+	EnforcementMode EnforcementMode `json:"enforcementMode,omitempty"`
+
+	// shadow evaluation - every query is sent to the shadow address/paths as well, and divergences are reported.
+	// Unset address/paths default to the primary ones, and leaving all unset disables shadow evaluation
+	ShadowAddress              string `json:"shadowAddress,omitempty"`
+	ShadowPermissionQueryPath  string `json:"shadowPermissionQueryPath,omitempty"`
+	ShadowPermissionFilterPath string `json:"shadowPermissionFilterPath,omitempty"`
+
+	// canary evaluation - the given percentage (0-100) of the queries is sent to the canary paths as well,
+	// and their agreement is reported. Unset paths default to the primary ones, and a zero percentage disables it
+	CanaryPermissionQueryPath  string  `json:"canaryPermissionQueryPath,omitempty"`
+	CanaryPermissionFilterPath string  `json:"canaryPermissionFilterPath,omitempty"`
+	CanaryPercentage           float64 `json:"canaryPercentage,omitempty"`
 }
 
+type EnforcementMode string
+
+const (
+
+	// EnforcementModeEnforce returns the policy decisions
+	EnforcementModeEnforce EnforcementMode = "enforce"
+
+	// EnforcementModeMonitor always allows, recording what the policy decisions would have been
+	EnforcementModeMonitor EnforcementMode = "monitor"
+)
+
+type HierarchyMode string
+
+const (
+
+	// HierarchyModeNone evaluates the resource alone
+	HierarchyModeNone HierarchyMode = ""
+
+	// HierarchyModeInput sends the resource ancestors in the query input, letting the policy honor parent-level grants
+	HierarchyModeInput HierarchyMode = "input"
+
+	// HierarchyModeClient evaluates the resource and its ancestors in a single filter request,
+	// allowing the resource if any of them is allowed
+	HierarchyModeClient HierarchyMode = "client"
+)
+
 type PermissionOptions struct {
 	MemberIds           []string
 	RaiseForbidden      bool
 	OverrideHeaderValue string
+
+	// RequestHeaders are the headers of the request being authorized, which the override value is read from
+	// (see WithOverride), unless OverrideHeaderValue is set
+	RequestHeaders http.Header
+
+	// Subject distinguishes the user identity from its group memberships, roles and tenant.
+	// When MemberIds is not set, the subject user and group ids are sent as the member ids
+	Subject *Subject
+
+	// Tenant the permission is queried in (the subject tenant, unless set), sent in the query input as input.tenant
+	// and replacing the tenant placeholders of the policy paths (see TenantPathPlaceholder)
+	Tenant string
+
+	// HierarchyMode determines whether the resource ancestors (e.g.: projects/p1 for projects/p1/functions/f1)
+	// are evaluated along with the resource
+	HierarchyMode HierarchyMode
+
+	// Priority of the query (PriorityHigh, unless set). Low priority queries (e.g.: background reconciliation) yield
+	// to high priority ones under the concurrency limit and adaptive throttling
+	Priority Priority
+
+	// Verbose overrides the client verbosity for the query, e.g.: to trace a troubled request with full logging
+	// while the client logs quietly
+	Verbose *bool
+
+	// ExtraInput fields are merged into the query input (e.g.: request IP, time, labels), for richer policies.
+	// They cannot override the fields set by the client (e.g.: resource, action)
+	ExtraInput map[string]any
+
+	// ResourceAttributes are the attributes (e.g.: owner, labels, sensitivity) of the queried resources, keyed by
+	// the resources (relative to the scope, of scoped clients), sent along with them in the query input
+	// (input.attributes) so attribute-based policies needn't fetch them from OPA data documents
+	ResourceAttributes map[string]map[string]any
+}
+
+// resourceAttributes returns the attributes of the given resources, keyed by the resources (nil if none are set)
+func (o *PermissionOptions) resourceAttributes(resources []string) map[string]map[string]any {
+	var resourceAttributes map[string]map[string]any
+	for _, resource := range resources {
+		if attributes, found := o.ResourceAttributes[resource]; found {
+			if resourceAttributes == nil {
+				resourceAttributes = map[string]map[string]any{}
+			}
+			resourceAttributes[resource] = attributes
+		}
+	}
+	return resourceAttributes
+}
+
+// tenant returns the tenant to query in
+func (o *PermissionOptions) tenant() string {
+	if o.Tenant != "" || o.Subject == nil {
+		return o.Tenant
+	}
+	return o.Subject.Tenant
+}
+
+// memberIds returns the member ids to query with
+func (o *PermissionOptions) memberIds() []string {
+	if len(o.MemberIds) > 0 || o.Subject == nil {
+		return o.MemberIds
+	}
+	return o.Subject.memberIds()
+}
+
+// withDefaults returns the permission options, with their unset fields taken from the given default ones.
+// Default extra input fields are overridden by the given ones
+func (o *PermissionOptions) withDefaults(defaultPermissionOptions *PermissionOptions) PermissionOptions {
+	permissionOptions := *o
+	if defaultPermissionOptions == nil {
+		return permissionOptions
+	}
+
+	if len(o.MemberIds) == 0 && o.Subject == nil {
+		permissionOptions.MemberIds = defaultPermissionOptions.MemberIds
+		permissionOptions.Subject = defaultPermissionOptions.Subject
+	}
+	if o.Tenant == "" {
+		permissionOptions.Tenant = defaultPermissionOptions.Tenant
+	}
+	permissionOptions.RaiseForbidden = o.RaiseForbidden || defaultPermissionOptions.RaiseForbidden
+	if o.OverrideHeaderValue == "" {
+		permissionOptions.OverrideHeaderValue = defaultPermissionOptions.OverrideHeaderValue
+	}
+	if o.HierarchyMode == "" {
+		permissionOptions.HierarchyMode = defaultPermissionOptions.HierarchyMode
+	}
+	if o.Priority == "" {
+		permissionOptions.Priority = defaultPermissionOptions.Priority
+	}
+	if o.Verbose == nil {
+		permissionOptions.Verbose = defaultPermissionOptions.Verbose
+	}
+	if len(defaultPermissionOptions.ExtraInput) > 0 {
+		permissionOptions.ExtraInput = make(map[string]any,
+			len(defaultPermissionOptions.ExtraInput)+len(o.ExtraInput))
+		for fieldName, fieldValue := range defaultPermissionOptions.ExtraInput {
+			permissionOptions.ExtraInput[fieldName] = fieldValue
+		}
+		for fieldName, fieldValue := range o.ExtraInput {
+			permissionOptions.ExtraInput[fieldName] = fieldValue
+		}
+	}
+	return permissionOptions
+}
+
+// setExtraInputField sets an extra input field, copying the extra input (which may be shared) first
+func (o *PermissionOptions) setExtraInputField(fieldName string, fieldValue any) {
+	extraInput := make(map[string]any, len(o.ExtraInput)+1)
+	for existingFieldName, existingFieldValue := range o.ExtraInput {
+		extraInput[existingFieldName] = existingFieldValue
+	}
+	extraInput[fieldName] = fieldValue
+	o.ExtraInput = extraInput
+}
+
+// Subject is the identity a permission is queried for, sent in the query input as input.subject
+type Subject struct {
+	UserID   string   `json:"userId,omitempty"`
+	GroupIDs []string `json:"groupIds,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	Tenant   string   `json:"tenant,omitempty"`
+}
+
+func (s *Subject) memberIds() []string {
+	var memberIds []string
+	if s.UserID != "" {
+		memberIds = append(memberIds, s.UserID)
+	}
+	return append(memberIds, s.GroupIDs...)
 }
 
 type PermissionQueryRequestInput struct {
-	Resource string   `json:"resource,omitempty"`
-	Action   string   `json:"action,omitempty"`
-	Ids      []string `json:"ids,omitempty"`
+	Resource  string   `json:"resource,omitempty"`
+	Action    string   `json:"action,omitempty"`
+	Ids       []string `json:"ids,omitempty"`
+	Subject   *Subject `json:"subject,omitempty"`
+	Ancestors []string `json:"ancestors,omitempty"`
+
+	// Attributes are the resource attributes (see PermissionOptions.ResourceAttributes)
+	Attributes map[string]any `json:"attributes,omitempty"`
+
+	// Prefix is set for wildcard resources (e.g.: /projects/p1/* -> /projects/p1/),
+	// letting the policy allow if the action is allowed on anything under it
+	Prefix string `json:"prefix,omitempty"`
+
+	// Extra fields are merged into the input
+	Extra map[string]any `json:"-"`
+}
+
+func (i PermissionQueryRequestInput) MarshalJSON() ([]byte, error) {
+	type permissionQueryRequestInput PermissionQueryRequestInput
+	return marshalInputWithExtra(permissionQueryRequestInput(i), i.Extra)
 }
 
 type PermissionQueryRequest struct {
@@ -73,9 +516,47 @@ type PermissionQueryRequest struct {
 }
 
 type PermissionFilterRequestInput struct {
-	Resources []string `json:"resources,omitempty"`
-	Action    string   `json:"action,omitempty"`
-	Ids       []string `json:"ids,omitempty"`
+	Resources []string            `json:"resources,omitempty"`
+	Action    string              `json:"action,omitempty"`
+	Ids       []string            `json:"ids,omitempty"`
+	Subject   *Subject            `json:"subject,omitempty"`
+	Ancestors map[string][]string `json:"ancestors,omitempty"`
+
+	// Attributes maps the resources to their attributes (see PermissionOptions.ResourceAttributes)
+	Attributes map[string]map[string]any `json:"attributes,omitempty"`
+
+	// Prefixes maps the wildcard resources to their prefixes
+	Prefixes map[string]string `json:"prefixes,omitempty"`
+
+	// Extra fields are merged into the input
+	Extra map[string]any `json:"-"`
+}
+
+func (i PermissionFilterRequestInput) MarshalJSON() ([]byte, error) {
+	type permissionFilterRequestInput PermissionFilterRequestInput
+	return marshalInputWithExtra(permissionFilterRequestInput(i), i.Extra)
+}
+
+// marshalInputWithExtra marshals a query input along with extra fields, which cannot override the input fields
+func marshalInputWithExtra(input any, extra map[string]any) ([]byte, error) {
+	encodedInput, err := json.Marshal(input)
+	if err != nil || len(extra) == 0 {
+		return encodedInput, err
+	}
+
+	inputFields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(encodedInput, &inputFields); err != nil {
+		return nil, err
+	}
+
+	mergedInput := make(map[string]any, len(extra)+len(inputFields))
+	for fieldName, fieldValue := range extra {
+		mergedInput[fieldName] = fieldValue
+	}
+	for fieldName, fieldValue := range inputFields {
+		mergedInput[fieldName] = fieldValue
+	}
+	return json.Marshal(mergedInput)
 }
 
 type PermissionFilterRequest struct {
@@ -83,11 +564,206 @@ type PermissionFilterRequest struct {
 }
 
 type PermissionQueryResponse struct {
-	Result bool `json:"result,omitempty"`
+	Result     bool           `json:"result,omitempty"`
+	Provenance *Provenance    `json:"provenance,omitempty"`
+	Metrics    map[string]any `json:"metrics,omitempty"`
+
+	// Reason, Violations and Obligations are set when the policy returns a rich result
+	// ({allow, reason, violations, obligations})
+	Reason      string      `json:"-"`
+	Violations  []string    `json:"-"`
+	Obligations Obligations `json:"-"`
+
+	// CacheTTL is set when the rich result suggests a cache TTL (ttl_seconds)
+	CacheTTL *time.Duration `json:"-"`
+}
+
+// maxCacheTTLHint caps the cache TTLs suggested by policies, so absurd ones cannot overflow
+const maxCacheTTLHint = 365 * 24 * time.Hour
+
+type permissionQueryRichResult struct {
+	Allow       bool        `json:"allow,omitempty"`
+	Reason      string      `json:"reason,omitempty"`
+	Violations  []string    `json:"violations,omitempty"`
+	Obligations Obligations `json:"obligations,omitempty"`
+	TTLSeconds  *float64    `json:"ttl_seconds,omitempty"`
+}
+
+// UnmarshalJSON parses either a boolean result, or a rich result
+// ({allow, reason, violations, obligations, ttl_seconds}).
+// An undefined result is a deny
+func (r *PermissionQueryResponse) UnmarshalJSON(data []byte) error {
+	rawResponse := struct {
+		Result     json.RawMessage `json:"result,omitempty"`
+		Provenance *Provenance     `json:"provenance,omitempty"`
+		Metrics    map[string]any  `json:"metrics,omitempty"`
+	}{}
+	if err := json.Unmarshal(data, &rawResponse); err != nil {
+		return err
+	}
+
+	*r = PermissionQueryResponse{
+		Provenance: rawResponse.Provenance,
+		Metrics:    rawResponse.Metrics,
+	}
+	if len(rawResponse.Result) == 0 || string(rawResponse.Result) == "null" {
+		return nil
+	}
+
+	if rawResponse.Result[0] != '{' {
+		return json.Unmarshal(rawResponse.Result, &r.Result)
+	}
+
+	richResult := permissionQueryRichResult{}
+	if err := json.Unmarshal(rawResponse.Result, &richResult); err != nil {
+		return err
+	}
+	r.Result = richResult.Allow
+	r.Reason = richResult.Reason
+	r.Violations = richResult.Violations
+	r.Obligations = richResult.Obligations
+	if richResult.TTLSeconds != nil {
+		cacheTTL := time.Duration(min(max(*richResult.TTLSeconds, 0), maxCacheTTLHint.Seconds()) * float64(time.Second))
+		r.CacheTTL = &cacheTTL
+	}
+	return nil
+}
+
+// Decision is the result of a permission query, along with its metadata
+type Decision struct {
+	Resource   string      `json:"resource,omitempty"`
+	Action     Action      `json:"action,omitempty"`
+	Allowed    bool        `json:"allowed"`
+	Reason     string      `json:"reason,omitempty"`
+	Violations []string    `json:"violations,omitempty"`
+	Cached     bool        `json:"cached,omitempty"`
+	Provenance *Provenance `json:"provenance,omitempty"`
+
+	// DecisionID is the id the decision was queried from OPA by (see WithDecisionIDs), to correlate it with OPA's
+	// decision logs
+	DecisionID string `json:"decisionId,omitempty"`
+
+	// Obligations the application must enforce along with the decision (e.g.: fields to mask)
+	Obligations Obligations `json:"obligations,omitempty"`
+
+	// Stale is set when an expired cached decision was served, since OPA could not be queried
+	Stale bool `json:"stale,omitempty"`
+
+	// Fallback is set when the decision was made by the fallback policy, since OPA could not be queried
+	Fallback bool `json:"fallback,omitempty"`
+
+	// Monitored is set when the decision was not enforced (monitor enforcement mode), in which case
+	// Allowed is always true, and the policy decision is recorded in the decision log
+	Monitored bool `json:"monitored,omitempty"`
+
+	// Overridden is set when the query carried an accepted override value, and was allowed without querying OPA
+	Overridden bool `json:"overridden,omitempty"`
+
+	// CacheTTL is the cache TTL suggested by the policy (ttl_seconds of a rich result), which the decision cache
+	// honors instead of the configured TTL. A zero TTL disables caching the decision
+	CacheTTL *time.Duration `json:"cacheTTL,omitempty"`
+
+	// Metrics are OPA's performance metrics of evaluating the decision (e.g.: timer_rego_query_eval_ns),
+	// set when instrumentation is enabled (see WithInstrumentation)
+	Metrics map[string]any `json:"metrics,omitempty"`
 }
 
 type PermissionFilterResponse struct {
-	Result []string `json:"result,omitempty"`
+	Result     []string    `json:"result,omitempty"`
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// Provenance describes the OPA instance and policy revision a decision was produced by
+type Provenance struct {
+	Version     string `json:"version,omitempty"`
+	BuildCommit string `json:"build_commit,omitempty"`
+
+	// Revision is set when OPA is running a single, legacy-style bundle
+	Revision string                      `json:"revision,omitempty"`
+	Bundles  map[string]ProvenanceBundle `json:"bundles,omitempty"`
+}
+
+type ProvenanceBundle struct {
+	Revision string `json:"revision"`
+}
+
+// BundleRevision returns the revision of the given bundle, or the legacy revision if the bundle is not listed
+func (p *Provenance) BundleRevision(name string) string {
+	if bundle, found := p.Bundles[name]; found {
+		return bundle.Revision
+	}
+	return p.Revision
+}
+
+type BundleStatus struct {
+	Name                     string    `json:"name,omitempty"`
+	ActiveRevision           string    `json:"active_revision,omitempty"`
+	LastSuccessfulActivation time.Time `json:"last_successful_activation,omitempty"`
+	Code                     string    `json:"code,omitempty"`
+	Message                  string    `json:"message,omitempty"`
+}
+
+type PluginStatus struct {
+	State   string `json:"state,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type ServerStatus struct {
+	Labels  map[string]string       `json:"labels,omitempty"`
+	Bundles map[string]BundleStatus `json:"bundles,omitempty"`
+	Plugins map[string]PluginStatus `json:"plugins,omitempty"`
+}
+
+// IsBundleActive returns true if the given bundle was activated.
+// If revision is not empty, the active revision must match it as well
+func (s *ServerStatus) IsBundleActive(name string, revision string) bool {
+	bundleStatus, found := s.Bundles[name]
+	if !found || bundleStatus.ActiveRevision == "" && bundleStatus.LastSuccessfulActivation.IsZero() {
+		return false
+	}
+	return revision == "" || bundleStatus.ActiveRevision == revision
+}
+
+type StatusResponse struct {
+	Result ServerStatus `json:"result,omitempty"`
+}
+
+type ConfigResponse struct {
+	Result map[string]json.RawMessage `json:"result,omitempty"`
+}
+
+type ServerInfo struct {
+	Version  string            `json:"version,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Features []string          `json:"features,omitempty"`
+}
+
+// AtLeastVersion returns true if the server version is equal or newer than the given version
+func (i *ServerInfo) AtLeastVersion(version string) bool {
+	if i.Version == "" {
+		return false
+	}
+	return compareVersions(i.Version, version) >= 0
+}
+
+// HasFeature returns true if the given feature (e.g.: bundles, decision_logs, status) is enabled on the server
+func (i *ServerInfo) HasFeature(feature string) bool {
+	return slices.Contains(i.Features, feature)
+}
+
+// RequireVersion returns a descriptive error if the server is older than the version required by the given feature
+func (i *ServerInfo) RequireVersion(feature string, minVersion string) error {
+	if i.AtLeastVersion(minVersion) {
+		return nil
+	}
+	serverVersion := i.Version
+	if serverVersion == "" {
+		serverVersion = "of unknown version"
+	}
+	return errors.Errorf("OPA server %s does not support %s (requires %s or newer)",
+		serverVersion,
+		feature,
+		minVersion)
 }
 
 type Action string
@@ -99,3 +775,20 @@ const (
 	ActionUpdate Action = "update"
 	ActionDelete Action = "delete"
 )
+
+// ActionFromHTTPMethod returns the action conventionally performed by a request of the given HTTP method
+// (e.g.: ActionUpdate for PUT and PATCH), and false for methods mapping to no action
+func ActionFromHTTPMethod(method string) (Action, bool) {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead:
+		return ActionRead, true
+	case http.MethodPost:
+		return ActionCreate, true
+	case http.MethodPut, http.MethodPatch:
+		return ActionUpdate, true
+	case http.MethodDelete:
+		return ActionDelete, true
+	default:
+		return "", false
+	}
+}
@@ -21,6 +21,8 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nuclio/errors"
@@ -33,7 +35,8 @@ func sendHTTPRequest(ctx context.Context,
 	body []byte,
 	headers map[string]string,
 	cookies []*http.Cookie,
-	expectedStatusCode int) ([]byte, *http.Response, error) {
+	expectedStatusCode int,
+	maxResponseSize int64) ([]byte, *http.Response, error) {
 
 	// create request object
 	req, err := http.NewRequestWithContext(ctx, method, requestURL, bytes.NewBuffer(body))
@@ -57,49 +60,152 @@ func sendHTTPRequest(ctx context.Context,
 		return nil, nil, errors.Wrap(err, "Failed to send HTTP request")
 	}
 
-	// read response body
+	// read response body, up to the max size (if set), as a misconfigured server may respond with anything
 	var responseBody []byte
 	if resp != nil && resp.Body != nil {
 		defer resp.Body.Close() // nolint: errcheck
 
-		responseBody, err = io.ReadAll(resp.Body)
+		var bodyReader io.Reader = resp.Body
+		if maxResponseSize > 0 {
+			bodyReader = io.LimitReader(resp.Body, maxResponseSize+1)
+		}
+		responseBody, err = io.ReadAll(bodyReader)
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "Failed to read response body")
 		}
+		if maxResponseSize > 0 && int64(len(responseBody)) > maxResponseSize {
+			return nil, nil, errors.Errorf("Response body exceeds the max size of %d bytes", maxResponseSize)
+		}
 	}
 
 	// validate status code is as expected
 	if expectedStatusCode != 0 && resp != nil && resp.StatusCode != expectedStatusCode {
-		return responseBody, resp, errors.Errorf(
-			"Got unexpected response status code: %d. Expected: %d",
-			resp.StatusCode,
-			expectedStatusCode)
+		return responseBody, resp, &UnexpectedStatusError{
+			StatusCode:         resp.StatusCode,
+			ExpectedStatusCode: expectedStatusCode,
+		}
 	}
 
 	return responseBody, resp, nil
 }
 
-// retryUntilSuccessful retries a callback function until it returns true or timeout is reached.
-// It waits for the specified interval between retries.
+// permanentError is returned by a retried callback to stop retrying, since the error would recur
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// retryUntilSuccessful retries a callback function until it succeeds, fails permanently or timeout is reached.
+// It waits for the specified interval between the starts of retries, as told by the clock, and invokes onRetry
+// (if set) with every failed attempt (numbered from 1) which is about to be retried. Failed attempts are not retried
+// once canRetry (if set) returns false.
 // Returns an error if the timeout duration is exceeded without success.
-func retryUntilSuccessful(duration time.Duration, interval time.Duration, callback func() bool) error {
-	timeout := time.After(duration)
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	// Try immediately first
-	if callback() {
-		return nil
-	}
+func retryUntilSuccessful(ctx context.Context,
+	clock Clock,
+	duration time.Duration,
+	interval time.Duration,
+	callback func() error,
+	onRetry func(attempt int, err error, nextDelay time.Duration),
+	canRetry func() bool) error {
+	deadline := clock.Now().Add(duration)
+	for attempt := 1; ; attempt++ {
+		attemptStartTime := clock.Now()
+		err := callback()
+		if err == nil {
+			return nil
+		}
+		if permanentErr, ok := err.(*permanentError); ok {
+			return permanentErr.err
+		}
+
+		nextAttemptTime := attemptStartTime.Add(interval)
+		if nextAttemptTime.After(deadline) {
+			return errors.Wrap(err, "Retry timeout exceeded")
+		}
+		if canRetry != nil && !canRetry() {
+			return errors.Wrap(err, "Retry budget exhausted")
+		}
+
+		nextDelay := max(nextAttemptTime.Sub(clock.Now()), 0)
+		if onRetry != nil {
+			onRetry(attempt, err, nextDelay)
+		}
 
-	for {
 		select {
-		case <-timeout:
-			return errors.New("Retry timeout exceeded")
-		case <-ticker.C:
-			if callback() {
-				return nil
+		case <-ctx.Done():
+
+			// the attempt failed by the context as well, and may tell more (e.g.: the phase it timed out in)
+			if errors.Is(err, ctx.Err()) {
+				return errors.Wrap(err, "Retry canceled")
 			}
+			return errors.Wrap(ctx.Err(), "Retry canceled")
+		case <-clock.After(nextDelay):
+		}
+	}
+}
+
+// compareVersions compares two semantic versions (e.g.: 0.38.1, v1.2.0-dev), ignoring pre-release and build suffixes.
+// Returns -1 if a < b, 0 if a == b and 1 if a > b
+func compareVersions(a string, b string) int {
+	parseVersion := func(version string) []int {
+		version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+		if idx := strings.IndexAny(version, "-+"); idx != -1 {
+			version = version[:idx]
 		}
+		parts := make([]int, 3)
+		for partIdx, part := range strings.SplitN(version, ".", 3) {
+			parts[partIdx], _ = strconv.Atoi(part)
+		}
+		return parts
 	}
+
+	aParts, bParts := parseVersion(a), parseVersion(b)
+	for partIdx := range aParts {
+		switch {
+		case aParts[partIdx] < bParts[partIdx]:
+			return -1
+		case aParts[partIdx] > bParts[partIdx]:
+			return 1
+		}
+	}
+	return 0
+}
+
+// resourceAncestors returns the ancestors of a slash-separated resource, nearest first
+// (e.g.: projects/p1/functions/f1 -> projects/p1/functions, projects/p1, projects)
+func resourceAncestors(resource string) []string {
+	var ancestors []string
+	resource = strings.TrimSuffix(resource, "/")
+	for idx := strings.LastIndex(resource, "/"); idx > 0; idx = strings.LastIndex(resource, "/") {
+		resource = resource[:idx]
+		ancestors = append(ancestors, resource)
+	}
+	return ancestors
+}
+
+// resultsByResource maps each resource to its positional result
+func resultsByResource(resources []string, results []bool) map[string]bool {
+	resultsMap := make(map[string]bool, len(resources))
+	for resourceIdx, resource := range resources {
+		resultsMap[resource] = results[resourceIdx]
+	}
+	return resultsMap
+}
+
+// attemptContext returns the context of an attempt out of the given attempts left, retried at the given interval.
+// If the context has a deadline, its remaining budget is divided across the attempts that may still start before it
+func attemptContext(ctx context.Context,
+	attemptsLeft int,
+	interval time.Duration) (context.Context, context.CancelFunc) {
+	deadline, hasDeadline := ctx.Deadline()
+	if !hasDeadline {
+		return context.WithCancel(ctx)
+	}
+
+	remainingBudget := time.Until(deadline)
+	attemptsLeft = max(min(attemptsLeft, int(remainingBudget/interval)+1), 1)
+	return context.WithTimeout(ctx, remainingBudget/time.Duration(attemptsLeft))
 }
@@ -0,0 +1,125 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/nuclio/errors"
+)
+
+// InputValidator validates the input of a query to the given path before it is sent (e.g.: against a JSON schema),
+// failing the query by its error. The input is the typed input of the query (e.g.: PermissionQueryRequestInput)
+type InputValidator func(ctx context.Context, path string, input any) error
+
+// ErrInvalidInput is matched (using errors.Is) by the error returned when the input of a query fails validation
+var ErrInvalidInput = errors.New("Invalid input")
+
+// InputValidationError is returned (wrapped) when the input of a query fails validation (see WithInputValidators),
+// in which case the query is not sent, nor decided by stale decisions or the fallback policy
+type InputValidationError struct {
+	Path string
+	Err  error
+}
+
+func (e *InputValidationError) Error() string {
+	return fmt.Sprintf("Invalid input of query to %s: %s", e.Path, errors.RootCause(e.Err).Error())
+}
+
+func (e *InputValidationError) Is(target error) bool {
+	return target == ErrInvalidInput
+}
+
+func (e *InputValidationError) Unwrap() error {
+	return e.Err
+}
+
+// StandardInputValidator validates the inputs of the client queries, catching those OPA would silently deny:
+// empty actions, inputs with neither member ids nor a subject, and empty or whitespace-padded member ids
+func StandardInputValidator(ctx context.Context, path string, input any) error {
+	switch typedInput := input.(type) {
+	case PermissionQueryRequestInput:
+		return validateInput([]string{typedInput.Action}, typedInput.Ids, typedInput.Subject)
+	case PermissionFilterRequestInput:
+		return validateInput([]string{typedInput.Action}, typedInput.Ids, typedInput.Subject)
+	case PermissionPageRequestInput:
+		return validateInput([]string{typedInput.Action}, typedInput.Ids, typedInput.Subject)
+	case PermissionAllowedActionsRequestInput:
+		return validateInput(nil, typedInput.Ids, typedInput.Subject)
+	case PermissionResourceActionsRequestInput:
+		actions := make([]string, len(typedInput.ResourceActions))
+		for resourceActionIdx, resourceAction := range typedInput.ResourceActions {
+			actions[resourceActionIdx] = string(resourceAction.Action)
+		}
+		return validateInput(actions, typedInput.Ids, typedInput.Subject)
+	case PermissionMultiSubjectsRequestInput:
+		for subjectIdx, subject := range typedInput.Subjects {
+			if err := validateInput([]string{typedInput.Action}, subject, nil); err != nil {
+				return errors.Wrapf(err, "Subject at index %d is invalid", subjectIdx)
+			}
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+// validateInput fails on empty actions, on missing member ids (unless given a subject) and on malformed member ids
+func validateInput(actions []string, memberIds []string, subject *Subject) error {
+	for _, action := range actions {
+		if action == "" {
+			return errors.New("Action is empty")
+		}
+	}
+	if len(memberIds) == 0 && subject == nil {
+		return errors.New("Input has neither member ids nor a subject")
+	}
+	for memberIdIdx, memberId := range memberIds {
+		if memberId == "" {
+			return errors.Errorf("Member id at index %d is empty", memberIdIdx)
+		}
+		if strings.TrimSpace(memberId) != memberId {
+			return errors.Errorf("Member id at index %d (%q) is padded with whitespace", memberIdIdx, memberId)
+		}
+	}
+	return nil
+}
+
+// validateInput runs the input validators against the input of the query request
+func (c *HTTPClient) validateInput(ctx context.Context, path string, request any) error {
+	requestValue := reflect.Indirect(reflect.ValueOf(request))
+	if requestValue.Kind() != reflect.Struct {
+		return nil
+	}
+	inputValue := requestValue.FieldByName("Input")
+	if !inputValue.IsValid() {
+		return nil
+	}
+
+	for _, inputValidator := range c.inputValidators {
+		if err := inputValidator(ctx, path, inputValue.Interface()); err != nil {
+			return &InputValidationError{
+				Path: path,
+				Err:  err,
+			}
+		}
+	}
+	return nil
+}
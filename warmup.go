@@ -0,0 +1,63 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// warmUp pre-establishes the warm-up connections to every endpoint, by concurrent health queries (which establish
+// a connection each, resolving the host and completing the TLS handshake), so the first queries find them idle.
+// Failures are logged, as queries will connect on their own
+func (c *HTTPClient) warmUp(ctx context.Context) {
+	endpoints := []string{c.address}
+	if c.endpointProvider != nil {
+		if providedEndpoints := c.endpointProvider.Endpoints(); len(providedEndpoints) > 0 {
+			endpoints = providedEndpoints
+		}
+	}
+
+	warmUpStartTime := time.Now()
+	var failures atomic.Int64
+	var waitGroup sync.WaitGroup
+	for _, endpoint := range endpoints {
+		for range c.warmupConnections {
+			waitGroup.Add(1)
+			go func() {
+				defer waitGroup.Done()
+
+				if err := c.probeEndpoint(ctx, endpoint); err != nil {
+					if failures.Add(1) == 1 {
+						c.logger.WarnWithCtx(ctx, "Failed to warm up connection to OPA",
+							"endpoint", endpoint,
+							"err", err.Error())
+					}
+				}
+			}()
+		}
+	}
+	waitGroup.Wait()
+
+	c.logger.DebugWithCtx(ctx, "Warmed up connections to OPA",
+		"endpoints", endpoints,
+		"connections", len(endpoints)*c.warmupConnections,
+		"failures", failures.Load(),
+		"duration", time.Since(warmUpStartTime).String())
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2025 The Nuclio Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package opaclient
+
+import (
+	"time"
+)
+
+// rollingWindowBuckets is the number of buckets a rolling window rolls by
+const rollingWindowBuckets = 12
+
+// rollingCounts sums a pair of counts (e.g.: requests and accepted requests) over a rolling window, by buckets of
+// a fraction of it. It is not safe for concurrent use
+type rollingCounts struct {
+	bucketDuration time.Duration
+	buckets        [rollingWindowBuckets]rollingCountsBucket
+}
+
+type rollingCountsBucket struct {
+	start  time.Time
+	first  int64
+	second int64
+}
+
+func newRollingCounts(window time.Duration) *rollingCounts {
+	return &rollingCounts{
+		bucketDuration: max(window/rollingWindowBuckets, time.Millisecond),
+	}
+}
+
+// empty returns new, empty counts over the same window
+func (r *rollingCounts) empty() *rollingCounts {
+	return &rollingCounts{bucketDuration: r.bucketDuration}
+}
+
+// add adds to the counts at the given time
+func (r *rollingCounts) add(now time.Time, first int64, second int64) {
+	bucketStart := now.Truncate(r.bucketDuration)
+	bucket := &r.buckets[(bucketStart.UnixNano()/int64(r.bucketDuration))%rollingWindowBuckets]
+	if !bucket.start.Equal(bucketStart) {
+
+		// the bucket last counted a past window
+		*bucket = rollingCountsBucket{start: bucketStart}
+	}
+	bucket.first += first
+	bucket.second += second
+}
+
+// sum returns the counts within the window ending at the given time
+func (r *rollingCounts) sum(now time.Time) (int64, int64) {
+	var first, second int64
+	for _, bucket := range r.buckets {
+		if now.Sub(bucket.start) < r.bucketDuration*rollingWindowBuckets {
+			first += bucket.first
+			second += bucket.second
+		}
+	}
+	return first, second
+}